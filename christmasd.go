@@ -2,14 +2,18 @@ package christmasd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"image"
 	"log/slog"
+	"net"
 	"net/http"
+	"time"
 
 	"dev.acmcsuf.com/christmas/lib/xcolor"
 	"dev.acmcsuf.com/christmasd/christmaspb"
 	"github.com/gobwas/ws"
+	"github.com/gofrs/uuid/v5"
 	"golang.org/x/sync/errgroup"
 	"gopkg.in/typ.v4/sync2"
 )
@@ -25,6 +29,11 @@ type ServerOpts struct {
 	Logger *slog.Logger
 	// HTTPUpgrader is the HTTP-to-Websocket upgrader to use for the server.
 	HTTPUpgrader ws.HTTPUpgrader
+	// Hooks are called to report what the server is doing.
+	Hooks ServerHooks
+	// FrameStats, if not nil, returns the frame statistics that clients get
+	// when they ask for them.
+	FrameStats func() FrameStats
 }
 
 // Server handles all HTTP requests for the server.
@@ -47,63 +56,277 @@ func NewServer(opts ServerOpts) *Server {
 // KickAllConnections kicks all connections from the server.
 // Optionally, a reason can be provided.
 func (s *Server) KickAllConnections(reason string) {
-	var err error
+	s.KickSessions(reason, func(*Session) bool { return true })
+}
+
+// kickTimeout is how long a kicked session gets to deliver its notice and
+// close the connection cleanly before it is cut off.
+const kickTimeout = 5 * time.Second
+
+// KickSessions kicks the sessions for which match returns true and returns
+// how many were kicked. Optionally, a reason can be provided. The clients are
+// sent the reason in a NoticeKicked notice and in the close frame.
+func (s *Server) KickSessions(reason string, match func(*Session) bool) int {
+	err := kickError(reason)
+
+	var kicked int
+	s.connections.Range(func(s *Session, ctrl sessionControl) bool {
+		if match(s) {
+			s.kick(reason)
+			time.AfterFunc(kickTimeout, func() { ctrl.cancel(err) })
+			kicked++
+		}
+		return true
+	})
+	return kicked
+}
+
+func kickError(reason string) error {
 	if reason != "" {
-		err = fmt.Errorf("kicked: %s", reason)
-	} else {
-		err = fmt.Errorf("kicked")
+		return fmt.Errorf("kicked: %s", reason)
 	}
+	return fmt.Errorf("kicked")
+}
+
+// Notify sends a notice to the sessions for which match returns true and
+// returns how many it was sent to. Use KickSessions to kick sessions instead
+// of sending NoticeKicked.
+func (s *Server) Notify(notice Notice, match func(*Session) bool) int {
+	var sent int
+	s.connections.Range(func(s *Session, ctrl sessionControl) bool {
+		if match(s) && s.Notify(notice) {
+			sent++
+		}
+		return true
+	})
+	return sent
+}
+
+// Sessions returns the sessions that are connected to the server, in no
+// particular order.
+func (s *Server) Sessions() []*Session {
+	var sessions []*Session
+	s.connections.Range(func(s *Session, ctrl sessionControl) bool {
+		sessions = append(sessions, s)
+		return true
+	})
+	return sessions
+}
 
+// NotifyCanvasChanged notifies all connected sessions that the LED canvas
+// changed. It should be called after the LEDController's image size or number
+// of LEDs changed.
+func (s *Server) NotifyCanvasChanged() {
 	s.connections.Range(func(s *Session, ctrl sessionControl) bool {
-		ctrl.cancel(err)
+		s.NotifyCanvasChanged()
 		return true
 	})
 }
 
 // ServeHTTP implements http.Handler.
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	session, err := SessionUpgrade(w, r, s.opts)
+	s.ServeSession(w, r, SessionOpts{})
+}
+
+// ServeSession is like ServeHTTP, but with options for the session.
+func (s *Server) ServeSession(w http.ResponseWriter, r *http.Request, sopts SessionOpts) {
+	session, err := sessionUpgrade(w, r, s.opts, sopts)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	ctx, cancel := context.WithCancelCause(r.Context())
+	defer cancel(nil)
+
 	s.connections.Store(session, sessionControl{cancel: cancel})
+	defer s.connections.Delete(session)
 
-	if err := session.Start(ctx); err != nil {
-		s.connections.Delete(session)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	// The connection is hijacked by now, so there's no way to report the
+	// error over HTTP.
+	if err := session.Start(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		session.logger.Warn(
+			"session ended with an error",
+			"error", err)
 	}
 }
 
+// SessionOpts are options for a single session.
+type SessionOpts struct {
+	// Label names the session's client in logs, e.g. the label of the token
+	// that it connected with.
+	Label string
+	// TokenID is the ID of the token that the client connected with, so that
+	// its sessions can be found when the token is revoked.
+	TokenID string
+	// ViewOnly lets the client look at the LEDs but not change them. Frames
+	// from the client are rejected and end the session.
+	ViewOnly bool
+}
+
 // Session is a websocket session. It implements handling of messages from a
 // single client.
 type Session struct {
 	ws     *websocketServer
 	logger *slog.Logger
 	opts   ServerOpts
+	sopts  SessionOpts
+	ctrl   LEDController
+	id     string
+	addr   string
+	start  time.Time
+
+	canvasChanged chan struct{}
+	notices       chan Notice
+	kicks         chan string
+	// kicked is the reason that the session ended for if it was kicked. It is
+	// only set by the main loop.
+	kicked error
 }
 
+// maxPendingNotices is how many notices can wait to be sent to a session
+// before new ones are dropped.
+const maxPendingNotices = 8
+
 // SessionUpgrade upgrades an HTTP request to a websocket session.
 func SessionUpgrade(w http.ResponseWriter, r *http.Request, opts ServerOpts) (*Session, error) {
+	return sessionUpgrade(w, r, opts, SessionOpts{})
+}
+
+func sessionUpgrade(w http.ResponseWriter, r *http.Request, opts ServerOpts, sopts SessionOpts) (*Session, error) {
 	wsconn, _, _, err := opts.HTTPUpgrader.Upgrade(r, w)
 	if err != nil {
 		return nil, fmt.Errorf("failed to upgrade HTTP: %w", err)
 	}
 
-	logger := opts.Logger.With("addr", wsconn.RemoteAddr())
+	session, err := NewSessionWithOpts(wsconn, opts, sopts)
+	if err != nil {
+		wsconn.Close()
+		return nil, err
+	}
 
-	return &Session{
-		ws:     newWebsocketServer(wsconn, logger),
+	return session, nil
+}
+
+// NewSession creates a new session over an already established websocket
+// connection. Most callers should use SessionUpgrade instead.
+func NewSession(wsconn net.Conn, opts ServerOpts) (*Session, error) {
+	return NewSessionWithOpts(wsconn, opts, SessionOpts{})
+}
+
+// NewSessionWithOpts is like NewSession, but with options for the session.
+func NewSessionWithOpts(wsconn net.Conn, opts ServerOpts, sopts SessionOpts) (*Session, error) {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate session ID: %w", err)
+	}
+
+	logger := opts.Logger.With(
+		"addr", wsconn.RemoteAddr(),
+		"session", id.String())
+	if sopts.Label != "" {
+		logger = logger.With("label", sopts.Label)
+	}
+
+	session := &Session{
 		logger: logger,
 		opts:   opts,
-	}, nil
+		sopts:  sopts,
+		id:     id.String(),
+		addr:   wsconn.RemoteAddr().String(),
+		start:  time.Now(),
+
+		canvasChanged: make(chan struct{}, 1),
+		notices:       make(chan Notice, maxPendingNotices),
+		kicks:         make(chan string, 1),
+	}
+	session.ws = newWebsocketServer(wsconn, logger, session, &session.opts.Hooks)
+	session.ctrl = ControllerForSession(opts.LEDController, session)
+
+	return session, nil
+}
+
+// ID returns the unique ID of the session.
+func (s *Session) ID() string {
+	return s.id
+}
+
+// RemoteAddr returns the address of the client.
+func (s *Session) RemoteAddr() string {
+	return s.addr
+}
+
+// Started returns when the session was created.
+func (s *Session) Started() time.Time {
+	return s.start
+}
+
+// Label returns the label of the session's client, if any.
+func (s *Session) Label() string {
+	return s.sopts.Label
+}
+
+// TokenID returns the ID of the token that the client connected with, if any.
+func (s *Session) TokenID() string {
+	return s.sopts.TokenID
+}
+
+// ViewOnly returns whether the client may only look at the LEDs.
+func (s *Session) ViewOnly() bool {
+	return s.sopts.ViewOnly
+}
+
+// NotifyCanvasChanged tells the client that the LED canvas changed. The client
+// is sent the new canvas info, and any frame that it sends with the old size
+// afterwards is ignored instead of being treated as an error.
+func (s *Session) NotifyCanvasChanged() {
+	select {
+	case s.canvasChanged <- struct{}{}:
+	default:
+	}
+}
+
+// Notify sends a notice to the client. It returns false if the notice was
+// dropped because too many are already waiting to be sent.
+func (s *Session) Notify(notice Notice) bool {
+	select {
+	case s.notices <- notice:
+		return true
+	default:
+		s.logger.Warn(
+			"dropping notice for slow client",
+			"kind", notice.Kind,
+			"message", notice.Message)
+		return false
+	}
+}
+
+// kick makes the session send the client a NoticeKicked notice with the
+// reason, then close the connection.
+func (s *Session) kick(reason string) {
+	select {
+	case s.kicks <- reason:
+	default:
+		// Already being kicked.
+	}
 }
 
 // Start starts the server.
-func (s *Session) Start(ctx context.Context) error {
+func (s *Session) Start(ctx context.Context) (err error) {
+	s.opts.Hooks.sessionStarted(s)
+	defer func(parent context.Context) {
+		// Report why the session was canceled, e.g. because it was kicked,
+		// instead of just that it was.
+		reason := err
+		switch {
+		case s.kicked != nil:
+			reason = s.kicked
+		case errors.Is(reason, context.Canceled):
+			reason = context.Cause(parent)
+		}
+		s.opts.Hooks.sessionEnded(s, reason)
+	}(ctx)
+
 	errg, ctx := errgroup.WithContext(ctx)
 
 	ctx, cancel := context.WithCancel(ctx)
@@ -117,6 +340,11 @@ func (s *Session) Start(ctx context.Context) error {
 		// Treat main loop errors as fatal and kill the connection,
 		// but don't return it because it's not the caller's fault.
 		if err := s.mainLoop(ctx); err != nil {
+			cause := ErrorProtocol
+			if errors.Is(err, errInternalServer) {
+				cause = ErrorController
+			}
+			s.opts.Hooks.error(s, cause, err)
 			return s.ws.SendError(ctx, err)
 		}
 		return nil
@@ -125,23 +353,86 @@ func (s *Session) Start(ctx context.Context) error {
 	return errg.Wait()
 }
 
-var errInternalServer = fmt.Errorf("internal server error")
+var (
+	errInternalServer = fmt.Errorf("internal server error")
+	errViewOnly       = fmt.Errorf("session is view-only, frames are not allowed")
+)
 
 func (s *Session) mainLoop(ctx context.Context) error {
-	bufPbLED := make([]uint32, len(s.opts.LEDController.LEDs()))
-	bufCtLED := make([]xcolor.RGB, len(s.opts.LEDController.LEDs()))
+	bufPbLED := make([]uint32, len(s.ctrl.LEDs()))
+	bufCtLED := make([]xcolor.RGB, len(s.ctrl.LEDs()))
+	width, height := s.ctrl.ImageSize()
+
+	// stale is the canvas from before the last change. Frames of that size
+	// might still be in flight, so they're dropped instead of killing the
+	// session.
+	stale := struct{ leds, w, h int }{-1, -1, -1}
 
 	for {
 		select {
 		case <-ctx.Done():
 			return nil
 
+		case <-s.canvasChanged:
+			stale.leds = len(bufCtLED)
+			stale.w, stale.h = width, height
+
+			bufCtLED = make([]xcolor.RGB, len(s.ctrl.LEDs()))
+			width, height = s.ctrl.ImageSize()
+
+			s.logger.Debug(
+				"notifying client of canvas change",
+				"leds", len(bufCtLED),
+				"width", width,
+				"height", height)
+
+			s.ws.Send(ctx, &christmaspb.LEDServerMessage{
+				Message: &christmaspb.LEDServerMessage_CanvasChanged{
+					CanvasChanged: &christmaspb.CanvasChangedEvent{
+						Width:   uint32(width),
+						Height:  uint32(height),
+						NumLeds: uint32(len(bufCtLED)),
+					},
+				},
+			})
+
+		case notice := <-s.notices:
+			s.ws.Send(ctx, &christmaspb.LEDServerMessage{
+				Message: &christmaspb.LEDServerMessage_Notice{
+					Notice: notice.proto(),
+				},
+			})
+
+		case reason := <-s.kicks:
+			s.kicked = kickError(reason)
+
+			s.logger.Debug(
+				"kicking client",
+				"reason", reason)
+
+			// The close frame has the reason too, for clients that don't
+			// know about notices, e.g. a browser that only logs the close
+			// event.
+			s.ws.SendAndClose(ctx,
+				&christmaspb.LEDServerMessage{
+					Message: &christmaspb.LEDServerMessage_Notice{
+						Notice: Notice{Kind: NoticeKicked, Message: reason}.proto(),
+					},
+				},
+				closeFrame{
+					Code:   ws.StatusPolicyViolation,
+					Reason: truncateCloseReason(s.kicked.Error()),
+				})
+			return nil
+
 		case msg := <-s.ws.Messages:
 			switch msg := msg.GetMessage().(type) {
 			case *christmaspb.LEDClientMessage_GetLeds:
-				ctLEDs := s.opts.LEDController.LEDs()
-				for i, led := range ctLEDs {
-					bufPbLED[i] = led.ToUint()
+				// The controller may have changed before we were notified, so
+				// don't assume that the buffer has the right size.
+				bufPbLED = bufPbLED[:0]
+				for _, led := range s.ctrl.LEDs() {
+					bufPbLED = append(bufPbLED, led.ToUint())
 				}
 				s.ws.Send(ctx, &christmaspb.LEDServerMessage{
 					Message: &christmaspb.LEDServerMessage_GetLeds{
@@ -152,14 +443,23 @@ func (s *Session) mainLoop(ctx context.Context) error {
 				})
 
 			case *christmaspb.LEDClientMessage_SetLeds:
+				if s.sopts.ViewOnly {
+					s.opts.Hooks.frameRejected(s, FrameViewOnly)
+					return errViewOnly
+				}
 				pbLEDs := msg.SetLeds.GetLeds()
 				if len(pbLEDs) != len(bufCtLED) {
+					if len(pbLEDs) == stale.leds {
+						s.opts.Hooks.frameRejected(s, FrameStaleSize)
+						continue
+					}
+					s.opts.Hooks.frameRejected(s, FrameInvalidSize)
 					return fmt.Errorf("invalid number of LEDs: %d", len(pbLEDs))
 				}
 				for i, led := range pbLEDs {
 					bufCtLED[i] = xcolor.RGBFromUint(led)
 				}
-				if err := s.opts.LEDController.SetLEDs(bufCtLED); err != nil {
+				if err := s.ctrl.SetLEDs(bufCtLED); err != nil {
 					s.logger.Error(
 						"failed to set LEDs",
 						"err", err)
@@ -167,27 +467,45 @@ func (s *Session) mainLoop(ctx context.Context) error {
 				}
 
 			case *christmaspb.LEDClientMessage_GetLedCanvasInfo:
-				w, h := s.opts.LEDController.ImageSize()
 				s.ws.Send(ctx, &christmaspb.LEDServerMessage{
 					Message: &christmaspb.LEDServerMessage_GetLedCanvasInfo{
 						GetLedCanvasInfo: &christmaspb.GetLEDCanvasInfoResponse{
-							Width:  uint32(w),
-							Height: uint32(h),
+							Width:  uint32(width),
+							Height: uint32(height),
 						},
 					},
 				})
 
+			case *christmaspb.LEDClientMessage_GetFrameStats:
+				stats := &christmaspb.GetFrameStatsResponse{}
+				if s.opts.FrameStats != nil {
+					stats = s.opts.FrameStats().proto()
+				}
+				s.ws.Send(ctx, &christmaspb.LEDServerMessage{
+					Message: &christmaspb.LEDServerMessage_GetFrameStats{
+						GetFrameStats: stats,
+					},
+				})
+
 			case *christmaspb.LEDClientMessage_SetLedCanvas:
-				w, h := s.opts.LEDController.ImageSize()
+				if s.sopts.ViewOnly {
+					s.opts.Hooks.frameRejected(s, FrameViewOnly)
+					return errViewOnly
+				}
 				img := image.RGBA{
-					Rect:   image.Rect(0, 0, w, h),
-					Stride: w * 4,
+					Rect:   image.Rect(0, 0, width, height),
+					Stride: width * 4,
 					Pix:    msg.SetLedCanvas.GetPixels().GetPixels(),
 				}
-				if len(img.Pix) != w*h*4 {
+				if len(img.Pix) != width*height*4 {
+					if len(img.Pix) == stale.w*stale.h*4 {
+						s.opts.Hooks.frameRejected(s, FrameStaleSize)
+						continue
+					}
+					s.opts.Hooks.frameRejected(s, FrameInvalidSize)
 					return fmt.Errorf("invalid image size")
 				}
-				if err := s.opts.LEDController.DrawImage(&img); err != nil {
+				if err := s.ctrl.DrawImage(&img); err != nil {
 					s.logger.Error(
 						"failed to draw image",
 						"err", err)
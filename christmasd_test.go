@@ -1,76 +1,193 @@
-package christmasd
+package christmasd_test
 
 import (
 	"context"
 	"errors"
-	"io"
-	"net"
+	"image"
+	"strings"
 	"testing"
+	"time"
 
-	"github.com/gobwas/ws/wsutil"
+	"dev.acmcsuf.com/christmas/lib/leddraw"
+	"dev.acmcsuf.com/christmas/lib/xcolor"
+	"dev.acmcsuf.com/christmasd"
+	"dev.acmcsuf.com/christmasd/christmasdtest"
+	"dev.acmcsuf.com/christmasd/christmaspb"
 	"github.com/google/go-cmp/cmp"
 	"github.com/neilotoole/slogt"
 	"google.golang.org/protobuf/proto"
-	"google.golang.org/protobuf/testing/protocmp"
-	"dev.acmcsuf.com/christmasd/christmaspb"
 )
 
 func TestSession(t *testing.T) {
 	tests := []struct {
-		name   string
-		config Config
-		play   func(t *testing.T, conn io.ReadWriteCloser)
+		name string
+		play func(t *testing.T, conn *christmasdtest.Conn, ctrl *christmasdtest.LEDController)
 	}{
 		{
-			name: "invalid secret",
-			play: func(t *testing.T, conn io.ReadWriteCloser) {
-				writeClientMessage(t, conn, &christmaspb.LEDClientMessage{
-					Message: &christmaspb.LEDClientMessage_Authenticate{
-						Authenticate: &christmaspb.AuthenticateRequest{
-							Secret: "bruh moment",
-						},
+			name: "get canvas info",
+			play: func(t *testing.T, conn *christmasdtest.Conn, ctrl *christmasdtest.LEDController) {
+				conn.Send(&christmaspb.LEDClientMessage{
+					Message: &christmaspb.LEDClientMessage_GetLedCanvasInfo{
+						GetLedCanvasInfo: &christmaspb.GetLEDCanvasInfoRequest{},
 					},
 				})
 
-				assertMessage(t, conn, &christmaspb.LEDServerMessage{
-					Message: &christmaspb.LEDServerMessage_Authenticate{
-						Authenticate: &christmaspb.AuthenticateResponse{
-							Success: false,
+				conn.ExpectMessage(&christmaspb.LEDServerMessage{
+					Message: &christmaspb.LEDServerMessage_GetLedCanvasInfo{
+						GetLedCanvasInfo: &christmaspb.GetLEDCanvasInfoResponse{
+							Width:  4,
+							Height: 2,
+						},
+					},
+				})
+			},
+		},
+		{
+			name: "set and get leds",
+			play: func(t *testing.T, conn *christmasdtest.Conn, ctrl *christmasdtest.LEDController) {
+				conn.Send(&christmaspb.LEDClientMessage{
+					Message: &christmaspb.LEDClientMessage_SetLeds{
+						SetLeds: &christmaspb.SetLEDsRequest{
+							Leds: []uint32{0xFF0000, 0x00FF00, 0x0000FF},
 						},
 					},
 				})
 
-				assertMessage(t, conn, &christmaspb.LEDServerMessage{
-					Error: proto.String("invalid secret"),
+				calls := waitCalls(t, ctrl, 1)
+				assertEq(t, []christmasdtest.Call{
+					{
+						Method: christmasdtest.MethodSetLEDs,
+						LEDs:   leddraw.LEDStrip{{R: 0xFF}, {G: 0xFF}, {B: 0xFF}},
+					},
+				}, calls)
+
+				conn.Send(&christmaspb.LEDClientMessage{
+					Message: &christmaspb.LEDClientMessage_GetLeds{
+						GetLeds: &christmaspb.GetLEDsRequest{},
+					},
 				})
 
-				expectCloseFrame(t, conn)
+				conn.ExpectMessage(&christmaspb.LEDServerMessage{
+					Message: &christmaspb.LEDServerMessage_GetLeds{
+						GetLeds: &christmaspb.GetLEDsResponse{
+							Leds: []uint32{0xFF0000, 0x00FF00, 0x0000FF},
+						},
+					},
+				})
 			},
-			config: Config{
-				Secret: "test",
+		},
+		{
+			name: "set invalid number of leds",
+			play: func(t *testing.T, conn *christmasdtest.Conn, ctrl *christmasdtest.LEDController) {
+				conn.Send(&christmaspb.LEDClientMessage{
+					Message: &christmaspb.LEDClientMessage_SetLeds{
+						SetLeds: &christmaspb.SetLEDsRequest{
+							Leds: []uint32{0xFF0000},
+						},
+					},
+				})
+
+				conn.ExpectMessage(&christmaspb.LEDServerMessage{
+					Error: proto.String("invalid number of LEDs: 1"),
+				})
+
+				conn.ExpectClose()
 			},
 		},
 		{
-			name: "valid secret",
-			play: func(t *testing.T, conn io.ReadWriteCloser) {
-				writeClientMessage(t, conn, &christmaspb.LEDClientMessage{
-					Message: &christmaspb.LEDClientMessage_Authenticate{
-						Authenticate: &christmaspb.AuthenticateRequest{
-							Secret: "bruh moment",
+			name: "set led canvas",
+			play: func(t *testing.T, conn *christmasdtest.Conn, ctrl *christmasdtest.LEDController) {
+				pixels := make([]byte, 4*2*4)
+				for i := range pixels {
+					pixels[i] = byte(i)
+				}
+
+				conn.Send(&christmaspb.LEDClientMessage{
+					Message: &christmaspb.LEDClientMessage_SetLedCanvas{
+						SetLedCanvas: &christmaspb.SetLEDCanvasRequest{
+							Pixels: &christmaspb.RGBAPixels{Pixels: pixels},
 						},
 					},
 				})
 
-				assertMessage(t, conn, &christmaspb.LEDServerMessage{
-					Message: &christmaspb.LEDServerMessage_Authenticate{
-						Authenticate: &christmaspb.AuthenticateResponse{
-							Success: true,
+				calls := waitCalls(t, ctrl, 1)
+				assertEq(t, []christmasdtest.Call{
+					{
+						Method: christmasdtest.MethodDrawImage,
+						Image: &image.RGBA{
+							Pix:    pixels,
+							Stride: 4 * 4,
+							Rect:   image.Rect(0, 0, 4, 2),
+						},
+					},
+				}, calls)
+			},
+		},
+		{
+			name: "set invalid led canvas",
+			play: func(t *testing.T, conn *christmasdtest.Conn, ctrl *christmasdtest.LEDController) {
+				conn.Send(&christmaspb.LEDClientMessage{
+					Message: &christmaspb.LEDClientMessage_SetLedCanvas{
+						SetLedCanvas: &christmaspb.SetLEDCanvasRequest{
+							Pixels: &christmaspb.RGBAPixels{Pixels: make([]byte, 3)},
 						},
 					},
 				})
+
+				conn.ExpectMessage(&christmaspb.LEDServerMessage{
+					Error: proto.String("invalid image size"),
+				})
+
+				conn.ExpectClose()
 			},
-			config: Config{
-				Secret: "bruh moment",
+		},
+		{
+			name: "canvas changed",
+			play: func(t *testing.T, conn *christmasdtest.Conn, ctrl *christmasdtest.LEDController) {
+				// Make sure that the session knows the old canvas first.
+				conn.Send(&christmaspb.LEDClientMessage{
+					Message: &christmaspb.LEDClientMessage_GetLedCanvasInfo{
+						GetLedCanvasInfo: &christmaspb.GetLEDCanvasInfoRequest{},
+					},
+				})
+				conn.Receive()
+
+				ctrl.Resize(2, 2, 1)
+				conn.Session.NotifyCanvasChanged()
+
+				conn.ExpectMessage(&christmaspb.LEDServerMessage{
+					Message: &christmaspb.LEDServerMessage_CanvasChanged{
+						CanvasChanged: &christmaspb.CanvasChangedEvent{
+							Width:   2,
+							Height:  1,
+							NumLeds: 2,
+						},
+					},
+				})
+
+				// Frames of the old size are dropped without an error.
+				conn.Send(&christmaspb.LEDClientMessage{
+					Message: &christmaspb.LEDClientMessage_SetLeds{
+						SetLeds: &christmaspb.SetLEDsRequest{
+							Leds: []uint32{0xFF0000, 0x00FF00, 0x0000FF},
+						},
+					},
+				})
+				conn.Send(&christmaspb.LEDClientMessage{
+					Message: &christmaspb.LEDClientMessage_SetLeds{
+						SetLeds: &christmaspb.SetLEDsRequest{
+							Leds: []uint32{0xFF0000, 0x00FF00},
+						},
+					},
+				})
+
+				calls := waitCalls(t, ctrl, 1)
+				assertEq(t, []christmasdtest.Call{
+					{
+						Method: christmasdtest.MethodSetLEDs,
+						LEDs:   leddraw.LEDStrip{{R: 0xFF}, {G: 0xFF}},
+					},
+				}, calls)
 			},
 		},
 	}
@@ -80,104 +197,285 @@ func TestSession(t *testing.T) {
 			ctx, cancel := context.WithCancel(context.Background())
 			defer cancel()
 
-			conn := startTestSession(t, ctx, test.config)
-			test.play(t, conn)
+			ctrl := christmasdtest.NewLEDController(3, 4, 2)
+			conn := christmasdtest.StartSession(t, ctx, christmasd.ServerOpts{
+				LEDController: ctrl,
+			})
+			test.play(t, conn, ctrl)
 		})
 	}
 }
 
-func writeClientMessage(t *testing.T, conn io.ReadWriteCloser, msg *christmaspb.LEDClientMessage) {
-	t.Helper()
+func TestSessionViewOnly(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ctrl := christmasdtest.NewLEDController(3, 4, 2)
+	conn := christmasdtest.StartSessionWithOpts(t, ctx, christmasd.ServerOpts{
+		LEDController: ctrl,
+	}, christmasd.SessionOpts{
+		Label:    "viewer",
+		ViewOnly: true,
+	})
+
+	conn.Send(&christmaspb.LEDClientMessage{
+		Message: &christmaspb.LEDClientMessage_GetLeds{
+			GetLeds: &christmaspb.GetLEDsRequest{},
+		},
+	})
+	conn.ExpectMessage(&christmaspb.LEDServerMessage{
+		Message: &christmaspb.LEDServerMessage_GetLeds{
+			GetLeds: &christmaspb.GetLEDsResponse{
+				Leds: []uint32{0, 0, 0},
+			},
+		},
+	})
+
+	conn.Send(&christmaspb.LEDClientMessage{
+		Message: &christmaspb.LEDClientMessage_SetLeds{
+			SetLeds: &christmaspb.SetLEDsRequest{
+				Leds: []uint32{0xFF0000, 0x00FF00, 0x0000FF},
+			},
+		},
+	})
+	conn.ExpectMessage(&christmaspb.LEDServerMessage{
+		Error: proto.String("session is view-only, frames are not allowed"),
+	})
+	conn.ExpectClose()
 
-	b, err := proto.Marshal(msg)
+	if calls := ctrl.Calls(); len(calls) != 0 {
+		t.Errorf("view-only session called the controller: %v", calls)
+	}
+}
+
+func TestClient(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ctrl := christmasdtest.NewLEDController(3, 4, 2)
+	ctrl.SetLEDs(leddraw.LEDStrip{{R: 1}, {G: 2}, {B: 3}})
+	ctrl.Reset()
+
+	frameStats := christmasd.FrameStats{
+		TargetFrameRate: 30,
+		FrameRate:       29.5,
+		Frames:          100,
+		Coalesced:       3,
+		LatencyMean:     2 * time.Millisecond,
+		LatencyMax:      5 * time.Millisecond,
+		JitterMean:      100 * time.Microsecond,
+		JitterMax:       time.Millisecond,
+	}
+
+	url := christmasdtest.StartServer(t, christmasd.ServerOpts{
+		LEDController: ctrl,
+		FrameStats:    func() christmasd.FrameStats { return frameStats },
+	})
+
+	client, err := christmasd.Dial(ctx, url, christmasd.ClientOpts{})
 	if err != nil {
-		t.Fatal("invalid client proto message:", err)
+		t.Fatal("cannot dial:", err)
 	}
-	if err := wsutil.WriteClientBinary(conn, b); err != nil {
-		t.Fatal("error writing client message:", err)
+	defer client.Close()
+
+	w, h := client.ImageSize()
+	assertEq(t, [2]int{4, 2}, [2]int{w, h})
+	assertEq(t, leddraw.LEDStrip{{R: 1}, {G: 2}, {B: 3}}, client.LEDs())
+
+	// The LEDs are a copy, which later frames don't write into.
+	leds := client.LEDs()
+	strip := leddraw.LEDStrip{{R: 4}, {G: 5}, {B: 6}}
+	if err := client.SetLEDs(strip); err != nil {
+		t.Fatal("cannot set LEDs:", err)
+	}
+	assertEq(t, leddraw.LEDStrip{{R: 1}, {G: 2}, {B: 3}}, leds)
+	assertEq(t, strip, client.LEDs())
+
+	calls, err := ctrl.WaitCalls(ctx, 1)
+	if err != nil {
+		t.Fatal("server never received the LEDs:", err)
+	}
+	assertEq(t, strip, calls[0].LEDs)
+
+	gotStats, err := client.GetFrameStats(ctx)
+	if err != nil {
+		t.Fatal("cannot get frame stats:", err)
+	}
+	assertEq(t, frameStats, gotStats)
+
+	if err := client.SetLEDs(strip[:1]); err == nil {
+		t.Error("expected error setting the wrong number of LEDs")
 	}
 }
 
-func readServerMessage(t *testing.T, conn io.ReadWriteCloser) *christmaspb.LEDServerMessage {
-	t.Helper()
+func TestClientNotices(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	server := christmasd.NewServer(christmasd.ServerOpts{
+		LEDController: christmasdtest.NewLEDController(3, 4, 2),
+		Logger:        slogt.New(t),
+	})
+	url := christmasdtest.Serve(t, server)
 
-	b, err := wsutil.ReadServerBinary(conn)
+	notices := make(chan christmasd.Notice, 2)
+	client, err := christmasd.Dial(ctx, url, christmasd.ClientOpts{
+		OnNotice: func(n christmasd.Notice) { notices <- n },
+	})
 	if err != nil {
-		t.Fatal("error reading server message:", err)
+		t.Fatal("cannot dial:", err)
 	}
+	defer client.Close()
 
-	msg := &christmaspb.LEDServerMessage{}
-	if err := proto.Unmarshal(b, msg); err != nil {
-		t.Fatal("invalid server proto message:", err)
+	all := func(*christmasd.Session) bool { return true }
+
+	maintenance := christmasd.Notice{
+		Kind:     christmasd.NoticeMaintenance,
+		Message:  "restarting for an update",
+		Deadline: time.UnixMilli(time.Now().Add(time.Minute).UnixMilli()),
 	}
+	assertEq(t, 1, server.Notify(maintenance, all))
+	assertEq(t, maintenance, receiveNotice(t, ctx, notices))
 
-	return msg
-}
+	assertEq(t, 1, server.KickSessions("lights out", all))
+	assertEq(t,
+		christmasd.Notice{Kind: christmasd.NoticeKicked, Message: "lights out"},
+		receiveNotice(t, ctx, notices))
 
-func assertMessage(t *testing.T, conn io.ReadWriteCloser, expect *christmaspb.LEDServerMessage) {
-	t.Helper()
+	select {
+	case <-ctx.Done():
+		t.Fatal("client was never disconnected")
+	case <-client.Done():
+	}
 
-	actual := readServerMessage(t, conn)
-	assertEq(t, expect, actual)
+	err = client.Err()
+	if !errors.Is(err, christmasd.ErrKicked) || !errors.Is(err, christmasd.ErrClientClosed) {
+		t.Fatalf("expected a kick error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "lights out") {
+		t.Errorf("expected the kick reason in the error, got %q", err)
+	}
 }
 
-func assertEq[T any](t *testing.T, expected, actual T, opts ...cmp.Option) {
-	t.Helper()
+func TestClientAbandonedRequest(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 
-	opts = append(opts, protocmp.Transform())
-	if diff := cmp.Diff(expected, actual, opts...); diff != "" {
-		t.Errorf("unexpected diff (-want +got):\n%s", diff)
+	ctrl := christmasdtest.NewLEDController(2, 4, 2)
+	ctrl.SetLEDs(leddraw.LEDStrip{{R: 1}, {G: 2}})
+
+	// The first frame stats request is answered late, after the client gave
+	// up on it.
+	release := make(chan struct{})
+	url := christmasdtest.StartServer(t, christmasd.ServerOpts{
+		LEDController: ctrl,
+		FrameStats: func() christmasd.FrameStats {
+			<-release
+			return christmasd.FrameStats{Frames: 1}
+		},
+	})
+
+	client, err := christmasd.Dial(ctx, url, christmasd.ClientOpts{})
+	if err != nil {
+		t.Fatal("cannot dial:", err)
 	}
-}
+	defer client.Close()
 
-func expectCloseFrame(t *testing.T, conn io.ReadWriteCloser) {
-	t.Helper()
-	var closedErr wsutil.ClosedError
+	reqCtx, reqCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer reqCancel()
 
-	_, op, err := wsutil.ReadServerData(conn)
-	if err == nil {
-		t.Fatal("no close frame received, got op", op)
+	if _, err := client.GetFrameStats(reqCtx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the request to time out, got %v", err)
 	}
-	if !errors.As(err, &closedErr) {
-		t.Fatal("unexpected non-ClosedError while reading server data:", err)
+	close(release)
+
+	leds, err := client.GetLEDs(ctx)
+	if err != nil {
+		t.Fatal("cannot get LEDs after an abandoned request:", err)
 	}
+	assertEq(t, leddraw.LEDStrip{{R: 1}, {G: 2}}, leds)
 
-	// Responding close frame is automatically handled by gobwas/ws/wsutil.
-	// See wsutil/handler.go @ ControlHandler.HandleClose.
+	stats, err := client.GetFrameStats(ctx)
+	if err != nil {
+		t.Fatal("cannot get frame stats after an abandoned request:", err)
+	}
+	assertEq(t, christmasd.FrameStats{Frames: 1}, stats)
 }
 
-func startTestSession(t *testing.T, ctx context.Context, cfg Config) io.ReadWriteCloser {
+func receiveNotice(t *testing.T, ctx context.Context, notices <-chan christmasd.Notice) christmasd.Notice {
 	t.Helper()
 
-	conn1, conn2 := net.Pipe()
+	select {
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for a notice")
+		return christmasd.Notice{}
+	case n := <-notices:
+		return n
+	}
+}
 
-	t.Cleanup(func() {
-		t.Log("closing test session pipes")
-		conn1.Close()
-		conn2.Close()
-	})
+func waitCalls(t *testing.T, ctrl *christmasdtest.LEDController, n int) []christmasdtest.Call {
+	t.Helper()
 
-	logger := slogt.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 
-	session := &Session{
-		ws:     newWebsocketServer(conn1, logger),
-		logger: logger,
-		cfg:    cfg,
+	calls, err := ctrl.WaitCalls(ctx, n)
+	if err != nil {
+		t.Fatalf("timed out waiting for %d calls, got %d", n, len(ctrl.Calls()))
 	}
+	return calls
+}
 
-	ctx, cancel := context.WithCancel(ctx)
-	errCh := make(chan error, 1)
-
-	t.Cleanup(func() {
-		cancel()
-		if err := <-errCh; err != nil && !errors.Is(err, context.Canceled) {
-			t.Error("server session error:", err)
+func TestJoinServerHooks(t *testing.T) {
+	var calls []string
+	record := func(name string) christmasd.ServerHooks {
+		return christmasd.ServerHooks{
+			SessionStarted: func(*christmasd.Session) {
+				calls = append(calls, name+" started")
+			},
+			SessionEnded: func(*christmasd.Session, error) {
+				calls = append(calls, name+" ended")
+			},
+			MessageReceived: func(_ *christmasd.Session, kind string, _ int) {
+				calls = append(calls, name+" received "+kind)
+			},
+			MessageSent: func(_ *christmasd.Session, kind string, _ int) {
+				calls = append(calls, name+" sent "+kind)
+			},
+			FrameRejected: func(_ *christmasd.Session, r christmasd.FrameRejectReason) {
+				calls = append(calls, name+" rejected "+string(r))
+			},
+			Error: func(_ *christmasd.Session, c christmasd.ErrorCause, _ error) {
+				calls = append(calls, name+" error "+string(c))
+			},
 		}
-	})
+	}
 
-	go func() {
-		errCh <- session.Start(ctx)
-	}()
+	// Nil hooks in any of the joined hooks are skipped.
+	hooks := christmasd.JoinServerHooks(record("a"), christmasd.ServerHooks{}, record("b"))
+	hooks.SessionStarted(nil)
+	hooks.MessageReceived(nil, "set_leds", 1)
+	hooks.MessageSent(nil, "error", 1)
+	hooks.FrameRejected(nil, christmasd.FrameStaleSize)
+	hooks.Error(nil, christmasd.ErrorRead, nil)
+	hooks.SessionEnded(nil, nil)
 
-	return conn2
+	assertEq(t, []string{
+		"a started", "b started",
+		"a received set_leds", "b received set_leds",
+		"a sent error", "b sent error",
+		"a rejected stale_size", "b rejected stale_size",
+		"a error read", "b error read",
+		"a ended", "b ended",
+	}, calls)
+}
+
+func assertEq[T any](t *testing.T, expected, actual T, opts ...cmp.Option) {
+	t.Helper()
+
+	opts = append(opts, cmp.Comparer(func(a, b xcolor.RGB) bool { return a == b }))
+	if diff := cmp.Diff(expected, actual, opts...); diff != "" {
+		t.Errorf("unexpected diff (-want +got):\n%s", diff)
+	}
 }
@@ -0,0 +1,227 @@
+// Package christmasdmetrics provides Prometheus metrics for christmasd servers
+// and LED controllers. It plugs into christmasd.ServerHooks and
+// christmasd.LEDControllerHooks.
+package christmasdmetrics
+
+import (
+	"sync"
+	"time"
+
+	"dev.acmcsuf.com/christmasd"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "christmasd"
+
+// frameRateWindow is the window over which the actual frame rate is measured.
+const frameRateWindow = 5 * time.Second
+
+// Metrics is a set of Prometheus metrics for a christmasd server and its LED
+// controller.
+type Metrics struct {
+	sessionsActive   prometheus.Gauge
+	sessionsTotal    prometheus.Counter
+	messagesReceived *prometheus.CounterVec
+	messagesSent     *prometheus.CounterVec
+	bytesReceived    prometheus.Counter
+	bytesSent        prometheus.Counter
+	framesRejected   *prometheus.CounterVec
+	errors           *prometheus.CounterVec
+
+	flushDuration  prometheus.Histogram
+	renderDuration prometheus.Histogram
+	frameLatency   prometheus.Histogram
+	framesTotal    prometheus.Counter
+	frameRateWant  prometheus.Gauge
+
+	flushesMu sync.Mutex
+	flushes   []time.Time // within frameRateWindow
+}
+
+// New creates a new set of metrics and registers them with reg.
+func New(reg prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		sessionsActive: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "sessions_active",
+			Help:      "Number of connected sessions.",
+		}),
+		sessionsTotal: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "sessions_total",
+			Help:      "Total number of sessions.",
+		}),
+		messagesReceived: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "messages_received_total",
+			Help:      "Total number of messages received from clients, by type.",
+		}, []string{"type"}),
+		messagesSent: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "messages_sent_total",
+			Help:      "Total number of messages sent to clients, by type.",
+		}, []string{"type"}),
+		bytesReceived: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "received_bytes_total",
+			Help:      "Total size of the messages received from clients.",
+		}),
+		bytesSent: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "sent_bytes_total",
+			Help:      "Total size of the messages sent to clients.",
+		}),
+		framesRejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "frames_rejected_total",
+			Help:      "Total number of frames from clients that were not shown, by reason.",
+		}, []string{"reason"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "errors_total",
+			Help:      "Total number of errors, by cause.",
+		}, []string{"cause"}),
+		flushDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "flush_duration_seconds",
+			Help:      "Time taken to write the LEDs out to the hardware.",
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 10), // 0.5ms to 256ms
+		}),
+		renderDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "render_duration_seconds",
+			Help:      "Time taken to render a canvas image onto the LEDs.",
+			Buckets:   prometheus.ExponentialBuckets(0.0001, 2, 12), // 0.1ms to 205ms
+		}),
+		frameLatency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "frame_latency_seconds",
+			Help:      "Time from a frame being queued to it being written out.",
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 10), // 0.5ms to 256ms
+		}),
+		framesTotal: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "frames_total",
+			Help:      "Total number of frames written out to the hardware.",
+		}),
+		frameRateWant: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "frame_rate_configured",
+			Help:      "Configured maximum frame rate.",
+		}),
+	}
+
+	frameRate := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "frame_rate",
+		Help:      "Actual frame rate over the last few seconds.",
+	}, m.frameRate)
+
+	reg.MustRegister(
+		m.sessionsActive,
+		m.sessionsTotal,
+		m.messagesReceived,
+		m.messagesSent,
+		m.bytesReceived,
+		m.bytesSent,
+		m.framesRejected,
+		m.errors,
+		m.flushDuration,
+		m.renderDuration,
+		m.frameLatency,
+		m.framesTotal,
+		m.frameRateWant,
+		frameRate,
+	)
+
+	return m
+}
+
+// ServerHooks returns the hooks that update the server metrics.
+func (m *Metrics) ServerHooks() christmasd.ServerHooks {
+	return christmasd.ServerHooks{
+		SessionStarted: func(s *christmasd.Session) {
+			m.sessionsActive.Inc()
+			m.sessionsTotal.Inc()
+		},
+		SessionEnded: func(s *christmasd.Session, err error) {
+			m.sessionsActive.Dec()
+		},
+		MessageReceived: func(s *christmasd.Session, kind string, size int) {
+			m.messagesReceived.WithLabelValues(kind).Inc()
+			m.bytesReceived.Add(float64(size))
+		},
+		MessageSent: func(s *christmasd.Session, kind string, size int) {
+			m.messagesSent.WithLabelValues(kind).Inc()
+			m.bytesSent.Add(float64(size))
+		},
+		FrameRejected: func(s *christmasd.Session, reason christmasd.FrameRejectReason) {
+			m.framesRejected.WithLabelValues(string(reason)).Inc()
+		},
+		Error: func(s *christmasd.Session, cause christmasd.ErrorCause, err error) {
+			m.errors.WithLabelValues(string(cause)).Inc()
+		},
+	}
+}
+
+// LEDControllerHooks returns the hooks that update the LED controller
+// metrics.
+func (m *Metrics) LEDControllerHooks() christmasd.LEDControllerHooks {
+	return christmasd.LEDControllerHooks{
+		Flushed: func(took time.Duration, err error) {
+			m.flushDuration.Observe(took.Seconds())
+			if err != nil {
+				m.errors.WithLabelValues("flush").Inc()
+				return
+			}
+			m.framesTotal.Inc()
+			m.recordFlush(time.Now())
+		},
+		Rendered: func(took time.Duration, err error) {
+			m.renderDuration.Observe(took.Seconds())
+			if err != nil {
+				m.errors.WithLabelValues("render").Inc()
+			}
+		},
+		FrameLatency: func(latency time.Duration) {
+			m.frameLatency.Observe(latency.Seconds())
+		},
+	}
+}
+
+// SetFrameRate sets the configured frame rate, which is reported next to the
+// actual frame rate.
+func (m *Metrics) SetFrameRate(fps int) {
+	m.frameRateWant.Set(float64(fps))
+}
+
+// Error counts an error with the given cause that is not covered by the
+// hooks.
+func (m *Metrics) Error(cause string) {
+	m.errors.WithLabelValues(cause).Inc()
+}
+
+func (m *Metrics) recordFlush(now time.Time) {
+	m.flushesMu.Lock()
+	defer m.flushesMu.Unlock()
+
+	m.flushes = append(m.flushes, now)
+	m.trimFlushes(now)
+}
+
+func (m *Metrics) trimFlushes(now time.Time) {
+	cutoff := now.Add(-frameRateWindow)
+	i := 0
+	for i < len(m.flushes) && m.flushes[i].Before(cutoff) {
+		i++
+	}
+	m.flushes = append(m.flushes[:0], m.flushes[i:]...)
+}
+
+func (m *Metrics) frameRate() float64 {
+	m.flushesMu.Lock()
+	defer m.flushesMu.Unlock()
+
+	m.trimFlushes(time.Now())
+	return float64(len(m.flushes)) / frameRateWindow.Seconds()
+}
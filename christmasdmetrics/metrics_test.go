@@ -0,0 +1,122 @@
+package christmasdmetrics_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"dev.acmcsuf.com/christmasd"
+	"dev.acmcsuf.com/christmasd/christmasdmetrics"
+	"dev.acmcsuf.com/christmasd/christmasdtest"
+	"dev.acmcsuf.com/christmasd/christmaspb"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestServerHooks(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	registry := prometheus.NewRegistry()
+	metrics := christmasdmetrics.New(registry)
+
+	ctrl := christmasdtest.NewLEDController(2, 2, 1)
+	conn := christmasdtest.StartSession(t, ctx, christmasd.ServerOpts{
+		LEDController: ctrl,
+		Hooks:         metrics.ServerHooks(),
+	})
+
+	conn.Send(&christmaspb.LEDClientMessage{
+		Message: &christmaspb.LEDClientMessage_GetLedCanvasInfo{
+			GetLedCanvasInfo: &christmaspb.GetLEDCanvasInfoRequest{},
+		},
+	})
+	conn.Receive()
+
+	conn.Send(&christmaspb.LEDClientMessage{
+		Message: &christmaspb.LEDClientMessage_SetLeds{
+			SetLeds: &christmaspb.SetLEDsRequest{Leds: []uint32{1}},
+		},
+	})
+	conn.Receive()
+	conn.ExpectClose()
+
+	expect := map[string]float64{
+		`christmasd_sessions_total`:                                      1,
+		`christmasd_messages_received_total{type="get_led_canvas_info"}`: 1,
+		`christmasd_messages_received_total{type="set_leds"}`:            1,
+		`christmasd_messages_sent_total{type="get_led_canvas_info"}`:     1,
+		`christmasd_messages_sent_total{type="error"}`:                   1,
+		`christmasd_frames_rejected_total{reason="invalid_size"}`:        1,
+		`christmasd_errors_total{cause="protocol"}`:                      1,
+	}
+
+	values := gather(t, registry)
+	for name, want := range expect {
+		if got := values[name]; got != want {
+			t.Errorf("%s = %v, want %v", name, got, want)
+		}
+	}
+
+	if values["christmasd_received_bytes_total"] == 0 {
+		t.Error("no received bytes were counted")
+	}
+}
+
+func TestLEDControllerHooks(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	metrics := christmasdmetrics.New(registry)
+	metrics.SetFrameRate(30)
+
+	hooks := metrics.LEDControllerHooks()
+	for i := 0; i < 10; i++ {
+		hooks.Flushed(time.Millisecond, nil)
+	}
+	hooks.Rendered(time.Millisecond, nil)
+
+	values := gather(t, registry)
+	if got := values["christmasd_frames_total"]; got != 10 {
+		t.Errorf("frames_total = %v, want 10", got)
+	}
+	if got := values["christmasd_frame_rate_configured"]; got != 30 {
+		t.Errorf("frame_rate_configured = %v, want 30", got)
+	}
+	if got := values["christmasd_frame_rate"]; got <= 0 {
+		t.Errorf("frame_rate = %v, want > 0", got)
+	}
+}
+
+// gather returns the value of every counter and gauge in the registry, keyed
+// by the metric name and its labels as written in PromQL.
+func gather(t *testing.T, registry *prometheus.Registry) map[string]float64 {
+	t.Helper()
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal("cannot gather metrics:", err)
+	}
+
+	values := make(map[string]float64)
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			name := family.GetName()
+			if labels := metric.GetLabel(); len(labels) > 0 {
+				name += "{"
+				for i, label := range labels {
+					if i > 0 {
+						name += ","
+					}
+					name += label.GetName() + `="` + label.GetValue() + `"`
+				}
+				name += "}"
+			}
+
+			switch {
+			case metric.Counter != nil:
+				values[name] = metric.GetCounter().GetValue()
+			case metric.Gauge != nil:
+				values[name] = metric.GetGauge().GetValue()
+			}
+		}
+	}
+	return values
+}
@@ -0,0 +1,173 @@
+// Package christmasdtest provides utilities for testing christmasd servers and
+// clients without any LED hardware.
+package christmasdtest
+
+import (
+	"context"
+	"image"
+	"sync"
+
+	"dev.acmcsuf.com/christmas/lib/leddraw"
+	"dev.acmcsuf.com/christmasd"
+)
+
+// Method is the name of an LEDController method.
+type Method string
+
+const (
+	MethodSetLEDs   Method = "SetLEDs"
+	MethodDrawImage Method = "DrawImage"
+)
+
+// Call is a single recorded call to an LEDController.
+type Call struct {
+	// Method is the method that was called.
+	Method Method
+	// LEDs is a copy of the strip given to SetLEDs.
+	LEDs leddraw.LEDStrip
+	// Image is a copy of the image given to DrawImage.
+	Image *image.RGBA
+}
+
+// LEDController is an in-memory christmasd.LEDController that records every
+// call that changes its LEDs. It is safe for concurrent use.
+type LEDController struct {
+	// Render, if not nil, is called by DrawImage to render the image onto
+	// the LEDs. By default, DrawImage leaves the LEDs unchanged.
+	Render func(img *image.RGBA, leds leddraw.LEDStrip)
+
+	mu      sync.Mutex
+	leds    leddraw.LEDStrip
+	width   int
+	height  int
+	calls   []Call
+	changed chan struct{}
+}
+
+var _ christmasd.LEDController = (*LEDController)(nil)
+
+// NewLEDController creates a new LEDController with the given number of LEDs
+// and the given image size. All LEDs start off black.
+func NewLEDController(numLEDs, width, height int) *LEDController {
+	return &LEDController{
+		leds:    make(leddraw.LEDStrip, numLEDs),
+		width:   width,
+		height:  height,
+		changed: make(chan struct{}),
+	}
+}
+
+// LEDs implements christmasd.LEDController. It returns a copy of the LEDs.
+func (c *LEDController) LEDs() leddraw.LEDStrip {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return copyStrip(c.leds)
+}
+
+// SetLEDs implements christmasd.LEDController.
+func (c *LEDController) SetLEDs(strip leddraw.LEDStrip) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	copy(c.leds, strip)
+	c.record(Call{
+		Method: MethodSetLEDs,
+		LEDs:   copyStrip(strip),
+	})
+	return nil
+}
+
+// ImageSize implements christmasd.LEDController.
+func (c *LEDController) ImageSize() (w, h int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.width, c.height
+}
+
+// Resize changes the number of LEDs and the image size. The LEDs that are
+// still present keep their colors, and new LEDs start off black.
+func (c *LEDController) Resize(numLEDs, width, height int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	leds := make(leddraw.LEDStrip, numLEDs)
+	copy(leds, c.leds)
+
+	c.leds = leds
+	c.width = width
+	c.height = height
+}
+
+// DrawImage implements christmasd.LEDController.
+func (c *LEDController) DrawImage(img *image.RGBA) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.Render != nil {
+		c.Render(img, c.leds)
+	}
+
+	imgCopy := image.NewRGBA(img.Bounds())
+	copy(imgCopy.Pix, img.Pix)
+
+	c.record(Call{
+		Method: MethodDrawImage,
+		Image:  imgCopy,
+	})
+	return nil
+}
+
+func (c *LEDController) record(call Call) {
+	c.calls = append(c.calls, call)
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// Calls returns all calls recorded so far.
+func (c *LEDController) Calls() []Call {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	calls := make([]Call, len(c.calls))
+	copy(calls, c.calls)
+	return calls
+}
+
+// WaitCalls waits until at least n calls have been recorded, then returns
+// all calls recorded so far. It returns the context's error if the context
+// is canceled first.
+func (c *LEDController) WaitCalls(ctx context.Context, n int) ([]Call, error) {
+	for {
+		c.mu.Lock()
+		if len(c.calls) >= n {
+			calls := make([]Call, len(c.calls))
+			copy(calls, c.calls)
+			c.mu.Unlock()
+			return calls, nil
+		}
+		changed := c.changed
+		c.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// Reset forgets all recorded calls. The LEDs are left unchanged.
+func (c *LEDController) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.calls = nil
+}
+
+func copyStrip(strip leddraw.LEDStrip) leddraw.LEDStrip {
+	cpy := make(leddraw.LEDStrip, len(strip))
+	copy(cpy, strip)
+	return cpy
+}
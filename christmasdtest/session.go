@@ -0,0 +1,202 @@
+package christmasdtest
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"dev.acmcsuf.com/christmasd"
+	"dev.acmcsuf.com/christmasd/christmaspb"
+	"github.com/gobwas/ws/wsutil"
+	"github.com/google/go-cmp/cmp"
+	"github.com/neilotoole/slogt"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/testing/protocmp"
+)
+
+// Conn is the client side of a session started by StartSession. It speaks the
+// websocket protocol, but without the HTTP handshake.
+type Conn struct {
+	net.Conn
+	// Session is the server side of the connection.
+	Session *christmasd.Session
+
+	t testing.TB
+}
+
+// StartSession starts a christmasd.Session over an in-memory connection and
+// returns the client side of it. If opts.Logger is nil, the test's logger is
+// used. The session is stopped when the test ends, and any error that it
+// returns fails the test.
+func StartSession(t testing.TB, ctx context.Context, opts christmasd.ServerOpts) *Conn {
+	t.Helper()
+	return StartSessionWithOpts(t, ctx, opts, christmasd.SessionOpts{})
+}
+
+// StartSessionWithOpts is like StartSession, but with options for the
+// session.
+func StartSessionWithOpts(t testing.TB, ctx context.Context, opts christmasd.ServerOpts, sopts christmasd.SessionOpts) *Conn {
+	t.Helper()
+
+	session, conn := newSession(t, opts, sopts)
+
+	ctx, cancel := context.WithCancel(ctx)
+	errCh := make(chan error, 1)
+
+	t.Cleanup(func() {
+		cancel()
+		if err := <-errCh; err != nil && !errors.Is(err, context.Canceled) {
+			t.Error("server session error:", err)
+		}
+	})
+
+	go func() {
+		errCh <- session.Start(ctx)
+	}()
+
+	return &Conn{Conn: conn, Session: session, t: t}
+}
+
+// NewSession creates a christmasd.Session over an in-memory connection
+// without starting it, for tests that only need a session to get an
+// LEDController for with christmasd.ControllerForSession. If opts.Logger is
+// nil, the test's logger is used.
+func NewSession(t testing.TB, opts christmasd.ServerOpts) *christmasd.Session {
+	t.Helper()
+
+	session, _ := newSession(t, opts, christmasd.SessionOpts{})
+	return session
+}
+
+// newSession creates a session and returns it with the client side of its
+// connection. The connection is closed when the test ends.
+func newSession(t testing.TB, opts christmasd.ServerOpts, sopts christmasd.SessionOpts) (*christmasd.Session, net.Conn) {
+	t.Helper()
+
+	if opts.Logger == nil {
+		opts.Logger = slogt.New(t)
+	}
+
+	conn1, conn2 := net.Pipe()
+
+	t.Cleanup(func() {
+		conn1.Close()
+		conn2.Close()
+	})
+
+	session, err := christmasd.NewSessionWithOpts(conn1, opts, sopts)
+	if err != nil {
+		t.Fatal("cannot create session:", err)
+	}
+
+	return session, conn2
+}
+
+// StartServer starts a christmasd.Server on a local HTTP server and returns
+// its websocket URL. Any websocket client can connect to it. If opts.Logger is
+// nil, the test's logger is used. The server is stopped when the test ends.
+func StartServer(t testing.TB, opts christmasd.ServerOpts) string {
+	t.Helper()
+
+	if opts.Logger == nil {
+		opts.Logger = slogt.New(t)
+	}
+
+	return Serve(t, christmasd.NewServer(opts))
+}
+
+// Serve is like StartServer, but serves an existing server, e.g. to kick its
+// sessions from the test.
+func Serve(t testing.TB, server *christmasd.Server) string {
+	t.Helper()
+
+	// httptest.Server doesn't wait for hijacked connections, so we have to
+	// stop and wait for the websocket sessions ourselves.
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wg.Add(1)
+		defer wg.Done()
+
+		rctx, rcancel := context.WithCancel(r.Context())
+		defer rcancel()
+
+		stop := context.AfterFunc(ctx, rcancel)
+		defer stop()
+
+		server.ServeHTTP(w, r.WithContext(rctx))
+	}))
+
+	t.Cleanup(func() {
+		cancel()
+		srv.Close()
+		wg.Wait()
+	})
+
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+// Send sends a message to the server.
+func (c *Conn) Send(msg *christmaspb.LEDClientMessage) {
+	c.t.Helper()
+
+	b, err := proto.Marshal(msg)
+	if err != nil {
+		c.t.Fatal("invalid client proto message:", err)
+	}
+	if err := wsutil.WriteClientBinary(c.Conn, b); err != nil {
+		c.t.Fatal("error writing client message:", err)
+	}
+}
+
+// Receive receives a message from the server.
+func (c *Conn) Receive() *christmaspb.LEDServerMessage {
+	c.t.Helper()
+
+	b, err := wsutil.ReadServerBinary(c.Conn)
+	if err != nil {
+		c.t.Fatal("error reading server message:", err)
+	}
+
+	msg := &christmaspb.LEDServerMessage{}
+	if err := proto.Unmarshal(b, msg); err != nil {
+		c.t.Fatal("invalid server proto message:", err)
+	}
+
+	return msg
+}
+
+// ExpectMessage receives a message from the server and fails the test if it
+// is not equal to expect.
+func (c *Conn) ExpectMessage(expect *christmaspb.LEDServerMessage) {
+	c.t.Helper()
+
+	actual := c.Receive()
+	if diff := cmp.Diff(expect, actual, protocmp.Transform()); diff != "" {
+		c.t.Errorf("unexpected message (-want +got):\n%s", diff)
+	}
+}
+
+// ExpectClose fails the test if the server does not send a close frame next.
+func (c *Conn) ExpectClose() {
+	c.t.Helper()
+
+	_, op, err := wsutil.ReadServerData(c.Conn)
+	if err == nil {
+		c.t.Fatal("no close frame received, got op", op)
+	}
+
+	var closedErr wsutil.ClosedError
+	if !errors.As(err, &closedErr) {
+		c.t.Fatal("unexpected non-ClosedError while reading server data:", err)
+	}
+
+	// Responding close frame is automatically handled by gobwas/ws/wsutil.
+	// See wsutil/handler.go @ ControlHandler.HandleClose.
+}
@@ -20,6 +20,68 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+type NoticeKind int32
+
+const (
+	// A general message, for example from an admin.
+	NoticeKind_NOTICE_INFO NoticeKind = 0
+	// The session was kicked. The server closes the connection right after
+	// this, with the reason in the message.
+	NoticeKind_NOTICE_KICKED NoticeKind = 1
+	// The session will be closed when it reaches its time limit at the
+	// deadline.
+	NoticeKind_NOTICE_TIME_LIMIT NoticeKind = 2
+	// The server will go down for maintenance, at the deadline if there is one.
+	NoticeKind_NOTICE_MAINTENANCE NoticeKind = 3
+	// The client's place in the queue for the LEDs changed.
+	NoticeKind_NOTICE_QUEUE NoticeKind = 4
+)
+
+// Enum value maps for NoticeKind.
+var (
+	NoticeKind_name = map[int32]string{
+		0: "NOTICE_INFO",
+		1: "NOTICE_KICKED",
+		2: "NOTICE_TIME_LIMIT",
+		3: "NOTICE_MAINTENANCE",
+		4: "NOTICE_QUEUE",
+	}
+	NoticeKind_value = map[string]int32{
+		"NOTICE_INFO":        0,
+		"NOTICE_KICKED":      1,
+		"NOTICE_TIME_LIMIT":  2,
+		"NOTICE_MAINTENANCE": 3,
+		"NOTICE_QUEUE":       4,
+	}
+)
+
+func (x NoticeKind) Enum() *NoticeKind {
+	p := new(NoticeKind)
+	*p = x
+	return p
+}
+
+func (x NoticeKind) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (NoticeKind) Descriptor() protoreflect.EnumDescriptor {
+	return file_christmas_proto_enumTypes[0].Descriptor()
+}
+
+func (NoticeKind) Type() protoreflect.EnumType {
+	return &file_christmas_proto_enumTypes[0]
+}
+
+func (x NoticeKind) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use NoticeKind.Descriptor instead.
+func (NoticeKind) EnumDescriptor() ([]byte, []int) {
+	return file_christmas_proto_rawDescGZIP(), []int{0}
+}
+
 type LEDClientMessage struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -31,6 +93,7 @@ type LEDClientMessage struct {
 	//	*LEDClientMessage_SetLedCanvas
 	//	*LEDClientMessage_GetLeds
 	//	*LEDClientMessage_SetLeds
+	//	*LEDClientMessage_GetFrameStats
 	Message isLEDClientMessage_Message `protobuf_oneof:"message"`
 }
 
@@ -101,6 +164,13 @@ func (x *LEDClientMessage) GetSetLeds() *SetLEDsRequest {
 	return nil
 }
 
+func (x *LEDClientMessage) GetGetFrameStats() *GetFrameStatsRequest {
+	if x, ok := x.GetMessage().(*LEDClientMessage_GetFrameStats); ok {
+		return x.GetFrameStats
+	}
+	return nil
+}
+
 type isLEDClientMessage_Message interface {
 	isLEDClientMessage_Message()
 }
@@ -131,6 +201,12 @@ type LEDClientMessage_SetLeds struct {
 	SetLeds *SetLEDsRequest `protobuf:"bytes,5,opt,name=set_leds,json=setLeds,proto3,oneof"`
 }
 
+type LEDClientMessage_GetFrameStats struct {
+	// Get statistics about how frames are written out to the LEDs. Sends back
+	// a GetFrameStatsResponse.
+	GetFrameStats *GetFrameStatsRequest `protobuf:"bytes,6,opt,name=get_frame_stats,json=getFrameStats,proto3,oneof"`
+}
+
 func (*LEDClientMessage_GetLedCanvasInfo) isLEDClientMessage_Message() {}
 
 func (*LEDClientMessage_SetLedCanvas) isLEDClientMessage_Message() {}
@@ -139,6 +215,8 @@ func (*LEDClientMessage_GetLeds) isLEDClientMessage_Message() {}
 
 func (*LEDClientMessage_SetLeds) isLEDClientMessage_Message() {}
 
+func (*LEDClientMessage_GetFrameStats) isLEDClientMessage_Message() {}
+
 type LEDServerMessage struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -148,6 +226,9 @@ type LEDServerMessage struct {
 	//
 	//	*LEDServerMessage_GetLedCanvasInfo
 	//	*LEDServerMessage_GetLeds
+	//	*LEDServerMessage_GetFrameStats
+	//	*LEDServerMessage_CanvasChanged
+	//	*LEDServerMessage_Notice
 	Message isLEDServerMessage_Message `protobuf_oneof:"message"`
 	// If present, the server encountered an error. This is a string describing
 	// the error.
@@ -207,6 +288,27 @@ func (x *LEDServerMessage) GetGetLeds() *GetLEDsResponse {
 	return nil
 }
 
+func (x *LEDServerMessage) GetGetFrameStats() *GetFrameStatsResponse {
+	if x, ok := x.GetMessage().(*LEDServerMessage_GetFrameStats); ok {
+		return x.GetFrameStats
+	}
+	return nil
+}
+
+func (x *LEDServerMessage) GetCanvasChanged() *CanvasChangedEvent {
+	if x, ok := x.GetMessage().(*LEDServerMessage_CanvasChanged); ok {
+		return x.CanvasChanged
+	}
+	return nil
+}
+
+func (x *LEDServerMessage) GetNotice() *NoticeEvent {
+	if x, ok := x.GetMessage().(*LEDServerMessage_Notice); ok {
+		return x.Notice
+	}
+	return nil
+}
+
 func (x *LEDServerMessage) GetError() string {
 	if x != nil && x.Error != nil {
 		return *x.Error
@@ -228,10 +330,33 @@ type LEDServerMessage_GetLeds struct {
 	GetLeds *GetLEDsResponse `protobuf:"bytes,3,opt,name=get_leds,json=getLeds,proto3,oneof"`
 }
 
+type LEDServerMessage_GetFrameStats struct {
+	// Response to GetFrameStatsRequest.
+	GetFrameStats *GetFrameStatsResponse `protobuf:"bytes,4,opt,name=get_frame_stats,json=getFrameStats,proto3,oneof"`
+}
+
+type LEDServerMessage_CanvasChanged struct {
+	// The LED canvas changed, for example because the server reloaded its LED
+	// points. Any frame sent with the old size after this is ignored.
+	CanvasChanged *CanvasChangedEvent `protobuf:"bytes,50,opt,name=canvas_changed,json=canvasChanged,proto3,oneof"`
+}
+
+type LEDServerMessage_Notice struct {
+	// A message from the server for the user, for example why the session is
+	// about to be closed. Clients should show it to the user.
+	Notice *NoticeEvent `protobuf:"bytes,51,opt,name=notice,proto3,oneof"`
+}
+
 func (*LEDServerMessage_GetLedCanvasInfo) isLEDServerMessage_Message() {}
 
 func (*LEDServerMessage_GetLeds) isLEDServerMessage_Message() {}
 
+func (*LEDServerMessage_GetFrameStats) isLEDServerMessage_Message() {}
+
+func (*LEDServerMessage_CanvasChanged) isLEDServerMessage_Message() {}
+
+func (*LEDServerMessage_Notice) isLEDServerMessage_Message() {}
+
 type GetLEDsRequest struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -464,6 +589,307 @@ func (x *GetLEDCanvasInfoResponse) GetHeight() uint32 {
 	return 0
 }
 
+type CanvasChangedEvent struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// New width of the LED canvas, in pixels.
+	Width uint32 `protobuf:"varint,1,opt,name=width,proto3" json:"width,omitempty"`
+	// New height of the LED canvas, in pixels.
+	Height uint32 `protobuf:"varint,2,opt,name=height,proto3" json:"height,omitempty"`
+	// New number of LEDs.
+	NumLeds uint32 `protobuf:"varint,3,opt,name=num_leds,json=numLeds,proto3" json:"num_leds,omitempty"`
+}
+
+func (x *CanvasChangedEvent) Reset() {
+	*x = CanvasChangedEvent{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_christmas_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *CanvasChangedEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CanvasChangedEvent) ProtoMessage() {}
+
+func (x *CanvasChangedEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_christmas_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CanvasChangedEvent.ProtoReflect.Descriptor instead.
+func (*CanvasChangedEvent) Descriptor() ([]byte, []int) {
+	return file_christmas_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *CanvasChangedEvent) GetWidth() uint32 {
+	if x != nil {
+		return x.Width
+	}
+	return 0
+}
+
+func (x *CanvasChangedEvent) GetHeight() uint32 {
+	if x != nil {
+		return x.Height
+	}
+	return 0
+}
+
+func (x *CanvasChangedEvent) GetNumLeds() uint32 {
+	if x != nil {
+		return x.NumLeds
+	}
+	return 0
+}
+
+type NoticeEvent struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Kind NoticeKind `protobuf:"varint,1,opt,name=kind,proto3,enum=christmas.NoticeKind" json:"kind,omitempty"`
+	// Human-readable message, for example the reason for a kick.
+	Message string `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	// When the notice takes effect, in milliseconds since the Unix epoch, or 0
+	// if it has no deadline.
+	DeadlineUnixMs int64 `protobuf:"varint,3,opt,name=deadline_unix_ms,json=deadlineUnixMs,proto3" json:"deadline_unix_ms,omitempty"`
+	// For NOTICE_QUEUE, the client's position in the queue, 1 being next.
+	QueuePosition uint32 `protobuf:"varint,4,opt,name=queue_position,json=queuePosition,proto3" json:"queue_position,omitempty"`
+}
+
+func (x *NoticeEvent) Reset() {
+	*x = NoticeEvent{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_christmas_proto_msgTypes[8]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *NoticeEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*NoticeEvent) ProtoMessage() {}
+
+func (x *NoticeEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_christmas_proto_msgTypes[8]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use NoticeEvent.ProtoReflect.Descriptor instead.
+func (*NoticeEvent) Descriptor() ([]byte, []int) {
+	return file_christmas_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *NoticeEvent) GetKind() NoticeKind {
+	if x != nil {
+		return x.Kind
+	}
+	return NoticeKind_NOTICE_INFO
+}
+
+func (x *NoticeEvent) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *NoticeEvent) GetDeadlineUnixMs() int64 {
+	if x != nil {
+		return x.DeadlineUnixMs
+	}
+	return 0
+}
+
+func (x *NoticeEvent) GetQueuePosition() uint32 {
+	if x != nil {
+		return x.QueuePosition
+	}
+	return 0
+}
+
+type GetFrameStatsRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *GetFrameStatsRequest) Reset() {
+	*x = GetFrameStatsRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_christmas_proto_msgTypes[9]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *GetFrameStatsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetFrameStatsRequest) ProtoMessage() {}
+
+func (x *GetFrameStatsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_christmas_proto_msgTypes[9]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetFrameStatsRequest.ProtoReflect.Descriptor instead.
+func (*GetFrameStatsRequest) Descriptor() ([]byte, []int) {
+	return file_christmas_proto_rawDescGZIP(), []int{9}
+}
+
+type GetFrameStatsResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// False if the server does not measure its frames. All other fields are
+	// zero then.
+	Available bool `protobuf:"varint,1,opt,name=available,proto3" json:"available,omitempty"`
+	// The frame rate that the server is configured for.
+	TargetFrameRate float64 `protobuf:"fixed64,2,opt,name=target_frame_rate,json=targetFrameRate,proto3" json:"target_frame_rate,omitempty"`
+	// The actual frame rate over the last few seconds.
+	FrameRate float64 `protobuf:"fixed64,3,opt,name=frame_rate,json=frameRate,proto3" json:"frame_rate,omitempty"`
+	// Total number of frames written out.
+	Frames uint64 `protobuf:"varint,4,opt,name=frames,proto3" json:"frames,omitempty"`
+	// Total number of frames that were replaced by a newer frame before they
+	// could be written out.
+	Coalesced uint64 `protobuf:"varint,5,opt,name=coalesced,proto3" json:"coalesced,omitempty"`
+	// Mean and maximum time from a frame being queued to it being written out,
+	// in microseconds, over the recent frames.
+	LatencyMeanUs int64 `protobuf:"varint,6,opt,name=latency_mean_us,json=latencyMeanUs,proto3" json:"latency_mean_us,omitempty"`
+	LatencyMaxUs  int64 `protobuf:"varint,7,opt,name=latency_max_us,json=latencyMaxUs,proto3" json:"latency_max_us,omitempty"`
+	// Mean and maximum deviation of the time between frames from the target
+	// frame interval, in microseconds, over the recent frames.
+	JitterMeanUs int64 `protobuf:"varint,8,opt,name=jitter_mean_us,json=jitterMeanUs,proto3" json:"jitter_mean_us,omitempty"`
+	JitterMaxUs  int64 `protobuf:"varint,9,opt,name=jitter_max_us,json=jitterMaxUs,proto3" json:"jitter_max_us,omitempty"`
+}
+
+func (x *GetFrameStatsResponse) Reset() {
+	*x = GetFrameStatsResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_christmas_proto_msgTypes[10]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *GetFrameStatsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetFrameStatsResponse) ProtoMessage() {}
+
+func (x *GetFrameStatsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_christmas_proto_msgTypes[10]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetFrameStatsResponse.ProtoReflect.Descriptor instead.
+func (*GetFrameStatsResponse) Descriptor() ([]byte, []int) {
+	return file_christmas_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *GetFrameStatsResponse) GetAvailable() bool {
+	if x != nil {
+		return x.Available
+	}
+	return false
+}
+
+func (x *GetFrameStatsResponse) GetTargetFrameRate() float64 {
+	if x != nil {
+		return x.TargetFrameRate
+	}
+	return 0
+}
+
+func (x *GetFrameStatsResponse) GetFrameRate() float64 {
+	if x != nil {
+		return x.FrameRate
+	}
+	return 0
+}
+
+func (x *GetFrameStatsResponse) GetFrames() uint64 {
+	if x != nil {
+		return x.Frames
+	}
+	return 0
+}
+
+func (x *GetFrameStatsResponse) GetCoalesced() uint64 {
+	if x != nil {
+		return x.Coalesced
+	}
+	return 0
+}
+
+func (x *GetFrameStatsResponse) GetLatencyMeanUs() int64 {
+	if x != nil {
+		return x.LatencyMeanUs
+	}
+	return 0
+}
+
+func (x *GetFrameStatsResponse) GetLatencyMaxUs() int64 {
+	if x != nil {
+		return x.LatencyMaxUs
+	}
+	return 0
+}
+
+func (x *GetFrameStatsResponse) GetJitterMeanUs() int64 {
+	if x != nil {
+		return x.JitterMeanUs
+	}
+	return 0
+}
+
+func (x *GetFrameStatsResponse) GetJitterMaxUs() int64 {
+	if x != nil {
+		return x.JitterMaxUs
+	}
+	return 0
+}
+
 type SetLEDCanvasRequest struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -477,7 +903,7 @@ type SetLEDCanvasRequest struct {
 func (x *SetLEDCanvasRequest) Reset() {
 	*x = SetLEDCanvasRequest{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_christmas_proto_msgTypes[7]
+		mi := &file_christmas_proto_msgTypes[11]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -490,7 +916,7 @@ func (x *SetLEDCanvasRequest) String() string {
 func (*SetLEDCanvasRequest) ProtoMessage() {}
 
 func (x *SetLEDCanvasRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_christmas_proto_msgTypes[7]
+	mi := &file_christmas_proto_msgTypes[11]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -503,7 +929,7 @@ func (x *SetLEDCanvasRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use SetLEDCanvasRequest.ProtoReflect.Descriptor instead.
 func (*SetLEDCanvasRequest) Descriptor() ([]byte, []int) {
-	return file_christmas_proto_rawDescGZIP(), []int{7}
+	return file_christmas_proto_rawDescGZIP(), []int{11}
 }
 
 func (x *SetLEDCanvasRequest) GetPixels() *RGBAPixels {
@@ -526,7 +952,7 @@ type RGBAPixels struct {
 func (x *RGBAPixels) Reset() {
 	*x = RGBAPixels{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_christmas_proto_msgTypes[8]
+		mi := &file_christmas_proto_msgTypes[12]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -539,7 +965,7 @@ func (x *RGBAPixels) String() string {
 func (*RGBAPixels) ProtoMessage() {}
 
 func (x *RGBAPixels) ProtoReflect() protoreflect.Message {
-	mi := &file_christmas_proto_msgTypes[8]
+	mi := &file_christmas_proto_msgTypes[12]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -552,7 +978,7 @@ func (x *RGBAPixels) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use RGBAPixels.ProtoReflect.Descriptor instead.
 func (*RGBAPixels) Descriptor() ([]byte, []int) {
-	return file_christmas_proto_rawDescGZIP(), []int{8}
+	return file_christmas_proto_rawDescGZIP(), []int{12}
 }
 
 func (x *RGBAPixels) GetPixels() []byte {
@@ -566,7 +992,7 @@ var File_christmas_proto protoreflect.FileDescriptor
 
 var file_christmas_proto_rawDesc = []byte{
 	0x0a, 0x0f, 0x63, 0x68, 0x72, 0x69, 0x73, 0x74, 0x6d, 0x61, 0x73, 0x2e, 0x70, 0x72, 0x6f, 0x74,
-	0x6f, 0x12, 0x09, 0x63, 0x68, 0x72, 0x69, 0x73, 0x74, 0x6d, 0x61, 0x73, 0x22, 0xaa, 0x02, 0x0a,
+	0x6f, 0x12, 0x09, 0x63, 0x68, 0x72, 0x69, 0x73, 0x74, 0x6d, 0x61, 0x73, 0x22, 0xf5, 0x02, 0x0a,
 	0x10, 0x4c, 0x45, 0x44, 0x43, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67,
 	0x65, 0x12, 0x53, 0x0a, 0x13, 0x67, 0x65, 0x74, 0x5f, 0x6c, 0x65, 0x64, 0x5f, 0x63, 0x61, 0x6e,
 	0x76, 0x61, 0x73, 0x5f, 0x69, 0x6e, 0x66, 0x6f, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x22,
@@ -584,44 +1010,107 @@ var file_christmas_proto_rawDesc = []byte{
 	0x65, 0x74, 0x4c, 0x65, 0x64, 0x73, 0x12, 0x36, 0x0a, 0x08, 0x73, 0x65, 0x74, 0x5f, 0x6c, 0x65,
 	0x64, 0x73, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x19, 0x2e, 0x63, 0x68, 0x72, 0x69, 0x73,
 	0x74, 0x6d, 0x61, 0x73, 0x2e, 0x53, 0x65, 0x74, 0x4c, 0x45, 0x44, 0x73, 0x52, 0x65, 0x71, 0x75,
-	0x65, 0x73, 0x74, 0x48, 0x00, 0x52, 0x07, 0x73, 0x65, 0x74, 0x4c, 0x65, 0x64, 0x73, 0x42, 0x09,
-	0x0a, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x22, 0xd1, 0x01, 0x0a, 0x10, 0x4c, 0x45,
-	0x44, 0x53, 0x65, 0x72, 0x76, 0x65, 0x72, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x54,
-	0x0a, 0x13, 0x67, 0x65, 0x74, 0x5f, 0x6c, 0x65, 0x64, 0x5f, 0x63, 0x61, 0x6e, 0x76, 0x61, 0x73,
-	0x5f, 0x69, 0x6e, 0x66, 0x6f, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x23, 0x2e, 0x63, 0x68,
-	0x72, 0x69, 0x73, 0x74, 0x6d, 0x61, 0x73, 0x2e, 0x47, 0x65, 0x74, 0x4c, 0x45, 0x44, 0x43, 0x61,
-	0x6e, 0x76, 0x61, 0x73, 0x49, 0x6e, 0x66, 0x6f, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
-	0x48, 0x00, 0x52, 0x10, 0x67, 0x65, 0x74, 0x4c, 0x65, 0x64, 0x43, 0x61, 0x6e, 0x76, 0x61, 0x73,
-	0x49, 0x6e, 0x66, 0x6f, 0x12, 0x37, 0x0a, 0x08, 0x67, 0x65, 0x74, 0x5f, 0x6c, 0x65, 0x64, 0x73,
-	0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x63, 0x68, 0x72, 0x69, 0x73, 0x74, 0x6d,
-	0x61, 0x73, 0x2e, 0x47, 0x65, 0x74, 0x4c, 0x45, 0x44, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e,
-	0x73, 0x65, 0x48, 0x00, 0x52, 0x07, 0x67, 0x65, 0x74, 0x4c, 0x65, 0x64, 0x73, 0x12, 0x19, 0x0a,
-	0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x18, 0x64, 0x20, 0x01, 0x28, 0x09, 0x48, 0x01, 0x52, 0x05,
-	0x65, 0x72, 0x72, 0x6f, 0x72, 0x88, 0x01, 0x01, 0x42, 0x09, 0x0a, 0x07, 0x6d, 0x65, 0x73, 0x73,
-	0x61, 0x67, 0x65, 0x42, 0x08, 0x0a, 0x06, 0x5f, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x22, 0x10, 0x0a,
-	0x0e, 0x47, 0x65, 0x74, 0x4c, 0x45, 0x44, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x22,
-	0x25, 0x0a, 0x0f, 0x47, 0x65, 0x74, 0x4c, 0x45, 0x44, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e,
-	0x73, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x6c, 0x65, 0x64, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x07,
-	0x52, 0x04, 0x6c, 0x65, 0x64, 0x73, 0x22, 0x24, 0x0a, 0x0e, 0x53, 0x65, 0x74, 0x4c, 0x45, 0x44,
-	0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x6c, 0x65, 0x64, 0x73,
-	0x18, 0x01, 0x20, 0x03, 0x28, 0x07, 0x52, 0x04, 0x6c, 0x65, 0x64, 0x73, 0x22, 0x19, 0x0a, 0x17,
-	0x47, 0x65, 0x74, 0x4c, 0x45, 0x44, 0x43, 0x61, 0x6e, 0x76, 0x61, 0x73, 0x49, 0x6e, 0x66, 0x6f,
-	0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x22, 0x48, 0x0a, 0x18, 0x47, 0x65, 0x74, 0x4c, 0x45,
-	0x44, 0x43, 0x61, 0x6e, 0x76, 0x61, 0x73, 0x49, 0x6e, 0x66, 0x6f, 0x52, 0x65, 0x73, 0x70, 0x6f,
-	0x6e, 0x73, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x77, 0x69, 0x64, 0x74, 0x68, 0x18, 0x01, 0x20, 0x01,
-	0x28, 0x0d, 0x52, 0x05, 0x77, 0x69, 0x64, 0x74, 0x68, 0x12, 0x16, 0x0a, 0x06, 0x68, 0x65, 0x69,
-	0x67, 0x68, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x06, 0x68, 0x65, 0x69, 0x67, 0x68,
-	0x74, 0x22, 0x44, 0x0a, 0x13, 0x53, 0x65, 0x74, 0x4c, 0x45, 0x44, 0x43, 0x61, 0x6e, 0x76, 0x61,
-	0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x2d, 0x0a, 0x06, 0x70, 0x69, 0x78, 0x65,
-	0x6c, 0x73, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x15, 0x2e, 0x63, 0x68, 0x72, 0x69, 0x73,
-	0x74, 0x6d, 0x61, 0x73, 0x2e, 0x52, 0x47, 0x42, 0x41, 0x50, 0x69, 0x78, 0x65, 0x6c, 0x73, 0x52,
-	0x06, 0x70, 0x69, 0x78, 0x65, 0x6c, 0x73, 0x22, 0x24, 0x0a, 0x0a, 0x52, 0x47, 0x42, 0x41, 0x50,
-	0x69, 0x78, 0x65, 0x6c, 0x73, 0x12, 0x16, 0x0a, 0x06, 0x70, 0x69, 0x78, 0x65, 0x6c, 0x73, 0x18,
-	0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x06, 0x70, 0x69, 0x78, 0x65, 0x6c, 0x73, 0x42, 0x35, 0x5a,
-	0x33, 0x6c, 0x69, 0x62, 0x64, 0x62, 0x2e, 0x73, 0x6f, 0x2f, 0x61, 0x63, 0x6d, 0x2d, 0x63, 0x68,
-	0x72, 0x69, 0x73, 0x74, 0x6d, 0x61, 0x73, 0x2f, 0x6c, 0x69, 0x62, 0x2f, 0x63, 0x68, 0x72, 0x69,
-	0x73, 0x74, 0x6d, 0x61, 0x73, 0x2f, 0x67, 0x6f, 0x2f, 0x63, 0x68, 0x72, 0x69, 0x73, 0x74, 0x6d,
-	0x61, 0x73, 0x70, 0x62, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x65, 0x73, 0x74, 0x48, 0x00, 0x52, 0x07, 0x73, 0x65, 0x74, 0x4c, 0x65, 0x64, 0x73, 0x12, 0x49,
+	0x0a, 0x0f, 0x67, 0x65, 0x74, 0x5f, 0x66, 0x72, 0x61, 0x6d, 0x65, 0x5f, 0x73, 0x74, 0x61, 0x74,
+	0x73, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1f, 0x2e, 0x63, 0x68, 0x72, 0x69, 0x73, 0x74,
+	0x6d, 0x61, 0x73, 0x2e, 0x47, 0x65, 0x74, 0x46, 0x72, 0x61, 0x6d, 0x65, 0x53, 0x74, 0x61, 0x74,
+	0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x48, 0x00, 0x52, 0x0d, 0x67, 0x65, 0x74, 0x46,
+	0x72, 0x61, 0x6d, 0x65, 0x53, 0x74, 0x61, 0x74, 0x73, 0x42, 0x09, 0x0a, 0x07, 0x6d, 0x65, 0x73,
+	0x73, 0x61, 0x67, 0x65, 0x22, 0x97, 0x03, 0x0a, 0x10, 0x4c, 0x45, 0x44, 0x53, 0x65, 0x72, 0x76,
+	0x65, 0x72, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x54, 0x0a, 0x13, 0x67, 0x65, 0x74,
+	0x5f, 0x6c, 0x65, 0x64, 0x5f, 0x63, 0x61, 0x6e, 0x76, 0x61, 0x73, 0x5f, 0x69, 0x6e, 0x66, 0x6f,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x23, 0x2e, 0x63, 0x68, 0x72, 0x69, 0x73, 0x74, 0x6d,
+	0x61, 0x73, 0x2e, 0x47, 0x65, 0x74, 0x4c, 0x45, 0x44, 0x43, 0x61, 0x6e, 0x76, 0x61, 0x73, 0x49,
+	0x6e, 0x66, 0x6f, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x48, 0x00, 0x52, 0x10, 0x67,
+	0x65, 0x74, 0x4c, 0x65, 0x64, 0x43, 0x61, 0x6e, 0x76, 0x61, 0x73, 0x49, 0x6e, 0x66, 0x6f, 0x12,
+	0x37, 0x0a, 0x08, 0x67, 0x65, 0x74, 0x5f, 0x6c, 0x65, 0x64, 0x73, 0x18, 0x03, 0x20, 0x01, 0x28,
+	0x0b, 0x32, 0x1a, 0x2e, 0x63, 0x68, 0x72, 0x69, 0x73, 0x74, 0x6d, 0x61, 0x73, 0x2e, 0x47, 0x65,
+	0x74, 0x4c, 0x45, 0x44, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x48, 0x00, 0x52,
+	0x07, 0x67, 0x65, 0x74, 0x4c, 0x65, 0x64, 0x73, 0x12, 0x4a, 0x0a, 0x0f, 0x67, 0x65, 0x74, 0x5f,
+	0x66, 0x72, 0x61, 0x6d, 0x65, 0x5f, 0x73, 0x74, 0x61, 0x74, 0x73, 0x18, 0x04, 0x20, 0x01, 0x28,
+	0x0b, 0x32, 0x20, 0x2e, 0x63, 0x68, 0x72, 0x69, 0x73, 0x74, 0x6d, 0x61, 0x73, 0x2e, 0x47, 0x65,
+	0x74, 0x46, 0x72, 0x61, 0x6d, 0x65, 0x53, 0x74, 0x61, 0x74, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f,
+	0x6e, 0x73, 0x65, 0x48, 0x00, 0x52, 0x0d, 0x67, 0x65, 0x74, 0x46, 0x72, 0x61, 0x6d, 0x65, 0x53,
+	0x74, 0x61, 0x74, 0x73, 0x12, 0x46, 0x0a, 0x0e, 0x63, 0x61, 0x6e, 0x76, 0x61, 0x73, 0x5f, 0x63,
+	0x68, 0x61, 0x6e, 0x67, 0x65, 0x64, 0x18, 0x32, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1d, 0x2e, 0x63,
+	0x68, 0x72, 0x69, 0x73, 0x74, 0x6d, 0x61, 0x73, 0x2e, 0x43, 0x61, 0x6e, 0x76, 0x61, 0x73, 0x43,
+	0x68, 0x61, 0x6e, 0x67, 0x65, 0x64, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x48, 0x00, 0x52, 0x0d, 0x63,
+	0x61, 0x6e, 0x76, 0x61, 0x73, 0x43, 0x68, 0x61, 0x6e, 0x67, 0x65, 0x64, 0x12, 0x30, 0x0a, 0x06,
+	0x6e, 0x6f, 0x74, 0x69, 0x63, 0x65, 0x18, 0x33, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x16, 0x2e, 0x63,
+	0x68, 0x72, 0x69, 0x73, 0x74, 0x6d, 0x61, 0x73, 0x2e, 0x4e, 0x6f, 0x74, 0x69, 0x63, 0x65, 0x45,
+	0x76, 0x65, 0x6e, 0x74, 0x48, 0x00, 0x52, 0x06, 0x6e, 0x6f, 0x74, 0x69, 0x63, 0x65, 0x12, 0x19,
+	0x0a, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x18, 0x64, 0x20, 0x01, 0x28, 0x09, 0x48, 0x01, 0x52,
+	0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x88, 0x01, 0x01, 0x42, 0x09, 0x0a, 0x07, 0x6d, 0x65, 0x73,
+	0x73, 0x61, 0x67, 0x65, 0x42, 0x08, 0x0a, 0x06, 0x5f, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x22, 0x10,
+	0x0a, 0x0e, 0x47, 0x65, 0x74, 0x4c, 0x45, 0x44, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
+	0x22, 0x25, 0x0a, 0x0f, 0x47, 0x65, 0x74, 0x4c, 0x45, 0x44, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f,
+	0x6e, 0x73, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x6c, 0x65, 0x64, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28,
+	0x07, 0x52, 0x04, 0x6c, 0x65, 0x64, 0x73, 0x22, 0x24, 0x0a, 0x0e, 0x53, 0x65, 0x74, 0x4c, 0x45,
+	0x44, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x6c, 0x65, 0x64,
+	0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x07, 0x52, 0x04, 0x6c, 0x65, 0x64, 0x73, 0x22, 0x19, 0x0a,
+	0x17, 0x47, 0x65, 0x74, 0x4c, 0x45, 0x44, 0x43, 0x61, 0x6e, 0x76, 0x61, 0x73, 0x49, 0x6e, 0x66,
+	0x6f, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x22, 0x48, 0x0a, 0x18, 0x47, 0x65, 0x74, 0x4c,
+	0x45, 0x44, 0x43, 0x61, 0x6e, 0x76, 0x61, 0x73, 0x49, 0x6e, 0x66, 0x6f, 0x52, 0x65, 0x73, 0x70,
+	0x6f, 0x6e, 0x73, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x77, 0x69, 0x64, 0x74, 0x68, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x0d, 0x52, 0x05, 0x77, 0x69, 0x64, 0x74, 0x68, 0x12, 0x16, 0x0a, 0x06, 0x68, 0x65,
+	0x69, 0x67, 0x68, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x06, 0x68, 0x65, 0x69, 0x67,
+	0x68, 0x74, 0x22, 0x5d, 0x0a, 0x12, 0x43, 0x61, 0x6e, 0x76, 0x61, 0x73, 0x43, 0x68, 0x61, 0x6e,
+	0x67, 0x65, 0x64, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x12, 0x14, 0x0a, 0x05, 0x77, 0x69, 0x64, 0x74,
+	0x68, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x05, 0x77, 0x69, 0x64, 0x74, 0x68, 0x12, 0x16,
+	0x0a, 0x06, 0x68, 0x65, 0x69, 0x67, 0x68, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x06,
+	0x68, 0x65, 0x69, 0x67, 0x68, 0x74, 0x12, 0x19, 0x0a, 0x08, 0x6e, 0x75, 0x6d, 0x5f, 0x6c, 0x65,
+	0x64, 0x73, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x07, 0x6e, 0x75, 0x6d, 0x4c, 0x65, 0x64,
+	0x73, 0x22, 0xa3, 0x01, 0x0a, 0x0b, 0x4e, 0x6f, 0x74, 0x69, 0x63, 0x65, 0x45, 0x76, 0x65, 0x6e,
+	0x74, 0x12, 0x29, 0x0a, 0x04, 0x6b, 0x69, 0x6e, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32,
+	0x15, 0x2e, 0x63, 0x68, 0x72, 0x69, 0x73, 0x74, 0x6d, 0x61, 0x73, 0x2e, 0x4e, 0x6f, 0x74, 0x69,
+	0x63, 0x65, 0x4b, 0x69, 0x6e, 0x64, 0x52, 0x04, 0x6b, 0x69, 0x6e, 0x64, 0x12, 0x18, 0x0a, 0x07,
+	0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x6d,
+	0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x28, 0x0a, 0x10, 0x64, 0x65, 0x61, 0x64, 0x6c, 0x69,
+	0x6e, 0x65, 0x5f, 0x75, 0x6e, 0x69, 0x78, 0x5f, 0x6d, 0x73, 0x18, 0x03, 0x20, 0x01, 0x28, 0x03,
+	0x52, 0x0e, 0x64, 0x65, 0x61, 0x64, 0x6c, 0x69, 0x6e, 0x65, 0x55, 0x6e, 0x69, 0x78, 0x4d, 0x73,
+	0x12, 0x25, 0x0a, 0x0e, 0x71, 0x75, 0x65, 0x75, 0x65, 0x5f, 0x70, 0x6f, 0x73, 0x69, 0x74, 0x69,
+	0x6f, 0x6e, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0d, 0x71, 0x75, 0x65, 0x75, 0x65, 0x50,
+	0x6f, 0x73, 0x69, 0x74, 0x69, 0x6f, 0x6e, 0x22, 0x16, 0x0a, 0x14, 0x47, 0x65, 0x74, 0x46, 0x72,
+	0x61, 0x6d, 0x65, 0x53, 0x74, 0x61, 0x74, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x22,
+	0xce, 0x02, 0x0a, 0x15, 0x47, 0x65, 0x74, 0x46, 0x72, 0x61, 0x6d, 0x65, 0x53, 0x74, 0x61, 0x74,
+	0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x1c, 0x0a, 0x09, 0x61, 0x76, 0x61,
+	0x69, 0x6c, 0x61, 0x62, 0x6c, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x08, 0x52, 0x09, 0x61, 0x76,
+	0x61, 0x69, 0x6c, 0x61, 0x62, 0x6c, 0x65, 0x12, 0x2a, 0x0a, 0x11, 0x74, 0x61, 0x72, 0x67, 0x65,
+	0x74, 0x5f, 0x66, 0x72, 0x61, 0x6d, 0x65, 0x5f, 0x72, 0x61, 0x74, 0x65, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x01, 0x52, 0x0f, 0x74, 0x61, 0x72, 0x67, 0x65, 0x74, 0x46, 0x72, 0x61, 0x6d, 0x65, 0x52,
+	0x61, 0x74, 0x65, 0x12, 0x1d, 0x0a, 0x0a, 0x66, 0x72, 0x61, 0x6d, 0x65, 0x5f, 0x72, 0x61, 0x74,
+	0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x01, 0x52, 0x09, 0x66, 0x72, 0x61, 0x6d, 0x65, 0x52, 0x61,
+	0x74, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x66, 0x72, 0x61, 0x6d, 0x65, 0x73, 0x18, 0x04, 0x20, 0x01,
+	0x28, 0x04, 0x52, 0x06, 0x66, 0x72, 0x61, 0x6d, 0x65, 0x73, 0x12, 0x1c, 0x0a, 0x09, 0x63, 0x6f,
+	0x61, 0x6c, 0x65, 0x73, 0x63, 0x65, 0x64, 0x18, 0x05, 0x20, 0x01, 0x28, 0x04, 0x52, 0x09, 0x63,
+	0x6f, 0x61, 0x6c, 0x65, 0x73, 0x63, 0x65, 0x64, 0x12, 0x26, 0x0a, 0x0f, 0x6c, 0x61, 0x74, 0x65,
+	0x6e, 0x63, 0x79, 0x5f, 0x6d, 0x65, 0x61, 0x6e, 0x5f, 0x75, 0x73, 0x18, 0x06, 0x20, 0x01, 0x28,
+	0x03, 0x52, 0x0d, 0x6c, 0x61, 0x74, 0x65, 0x6e, 0x63, 0x79, 0x4d, 0x65, 0x61, 0x6e, 0x55, 0x73,
+	0x12, 0x24, 0x0a, 0x0e, 0x6c, 0x61, 0x74, 0x65, 0x6e, 0x63, 0x79, 0x5f, 0x6d, 0x61, 0x78, 0x5f,
+	0x75, 0x73, 0x18, 0x07, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0c, 0x6c, 0x61, 0x74, 0x65, 0x6e, 0x63,
+	0x79, 0x4d, 0x61, 0x78, 0x55, 0x73, 0x12, 0x24, 0x0a, 0x0e, 0x6a, 0x69, 0x74, 0x74, 0x65, 0x72,
+	0x5f, 0x6d, 0x65, 0x61, 0x6e, 0x5f, 0x75, 0x73, 0x18, 0x08, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0c,
+	0x6a, 0x69, 0x74, 0x74, 0x65, 0x72, 0x4d, 0x65, 0x61, 0x6e, 0x55, 0x73, 0x12, 0x22, 0x0a, 0x0d,
+	0x6a, 0x69, 0x74, 0x74, 0x65, 0x72, 0x5f, 0x6d, 0x61, 0x78, 0x5f, 0x75, 0x73, 0x18, 0x09, 0x20,
+	0x01, 0x28, 0x03, 0x52, 0x0b, 0x6a, 0x69, 0x74, 0x74, 0x65, 0x72, 0x4d, 0x61, 0x78, 0x55, 0x73,
+	0x22, 0x44, 0x0a, 0x13, 0x53, 0x65, 0x74, 0x4c, 0x45, 0x44, 0x43, 0x61, 0x6e, 0x76, 0x61, 0x73,
+	0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x2d, 0x0a, 0x06, 0x70, 0x69, 0x78, 0x65, 0x6c,
+	0x73, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x15, 0x2e, 0x63, 0x68, 0x72, 0x69, 0x73, 0x74,
+	0x6d, 0x61, 0x73, 0x2e, 0x52, 0x47, 0x42, 0x41, 0x50, 0x69, 0x78, 0x65, 0x6c, 0x73, 0x52, 0x06,
+	0x70, 0x69, 0x78, 0x65, 0x6c, 0x73, 0x22, 0x24, 0x0a, 0x0a, 0x52, 0x47, 0x42, 0x41, 0x50, 0x69,
+	0x78, 0x65, 0x6c, 0x73, 0x12, 0x16, 0x0a, 0x06, 0x70, 0x69, 0x78, 0x65, 0x6c, 0x73, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x0c, 0x52, 0x06, 0x70, 0x69, 0x78, 0x65, 0x6c, 0x73, 0x2a, 0x71, 0x0a, 0x0a,
+	0x4e, 0x6f, 0x74, 0x69, 0x63, 0x65, 0x4b, 0x69, 0x6e, 0x64, 0x12, 0x0f, 0x0a, 0x0b, 0x4e, 0x4f,
+	0x54, 0x49, 0x43, 0x45, 0x5f, 0x49, 0x4e, 0x46, 0x4f, 0x10, 0x00, 0x12, 0x11, 0x0a, 0x0d, 0x4e,
+	0x4f, 0x54, 0x49, 0x43, 0x45, 0x5f, 0x4b, 0x49, 0x43, 0x4b, 0x45, 0x44, 0x10, 0x01, 0x12, 0x15,
+	0x0a, 0x11, 0x4e, 0x4f, 0x54, 0x49, 0x43, 0x45, 0x5f, 0x54, 0x49, 0x4d, 0x45, 0x5f, 0x4c, 0x49,
+	0x4d, 0x49, 0x54, 0x10, 0x02, 0x12, 0x16, 0x0a, 0x12, 0x4e, 0x4f, 0x54, 0x49, 0x43, 0x45, 0x5f,
+	0x4d, 0x41, 0x49, 0x4e, 0x54, 0x45, 0x4e, 0x41, 0x4e, 0x43, 0x45, 0x10, 0x03, 0x12, 0x10, 0x0a,
+	0x0c, 0x4e, 0x4f, 0x54, 0x49, 0x43, 0x45, 0x5f, 0x51, 0x55, 0x45, 0x55, 0x45, 0x10, 0x04, 0x42,
+	0x35, 0x5a, 0x33, 0x6c, 0x69, 0x62, 0x64, 0x62, 0x2e, 0x73, 0x6f, 0x2f, 0x61, 0x63, 0x6d, 0x2d,
+	0x63, 0x68, 0x72, 0x69, 0x73, 0x74, 0x6d, 0x61, 0x73, 0x2f, 0x6c, 0x69, 0x62, 0x2f, 0x63, 0x68,
+	0x72, 0x69, 0x73, 0x74, 0x6d, 0x61, 0x73, 0x2f, 0x67, 0x6f, 0x2f, 0x63, 0x68, 0x72, 0x69, 0x73,
+	0x74, 0x6d, 0x61, 0x73, 0x70, 0x62, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -636,31 +1125,42 @@ func file_christmas_proto_rawDescGZIP() []byte {
 	return file_christmas_proto_rawDescData
 }
 
-var file_christmas_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
+var file_christmas_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_christmas_proto_msgTypes = make([]protoimpl.MessageInfo, 13)
 var file_christmas_proto_goTypes = []interface{}{
-	(*LEDClientMessage)(nil),         // 0: christmas.LEDClientMessage
-	(*LEDServerMessage)(nil),         // 1: christmas.LEDServerMessage
-	(*GetLEDsRequest)(nil),           // 2: christmas.GetLEDsRequest
-	(*GetLEDsResponse)(nil),          // 3: christmas.GetLEDsResponse
-	(*SetLEDsRequest)(nil),           // 4: christmas.SetLEDsRequest
-	(*GetLEDCanvasInfoRequest)(nil),  // 5: christmas.GetLEDCanvasInfoRequest
-	(*GetLEDCanvasInfoResponse)(nil), // 6: christmas.GetLEDCanvasInfoResponse
-	(*SetLEDCanvasRequest)(nil),      // 7: christmas.SetLEDCanvasRequest
-	(*RGBAPixels)(nil),               // 8: christmas.RGBAPixels
+	(NoticeKind)(0),                  // 0: christmas.NoticeKind
+	(*LEDClientMessage)(nil),         // 1: christmas.LEDClientMessage
+	(*LEDServerMessage)(nil),         // 2: christmas.LEDServerMessage
+	(*GetLEDsRequest)(nil),           // 3: christmas.GetLEDsRequest
+	(*GetLEDsResponse)(nil),          // 4: christmas.GetLEDsResponse
+	(*SetLEDsRequest)(nil),           // 5: christmas.SetLEDsRequest
+	(*GetLEDCanvasInfoRequest)(nil),  // 6: christmas.GetLEDCanvasInfoRequest
+	(*GetLEDCanvasInfoResponse)(nil), // 7: christmas.GetLEDCanvasInfoResponse
+	(*CanvasChangedEvent)(nil),       // 8: christmas.CanvasChangedEvent
+	(*NoticeEvent)(nil),              // 9: christmas.NoticeEvent
+	(*GetFrameStatsRequest)(nil),     // 10: christmas.GetFrameStatsRequest
+	(*GetFrameStatsResponse)(nil),    // 11: christmas.GetFrameStatsResponse
+	(*SetLEDCanvasRequest)(nil),      // 12: christmas.SetLEDCanvasRequest
+	(*RGBAPixels)(nil),               // 13: christmas.RGBAPixels
 }
 var file_christmas_proto_depIdxs = []int32{
-	5, // 0: christmas.LEDClientMessage.get_led_canvas_info:type_name -> christmas.GetLEDCanvasInfoRequest
-	7, // 1: christmas.LEDClientMessage.set_led_canvas:type_name -> christmas.SetLEDCanvasRequest
-	2, // 2: christmas.LEDClientMessage.get_leds:type_name -> christmas.GetLEDsRequest
-	4, // 3: christmas.LEDClientMessage.set_leds:type_name -> christmas.SetLEDsRequest
-	6, // 4: christmas.LEDServerMessage.get_led_canvas_info:type_name -> christmas.GetLEDCanvasInfoResponse
-	3, // 5: christmas.LEDServerMessage.get_leds:type_name -> christmas.GetLEDsResponse
-	8, // 6: christmas.SetLEDCanvasRequest.pixels:type_name -> christmas.RGBAPixels
-	7, // [7:7] is the sub-list for method output_type
-	7, // [7:7] is the sub-list for method input_type
-	7, // [7:7] is the sub-list for extension type_name
-	7, // [7:7] is the sub-list for extension extendee
-	0, // [0:7] is the sub-list for field type_name
+	6,  // 0: christmas.LEDClientMessage.get_led_canvas_info:type_name -> christmas.GetLEDCanvasInfoRequest
+	12, // 1: christmas.LEDClientMessage.set_led_canvas:type_name -> christmas.SetLEDCanvasRequest
+	3,  // 2: christmas.LEDClientMessage.get_leds:type_name -> christmas.GetLEDsRequest
+	5,  // 3: christmas.LEDClientMessage.set_leds:type_name -> christmas.SetLEDsRequest
+	10, // 4: christmas.LEDClientMessage.get_frame_stats:type_name -> christmas.GetFrameStatsRequest
+	7,  // 5: christmas.LEDServerMessage.get_led_canvas_info:type_name -> christmas.GetLEDCanvasInfoResponse
+	4,  // 6: christmas.LEDServerMessage.get_leds:type_name -> christmas.GetLEDsResponse
+	11, // 7: christmas.LEDServerMessage.get_frame_stats:type_name -> christmas.GetFrameStatsResponse
+	8,  // 8: christmas.LEDServerMessage.canvas_changed:type_name -> christmas.CanvasChangedEvent
+	9,  // 9: christmas.LEDServerMessage.notice:type_name -> christmas.NoticeEvent
+	0,  // 10: christmas.NoticeEvent.kind:type_name -> christmas.NoticeKind
+	13, // 11: christmas.SetLEDCanvasRequest.pixels:type_name -> christmas.RGBAPixels
+	12, // [12:12] is the sub-list for method output_type
+	12, // [12:12] is the sub-list for method input_type
+	12, // [12:12] is the sub-list for extension type_name
+	12, // [12:12] is the sub-list for extension extendee
+	0,  // [0:12] is the sub-list for field type_name
 }
 
 func init() { file_christmas_proto_init() }
@@ -754,7 +1254,7 @@ func file_christmas_proto_init() {
 			}
 		}
 		file_christmas_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*SetLEDCanvasRequest); i {
+			switch v := v.(*CanvasChangedEvent); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -766,6 +1266,54 @@ func file_christmas_proto_init() {
 			}
 		}
 		file_christmas_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*NoticeEvent); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_christmas_proto_msgTypes[9].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*GetFrameStatsRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_christmas_proto_msgTypes[10].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*GetFrameStatsResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_christmas_proto_msgTypes[11].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SetLEDCanvasRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_christmas_proto_msgTypes[12].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*RGBAPixels); i {
 			case 0:
 				return &v.state
@@ -783,23 +1331,28 @@ func file_christmas_proto_init() {
 		(*LEDClientMessage_SetLedCanvas)(nil),
 		(*LEDClientMessage_GetLeds)(nil),
 		(*LEDClientMessage_SetLeds)(nil),
+		(*LEDClientMessage_GetFrameStats)(nil),
 	}
 	file_christmas_proto_msgTypes[1].OneofWrappers = []interface{}{
 		(*LEDServerMessage_GetLedCanvasInfo)(nil),
 		(*LEDServerMessage_GetLeds)(nil),
+		(*LEDServerMessage_GetFrameStats)(nil),
+		(*LEDServerMessage_CanvasChanged)(nil),
+		(*LEDServerMessage_Notice)(nil),
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_christmas_proto_rawDesc,
-			NumEnums:      0,
-			NumMessages:   9,
+			NumEnums:      1,
+			NumMessages:   13,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
 		GoTypes:           file_christmas_proto_goTypes,
 		DependencyIndexes: file_christmas_proto_depIdxs,
+		EnumInfos:         file_christmas_proto_enumTypes,
 		MessageInfos:      file_christmas_proto_msgTypes,
 	}.Build()
 	File_christmas_proto = out.File
@@ -0,0 +1,483 @@
+package christmasd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log/slog"
+	"net"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"dev.acmcsuf.com/christmas/lib/leddraw"
+	"dev.acmcsuf.com/christmas/lib/xcolor"
+	"dev.acmcsuf.com/christmasd/christmaspb"
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrClientClosed is returned by Client methods after the connection has been
+// closed.
+var ErrClientClosed = errors.New("client closed")
+
+// ErrKicked is returned by Client methods after the server kicked the client.
+// The error wraps both ErrKicked and ErrClientClosed, and has the reason that
+// the server gave.
+var ErrKicked = errors.New("kicked by the server")
+
+// ClientOpts are options for a client.
+type ClientOpts struct {
+	// Logger is the logger to use for the client.
+	Logger *slog.Logger
+	// Dialer is the Websocket dialer to use for the client.
+	Dialer ws.Dialer
+	// OnNotice, if not nil, is called with the notices that the server sends,
+	// e.g. why the client is about to be kicked. It is called from the
+	// goroutine that reads messages, so it must not block. If nil, notices are
+	// logged.
+	OnNotice func(Notice)
+}
+
+// Client is a Websocket client for a christmasd server. It implements
+// LEDController, so a remote server can be used wherever a local controller
+// can.
+type Client struct {
+	conn     net.Conn
+	logger   *slog.Logger
+	onNotice func(Notice)
+
+	// replies receives responses to requests. Requests are serialized using
+	// reqMu, so there is at most one reply pending at a time.
+	replies chan *christmaspb.LEDServerMessage
+	reqMu   sync.Mutex
+	// abandoned is the number of replies still to come for requests that
+	// were given up on. The server replies in order, so they come before the
+	// reply to any later request, and readLoop drops them.
+	abandoned int
+	replyMu   sync.Mutex
+
+	writeMu sync.Mutex
+	done    chan struct{}
+	err     error // only read after done is closed
+	closing atomic.Bool
+	kicked  *Notice // only used by readLoop
+
+	ledsMu sync.Mutex
+	leds   leddraw.LEDStrip
+	pbLEDs []uint32
+	width  int
+	height int
+}
+
+var _ LEDController = (*Client)(nil)
+
+// Dial connects to the christmasd server at the given Websocket URL.
+func Dial(ctx context.Context, url string, opts ClientOpts) (*Client, error) {
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+
+	conn, br, _, err := opts.Dialer.Dial(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial: %w", err)
+	}
+
+	var r io.Reader = conn
+	if br != nil {
+		r = br
+	}
+
+	c := &Client{
+		conn:     conn,
+		logger:   opts.Logger.With("url", url),
+		onNotice: opts.OnNotice,
+		replies:  make(chan *christmaspb.LEDServerMessage, 1),
+		done:     make(chan struct{}),
+	}
+
+	go c.readLoop(r, br)
+
+	w, h, err := c.GetLEDCanvasInfo(ctx)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	leds, err := c.GetLEDs(ctx)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	c.ledsMu.Lock()
+	c.width = w
+	c.height = h
+	c.leds = leds
+	c.ledsMu.Unlock()
+
+	return c, nil
+}
+
+func (c *Client) readLoop(r io.Reader, br *bufio.Reader) {
+	defer close(c.done)
+
+	if br != nil {
+		defer ws.PutReader(br)
+	}
+
+	rw := struct {
+		io.Reader
+		io.Writer
+	}{r, writerFunc(c.writeRaw)}
+
+	for {
+		b, err := wsutil.ReadServerBinary(rw)
+		if err != nil {
+			var closedErr wsutil.ClosedError
+			if errors.As(err, &closedErr) || c.closing.Load() {
+				err = ErrClientClosed
+				switch {
+				case c.kicked != nil && c.kicked.Message != "":
+					err = fmt.Errorf("%w: %w: %s", ErrClientClosed, ErrKicked, c.kicked.Message)
+				case c.kicked != nil:
+					err = fmt.Errorf("%w: %w", ErrClientClosed, ErrKicked)
+				}
+			}
+			c.err = err
+			c.conn.Close()
+			return
+		}
+
+		msg := &christmaspb.LEDServerMessage{}
+		if err := proto.Unmarshal(b, msg); err != nil {
+			c.err = fmt.Errorf("invalid message from server: %w", err)
+			c.conn.Close()
+			return
+		}
+
+		if msg.Error != nil {
+			c.err = fmt.Errorf("server error: %s", msg.GetError())
+			c.conn.Close()
+			return
+		}
+
+		if event := msg.GetCanvasChanged(); event != nil {
+			c.canvasChanged(event)
+			continue
+		}
+
+		if event := msg.GetNotice(); event != nil {
+			c.notice(noticeFromProto(event))
+			continue
+		}
+
+		c.reply(msg)
+	}
+}
+
+func (c *Client) reply(msg *christmaspb.LEDServerMessage) {
+	c.replyMu.Lock()
+	defer c.replyMu.Unlock()
+
+	if c.abandoned > 0 {
+		c.abandoned--
+		c.logger.Debug(
+			"dropping reply to an abandoned request",
+			"message", msg.String())
+		return
+	}
+
+	select {
+	case c.replies <- msg:
+	default:
+		c.logger.Warn(
+			"dropping unexpected message from server",
+			"message", msg.String())
+	}
+}
+
+// abandon gives up on the reply to the current request, so that it is not
+// taken as the reply to the next one.
+func (c *Client) abandon() {
+	c.replyMu.Lock()
+	defer c.replyMu.Unlock()
+
+	select {
+	case <-c.replies:
+		// The reply already came.
+	default:
+		c.abandoned++
+	}
+}
+
+func (c *Client) canvasChanged(event *christmaspb.CanvasChangedEvent) {
+	c.ledsMu.Lock()
+	defer c.ledsMu.Unlock()
+
+	leds := make(leddraw.LEDStrip, event.GetNumLeds())
+	copy(leds, c.leds)
+
+	c.leds = leds
+	c.width = int(event.GetWidth())
+	c.height = int(event.GetHeight())
+
+	c.logger.Info(
+		"server canvas changed",
+		"leds", len(c.leds),
+		"width", c.width,
+		"height", c.height)
+}
+
+func (c *Client) notice(notice Notice) {
+	if notice.Kind == NoticeKicked {
+		c.kicked = &notice
+	}
+
+	if c.onNotice != nil {
+		c.onNotice(notice)
+		return
+	}
+
+	attrs := []any{
+		"kind", notice.Kind,
+		"message", notice.Message,
+	}
+	if !notice.Deadline.IsZero() {
+		attrs = append(attrs, "deadline", notice.Deadline)
+	}
+	if notice.Kind == NoticeQueue {
+		attrs = append(attrs, "queue_position", notice.QueuePosition)
+	}
+	c.logger.Warn("notice from server", attrs...)
+}
+
+type writerFunc func([]byte) (int, error)
+
+func (f writerFunc) Write(b []byte) (int, error) { return f(b) }
+
+func (c *Client) writeRaw(b []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	return c.conn.Write(b)
+}
+
+// Err returns the error that caused the connection to close, or nil if the
+// connection is still open.
+func (c *Client) Err() error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+		return nil
+	}
+}
+
+// Done returns a channel that is closed when the connection is closed.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	c.closing.Store(true)
+
+	c.writeMu.Lock()
+	ws.WriteFrame(c.conn, ws.MaskFrame(ws.NewCloseFrame(
+		ws.NewCloseFrameBody(ws.StatusNormalClosure, ""))))
+	c.writeMu.Unlock()
+
+	err := c.conn.Close()
+	<-c.done
+	return err
+}
+
+func (c *Client) send(msg *christmaspb.LEDClientMessage) error {
+	if err := c.Err(); err != nil {
+		return err
+	}
+
+	b, err := proto.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if err := wsutil.WriteClientBinary(c.conn, b); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Client) request(ctx context.Context, msg *christmaspb.LEDClientMessage) (*christmaspb.LEDServerMessage, error) {
+	c.reqMu.Lock()
+	defer c.reqMu.Unlock()
+
+	if err := c.send(msg); err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-ctx.Done():
+		c.abandon()
+		return nil, ctx.Err()
+	case <-c.done:
+		return nil, c.err
+	case reply := <-c.replies:
+		return reply, nil
+	}
+}
+
+// GetLEDCanvasInfo returns the size of the LED canvas from the server.
+func (c *Client) GetLEDCanvasInfo(ctx context.Context) (w, h int, err error) {
+	reply, err := c.request(ctx, &christmaspb.LEDClientMessage{
+		Message: &christmaspb.LEDClientMessage_GetLedCanvasInfo{
+			GetLedCanvasInfo: &christmaspb.GetLEDCanvasInfoRequest{},
+		},
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	info := reply.GetGetLedCanvasInfo()
+	if info == nil {
+		return 0, 0, fmt.Errorf("unexpected reply from server: %v", reply)
+	}
+
+	return int(info.GetWidth()), int(info.GetHeight()), nil
+}
+
+// GetLEDs returns the current state of the LEDs from the server.
+func (c *Client) GetLEDs(ctx context.Context) (leddraw.LEDStrip, error) {
+	reply, err := c.request(ctx, &christmaspb.LEDClientMessage{
+		Message: &christmaspb.LEDClientMessage_GetLeds{
+			GetLeds: &christmaspb.GetLEDsRequest{},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	leds := reply.GetGetLeds()
+	if leds == nil {
+		return nil, fmt.Errorf("unexpected reply from server: %v", reply)
+	}
+
+	strip := make(leddraw.LEDStrip, len(leds.GetLeds()))
+	for i, led := range leds.GetLeds() {
+		strip[i] = xcolor.RGBFromUint(led)
+	}
+
+	return strip, nil
+}
+
+// ErrNoFrameStats is returned by GetFrameStats if the server does not measure
+// its frames.
+var ErrNoFrameStats = errors.New("server has no frame statistics")
+
+// GetFrameStats returns statistics about how the server writes out frames.
+func (c *Client) GetFrameStats(ctx context.Context) (FrameStats, error) {
+	reply, err := c.request(ctx, &christmaspb.LEDClientMessage{
+		Message: &christmaspb.LEDClientMessage_GetFrameStats{
+			GetFrameStats: &christmaspb.GetFrameStatsRequest{},
+		},
+	})
+	if err != nil {
+		return FrameStats{}, err
+	}
+
+	stats := reply.GetGetFrameStats()
+	if stats == nil {
+		return FrameStats{}, fmt.Errorf("unexpected reply from server: %v", reply)
+	}
+	if !stats.GetAvailable() {
+		return FrameStats{}, ErrNoFrameStats
+	}
+
+	return frameStatsFromProto(stats), nil
+}
+
+// LEDs implements LEDController. It returns a copy of the LEDs as they were
+// last fetched or set by this client. Use GetLEDs to fetch the current LEDs
+// from the server.
+func (c *Client) LEDs() leddraw.LEDStrip {
+	c.ledsMu.Lock()
+	defer c.ledsMu.Unlock()
+
+	return slices.Clone(c.leds)
+}
+
+// SetLEDs implements LEDController.
+func (c *Client) SetLEDs(strip leddraw.LEDStrip) error {
+	c.ledsMu.Lock()
+	defer c.ledsMu.Unlock()
+
+	if len(strip) != len(c.leds) {
+		return fmt.Errorf("invalid number of LEDs: %d, server has %d", len(strip), len(c.leds))
+	}
+
+	c.pbLEDs = c.pbLEDs[:0]
+	for _, led := range strip {
+		c.pbLEDs = append(c.pbLEDs, led.ToUint())
+	}
+
+	err := c.send(&christmaspb.LEDClientMessage{
+		Message: &christmaspb.LEDClientMessage_SetLeds{
+			SetLeds: &christmaspb.SetLEDsRequest{
+				Leds: c.pbLEDs,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	copy(c.leds, strip)
+	return nil
+}
+
+// ImageSize implements LEDController. It returns the canvas size that the
+// server last reported.
+func (c *Client) ImageSize() (w, h int) {
+	c.ledsMu.Lock()
+	defer c.ledsMu.Unlock()
+
+	return c.width, c.height
+}
+
+// DrawImage implements LEDController. The image must have the size returned
+// by ImageSize.
+func (c *Client) DrawImage(img *image.RGBA) error {
+	w, h := c.ImageSize()
+	if img.Rect.Dx() != w || img.Rect.Dy() != h {
+		return fmt.Errorf("invalid image size %dx%d, server wants %dx%d",
+			img.Rect.Dx(), img.Rect.Dy(), w, h)
+	}
+
+	pix := img.Pix
+	if img.Stride != w*4 || img.Rect.Min != (image.Point{}) {
+		// The image is a sub-image, so copy it into a packed one.
+		packed := image.NewRGBA(image.Rect(0, 0, w, h))
+		for y := 0; y < h; y++ {
+			i := img.PixOffset(img.Rect.Min.X, img.Rect.Min.Y+y)
+			copy(packed.Pix[y*packed.Stride:], img.Pix[i:i+w*4])
+		}
+		pix = packed.Pix
+	}
+
+	return c.send(&christmaspb.LEDClientMessage{
+		Message: &christmaspb.LEDClientMessage_SetLedCanvas{
+			SetLedCanvas: &christmaspb.SetLEDCanvasRequest{
+				Pixels: &christmaspb.RGBAPixels{Pixels: pix},
+			},
+		},
+	})
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// adminClient makes requests to the christmasd admin API.
+type adminClient struct {
+	base   *url.URL
+	client *http.Client
+	token  string
+	user   string // "user:password"
+}
+
+// newAdminClient creates a client for the admin API at addr, which is either
+// an HTTP URL or unix:///path for the admin socket.
+func newAdminClient(addr, token, user string) (*adminClient, error) {
+	if user != "" && !strings.Contains(user, ":") {
+		return nil, fmt.Errorf("invalid user %q, expected user:password", user)
+	}
+
+	c := &adminClient{
+		client: &http.Client{},
+		token:  token,
+		user:   user,
+	}
+
+	if path, ok := strings.CutPrefix(addr, "unix://"); ok {
+		c.base = &url.URL{Scheme: "http", Host: "christmasd"}
+		c.client.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		}
+		return c, nil
+	}
+
+	base, err := url.Parse(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid admin URL %q: %v", addr, err)
+	}
+	if base.Scheme != "http" && base.Scheme != "https" {
+		return nil, fmt.Errorf("invalid admin URL %q, expected http://, https:// or unix://", addr)
+	}
+	c.base = base
+
+	return c, nil
+}
+
+// do makes a request and returns the response if it succeeded. The error has
+// the server's message otherwise.
+func (c *adminClient) do(ctx context.Context, method, path string, params url.Values, body io.Reader) (*http.Response, error) {
+	u := c.base.JoinPath(path)
+	u.RawQuery = params.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case c.user != "":
+		user, password, _ := strings.Cut(c.user, ":")
+		req.SetBasicAuth(user, password)
+	case c.token != "":
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if len(bytes.TrimSpace(msg)) == 0 {
+			msg = []byte(resp.Status)
+		}
+		return nil, fmt.Errorf("%s %s: %s", method, path, bytes.TrimSpace(msg))
+	}
+
+	return resp, nil
+}
+
+// call makes a request and decodes the JSON response into v, unless v is nil.
+func (c *adminClient) call(ctx context.Context, method, path string, params url.Values, body io.Reader, v any) error {
+	resp, err := c.do(ctx, method, path, params, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if v == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("%s %s: invalid response: %v", method, path, err)
+	}
+	return nil
+}
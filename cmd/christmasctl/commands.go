@@ -0,0 +1,395 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"dev.acmcsuf.com/christmas/lib/leddraw"
+	"dev.acmcsuf.com/christmasd"
+
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// cmdEnv is what commands run with.
+type cmdEnv struct {
+	admin  *adminClient
+	logger *slog.Logger
+	out    io.Writer
+}
+
+// print prints v as JSON if --json is given, or calls table otherwise. Lines
+// that table writes are aligned on tabs.
+func (e *cmdEnv) print(v any, table func(w io.Writer)) error {
+	if jsonOutput {
+		enc := json.NewEncoder(e.out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+
+	tw := tabwriter.NewWriter(e.out, 0, 8, 2, ' ', 0)
+	table(tw)
+	return tw.Flush()
+}
+
+// dial connects to the websocket in --ws.
+func (e *cmdEnv) dial(ctx context.Context) (*christmasd.Client, error) {
+	if wsURL == "" {
+		return nil, errors.New("no websocket URL, use --ws or $CHRISTMASCTL_WS")
+	}
+
+	client, err := christmasd.Dial(ctx, wsURL, christmasd.ClientOpts{
+		Logger: e.logger,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %q: %v", wsURL, err)
+	}
+	return client, nil
+}
+
+func wantArgs(args []string, min, max int) error {
+	switch {
+	case len(args) >= min && len(args) <= max:
+		return nil
+	case min == max:
+		return fmt.Errorf("expected %d arguments, got %d, see --help", min, len(args))
+	default:
+		return fmt.Errorf("expected %d to %d arguments, got %d, see --help", min, max, len(args))
+	}
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "never"
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+type accessToken struct {
+	ID      string     `json:"id"`
+	Secret  string     `json:"token,omitempty"`
+	Label   string     `json:"label"`
+	Scope   string     `json:"scope"`
+	Created time.Time  `json:"created"`
+	Expires *time.Time `json:"expires,omitempty"`
+	MaxUses int        `json:"max_uses,omitempty"`
+	Uses    int        `json:"uses"`
+}
+
+func tokenList(ctx context.Context, e *cmdEnv, args []string) error {
+	if err := wantArgs(args, 0, 0); err != nil {
+		return err
+	}
+
+	var tokens []accessToken
+	if err := e.admin.call(ctx, "GET", "/tokens", nil, nil, &tokens); err != nil {
+		return err
+	}
+
+	return e.print(tokens, func(w io.Writer) {
+		fmt.Fprintln(w, "ID\tLABEL\tSCOPE\tUSES\tEXPIRES")
+		for _, t := range tokens {
+			uses := strconv.Itoa(t.Uses)
+			if t.MaxUses > 0 {
+				uses += "/" + strconv.Itoa(t.MaxUses)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", t.ID, t.Label, t.Scope, uses, formatTime(t.Expires))
+		}
+	})
+}
+
+func tokenCreate(ctx context.Context, e *cmdEnv, args []string) error {
+	if err := wantArgs(args, 1, 1); err != nil {
+		return err
+	}
+
+	params := url.Values{
+		"label":    {args[0]},
+		"scope":    {tokenScope},
+		"max_uses": {strconv.Itoa(tokenMaxUses)},
+	}
+	if tokenExpires != "" {
+		params.Set("expires", tokenExpires)
+	}
+
+	var token accessToken
+	if err := e.admin.call(ctx, "POST", "/tokens", params, nil, &token); err != nil {
+		return err
+	}
+
+	return e.print(token, func(w io.Writer) {
+		fmt.Fprintln(w, token.Secret)
+	})
+}
+
+func tokenRevoke(ctx context.Context, e *cmdEnv, args []string) error {
+	if err := wantArgs(args, 1, 1); err != nil {
+		return err
+	}
+
+	var revoked struct {
+		Token  accessToken `json:"token"`
+		Kicked int         `json:"kicked"`
+	}
+	if err := e.admin.call(ctx, "DELETE", "/tokens/"+url.PathEscape(args[0]), nil, nil, &revoked); err != nil {
+		return err
+	}
+
+	return e.print(revoked, func(w io.Writer) {
+		fmt.Fprintf(w, "revoked %s, kicked %d sessions\n", revoked.Token.Label, revoked.Kicked)
+	})
+}
+
+func tokenRotate(ctx context.Context, e *cmdEnv, args []string) error {
+	if err := wantArgs(args, 0, 0); err != nil {
+		return err
+	}
+
+	resp, err := e.admin.do(ctx, "POST", "/token/randomize", nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	token, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	v := struct {
+		Token string `json:"token"`
+	}{string(token)}
+
+	return e.print(v, func(w io.Writer) {
+		fmt.Fprintln(w, v.Token)
+	})
+}
+
+type sessionInfo struct {
+	ID       string    `json:"id"`
+	Addr     string    `json:"addr"`
+	Label    string    `json:"label,omitempty"`
+	TokenID  string    `json:"token_id,omitempty"`
+	ViewOnly bool      `json:"view_only"`
+	Started  time.Time `json:"started"`
+}
+
+func sessionsList(ctx context.Context, e *cmdEnv, args []string) error {
+	if err := wantArgs(args, 0, 0); err != nil {
+		return err
+	}
+
+	var sessions []sessionInfo
+	if err := e.admin.call(ctx, "GET", "/sessions", nil, nil, &sessions); err != nil {
+		return err
+	}
+
+	return e.print(sessions, func(w io.Writer) {
+		fmt.Fprintln(w, "ID\tLABEL\tADDRESS\tCONNECTED\tVIEW ONLY")
+		for _, s := range sessions {
+			connected := time.Since(s.Started).Round(time.Second)
+			fmt.Fprintf(w, "%s\t%s\t%s\t%v\t%v\n", s.ID, s.Label, s.Addr, connected, s.ViewOnly)
+		}
+	})
+}
+
+func kick(ctx context.Context, e *cmdEnv, args []string) error {
+	if len(args) == 0 {
+		return wantArgs(args, 1, 1)
+	}
+
+	path := "/sessions/" + url.PathEscape(args[0]) + "/kick"
+	if args[0] == "all" {
+		path = "/kick-all"
+	}
+
+	params := url.Values{"reason": {strings.Join(args[1:], " ")}}
+	return e.admin.call(ctx, "POST", path, params, nil, nil)
+}
+
+func notice(ctx context.Context, e *cmdEnv, args []string) error {
+	if len(args) == 0 {
+		return wantArgs(args, 1, 1)
+	}
+
+	params := url.Values{
+		"message": {strings.Join(args, " ")},
+		"kind":    {noticeKind},
+	}
+	if noticeDeadline != "" {
+		params.Set("deadline", noticeDeadline)
+	}
+	if noticeSession != "" {
+		params.Set("session", noticeSession)
+	}
+
+	var sent struct {
+		Sent int `json:"sent"`
+	}
+	if err := e.admin.call(ctx, "POST", "/notice", params, nil, &sent); err != nil {
+		return err
+	}
+
+	return e.print(sent, func(w io.Writer) {
+		fmt.Fprintf(w, "sent to %d sessions\n", sent.Sent)
+	})
+}
+
+type brightnessStatus struct {
+	Level     float64 `json:"level"`
+	Effective float64 `json:"effective"`
+}
+
+func brightness(ctx context.Context, e *cmdEnv, args []string) error {
+	if err := wantArgs(args, 0, 1); err != nil {
+		return err
+	}
+
+	var status brightnessStatus
+	if len(args) == 0 {
+		if err := e.admin.call(ctx, "GET", "/brightness", nil, nil, &status); err != nil {
+			return err
+		}
+	} else {
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(args[0], "%"), 64)
+		if err != nil || percent < 0 || percent > 100 {
+			return fmt.Errorf("invalid brightness %q, expected a percentage from 0 to 100", args[0])
+		}
+
+		params := url.Values{"level": {strconv.FormatFloat(percent/100, 'f', -1, 64)}}
+		if err := e.admin.call(ctx, "POST", "/brightness", params, nil, &status); err != nil {
+			return err
+		}
+	}
+
+	return e.print(status, func(w io.Writer) {
+		fmt.Fprintf(w, "%.0f%%, drawn at %.0f%% after the config and the schedule\n",
+			status.Level*100, status.Effective*100)
+	})
+}
+
+func overrideParams() url.Values {
+	params := url.Values{}
+	if overrideDuration > 0 {
+		params.Set("duration", overrideDuration.String())
+	}
+	return params
+}
+
+func push(ctx context.Context, e *cmdEnv, args []string) error {
+	if err := wantArgs(args, 1, 1); err != nil {
+		return err
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if useOverride {
+		// The server decodes the image, so that animated GIFs play.
+		params := overrideParams()
+		params.Set("fit", overrideFit)
+		return e.admin.call(ctx, "POST", "/override/image", params, f, nil)
+	}
+
+	src, _, err := image.Decode(f)
+	if err != nil {
+		return fmt.Errorf("failed to decode image: %v", err)
+	}
+
+	client, err := e.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	w, h := client.ImageSize()
+	img, err := fitImage(src, w, h, overrideFit)
+	if err != nil {
+		return err
+	}
+	return client.DrawImage(img)
+}
+
+func fill(ctx context.Context, e *cmdEnv, args []string) error {
+	if err := wantArgs(args, 1, 1); err != nil {
+		return err
+	}
+
+	color, err := parseColor(args[0])
+	if err != nil {
+		return err
+	}
+
+	if useOverride {
+		params := overrideParams()
+		params.Set("color", args[0])
+		return e.admin.call(ctx, "POST", "/override/color", params, nil, nil)
+	}
+
+	client, err := e.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	leds := make(leddraw.LEDStrip, len(client.LEDs()))
+	for i := range leds {
+		leds[i] = color
+	}
+	return client.SetLEDs(leds)
+}
+
+type recordingStatus struct {
+	Recording bool   `json:"recording"`
+	File      string `json:"file,omitempty"`
+	Frames    int    `json:"frames,omitempty"`
+}
+
+func record(ctx context.Context, e *cmdEnv, args []string) error {
+	var status recordingStatus
+	var err error
+
+	switch {
+	case len(args) == 0:
+		err = e.admin.call(ctx, "GET", "/recording", nil, nil, &status)
+	case args[0] == "start" && len(args) <= 2:
+		params := url.Values{}
+		if len(args) == 2 {
+			params.Set("name", args[1])
+		}
+		err = e.admin.call(ctx, "POST", "/recording/start", params, nil, &status)
+	case args[0] == "stop" && len(args) == 1:
+		err = e.admin.call(ctx, "POST", "/recording/stop", nil, nil, &status)
+	default:
+		return errors.New("expected no arguments, start [name] or stop, see --help")
+	}
+	if err != nil {
+		return err
+	}
+
+	return e.print(status, func(w io.Writer) {
+		switch {
+		case status.Recording:
+			fmt.Fprintf(w, "recording to %s\n", status.File)
+		case status.File != "":
+			fmt.Fprintf(w, "recorded %d frames to %s\n", status.Frames, status.File)
+		default:
+			fmt.Fprintln(w, "not recording")
+		}
+	})
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"strconv"
+	"strings"
+
+	"dev.acmcsuf.com/christmas/lib/xcolor"
+)
+
+// parseColor parses a hex color like "#ff0000" or "f00".
+func parseColor(s string) (xcolor.RGB, error) {
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || len(hex) != 6 {
+		return xcolor.RGB{}, fmt.Errorf("invalid color %q, expected a hex color like #ff0000", s)
+	}
+
+	return xcolor.RGB{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v)}, nil
+}
+
+// fitImage scales src to w by h with nearest neighbor sampling. fit is
+// contain, which letterboxes the image in black, cover, which crops it, or
+// stretch.
+func fitImage(src image.Image, w, h int, fit string) (*image.RGBA, error) {
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(dst, dst.Bounds(), image.Black, image.Point{}, draw.Src)
+
+	sb := src.Bounds()
+	if sb.Empty() || w == 0 || h == 0 {
+		return dst, nil
+	}
+
+	// The part of dst that the image is drawn to.
+	target := dst.Bounds()
+
+	switch fit {
+	case "stretch":
+	case "contain", "cover":
+		// Compare w/h against the image's aspect ratio without dividing.
+		wider := w*sb.Dy() > h*sb.Dx()
+		if wider == (fit == "contain") {
+			// Fit the height, and center horizontally.
+			sw := sb.Dx() * h / sb.Dy()
+			target = image.Rect((w-sw)/2, 0, (w-sw)/2+sw, h)
+		} else {
+			// Fit the width, and center vertically.
+			sh := sb.Dy() * w / sb.Dx()
+			target = image.Rect(0, (h-sh)/2, w, (h-sh)/2+sh)
+		}
+	default:
+		return nil, fmt.Errorf("invalid fit %q, expected contain, cover or stretch", fit)
+	}
+
+	if target.Empty() {
+		return dst, nil
+	}
+
+	for y := max(target.Min.Y, 0); y < min(target.Max.Y, h); y++ {
+		sy := sb.Min.Y + (y-target.Min.Y)*sb.Dy()/target.Dy()
+		for x := max(target.Min.X, 0); x < min(target.Max.X, w); x++ {
+			sx := sb.Min.X + (x-target.Min.X)*sb.Dx()/target.Dx()
+			dst.Set(x, y, src.At(sx, sy))
+		}
+	}
+
+	return dst, nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"dev.acmcsuf.com/christmas/lib/xcolor"
+)
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		in   string
+		want xcolor.RGB
+		ok   bool
+	}{
+		{"#ff8000", xcolor.RGB{R: 0xff, G: 0x80, B: 0x00}, true},
+		{"00ff00", xcolor.RGB{G: 0xff}, true},
+		{"#f00", xcolor.RGB{R: 0xff}, true},
+		{"#ff00", xcolor.RGB{}, false},
+		{"red", xcolor.RGB{}, false},
+	}
+
+	for _, test := range tests {
+		got, err := parseColor(test.in)
+		if (err == nil) != test.ok || got != test.want {
+			t.Errorf("parseColor(%q) = %v, %v, want %v, ok %v", test.in, got, err, test.want, test.ok)
+		}
+	}
+}
+
+func TestFitImage(t *testing.T) {
+	// A 2x1 image with a red left half and a blue right half.
+	src := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	src.Set(0, 0, color.RGBA{R: 255, A: 255})
+	src.Set(1, 0, color.RGBA{B: 255, A: 255})
+
+	red := color.RGBA{R: 255, A: 255}
+	blue := color.RGBA{B: 255, A: 255}
+	black := color.RGBA{A: 255}
+
+	tests := []struct {
+		fit  string
+		want [4][4]color.RGBA // [y][x]
+	}{
+		{"stretch", [4][4]color.RGBA{
+			{red, red, blue, blue},
+			{red, red, blue, blue},
+			{red, red, blue, blue},
+			{red, red, blue, blue},
+		}},
+		{"contain", [4][4]color.RGBA{
+			{black, black, black, black},
+			{red, red, blue, blue},
+			{red, red, blue, blue},
+			{black, black, black, black},
+		}},
+		{"cover", [4][4]color.RGBA{
+			{red, red, blue, blue},
+			{red, red, blue, blue},
+			{red, red, blue, blue},
+			{red, red, blue, blue},
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.fit, func(t *testing.T) {
+			img, err := fitImage(src, 4, 4, test.fit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for y, row := range test.want {
+				for x, want := range row {
+					if got := img.RGBAAt(x, y); got != want {
+						t.Errorf("pixel (%d, %d) = %v, want %v", x, y, got, want)
+					}
+				}
+			}
+		})
+	}
+
+	if _, err := fitImage(src, 4, 4, "tile"); err == nil {
+		t.Error("no error for an invalid fit")
+	}
+}
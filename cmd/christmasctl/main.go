@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lmittmann/tint"
+	"github.com/mattn/go-isatty"
+	"github.com/spf13/pflag"
+)
+
+var (
+	adminAddr  = envOr("CHRISTMASCTL_ADMIN", "http://127.0.0.1:9002")
+	adminToken = os.Getenv("CHRISTMASCTL_TOKEN")
+	adminUser  = os.Getenv("CHRISTMASCTL_USER")
+	wsURL      = os.Getenv("CHRISTMASCTL_WS")
+	jsonOutput = false
+	verbose    = false
+
+	tokenScope   = "control"
+	tokenExpires = ""
+	tokenMaxUses = 0
+
+	useOverride      = false
+	overrideFit      = "contain"
+	overrideDuration = time.Duration(0)
+
+	watchWidth    = 0
+	watchInterval = 250 * time.Millisecond
+
+	noticeKind     = "info"
+	noticeDeadline = ""
+	noticeSession  = ""
+)
+
+func init() {
+	pflag.StringVar(&adminAddr, "admin", adminAddr, "admin API URL, or unix:///path for the admin socket ($CHRISTMASCTL_ADMIN)")
+	pflag.StringVar(&adminToken, "token", adminToken, "admin bearer token ($CHRISTMASCTL_TOKEN)")
+	pflag.StringVar(&adminUser, "user", adminUser, "admin username and password as user:password ($CHRISTMASCTL_USER)")
+	pflag.StringVar(&wsURL, "ws", wsURL, "websocket URL for push and fill, e.g. ws://localhost:9000/ws/TOKEN ($CHRISTMASCTL_WS)")
+	pflag.BoolVar(&jsonOutput, "json", jsonOutput, "print JSON instead of tables")
+	pflag.BoolVarP(&verbose, "verbose", "v", verbose, "verbose logging")
+
+	pflag.StringVar(&tokenScope, "scope", tokenScope, "token create: scope of the token, one of view, control or admin")
+	pflag.StringVar(&tokenExpires, "expires", tokenExpires, `token create: when the token expires, e.g. "6h" or an RFC 3339 time`)
+	pflag.IntVar(&tokenMaxUses, "max-uses", tokenMaxUses, "token create: how many connections the token can be used for, 0 for unlimited")
+
+	pflag.BoolVar(&useOverride, "override", useOverride, "push, fill: show it as an admin override instead of as a client")
+	pflag.StringVar(&overrideFit, "fit", overrideFit, "push: how the image fits the canvas, one of contain, cover or stretch")
+	pflag.DurationVar(&overrideDuration, "duration", overrideDuration, "push, fill: how long the override lasts, 0 for until stopped")
+
+	pflag.IntVar(&watchWidth, "width", watchWidth, "watch: width of the preview in columns, 0 for the terminal width")
+	pflag.DurationVar(&watchInterval, "interval", watchInterval, "watch: time between updates")
+
+	pflag.StringVar(&noticeKind, "kind", noticeKind, "notice: what the notice is about, one of info, time_limit, maintenance or queue")
+	pflag.StringVar(&noticeDeadline, "deadline", noticeDeadline, `notice: when the notice takes effect, e.g. "10m" or an RFC 3339 time`)
+	pflag.StringVar(&noticeSession, "session", noticeSession, "notice: ID of the session to send the notice to, instead of all of them")
+
+	pflag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] <command> [args]\n", os.Args[0])
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Controls a christmasd server through its admin API and websocket.")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Commands:")
+		for _, cmd := range commands {
+			usage := cmd.name
+			if cmd.args != "" {
+				usage += " " + cmd.args
+			}
+			fmt.Fprintf(os.Stderr, "  %-30s %s\n", usage, cmd.help)
+		}
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Flags:")
+		pflag.PrintDefaults()
+	}
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// command is a subcommand of christmasctl.
+type command struct {
+	// name is the words that select the command, e.g. "token rotate".
+	name string
+	args string
+	help string
+	run  func(ctx context.Context, env *cmdEnv, args []string) error
+}
+
+var commands = []command{
+	{"token ls", "", "list the access tokens", tokenList},
+	{"token create", "<label>", "create an access token and print its secret", tokenCreate},
+	{"token revoke", "<id>", "revoke an access token and kick its sessions", tokenRevoke},
+	{"token rotate", "", "replace the default token with a random one", tokenRotate},
+	{"sessions ls", "", "list the connected sessions", sessionsList},
+	{"kick", "<id>|all [reason]", "kick a session, or all of them", kick},
+	{"notice", "<message>", "send a message to the connected clients", notice},
+	{"brightness", "[percent]", "show or set the brightness", brightness},
+	{"push", "<image>", "show an image on the LEDs", push},
+	{"fill", "<color>", "light all LEDs in a color, e.g. #ff0000", fill},
+	{"watch", "", "preview the LEDs in the terminal", watch},
+	{"record", "[start [name] | stop]", "show, start or stop a recording on the server", record},
+}
+
+// findCommand returns the command whose name is the first words of args, and
+// the rest of args.
+func findCommand(args []string) (command, []string, bool) {
+	var found command
+	var foundWords int
+	for _, cmd := range commands {
+		words := strings.Fields(cmd.name)
+		if len(words) > foundWords && len(args) >= len(words) && slices.Equal(args[:len(words)], words) {
+			found = cmd
+			foundWords = len(words)
+		}
+	}
+	return found, args[foundWords:], foundWords > 0
+}
+
+func main() {
+	log.SetFlags(0)
+	pflag.Parse()
+
+	cmd, args, ok := findCommand(pflag.Args())
+	if !ok {
+		pflag.Usage()
+		os.Exit(2)
+	}
+
+	level := slog.LevelWarn
+	if verbose {
+		level = slog.LevelDebug
+	}
+
+	logHandler := tint.NewHandler(os.Stderr, &tint.Options{
+		Level:      level,
+		TimeFormat: "15:04:05 PM", // extended time.Kitchen
+		NoColor:    !isatty.IsTerminal(os.Stderr.Fd()),
+	})
+
+	// Not the default logger, since that would send the errors from the log
+	// package through the level filter too.
+	logger := slog.New(logHandler)
+
+	admin, err := newAdminClient(adminAddr, adminToken, adminUser)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	env := &cmdEnv{
+		admin:  admin,
+		logger: logger,
+		out:    os.Stdout,
+	}
+
+	if err := cmd.run(ctx, env, args); err != nil {
+		log.Fatalf("%s: %v", cmd.name, err)
+	}
+}
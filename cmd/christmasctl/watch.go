@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// terminalSize guesses the size of the terminal from $COLUMNS and $LINES,
+// which most shells set, falling back to 80 by 24.
+func terminalSize() (cols, rows int) {
+	cols, rows = 80, 24
+	if v, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && v > 0 {
+		cols = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("LINES")); err == nil && v > 0 {
+		rows = v
+	}
+	return cols, rows
+}
+
+func watch(ctx context.Context, e *cmdEnv, args []string) error {
+	if err := wantArgs(args, 0, 0); err != nil {
+		return err
+	}
+
+	cols, rows := terminalSize()
+	if watchWidth > 0 {
+		cols = watchWidth
+	}
+	// Each character is two pixels high, and the last line is kept free for
+	// the cursor.
+	params := url.Values{
+		"width":  {strconv.Itoa(cols)},
+		"height": {strconv.Itoa(2 * max(rows-1, 1))},
+	}
+
+	out := bufio.NewWriter(e.out)
+	// Clear the screen and hide the cursor, then show it again when done.
+	fmt.Fprint(out, "\x1b[2J\x1b[?25l")
+	defer func() {
+		fmt.Fprint(out, "\x1b[0m\x1b[?25h\n")
+		out.Flush()
+	}()
+
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	for {
+		img, err := e.snapshot(ctx, params)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		fmt.Fprint(out, "\x1b[H")
+		drawHalfBlocks(out, img)
+		if err := out.Flush(); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// snapshot fetches a PNG snapshot of the LEDs from the admin API.
+func (e *cmdEnv) snapshot(ctx context.Context, params url.Values) (image.Image, error) {
+	resp, err := e.admin.do(ctx, "GET", "/snapshot.png", params, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	img, err := png.Decode(resp.Body)
+	if err != nil {
+		return nil, errors.Join(errors.New("invalid snapshot"), err)
+	}
+	return img, nil
+}
+
+// drawHalfBlocks draws img with 24-bit colors, using the upper half block
+// character so that each character shows two pixels on top of each other.
+func drawHalfBlocks(w io.Writer, img image.Image) {
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y += 2 {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			tr, tg, tb, _ := img.At(x, y).RGBA()
+			var br, bg, bb uint32
+			if y+1 < b.Max.Y {
+				br, bg, bb, _ = img.At(x, y+1).RGBA()
+			}
+			fmt.Fprintf(w, "\x1b[38;2;%d;%d;%dm\x1b[48;2;%d;%d;%dm▀",
+				tr>>8, tg>>8, tb>>8, br>>8, bg>>8, bb>>8)
+		}
+		fmt.Fprint(w, "\x1b[0m\n")
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"dev.acmcsuf.com/christmas/lib/csvutil"
+	"github.com/lmittmann/tint"
+	"github.com/mattn/go-isatty"
+	"github.com/spf13/pflag"
+)
+
+var (
+	mode          = "walk"
+	output        = "led-points.csv"
+	background    = ""
+	numLEDs       = 0
+	threshold     = 64
+	minArea       = 4
+	outlierFactor = 4.0
+	width         = 0
+	verbose       = false
+)
+
+func init() {
+	pflag.StringVarP(&mode, "mode", "m", mode, "diagnostics pattern the photos were taken of, walk or binary")
+	pflag.StringVarP(&output, "output", "o", output, "LED points CSV file to write, or - for stdout")
+	pflag.StringVarP(&background, "background", "b", background, "photo with all LEDs off, subtracted from every photo to remove ambient light")
+	pflag.IntVarP(&numLEDs, "leds", "n", numLEDs, "number of LEDs, guessed from the photos if 0")
+	pflag.IntVar(&threshold, "threshold", threshold, "brightness from 0 to 255 above which a pixel is part of a lit LED")
+	pflag.IntVar(&minArea, "min-area", minArea, "number of pixels below which a bright spot is ignored as noise")
+	pflag.Float64Var(&outlierFactor, "outlier-factor", outlierFactor, "how many times the usual distance between neighboring LEDs an LED can be from its neighbors before it is thrown out, 0 to keep all")
+	pflag.IntVarP(&width, "width", "w", width, "scale the points to be this wide, starting at 0,0, instead of using photo pixels")
+	pflag.BoolVarP(&verbose, "verbose", "v", verbose, "verbose logging")
+
+	pflag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] <photo-dir>\n", os.Args[0])
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Makes an LED points file from JPEG or PNG photos taken from a fixed position")
+		fmt.Fprintln(os.Stderr, "while christmasd ran a diagnostics pattern. The photos are used in the")
+		fmt.Fprintln(os.Stderr, "order of their names, with numbers compared by value.")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "  walk    one photo per LED, with only that LED lit")
+		fmt.Fprintln(os.Stderr, "  binary  one photo with all LEDs lit, then one photo per bit of the")
+		fmt.Fprintln(os.Stderr, "          LED indices, most significant bit first")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "LEDs that are not found are reported and placed in between their")
+		fmt.Fprintln(os.Stderr, "neighbors. The strip column is not written and must be added by hand for")
+		fmt.Fprintln(os.Stderr, "setups with more than one strip.")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Flags:")
+		pflag.PrintDefaults()
+	}
+}
+
+func main() {
+	log.SetFlags(0)
+	pflag.Parse()
+
+	if pflag.NArg() != 1 {
+		pflag.Usage()
+		os.Exit(2)
+	}
+
+	level := slog.LevelInfo
+	if verbose {
+		level = slog.LevelDebug
+	}
+
+	logHandler := tint.NewHandler(os.Stderr, &tint.Options{
+		Level:      level,
+		TimeFormat: "15:04:05 PM", // extended time.Kitchen
+		NoColor:    !isatty.IsTerminal(os.Stderr.Fd()),
+	})
+
+	logger := slog.New(logHandler)
+	slog.SetDefault(logger)
+
+	if err := run(logger, pflag.Arg(0)); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(logger *slog.Logger, dir string) error {
+	if threshold < 0 || threshold > 255 {
+		return fmt.Errorf("invalid --threshold %d, must be from 0 to 255", threshold)
+	}
+
+	paths, err := listPhotos(dir)
+	if err != nil {
+		return fmt.Errorf("failed to list photos: %v", err)
+	}
+
+	opts := mapOpts{
+		Spots: spotOpts{
+			Threshold: uint8(threshold),
+			MinArea:   minArea,
+		},
+		NumLEDs: numLEDs,
+		Logger:  logger,
+	}
+
+	if background != "" {
+		paths = slices.DeleteFunc(paths, func(path string) bool { return sameFile(path, background) })
+
+		bg, err := loadPhoto(background)
+		if err != nil {
+			return fmt.Errorf("failed to load background photo: %v", err)
+		}
+		opts.Spots.Background = bg.Luma
+	}
+
+	logger.Info(
+		"mapping LEDs",
+		"mode", mode,
+		"photos", len(paths))
+
+	var leds []ledPosition
+	switch mode {
+	case "walk":
+		leds, err = mapWalk(paths, opts)
+	case "binary":
+		leds, err = mapBinary(paths, opts)
+	default:
+		return fmt.Errorf("invalid --mode %q, expected walk or binary", mode)
+	}
+	if err != nil {
+		return err
+	}
+
+	var outliers int
+	if outlierFactor > 0 {
+		outliers = markOutliers(leds, outlierFactor)
+	}
+
+	var missing int
+	for i, led := range leds {
+		if !led.Found {
+			missing++
+			logger.Warn(
+				"could not find LED",
+				"led", i,
+				"problem", led.Problem)
+		}
+	}
+
+	points, err := ledPoints(leds, width)
+	if err != nil {
+		return err
+	}
+
+	if err := writePoints(output, points); err != nil {
+		return fmt.Errorf("failed to write LED points: %v", err)
+	}
+
+	logger.Info(
+		"wrote LED points",
+		"file", output,
+		"leds", len(leds),
+		"found", len(leds)-missing,
+		"outliers", outliers,
+		"missing", missing)
+
+	return nil
+}
+
+func writePoints(path string, points []image.Point) error {
+	if path == "-" {
+		return encodePoints(os.Stdout, points)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := encodePoints(f, points); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+func encodePoints(w io.Writer, points []image.Point) error {
+	csvw := csv.NewWriter(w)
+	if err := csvutil.Marshal(csvw, points); err != nil {
+		return err
+	}
+	csvw.Flush()
+	return csvw.Error()
+}
+
+// listPhotos returns the JPEG and PNG files in dir in natural order.
+func listPhotos(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, entry := range entries {
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".jpg", ".jpeg", ".png":
+			if !entry.IsDir() {
+				paths = append(paths, filepath.Join(dir, entry.Name()))
+			}
+		}
+	}
+
+	slices.SortFunc(paths, naturalCompare)
+	return paths, nil
+}
+
+// naturalCompare compares strings so that runs of digits are compared by
+// their value, e.g. "led2.jpg" comes before "led10.jpg".
+func naturalCompare(a, b string) int {
+	for a != "" && b != "" {
+		aDigits, bDigits := leadingDigits(a), leadingDigits(b)
+		if aDigits != "" && bDigits != "" {
+			an, _ := strconv.ParseUint(aDigits, 10, 64)
+			bn, _ := strconv.ParseUint(bDigits, 10, 64)
+			if an != bn {
+				if an < bn {
+					return -1
+				}
+				return 1
+			}
+			a, b = a[len(aDigits):], b[len(bDigits):]
+			continue
+		}
+
+		if a[0] != b[0] {
+			if a[0] < b[0] {
+				return -1
+			}
+			return 1
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) - len(b)
+}
+
+func leadingDigits(s string) string {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	return s[:i]
+}
+
+func sameFile(a, b string) bool {
+	aStat, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	bStat, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(aStat, bStat)
+}
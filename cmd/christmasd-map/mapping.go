@@ -0,0 +1,282 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"log/slog"
+	"math"
+	"slices"
+)
+
+// ledPosition is where an LED was found in the photos.
+type ledPosition struct {
+	X, Y  float64
+	Found bool
+	// Problem is why the LED was not found, or why its position was thrown
+	// out.
+	Problem string
+}
+
+// mapOpts are the options for mapping LEDs.
+type mapOpts struct {
+	Spots spotOpts
+	// NumLEDs is the number of LEDs. If 0, it is guessed from the photos.
+	NumLEDs int
+	// Logger is used to report progress.
+	Logger *slog.Logger
+}
+
+// mapWalk finds the LEDs in photos taken while the walk diagnostics pattern
+// ran, so that the nth photo has only the nth LED lit.
+func mapWalk(paths []string, opts mapOpts) ([]ledPosition, error) {
+	numLEDs := opts.NumLEDs
+	if numLEDs == 0 {
+		numLEDs = len(paths)
+	}
+	if len(paths) < numLEDs {
+		return nil, fmt.Errorf("expected a photo for each of the %d LEDs, got %d photos", numLEDs, len(paths))
+	}
+
+	leds := make([]ledPosition, numLEDs)
+	for i := range leds {
+		p, err := loadPhoto(paths[i])
+		if err != nil {
+			return nil, err
+		}
+
+		spots, err := findSpots(p, opts.Spots)
+		if err != nil {
+			return nil, err
+		}
+
+		opts.Logger.Debug(
+			"looked for the LED",
+			"led", i,
+			"photo", paths[i],
+			"spots", len(spots))
+
+		switch {
+		case len(spots) == 0:
+			leds[i].Problem = "no bright spot in " + paths[i]
+		case len(spots) > 1 && spots[1].Brightness > spots[0].Brightness/2:
+			leds[i].Problem = fmt.Sprintf("%d similarly bright spots in %s", len(spots), paths[i])
+		default:
+			leds[i] = ledPosition{X: spots[0].X, Y: spots[0].Y, Found: true}
+		}
+	}
+
+	return leds, nil
+}
+
+// mapBinary finds the LEDs in photos taken while the binary diagnostics
+// pattern ran. The first photo has all LEDs lit, and each photo after it has
+// one bit of every LED's index, most significant bit first, where a green LED
+// is a 1 and a red LED is a 0.
+func mapBinary(paths []string, opts mapOpts) ([]ledPosition, error) {
+	if len(paths) < 2 {
+		return nil, errors.New("expected a photo with all LEDs lit followed by a photo per bit")
+	}
+
+	nbits := len(paths) - 1
+	if nbits > 30 {
+		return nil, fmt.Errorf("too many photos, %d bits is more than any strip needs", nbits)
+	}
+
+	all, err := loadPhoto(paths[0])
+	if err != nil {
+		return nil, err
+	}
+
+	spots, err := findSpots(all, opts.Spots)
+	if err != nil {
+		return nil, err
+	}
+	if len(spots) == 0 {
+		return nil, fmt.Errorf("no bright spots in %s, which should have all LEDs lit", paths[0])
+	}
+
+	opts.Logger.Debug(
+		"found spots",
+		"photo", paths[0],
+		"spots", len(spots))
+
+	codes := make([]int, len(spots))
+	for _, path := range paths[1:] {
+		p, err := loadPhoto(path)
+		if err != nil {
+			return nil, err
+		}
+		if p.Luma.Width != all.Luma.Width || p.Luma.Height != all.Luma.Height {
+			return nil, fmt.Errorf("%s has a different size than %s", path, paths[0])
+		}
+
+		for i, s := range spots {
+			radius := max(1, int(math.Sqrt(float64(s.Area)/math.Pi)))
+			r, g, _ := colorAt(p, s.X, s.Y, radius)
+			codes[i] <<= 1
+			if g > r {
+				codes[i] |= 1
+			}
+		}
+	}
+
+	numLEDs := opts.NumLEDs
+	if numLEDs == 0 {
+		numLEDs = slices.Max(codes) + 1
+	}
+
+	leds := make([]ledPosition, numLEDs)
+	for i, s := range spots {
+		code := codes[i]
+		if code >= numLEDs {
+			opts.Logger.Warn(
+				"ignoring a spot that decoded to an index past the last LED",
+				"x", int(s.X),
+				"y", int(s.Y),
+				"index", code)
+			continue
+		}
+
+		switch led := &leds[code]; {
+		case led.Found:
+			led.Found = false
+			led.Problem = fmt.Sprintf("several spots decoded to this LED, e.g. at %d,%d and %d,%d",
+				int(led.X), int(led.Y), int(s.X), int(s.Y))
+		case led.Problem != "":
+			// Already seen several times.
+		default:
+			*led = ledPosition{X: s.X, Y: s.Y, Found: true}
+		}
+	}
+
+	for i := range leds {
+		if !leds[i].Found && leds[i].Problem == "" {
+			leds[i].Problem = "no spot decoded to this LED"
+		}
+	}
+
+	return leds, nil
+}
+
+// markOutliers throws out LEDs that are much further from both of their
+// neighbors than neighboring LEDs usually are from each other. LEDs on a
+// strip are wired in order, so a found position that is far from both
+// neighbors was most likely a reflection or another light. It returns the
+// number of LEDs that were thrown out.
+func markOutliers(leds []ledPosition, factor float64) int {
+	// Use the distance of each LED to its closest neighbor, since an outlier
+	// only skews the distance of itself and not of its neighbors.
+	var gaps []float64
+	for i := range leds {
+		gap := math.Inf(1)
+		for _, j := range [...]int{i - 1, i + 1} {
+			if j >= 0 && j < len(leds) && leds[i].Found && leds[j].Found {
+				gap = min(gap, distance(leds[i], leds[j]))
+			}
+		}
+		if !math.IsInf(gap, 1) {
+			gaps = append(gaps, gap)
+		}
+	}
+	if len(gaps) == 0 {
+		return 0
+	}
+
+	slices.Sort(gaps)
+	limit := factor * max(gaps[len(gaps)/2], 1)
+
+	// Decide on every LED before throwing any out, so that one outlier
+	// doesn't make its neighbors look like outliers too.
+	var outliers []int
+	for i := range leds {
+		if !leds[i].Found {
+			continue
+		}
+
+		var neighbors, far int
+		for _, j := range [...]int{i - 1, i + 1} {
+			if j < 0 || j >= len(leds) || !leds[j].Found {
+				continue
+			}
+			neighbors++
+			if distance(leds[i], leds[j]) > limit {
+				far++
+			}
+		}
+
+		if neighbors > 0 && far == neighbors {
+			outliers = append(outliers, i)
+		}
+	}
+
+	for _, i := range outliers {
+		leds[i].Found = false
+		leds[i].Problem = fmt.Sprintf("found at %d,%d, which is too far from its neighbors",
+			int(leds[i].X), int(leds[i].Y))
+	}
+
+	return len(outliers)
+}
+
+func distance(a, b ledPosition) float64 {
+	return math.Hypot(a.X-b.X, a.Y-b.Y)
+}
+
+// ledPoints turns the LED positions into points for the LED points file.
+// LEDs that were not found are placed in between the nearest found LEDs
+// before and after them. If width is more than 0, then the points are moved
+// to start at 0,0 and scaled to be width wide.
+func ledPoints(leds []ledPosition, width int) ([]image.Point, error) {
+	found := make([]int, 0, len(leds))
+	for i, led := range leds {
+		if led.Found {
+			found = append(found, i)
+		}
+	}
+	if len(found) == 0 {
+		return nil, errors.New("none of the LEDs were found")
+	}
+
+	xs := make([]float64, len(leds))
+	ys := make([]float64, len(leds))
+	for i, led := range leds {
+		if led.Found {
+			xs[i], ys[i] = led.X, led.Y
+			continue
+		}
+
+		// Find the found LEDs on either side.
+		next, _ := slices.BinarySearch(found, i)
+		switch {
+		case next == 0:
+			xs[i], ys[i] = leds[found[0]].X, leds[found[0]].Y
+		case next == len(found):
+			last := leds[found[len(found)-1]]
+			xs[i], ys[i] = last.X, last.Y
+		default:
+			a, b := found[next-1], found[next]
+			t := float64(i-a) / float64(b-a)
+			xs[i] = leds[a].X + t*(leds[b].X-leds[a].X)
+			ys[i] = leds[a].Y + t*(leds[b].Y-leds[a].Y)
+		}
+	}
+
+	offsetX, offsetY, scale := 0.0, 0.0, 1.0
+	if width > 0 {
+		minX, maxX := slices.Min(xs), slices.Max(xs)
+		offsetX, offsetY = minX, slices.Min(ys)
+		if maxX > minX {
+			scale = float64(width) / (maxX - minX)
+		}
+	}
+
+	points := make([]image.Point, len(leds))
+	for i := range points {
+		points[i] = image.Pt(
+			int(math.Round((xs[i]-offsetX)*scale)),
+			int(math.Round((ys[i]-offsetY)*scale)))
+	}
+
+	return points, nil
+}
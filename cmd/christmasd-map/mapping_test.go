@@ -0,0 +1,171 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+var testSpotOpts = spotOpts{Threshold: 64, MinArea: 4}
+
+// testPhoto draws a dark photo with a 3x3 spot of the given color at each
+// point.
+func testPhoto(spots map[image.Point]color.RGBA) *photo {
+	img := image.NewRGBA(image.Rect(0, 0, 100, 60))
+	for pt, c := range spots {
+		for y := pt.Y - 1; y <= pt.Y+1; y++ {
+			for x := pt.X - 1; x <= pt.X+1; x++ {
+				img.SetRGBA(x, y, c)
+			}
+		}
+	}
+	return &photo{Name: "test", Image: img, Luma: toLuma(img)}
+}
+
+func TestFindSpots(t *testing.T) {
+	white := color.RGBA{255, 255, 255, 255}
+	gray := color.RGBA{128, 128, 128, 255}
+
+	p := testPhoto(map[image.Point]color.RGBA{
+		{20, 10}: gray,
+		{70, 40}: white,
+	})
+
+	spots, err := findSpots(p, testSpotOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(spots) != 2 {
+		t.Fatalf("found %d spots, want 2", len(spots))
+	}
+	if spots[0].X != 70 || spots[0].Y != 40 {
+		t.Errorf("brightest spot at %v,%v, want 70,40", spots[0].X, spots[0].Y)
+	}
+	if spots[1].X != 20 || spots[1].Y != 10 {
+		t.Errorf("second spot at %v,%v, want 20,10", spots[1].X, spots[1].Y)
+	}
+
+	bg := testPhoto(map[image.Point]color.RGBA{{20, 10}: gray})
+	opts := testSpotOpts
+	opts.Background = bg.Luma
+
+	spots, err = findSpots(p, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spots) != 1 {
+		t.Errorf("found %d spots with the background removed, want 1", len(spots))
+	}
+}
+
+func TestMapBinary(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	green := color.RGBA{0, 255, 0, 255}
+	white := color.RGBA{255, 255, 255, 255}
+
+	// LED i is at positions[i].
+	positions := []image.Point{{10, 10}, {30, 10}, {50, 10}, {70, 10}, {90, 50}}
+	const nbits = 3
+
+	dir := t.TempDir()
+	for step := 0; step <= nbits; step++ {
+		spots := make(map[image.Point]color.RGBA)
+		for i, pt := range positions {
+			switch {
+			case step == 0:
+				spots[pt] = white
+			case i&(1<<(nbits-step)) != 0:
+				spots[pt] = green
+			default:
+				spots[pt] = red
+			}
+		}
+		writeTestPNG(t, filepath.Join(dir, "step"+string(rune('0'+step))+".png"), testPhoto(spots).Image)
+	}
+
+	paths, err := listPhotos(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leds, err := mapBinary(paths, mapOpts{
+		Spots:  testSpotOpts,
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(leds) != len(positions) {
+		t.Fatalf("mapped %d LEDs, want %d", len(leds), len(positions))
+	}
+	for i, led := range leds {
+		if !led.Found {
+			t.Errorf("LED %d not found: %s", i, led.Problem)
+			continue
+		}
+		if got := image.Pt(int(led.X), int(led.Y)); got != positions[i] {
+			t.Errorf("LED %d at %v, want %v", i, got, positions[i])
+		}
+	}
+}
+
+func TestMarkOutliers(t *testing.T) {
+	leds := []ledPosition{
+		{X: 0, Y: 0, Found: true},
+		{X: 10, Y: 0, Found: true},
+		{X: 500, Y: 300, Found: true}, // a reflection
+		{X: 30, Y: 0, Found: true},
+		{X: 40, Y: 0, Found: true},
+		{Problem: "not found"},
+		{X: 60, Y: 0, Found: true},
+	}
+
+	if n := markOutliers(leds, 4); n != 1 {
+		t.Errorf("marked %d outliers, want 1", n)
+	}
+	if leds[2].Found {
+		t.Error("LED 2 was not marked as an outlier")
+	}
+
+	points, err := ledPoints(leds, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []image.Point{{0, 0}, {10, 0}, {20, 0}, {30, 0}, {40, 0}, {50, 0}, {60, 0}}
+	if !slices.Equal(points, want) {
+		t.Errorf("points = %v, want %v", points, want)
+	}
+}
+
+func TestNaturalCompare(t *testing.T) {
+	names := []string{"led10.jpg", "led2.jpg", "led1.jpg", "a.jpg", "led02b.jpg"}
+	slices.SortFunc(names, naturalCompare)
+
+	want := []string{"a.jpg", "led1.jpg", "led2.jpg", "led02b.jpg", "led10.jpg"}
+	if !slices.Equal(names, want) {
+		t.Errorf("sorted = %q, want %q", names, want)
+	}
+}
+
+func writeTestPNG(t *testing.T, path string, img image.Image) {
+	t.Helper()
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+}
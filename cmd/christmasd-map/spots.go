@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"sort"
+)
+
+// lumaImage is the brightness of every pixel of a photo.
+type lumaImage struct {
+	Pix    []uint8
+	Width  int
+	Height int
+}
+
+func (l *lumaImage) at(x, y int) uint8 {
+	return l.Pix[y*l.Width+x]
+}
+
+// photo is a decoded photo along with its brightness.
+type photo struct {
+	Name  string
+	Image image.Image
+	Luma  *lumaImage
+}
+
+// loadPhoto decodes the JPEG or PNG photo at the given path.
+func loadPhoto(path string) (*photo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %q: %v", path, err)
+	}
+
+	return &photo{
+		Name:  path,
+		Image: img,
+		Luma:  toLuma(img),
+	}, nil
+}
+
+func toLuma(img image.Image) *lumaImage {
+	bounds := img.Bounds()
+	l := &lumaImage{
+		Pix:    make([]uint8, bounds.Dx()*bounds.Dy()),
+		Width:  bounds.Dx(),
+		Height: bounds.Dy(),
+	}
+
+	// JPEGs already have the brightness in their Y plane.
+	if ycbcr, ok := img.(*image.YCbCr); ok {
+		for y := 0; y < l.Height; y++ {
+			row := ycbcr.Y[ycbcr.YOffset(bounds.Min.X, bounds.Min.Y+y):]
+			copy(l.Pix[y*l.Width:(y+1)*l.Width], row[:l.Width])
+		}
+		return l
+	}
+
+	for y := 0; y < l.Height; y++ {
+		for x := 0; x < l.Width; x++ {
+			gray := color.GrayModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.Gray)
+			l.Pix[y*l.Width+x] = gray.Y
+		}
+	}
+	return l
+}
+
+// spot is a bright spot in a photo.
+type spot struct {
+	// X and Y are the brightness-weighted center of the spot, in photo
+	// pixels.
+	X, Y float64
+	// Area is the number of pixels in the spot.
+	Area int
+	// Brightness is the sum of the brightness of the spot's pixels above
+	// the threshold.
+	Brightness float64
+}
+
+// spotOpts are the options for finding spots.
+type spotOpts struct {
+	// Background is subtracted from the photo before looking for spots, to
+	// remove ambient light. It may be nil.
+	Background *lumaImage
+	// Threshold is the brightness above which a pixel is part of a spot.
+	Threshold uint8
+	// MinArea is the number of pixels below which a spot is ignored as
+	// noise.
+	MinArea int
+}
+
+// findSpots finds all bright spots in the photo, brightest first.
+func findSpots(p *photo, opts spotOpts) ([]spot, error) {
+	l := p.Luma
+	if bg := opts.Background; bg != nil && (bg.Width != l.Width || bg.Height != l.Height) {
+		return nil, fmt.Errorf("%s is %dx%d but the background photo is %dx%d",
+			p.Name, l.Width, l.Height, bg.Width, bg.Height)
+	}
+
+	// level returns how far above the threshold a pixel is, or 0 if it
+	// isn't.
+	level := func(x, y int) float64 {
+		v := int(l.at(x, y))
+		if opts.Background != nil {
+			v -= int(opts.Background.at(x, y))
+		}
+		return float64(max(0, v-int(opts.Threshold)))
+	}
+
+	seen := make([]bool, len(l.Pix))
+	var spots []spot
+	var queue []image.Point
+
+	for y := 0; y < l.Height; y++ {
+		for x := 0; x < l.Width; x++ {
+			if seen[y*l.Width+x] || level(x, y) == 0 {
+				continue
+			}
+
+			// Flood fill the spot.
+			var s spot
+			var weight float64
+			queue = append(queue[:0], image.Pt(x, y))
+			seen[y*l.Width+x] = true
+
+			for len(queue) > 0 {
+				pt := queue[len(queue)-1]
+				queue = queue[:len(queue)-1]
+
+				w := level(pt.X, pt.Y)
+				s.Area++
+				s.X += float64(pt.X) * w
+				s.Y += float64(pt.Y) * w
+				weight += w
+
+				for _, next := range [...]image.Point{
+					{pt.X - 1, pt.Y}, {pt.X + 1, pt.Y},
+					{pt.X, pt.Y - 1}, {pt.X, pt.Y + 1},
+				} {
+					if next.X < 0 || next.Y < 0 || next.X >= l.Width || next.Y >= l.Height {
+						continue
+					}
+					i := next.Y*l.Width + next.X
+					if seen[i] || level(next.X, next.Y) == 0 {
+						continue
+					}
+					seen[i] = true
+					queue = append(queue, next)
+				}
+			}
+
+			if s.Area < opts.MinArea {
+				continue
+			}
+
+			s.X /= weight
+			s.Y /= weight
+			s.Brightness = weight
+			spots = append(spots, s)
+		}
+	}
+
+	sort.SliceStable(spots, func(i, j int) bool {
+		return spots[i].Brightness > spots[j].Brightness
+	})
+	return spots, nil
+}
+
+// colorAt returns the average color of the photo in a square of the given
+// radius around (x, y).
+func colorAt(p *photo, x, y float64, radius int) (r, g, b float64) {
+	bounds := p.Image.Bounds()
+	cx, cy := int(x), int(y)
+
+	var n int
+	for py := max(0, cy-radius); py <= min(bounds.Dy()-1, cy+radius); py++ {
+		for px := max(0, cx-radius); px <= min(bounds.Dx()-1, cx+radius); px++ {
+			pr, pg, pb, _ := p.Image.At(bounds.Min.X+px, bounds.Min.Y+py).RGBA()
+			r += float64(pr >> 8)
+			g += float64(pg >> 8)
+			b += float64(pb >> 8)
+			n++
+		}
+	}
+
+	if n == 0 {
+		return 0, 0, 0
+	}
+	return r / float64(n), g / float64(n), b / float64(n)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"time"
+
+	"dev.acmcsuf.com/christmasd"
+	"dev.acmcsuf.com/christmasd/ledrecord"
+	"github.com/lmittmann/tint"
+	"github.com/mattn/go-isatty"
+	"github.com/spf13/pflag"
+)
+
+var (
+	speed   = 1.0
+	seek    = time.Duration(0)
+	loop    = false
+	verbose = false
+)
+
+func init() {
+	pflag.Float64VarP(&speed, "speed", "s", speed, "playback speed multiplier")
+	pflag.DurationVar(&seek, "seek", seek, "position in the recording to start playing from")
+	pflag.BoolVarP(&loop, "loop", "l", loop, "loop the recording until interrupted")
+	pflag.BoolVarP(&verbose, "verbose", "v", verbose, "verbose logging")
+
+	pflag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] <recording> <websocket-url>\n", os.Args[0])
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Plays a recording made by christmasd onto a christmasd server,")
+		fmt.Fprintln(os.Stderr, "e.g. ws://localhost:9000/ws/TOKEN, or a christmasd-test session.")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Flags:")
+		pflag.PrintDefaults()
+	}
+}
+
+func main() {
+	log.SetFlags(0)
+	pflag.Parse()
+
+	if pflag.NArg() != 2 {
+		pflag.Usage()
+		os.Exit(2)
+	}
+
+	level := slog.LevelInfo
+	if verbose {
+		level = slog.LevelDebug
+	}
+
+	logHandler := tint.NewHandler(os.Stderr, &tint.Options{
+		Level:      level,
+		TimeFormat: "15:04:05 PM", // extended time.Kitchen
+		NoColor:    !isatty.IsTerminal(os.Stderr.Fd()),
+	})
+
+	logger := slog.New(logHandler)
+	slog.SetDefault(logger)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	if err := run(ctx, logger, pflag.Arg(0), pflag.Arg(1)); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(ctx context.Context, logger *slog.Logger, recordingPath, wsURL string) error {
+	f, err := os.Open(recordingPath)
+	if err != nil {
+		return fmt.Errorf("failed to open recording: %v", err)
+	}
+	defer f.Close()
+
+	client, err := christmasd.Dial(ctx, wsURL, christmasd.ClientOpts{
+		Logger: logger,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to connect to %q: %v", wsURL, err)
+	}
+	defer client.Close()
+
+	logger.Info(
+		"playing recording",
+		"file", recordingPath,
+		"leds", len(client.LEDs()),
+		"speed", speed,
+		"seek", seek,
+		"loop", loop)
+
+	err = ledrecord.Play(ctx, f, client, ledrecord.PlayOpts{
+		Speed: speed,
+		Seek:  seek,
+		Loop:  loop,
+	})
+	if err != nil && ctx.Err() == nil {
+		return fmt.Errorf("failed to play recording: %v", err)
+	}
+
+	logger.Info(
+		"playback finished")
+
+	return nil
+}
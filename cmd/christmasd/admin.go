@@ -2,11 +2,23 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
+	"io/fs"
+	"math"
 	"net/http"
-	"sync/atomic"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"dev.acmcsuf.com/christmas/lib/xcolor"
 	"dev.acmcsuf.com/christmasd"
+	"dev.acmcsuf.com/christmasd/ledrecord"
 	"github.com/go-chi/chi/v5"
 	"github.com/gofrs/uuid/v5"
 	"libdb.so/hrt"
@@ -14,15 +26,36 @@ import (
 
 type adminHandler struct {
 	*chi.Mux
-	server *christmasd.Server
-	token  *atomic.Pointer[string]
+	server   *christmasd.Server
+	tokens   *tokenStore
+	recorder *ledrecord.Recorder
+	reloader *reloader
+	sched    *scheduler
+	diag     *diagnostics
+	input    *dmxInput // nil if DMX input is disabled
+	override *override
+	bans     *banList
+	audit    *auditLog
+	state    *stateStore
+
+	recordingMu   sync.Mutex
+	recordingFile string
 }
 
-func newAdminHandler(server *christmasd.Server, token *atomic.Pointer[string]) *adminHandler {
+func newAdminHandler(server *christmasd.Server, tokens *tokenStore, recorder *ledrecord.Recorder, reloader *reloader, sched *scheduler, diag *diagnostics, override *override, input *dmxInput, bans *banList, audit *auditLog, state *stateStore, snapshot, metrics http.Handler) *adminHandler {
 	h := &adminHandler{
-		Mux:    chi.NewRouter(),
-		server: server,
-		token:  token,
+		Mux:      chi.NewRouter(),
+		server:   server,
+		tokens:   tokens,
+		recorder: recorder,
+		reloader: reloader,
+		sched:    sched,
+		diag:     diag,
+		override: override,
+		input:    input,
+		bans:     bans,
+		audit:    audit,
+		state:    state,
 	}
 
 	h.Use(hrt.Use(hrt.Opts{
@@ -33,9 +66,51 @@ func newAdminHandler(server *christmasd.Server, token *atomic.Pointer[string]) *
 		ErrorWriter: hrt.TextErrorWriter,
 	}))
 
+	// Anything but a GET might have changed a setting that is kept across
+	// restarts.
+	h.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r)
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				h.state.changed()
+			}
+		})
+	})
+
 	h.Patch("/token", h.patchConfig)
 	h.Post("/token/randomize", h.randomizeToken)
+	h.Get("/tokens", hrt.Wrap(h.listTokens))
+	h.Post("/tokens", hrt.Wrap(h.createToken))
+	h.Delete("/tokens/{id}", hrt.Wrap(h.revokeToken))
 	h.Post("/kick-all", hrt.Wrap(h.kickAll))
+	h.Get("/sessions", hrt.Wrap(h.listSessions))
+	h.Post("/sessions/{id}/kick", hrt.Wrap(h.kickSession))
+	h.Post("/notice", hrt.Wrap(h.sendNotice))
+	h.Get("/bans", hrt.Wrap(h.listBans))
+	h.Post("/bans", hrt.Wrap(h.addBan))
+	h.Delete("/bans/{id}", hrt.Wrap(h.removeBan))
+	h.Get("/audit", hrt.Wrap(h.queryAudit))
+	h.Get("/recording", hrt.Wrap(h.getRecording))
+	h.Post("/recording/start", hrt.Wrap(h.startRecording))
+	h.Post("/recording/stop", hrt.Wrap(h.stopRecording))
+	h.Post("/reload", hrt.Wrap(h.reload))
+	h.Get("/schedule", hrt.Wrap(h.getSchedule))
+	h.Post("/schedule/override", hrt.Wrap(h.overrideSchedule))
+	h.Get("/brightness", hrt.Wrap(h.getBrightness))
+	h.Post("/brightness", hrt.Wrap(h.setBrightness))
+	h.Get("/canvas", hrt.Wrap(h.getCanvas))
+	h.Post("/canvas", hrt.Wrap(h.setCanvas))
+	h.Get("/frames", hrt.Wrap(h.getFrameStats))
+	h.Get("/diagnostics", hrt.Wrap(h.getDiagnostics))
+	h.Post("/diagnostics/start", hrt.Wrap(h.startDiagnostics))
+	h.Post("/diagnostics/stop", hrt.Wrap(h.stopDiagnostics))
+	h.Get("/override", hrt.Wrap(h.getOverride))
+	h.Post("/override/color", hrt.Wrap(h.overrideColor))
+	h.Post("/override/image", hrt.Wrap(h.overrideImage))
+	h.Post("/override/stop", hrt.Wrap(h.stopOverride))
+	h.Get("/input", hrt.Wrap(h.getInput))
+	h.Get("/snapshot.png", snapshot.ServeHTTP)
+	h.Handle("/metrics", metrics)
 
 	return h
 }
@@ -47,8 +122,8 @@ func (h *adminHandler) patchConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token := string(b)
-	h.token.Store(&token)
+	h.tokens.setDefault(string(b))
+	h.audit.recordAdmin(r, "token.set", nil)
 }
 
 func (h *adminHandler) randomizeToken(w http.ResponseWriter, r *http.Request) {
@@ -58,17 +133,914 @@ func (h *adminHandler) randomizeToken(w http.ResponseWriter, r *http.Request) {
 	}
 
 	token := uuid.String()
-	h.token.Store(&token)
+	h.tokens.setDefault(token)
+	h.audit.recordAdmin(r, "token.randomize", nil)
 
 	w.Header().Set("Content-Type", "text/plain")
 	w.Write([]byte(token))
 }
 
+func (h *adminHandler) listTokens(ctx context.Context, req hrt.None) ([]accessToken, error) {
+	return h.tokens.list(), nil
+}
+
+type createTokenRequest struct {
+	// Label names the token in logs, e.g. the team that it is handed to.
+	Label string `query:"label"`
+	// Scope is view, control or admin. It defaults to control.
+	Scope string `query:"scope"`
+	// Expires is when the token expires, either as a duration from now,
+	// e.g. "6h", or as an RFC 3339 time. If empty, it never expires.
+	Expires string `query:"expires"`
+	// MaxUses is how many connections the token can be used for. Zero means
+	// unlimited.
+	MaxUses int `query:"max_uses"`
+}
+
+func (h *adminHandler) createToken(ctx context.Context, req createTokenRequest) (accessToken, error) {
+	scope := scopeControl
+	if req.Scope != "" {
+		if err := scope.UnmarshalText([]byte(req.Scope)); err != nil {
+			return accessToken{}, hrt.WrapHTTPError(http.StatusBadRequest, err)
+		}
+	}
+
+	var expires *time.Time
+	if req.Expires != "" {
+		t, err := parseExpiry(req.Expires, time.Now())
+		if err != nil {
+			return accessToken{}, hrt.WrapHTTPError(http.StatusBadRequest, err)
+		}
+		expires = &t
+	}
+
+	if req.MaxUses < 0 {
+		return accessToken{}, hrt.NewHTTPError(http.StatusBadRequest, "max_uses must not be negative")
+	}
+
+	token, err := h.tokens.create(req.Label, scope, expires, req.MaxUses)
+	if err != nil {
+		return accessToken{}, err
+	}
+
+	h.audit.recordAdmin(hrt.RequestFromContext(ctx), "token.create", map[string]any{
+		"id":       token.ID,
+		"label":    token.Label,
+		"scope":    token.Scope,
+		"expires":  token.Expires,
+		"max_uses": token.MaxUses,
+	})
+
+	return token, nil
+}
+
+// parseExpiry parses a duration from now or an RFC 3339 time.
+func parseExpiry(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		if d <= 0 {
+			return time.Time{}, fmt.Errorf("expiry %v is not in the future", d)
+		}
+		return now.Add(d), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid expiry %q, expected a duration or an RFC 3339 time", s)
+	}
+	if !t.After(now) {
+		return time.Time{}, fmt.Errorf("expiry %v is not in the future", t)
+	}
+	return t, nil
+}
+
+type revokeTokenRequest struct {
+	ID string `url:"id"`
+}
+
+type revokeTokenResponse struct {
+	Token accessToken `json:"token"`
+	// Kicked is the number of sessions that were kicked because they were
+	// connected with the token.
+	Kicked int `json:"kicked"`
+}
+
+func (h *adminHandler) revokeToken(ctx context.Context, req revokeTokenRequest) (revokeTokenResponse, error) {
+	token, ok := h.tokens.revoke(req.ID)
+	if !ok {
+		return revokeTokenResponse{}, hrt.NewHTTPError(http.StatusNotFound, "no such token")
+	}
+
+	kicked := h.server.KickSessions("token revoked", func(s *christmasd.Session) bool {
+		return s.TokenID() == token.ID
+	})
+
+	h.audit.recordAdmin(hrt.RequestFromContext(ctx), "token.revoke", map[string]any{
+		"id":     token.ID,
+		"label":  token.Label,
+		"kicked": kicked,
+	})
+
+	return revokeTokenResponse{
+		Token:  token,
+		Kicked: kicked,
+	}, nil
+}
+
 type kickAllRequest struct {
 	Reason string `query:"reason"`
 }
 
 func (h *adminHandler) kickAll(ctx context.Context, req kickAllRequest) (hrt.None, error) {
-	h.server.KickAllConnections(req.Reason)
+	kicked := h.server.KickSessions(req.Reason, func(*christmasd.Session) bool { return true })
+
+	h.audit.recordAdmin(hrt.RequestFromContext(ctx), "kick", map[string]any{
+		"reason": req.Reason,
+		"kicked": kicked,
+	})
+
+	return hrt.Empty, nil
+}
+
+type sessionInfo struct {
+	ID       string    `json:"id"`
+	Addr     string    `json:"addr"`
+	Label    string    `json:"label,omitempty"`
+	TokenID  string    `json:"token_id,omitempty"`
+	ViewOnly bool      `json:"view_only"`
+	Started  time.Time `json:"started"`
+}
+
+func (h *adminHandler) listSessions(ctx context.Context, req hrt.None) ([]sessionInfo, error) {
+	sessions := h.server.Sessions()
+	slices.SortFunc(sessions, func(a, b *christmasd.Session) int {
+		return a.Started().Compare(b.Started())
+	})
+
+	infos := make([]sessionInfo, len(sessions))
+	for i, s := range sessions {
+		infos[i] = sessionInfo{
+			ID:       s.ID(),
+			Addr:     s.RemoteAddr(),
+			Label:    s.Label(),
+			TokenID:  s.TokenID(),
+			ViewOnly: s.ViewOnly(),
+			Started:  s.Started(),
+		}
+	}
+	return infos, nil
+}
+
+type kickSessionRequest struct {
+	ID     string `url:"id"`
+	Reason string `query:"reason"`
+}
+
+func (h *adminHandler) kickSession(ctx context.Context, req kickSessionRequest) (hrt.None, error) {
+	var label string
+	kicked := h.server.KickSessions(req.Reason, func(s *christmasd.Session) bool {
+		if s.ID() != req.ID {
+			return false
+		}
+		label = s.Label()
+		return true
+	})
+	if kicked == 0 {
+		return hrt.Empty, hrt.NewHTTPError(http.StatusNotFound, "no such session")
+	}
+
+	h.audit.recordAdmin(hrt.RequestFromContext(ctx), "kick", map[string]any{
+		"session": req.ID,
+		"label":   label,
+		"reason":  req.Reason,
+		"kicked":  kicked,
+	})
+
 	return hrt.Empty, nil
 }
+
+type sendNoticeRequest struct {
+	// Message is the message for the users.
+	Message string `query:"message"`
+	// Kind is what the notice is about, e.g. "maintenance". It defaults to
+	// "info". Sessions are kicked through the kick endpoints instead.
+	Kind string `query:"kind"`
+	// Deadline is when the notice takes effect, either as a duration from
+	// now, e.g. "10m", or as an RFC 3339 time. It is optional.
+	Deadline string `query:"deadline"`
+	// Session is the ID of the session to send the notice to. If empty, it
+	// is sent to all sessions.
+	Session string `query:"session"`
+}
+
+type sendNoticeResponse struct {
+	// Sent is the number of sessions that the notice was sent to.
+	Sent int `json:"sent"`
+}
+
+func (h *adminHandler) sendNotice(ctx context.Context, req sendNoticeRequest) (sendNoticeResponse, error) {
+	if req.Message == "" {
+		return sendNoticeResponse{}, hrt.NewHTTPError(http.StatusBadRequest, "missing message")
+	}
+
+	notice := christmasd.Notice{
+		Kind:    christmasd.NoticeInfo,
+		Message: req.Message,
+	}
+
+	if req.Kind != "" {
+		kind, err := christmasd.ParseNoticeKind(req.Kind)
+		if err != nil {
+			return sendNoticeResponse{}, hrt.WrapHTTPError(http.StatusBadRequest, err)
+		}
+		if kind == christmasd.NoticeKicked {
+			return sendNoticeResponse{}, hrt.NewHTTPError(http.StatusBadRequest, "use the kick endpoints to kick sessions")
+		}
+		notice.Kind = kind
+	}
+
+	if req.Deadline != "" {
+		t, err := parseExpiry(req.Deadline, time.Now())
+		if err != nil {
+			return sendNoticeResponse{}, hrt.WrapHTTPError(http.StatusBadRequest, fmt.Errorf("deadline: %v", err))
+		}
+		notice.Deadline = t
+	}
+
+	sent := h.server.Notify(notice, func(s *christmasd.Session) bool {
+		return req.Session == "" || s.ID() == req.Session
+	})
+	if sent == 0 && req.Session != "" {
+		return sendNoticeResponse{}, hrt.NewHTTPError(http.StatusNotFound, "no such session")
+	}
+
+	h.audit.recordAdmin(hrt.RequestFromContext(ctx), "notice", map[string]any{
+		"kind":     notice.Kind.String(),
+		"message":  notice.Message,
+		"deadline": req.Deadline,
+		"session":  req.Session,
+		"sent":     sent,
+	})
+
+	return sendNoticeResponse{Sent: sent}, nil
+}
+
+func (h *adminHandler) listBans(ctx context.Context, req hrt.None) ([]clientBan, error) {
+	return h.bans.list(), nil
+}
+
+type addBanRequest struct {
+	// Addr is the IP address or CIDR network to ban.
+	Addr string `query:"addr"`
+	// Reason is why the clients are banned. It is also the reason that
+	// their sessions are kicked with.
+	Reason string `query:"reason"`
+	// Expires is when the ban is lifted, either as a duration from now, e.g.
+	// "1h", or as an RFC 3339 time. If empty, it is never lifted.
+	Expires string `query:"expires"`
+}
+
+type addBanResponse struct {
+	Ban clientBan `json:"ban"`
+	// Kicked is the number of sessions that were kicked because they were
+	// connected from the banned address.
+	Kicked int `json:"kicked"`
+}
+
+func (h *adminHandler) addBan(ctx context.Context, req addBanRequest) (addBanResponse, error) {
+	addr, err := parseBanAddr(req.Addr)
+	if err != nil {
+		return addBanResponse{}, hrt.WrapHTTPError(http.StatusBadRequest, err)
+	}
+
+	var expires *time.Time
+	if req.Expires != "" {
+		t, err := parseExpiry(req.Expires, time.Now())
+		if err != nil {
+			return addBanResponse{}, hrt.WrapHTTPError(http.StatusBadRequest, err)
+		}
+		expires = &t
+	}
+
+	ban, err := h.bans.add(addr, req.Reason, expires)
+	if err != nil {
+		return addBanResponse{}, err
+	}
+
+	reason := "banned"
+	if req.Reason != "" {
+		reason += ": " + req.Reason
+	}
+	now := time.Now()
+	kicked := h.server.KickSessions(reason, func(s *christmasd.Session) bool {
+		return ban.matches(s.RemoteAddr(), now)
+	})
+
+	h.audit.recordAdmin(hrt.RequestFromContext(ctx), "ban.add", map[string]any{
+		"id":      ban.ID,
+		"addr":    ban.Addr,
+		"reason":  ban.Reason,
+		"expires": ban.Expires,
+		"kicked":  kicked,
+	})
+
+	return addBanResponse{
+		Ban:    ban,
+		Kicked: kicked,
+	}, nil
+}
+
+type removeBanRequest struct {
+	ID string `url:"id"`
+}
+
+func (h *adminHandler) removeBan(ctx context.Context, req removeBanRequest) (clientBan, error) {
+	ban, ok := h.bans.remove(req.ID)
+	if !ok {
+		return clientBan{}, hrt.NewHTTPError(http.StatusNotFound, "no such ban")
+	}
+
+	h.audit.recordAdmin(hrt.RequestFromContext(ctx), "ban.remove", map[string]any{
+		"id":   ban.ID,
+		"addr": ban.Addr,
+	})
+
+	return ban, nil
+}
+
+type queryAuditRequest struct {
+	// Since and Until limit the events to a time range, either as durations
+	// before now, e.g. "1h", or as RFC 3339 times. Both are optional.
+	Since string `query:"since"`
+	Until string `query:"until"`
+	// Event only returns events with this name, e.g. "session.end".
+	Event string `query:"event"`
+	// Limit is the largest number of events to return, counting back from
+	// the latest. It defaults to 1000.
+	Limit int `query:"limit"`
+}
+
+func (h *adminHandler) queryAudit(ctx context.Context, req queryAuditRequest) ([]auditEvent, error) {
+	now := time.Now()
+	q := auditQuery{
+		Event: req.Event,
+		Limit: req.Limit,
+	}
+
+	var err error
+	if req.Since != "" {
+		if q.Since, err = parseAuditTime(req.Since, now); err != nil {
+			return nil, hrt.WrapHTTPError(http.StatusBadRequest, fmt.Errorf("since: %v", err))
+		}
+	}
+	if req.Until != "" {
+		if q.Until, err = parseAuditTime(req.Until, now); err != nil {
+			return nil, hrt.WrapHTTPError(http.StatusBadRequest, fmt.Errorf("until: %v", err))
+		}
+	}
+
+	switch {
+	case q.Limit < 0:
+		return nil, hrt.NewHTTPError(http.StatusBadRequest, "limit must not be negative")
+	case q.Limit == 0:
+		q.Limit = 1000
+	}
+
+	events, err := h.audit.query(q)
+	if err != nil {
+		if errors.Is(err, errAuditDisabled) {
+			return nil, hrt.WrapHTTPError(http.StatusNotFound, err)
+		}
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// parseAuditTime parses a duration before now, e.g. "1h", or an RFC 3339
+// time.
+func parseAuditTime(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, expected a duration or an RFC 3339 time", s)
+	}
+	return t, nil
+}
+
+type recordingStatus struct {
+	Recording bool   `json:"recording"`
+	File      string `json:"file,omitempty"`
+	Frames    int    `json:"frames,omitempty"`
+}
+
+func (h *adminHandler) getRecording(ctx context.Context, req hrt.None) (recordingStatus, error) {
+	h.recordingMu.Lock()
+	defer h.recordingMu.Unlock()
+
+	if !h.recorder.Recording() {
+		return recordingStatus{}, nil
+	}
+
+	return recordingStatus{
+		Recording: true,
+		File:      h.recordingFile,
+		Frames:    h.recorder.Frames(),
+	}, nil
+}
+
+type startRecordingRequest struct {
+	// Name is the name of the recording file, without the extension.
+	// If empty, the current time is used.
+	Name string `query:"name"`
+}
+
+func (h *adminHandler) startRecording(ctx context.Context, req startRecordingRequest) (recordingStatus, error) {
+	name := req.Name
+	if name == "" {
+		name = time.Now().Format("2006-01-02T15-04-05")
+	}
+	if name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return recordingStatus{}, hrt.NewHTTPError(http.StatusBadRequest, "invalid recording name")
+	}
+
+	h.recordingMu.Lock()
+	defer h.recordingMu.Unlock()
+
+	if h.recorder.Recording() {
+		return recordingStatus{}, hrt.WrapHTTPError(http.StatusConflict, ledrecord.ErrAlreadyRecording)
+	}
+
+	recordDir := h.reloader.config().Recording.Dir
+	if err := os.MkdirAll(recordDir, 0755); err != nil {
+		return recordingStatus{}, fmt.Errorf("failed to create recording directory: %w", err)
+	}
+
+	path := filepath.Join(recordDir, name+ledrecord.FileExtension)
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return recordingStatus{}, hrt.NewHTTPError(http.StatusConflict, "recording already exists")
+		}
+		return recordingStatus{}, fmt.Errorf("failed to create recording file: %w", err)
+	}
+
+	if err := h.recorder.Start(f); err != nil {
+		f.Close()
+		return recordingStatus{}, fmt.Errorf("failed to start recording: %w", err)
+	}
+
+	h.recordingFile = path
+
+	h.audit.recordAdmin(hrt.RequestFromContext(ctx), "recording.start", map[string]any{
+		"file": path,
+	})
+
+	return recordingStatus{
+		Recording: true,
+		File:      path,
+	}, nil
+}
+
+func (h *adminHandler) stopRecording(ctx context.Context, req hrt.None) (recordingStatus, error) {
+	h.recordingMu.Lock()
+	defer h.recordingMu.Unlock()
+
+	frames, err := h.recorder.Stop()
+	if err != nil {
+		if errors.Is(err, ledrecord.ErrNotRecording) {
+			return recordingStatus{}, hrt.WrapHTTPError(http.StatusConflict, err)
+		}
+		return recordingStatus{}, fmt.Errorf("failed to stop recording: %w", err)
+	}
+
+	h.audit.recordAdmin(hrt.RequestFromContext(ctx), "recording.stop", map[string]any{
+		"file":   h.recordingFile,
+		"frames": frames,
+	})
+
+	return recordingStatus{
+		File:   h.recordingFile,
+		Frames: frames,
+	}, nil
+}
+
+type reloadResponse struct {
+	LEDs   int `json:"leds"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+func (h *adminHandler) reload(ctx context.Context, req hrt.None) (reloadResponse, error) {
+	if err := h.reloader.reload(); err != nil {
+		return reloadResponse{}, hrt.WrapHTTPError(http.StatusUnprocessableEntity, err)
+	}
+
+	width, height := h.reloader.leds.ImageSize()
+	h.audit.recordAdmin(hrt.RequestFromContext(ctx), "reload", map[string]any{
+		"leds":   len(h.reloader.leds.LEDs()),
+		"width":  width,
+		"height": height,
+	})
+
+	return reloadResponse{
+		LEDs:   len(h.reloader.leds.LEDs()),
+		Width:  width,
+		Height: height,
+	}, nil
+}
+
+type scheduleStatus struct {
+	On         bool       `json:"on"`
+	Brightness float64    `json:"brightness"`
+	Reason     string     `json:"reason,omitempty"`
+	Until      *time.Time `json:"until,omitempty"`
+	OffAction  offAction  `json:"off_action"`
+	TimeZone   string     `json:"timezone"`
+	// Override is set while an admin forces the tree on or off.
+	Override *scheduleOverride `json:"override,omitempty"`
+}
+
+func (h *adminHandler) getSchedule(ctx context.Context, req hrt.None) (scheduleStatus, error) {
+	state := h.sched.current()
+	cfg := h.reloader.config().Schedule
+
+	status := scheduleStatus{
+		On:         state.On,
+		Brightness: state.Brightness,
+		Reason:     state.Reason,
+		OffAction:  cfg.OffAction,
+		TimeZone:   cfg.TimeZone,
+	}
+	if status.TimeZone == "" {
+		status.TimeZone = time.Local.String()
+	}
+	if !state.Until.IsZero() {
+		status.Until = &state.Until
+	}
+	status.Override = h.sched.currentOverride()
+
+	return status, nil
+}
+
+type overrideScheduleRequest struct {
+	// State is on or off to force the tree on or off, or auto to follow the
+	// schedule again.
+	State string `query:"state"`
+	// Duration is how long the tree is forced on or off, e.g. "2h". If empty,
+	// it is until the state is set back to auto.
+	Duration string `query:"duration"`
+}
+
+func (h *adminHandler) overrideSchedule(ctx context.Context, req overrideScheduleRequest) (scheduleStatus, error) {
+	var override *scheduleOverride
+	switch req.State {
+	case "on", "off":
+		override = &scheduleOverride{On: req.State == "on"}
+		if req.Duration != "" {
+			until, err := parseExpiry(req.Duration, time.Now())
+			if err != nil {
+				return scheduleStatus{}, hrt.WrapHTTPError(http.StatusBadRequest, err)
+			}
+			override.Until = &until
+		}
+	case "auto":
+	default:
+		return scheduleStatus{}, hrt.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("unknown state %q, expected on, off or auto", req.State))
+	}
+
+	h.sched.setOverride(override)
+
+	h.audit.recordAdmin(hrt.RequestFromContext(ctx), "schedule.override", map[string]any{
+		"state":    req.State,
+		"duration": req.Duration,
+	})
+
+	return h.getSchedule(ctx, hrt.Empty)
+}
+
+type brightnessStatus struct {
+	// Level is the brightness set through the admin API, from 0 to 1.
+	Level float64 `json:"level"`
+	// Effective is the brightness that the LEDs are drawn with, after the
+	// config and the schedule are applied.
+	Effective float64 `json:"effective"`
+}
+
+func (h *adminHandler) getBrightness(ctx context.Context, req hrt.None) (brightnessStatus, error) {
+	level, effective := h.reloader.leds.brightness()
+	return brightnessStatus{
+		Level:     level,
+		Effective: effective,
+	}, nil
+}
+
+type setBrightnessRequest struct {
+	// Level scales the brightness from 0 to 1, on top of the configured
+	// brightness and the schedule.
+	Level string `query:"level"`
+}
+
+func (h *adminHandler) setBrightness(ctx context.Context, req setBrightnessRequest) (brightnessStatus, error) {
+	level, err := strconv.ParseFloat(req.Level, 64)
+	if err != nil || level < 0 || level > 1 {
+		return brightnessStatus{}, hrt.NewHTTPError(http.StatusBadRequest, "level must be a number between 0 and 1")
+	}
+
+	h.reloader.leds.setLevel(level)
+
+	h.audit.recordAdmin(hrt.RequestFromContext(ctx), "brightness.set", map[string]any{
+		"level": level,
+	})
+
+	return h.getBrightness(ctx, hrt.Empty)
+}
+
+type canvasStatus struct {
+	FrameRate int     `json:"fps"`
+	PPI       float64 `json:"ppi"`
+	Width     int     `json:"width"`
+	Height    int     `json:"height"`
+}
+
+func (h *adminHandler) getCanvas(ctx context.Context, req hrt.None) (canvasStatus, error) {
+	frameRate, ppi := h.reloader.leds.canvasSettings()
+	width, height := h.reloader.leds.ImageSize()
+	return canvasStatus{
+		FrameRate: frameRate,
+		PPI:       ppi,
+		Width:     width,
+		Height:    height,
+	}, nil
+}
+
+type setCanvasRequest struct {
+	// FrameRate is the new frame rate. If empty, it is left alone.
+	FrameRate string `query:"fps"`
+	// PPI is the new pixel density of the canvas. If empty, it is left
+	// alone. Sessions are told about the new canvas size.
+	PPI string `query:"ppi"`
+}
+
+func (h *adminHandler) setCanvas(ctx context.Context, req setCanvasRequest) (canvasStatus, error) {
+	var frameRate int
+	if req.FrameRate != "" {
+		var err error
+		frameRate, err = strconv.Atoi(req.FrameRate)
+		if err != nil || frameRate < 1 || frameRate > 1000 {
+			return canvasStatus{}, hrt.NewHTTPError(http.StatusBadRequest, "fps must be a whole number between 1 and 1000")
+		}
+	}
+
+	var ppi float64
+	if req.PPI != "" {
+		var err error
+		ppi, err = strconv.ParseFloat(req.PPI, 64)
+		if err != nil || !(ppi > 0) || math.IsInf(ppi, 0) {
+			return canvasStatus{}, hrt.NewHTTPError(http.StatusBadRequest, "ppi must be a positive number")
+		}
+	}
+
+	if frameRate == 0 && ppi == 0 {
+		return canvasStatus{}, hrt.NewHTTPError(http.StatusBadRequest, "fps or ppi is required")
+	}
+
+	if err := h.reloader.setCanvas(frameRate, ppi); err != nil {
+		return canvasStatus{}, hrt.WrapHTTPError(http.StatusUnprocessableEntity, err)
+	}
+
+	details := map[string]any{}
+	if frameRate != 0 {
+		details["fps"] = frameRate
+	}
+	if ppi != 0 {
+		details["ppi"] = ppi
+	}
+	h.audit.recordAdmin(hrt.RequestFromContext(ctx), "canvas.set", details)
+
+	return h.getCanvas(ctx, hrt.Empty)
+}
+
+func (h *adminHandler) getFrameStats(ctx context.Context, req hrt.None) (christmasd.FrameStats, error) {
+	return h.reloader.leds.frameStats(), nil
+}
+
+func (h *adminHandler) getDiagnostics(ctx context.Context, req hrt.None) (diagStatus, error) {
+	return h.diag.status(), nil
+}
+
+type startDiagnosticsRequest struct {
+	// Pattern is one of walk, rgb, binary or points. For points, the body is
+	// a CSV file of the x and y coordinates of the LEDs to light.
+	Pattern string `query:"pattern"`
+	// Interval is how long each step of the pattern is shown for, e.g.
+	// "250ms". Each pattern has its own default.
+	Interval string `query:"interval"`
+	// Duration is how long the pattern runs for, e.g. "5m". If empty, it runs
+	// until it is stopped.
+	Duration string `query:"duration"`
+}
+
+func (h *adminHandler) startDiagnostics(ctx context.Context, req startDiagnosticsRequest) (diagStatus, error) {
+	var opts diagOptions
+	var err error
+
+	opts.Pattern = req.Pattern
+	if req.Interval != "" {
+		opts.Interval, err = time.ParseDuration(req.Interval)
+		if err != nil {
+			return diagStatus{}, hrt.NewHTTPError(http.StatusBadRequest, "invalid interval: "+err.Error())
+		}
+	}
+	if req.Duration != "" {
+		opts.Duration, err = time.ParseDuration(req.Duration)
+		if err != nil {
+			return diagStatus{}, hrt.NewHTTPError(http.StatusBadRequest, "invalid duration: "+err.Error())
+		}
+	}
+
+	opts, err = parseDiagOptions(opts)
+	if err != nil {
+		return diagStatus{}, hrt.WrapHTTPError(http.StatusBadRequest, err)
+	}
+
+	if opts.Pattern == "points" {
+		opts.LEDs, err = h.diagPointLEDs(hrt.RequestFromContext(ctx).Body)
+		if err != nil {
+			return diagStatus{}, hrt.WrapHTTPError(http.StatusBadRequest, err)
+		}
+	}
+
+	status := h.diag.start(opts)
+
+	h.audit.recordAdmin(hrt.RequestFromContext(ctx), "diagnostics.start", map[string]any{
+		"pattern":  opts.Pattern,
+		"interval": opts.Interval.String(),
+		"duration": opts.Duration.String(),
+	})
+
+	return status, nil
+}
+
+// diagPointLEDs returns the indices of the LEDs at the coordinates in the
+// given CSV file.
+func (h *adminHandler) diagPointLEDs(r io.Reader) ([]int, error) {
+	points, err := readLEDPoints(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid points: %v", err)
+	}
+	if len(points) == 0 {
+		return nil, errors.New("no points given")
+	}
+
+	ledPoints := h.reloader.leds.ledPoints()
+
+	var leds []int
+	for _, point := range points {
+		n := len(leds)
+		for i, ledPoint := range ledPoints {
+			if ledPoint.Point == point.Point {
+				leds = append(leds, i)
+			}
+		}
+		if len(leds) == n {
+			return nil, fmt.Errorf("no LED at %d,%d", point.X, point.Y)
+		}
+	}
+
+	return leds, nil
+}
+
+func (h *adminHandler) stopDiagnostics(ctx context.Context, req hrt.None) (diagStatus, error) {
+	if h.diag.status().Running {
+		h.diag.stop()
+		h.audit.recordAdmin(hrt.RequestFromContext(ctx), "diagnostics.stop", nil)
+	}
+	return h.diag.status(), nil
+}
+
+func (h *adminHandler) getOverride(ctx context.Context, req hrt.None) (overrideStatus, error) {
+	return h.override.status(), nil
+}
+
+type overrideColorRequest struct {
+	// Color is a hex color, e.g. "#ff8800".
+	Color string `query:"color"`
+	// Duration is how long the color is shown for, e.g. "5m". If empty, it
+	// is shown until it is stopped.
+	Duration string `query:"duration"`
+}
+
+func (h *adminHandler) overrideColor(ctx context.Context, req overrideColorRequest) (overrideStatus, error) {
+	duration, err := parseOverrideDuration(req.Duration)
+	if err != nil {
+		return overrideStatus{}, err
+	}
+
+	c, err := parseHexColor(req.Color)
+	if err != nil {
+		return overrideStatus{}, hrt.WrapHTTPError(http.StatusBadRequest, err)
+	}
+
+	src := &colorOverride{color: xcolor.RGB{R: c.R, G: c.G, B: c.B}}
+	return h.startOverride(ctx, src, overrideRun{
+		Kind:     "color",
+		Color:    fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B),
+		Duration: duration,
+	})
+}
+
+type overrideImageRequest struct {
+	// Fit is how the image is scaled into the canvas: contain, cover or
+	// stretch. It defaults to contain.
+	Fit string `query:"fit"`
+	// Duration is how long the image is shown for, e.g. "5m". If empty, it
+	// is shown until it is stopped.
+	Duration string `query:"duration"`
+}
+
+// overrideImage shows the PNG, JPEG or GIF image in the body. Animated GIFs
+// are looped.
+func (h *adminHandler) overrideImage(ctx context.Context, req overrideImageRequest) (overrideStatus, error) {
+	duration, err := parseOverrideDuration(req.Duration)
+	if err != nil {
+		return overrideStatus{}, err
+	}
+
+	fit, err := parseImageFit(req.Fit)
+	if err != nil {
+		return overrideStatus{}, hrt.WrapHTTPError(http.StatusBadRequest, err)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(hrt.RequestFromContext(ctx).Body, maxOverrideUpload+1))
+	if err != nil {
+		return overrideStatus{}, hrt.WrapHTTPError(http.StatusBadRequest, err)
+	}
+	if len(data) == 0 {
+		return overrideStatus{}, hrt.NewHTTPError(http.StatusBadRequest, "no image given")
+	}
+	if len(data) > maxOverrideUpload {
+		return overrideStatus{}, hrt.NewHTTPError(http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("image is larger than %d MiB", maxOverrideUpload>>20))
+	}
+
+	src, kind, err := decodeOverrideImage(data, fit)
+	if err != nil {
+		return overrideStatus{}, hrt.WrapHTTPError(http.StatusBadRequest, err)
+	}
+
+	return h.startOverride(ctx, src, overrideRun{
+		Kind:     kind,
+		Fit:      fit,
+		Duration: duration,
+	})
+}
+
+func (h *adminHandler) startOverride(ctx context.Context, src overrideSource, run overrideRun) (overrideStatus, error) {
+	status, err := h.override.start(src, run)
+	if err != nil {
+		return status, err
+	}
+
+	h.audit.recordAdmin(hrt.RequestFromContext(ctx), "override.start", map[string]any{
+		"kind":     run.Kind,
+		"color":    run.Color,
+		"fit":      run.Fit,
+		"duration": run.Duration.String(),
+	})
+
+	return status, nil
+}
+
+func parseOverrideDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, hrt.NewHTTPError(http.StatusBadRequest, "invalid duration: "+err.Error())
+	}
+	if d < 0 {
+		return 0, hrt.NewHTTPError(http.StatusBadRequest, "duration must not be negative")
+	}
+	return d, nil
+}
+
+func (h *adminHandler) stopOverride(ctx context.Context, req hrt.None) (overrideStatus, error) {
+	if h.override.status().Active {
+		h.override.stop()
+		h.audit.recordAdmin(hrt.RequestFromContext(ctx), "override.stop", nil)
+	}
+	return h.override.status(), nil
+}
+
+func (h *adminHandler) getInput(ctx context.Context, req hrt.None) (dmxInputStatus, error) {
+	if h.input == nil {
+		return dmxInputStatus{}, hrt.NewHTTPError(http.StatusNotFound, "DMX input is disabled")
+	}
+	return h.input.status(), nil
+}
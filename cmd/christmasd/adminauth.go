@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"libdb.so/hserve"
+)
+
+type adminConfig struct {
+	// Token is a bearer token that admin requests may authenticate with.
+	Token string `toml:"token,omitempty"`
+	// Users maps usernames to passwords that admin requests may
+	// authenticate with using HTTP basic authentication. Requests that change
+	// anything are rejected if a browser sent them from another site.
+	Users map[string]string `toml:"users,omitempty"`
+	// Socket is the path of a Unix socket to serve the admin API on, in
+	// addition to server.admin_addr. Requests over the socket don't need to
+	// authenticate, since only the users allowed by the socket's file mode
+	// and peer credentials can connect.
+	Socket string `toml:"socket,omitempty"`
+	// SocketMode is the file mode of the socket.
+	SocketMode fileMode `toml:"socket_mode"`
+	// SocketUIDs and SocketGIDs are the users and groups that may use the
+	// socket, besides root and the user that the daemon runs as. Peer
+	// credentials are only checked on Linux.
+	SocketUIDs []int `toml:"socket_uids,omitempty"`
+	SocketGIDs []int `toml:"socket_gids,omitempty"`
+}
+
+// authRequired returns whether requests to the admin HTTP server must
+// authenticate. It is true once a token or users are configured. Admin-scoped
+// access tokens are accepted as bearer tokens as well, but they don't turn
+// authentication on by themselves.
+func (cfg adminConfig) authRequired() bool {
+	return cfg.Token != "" || len(cfg.Users) > 0
+}
+
+func (cfg adminConfig) validate() error {
+	var errs []error
+	for user := range cfg.Users {
+		if user == "" || strings.Contains(user, ":") {
+			errs = append(errs, fmt.Errorf("users: invalid username %q", user))
+		}
+	}
+	if cfg.SocketMode&^0777 != 0 {
+		errs = append(errs, fmt.Errorf("socket_mode: %v has more than permission bits", fs.FileMode(cfg.SocketMode)))
+	}
+	return errors.Join(errs...)
+}
+
+// allowsPeer returns whether a process with the given credentials may use the
+// admin socket.
+func (cfg adminConfig) allowsPeer(cred peerCred) bool {
+	return cred.UID == 0 ||
+		cred.UID == os.Getuid() ||
+		slices.Contains(cfg.SocketUIDs, cred.UID) ||
+		slices.Contains(cfg.SocketGIDs, cred.GID)
+}
+
+// fileMode is a file mode that is encoded as an octal string, e.g. "0660".
+type fileMode fs.FileMode
+
+func (m fileMode) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("%04o", uint32(m))), nil
+}
+
+func (m *fileMode) UnmarshalText(text []byte) error {
+	mode, err := strconv.ParseUint(string(text), 8, 32)
+	if err != nil {
+		return fmt.Errorf("invalid file mode %q, expected octal digits like 0660", text)
+	}
+	*m = fileMode(mode)
+	return nil
+}
+
+// peerCred is the credentials of the process on the other end of a Unix
+// socket.
+type peerCred struct {
+	PID int
+	UID int
+	GID int
+}
+
+// adminSocketKey is set in the context of requests that came in over the
+// admin socket, with the peer's credentials as its value. The credentials are
+// zero if they are not supported on this platform.
+type adminSocketKey struct{}
+
+// adminWhoKey is set in the context of admin requests to describe who made
+// them, e.g. "user santa", if they had to authenticate.
+type adminWhoKey struct{}
+
+// adminWho returns who made the admin request, or an empty string if nobody
+// had to authenticate.
+func adminWho(r *http.Request) string {
+	who, _ := r.Context().Value(adminWhoKey{}).(string)
+	return who
+}
+
+// adminAuth authenticates requests to the admin API.
+type adminAuth struct {
+	config func() adminConfig
+	tokens *tokenStore
+	logger *slog.Logger
+}
+
+func newAdminAuth(config func() adminConfig, tokens *tokenStore, logger *slog.Logger) *adminAuth {
+	return &adminAuth{
+		config: config,
+		tokens: tokens,
+		logger: logger,
+	}
+}
+
+// middleware rejects requests that are not authenticated.
+func (a *adminAuth) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := a.config()
+
+		if cred, ok := r.Context().Value(adminSocketKey{}).(peerCred); ok {
+			// Came in over the Unix socket, which was checked when the
+			// connection was accepted.
+			who := "socket"
+			if cred != (peerCred{}) {
+				who = fmt.Sprintf("socket uid %d pid %d", cred.UID, cred.PID)
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), adminWhoKey{}, who)))
+			return
+		}
+
+		if !cfg.authRequired() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if who, ok := a.authenticate(cfg, r); ok {
+			a.logger.Debug(
+				"authenticated admin request",
+				"who", who,
+				"method", r.Method,
+				"path", r.URL.Path)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), adminWhoKey{}, who)))
+			return
+		}
+
+		a.logger.Warn(
+			"rejected unauthenticated admin request",
+			"remote_addr", r.RemoteAddr,
+			"method", r.Method,
+			"path", r.URL.Path)
+
+		// Scripts such as the dashboard ask for credentials themselves, so
+		// they don't get the Basic challenge that makes browsers prompt.
+		if len(cfg.Users) > 0 && r.Header.Get("X-Requested-With") == "" {
+			w.Header().Add("WWW-Authenticate", `Basic realm="christmasd admin"`)
+		}
+		w.Header().Add("WWW-Authenticate", `Bearer realm="christmasd admin"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	})
+}
+
+// authenticate checks the request's credentials and returns who made it.
+func (a *adminAuth) authenticate(cfg adminConfig, r *http.Request) (string, bool) {
+	if user, password, ok := r.BasicAuth(); ok {
+		want, exists := cfg.Users[user]
+		// Compare even if the user doesn't exist, so that the time taken
+		// doesn't tell whether it does.
+		match := subtle.ConstantTimeCompare([]byte(password), []byte(want)) == 1
+		return "user " + user, exists && match
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return "", false
+	}
+
+	if cfg.Token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(cfg.Token)) == 1 {
+		return "admin token", true
+	}
+
+	if t, err := a.tokens.check(token, scopeAdmin); err == nil {
+		return "token " + t.Label, true
+	}
+
+	return "", false
+}
+
+// serveSocket serves the admin API on the Unix socket in the config until the
+// context is canceled.
+func (a *adminAuth) serveSocket(ctx context.Context, handler http.Handler) error {
+	cfg := a.config()
+
+	l, err := hserve.Listen(ctx, "unix://"+cfg.Socket)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	if err := os.Chmod(cfg.Socket, fs.FileMode(cfg.SocketMode)); err != nil {
+		return fmt.Errorf("failed to set the mode of the admin socket: %v", err)
+	}
+
+	server := &http.Server{
+		Handler: handler,
+		ConnContext: func(ctx context.Context, conn net.Conn) context.Context {
+			var cred peerCred
+			if uconn, ok := conn.(*net.UnixConn); ok {
+				cred, _ = unixPeerCred(uconn)
+			}
+			return context.WithValue(ctx, adminSocketKey{}, cred)
+		},
+	}
+
+	// Check the peer before anything is read from it.
+	server.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state != http.StateNew {
+			return
+		}
+		uconn, ok := conn.(*net.UnixConn)
+		if !ok {
+			return
+		}
+
+		cred, err := unixPeerCred(uconn)
+		if err != nil {
+			if !errors.Is(err, errors.ErrUnsupported) {
+				a.logger.Warn(
+					"failed to get admin socket peer credentials, closing",
+					"error", err)
+				conn.Close()
+			}
+			return
+		}
+
+		if !a.config().allowsPeer(cred) {
+			a.logger.Warn(
+				"rejected admin socket connection",
+				"pid", cred.PID,
+				"uid", cred.UID,
+				"gid", cred.GID)
+			conn.Close()
+		}
+	}
+
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- server.Serve(l) }()
+
+	select {
+	case <-ctx.Done():
+	case err := <-serveErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), hserve.ShutdownTimeout)
+	defer cancel()
+
+	return server.Shutdown(shutdownCtx)
+}
+
+// isLoopbackAddr returns whether the host:port address only listens on the
+// loopback interface.
+func isLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
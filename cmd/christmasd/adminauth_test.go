@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAdminAuth(t *testing.T) {
+	tokens := newTokenStore("client")
+	admin, err := tokens.create("ops", scopeAdmin, nil, 0)
+	if err != nil {
+		t.Fatal("cannot create token:", err)
+	}
+
+	cfg := adminConfig{
+		Token: "hunter2",
+		Users: map[string]string{"santa": "cookies"},
+	}
+	auth := newAdminAuth(
+		func() adminConfig { return cfg },
+		tokens,
+		slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	handler := auth.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name   string
+		setup  func(r *http.Request)
+		status int
+	}{
+		{"none", func(r *http.Request) {}, http.StatusUnauthorized},
+		{"config token", func(r *http.Request) { r.Header.Set("Authorization", "Bearer hunter2") }, http.StatusNoContent},
+		{"admin token", func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+admin.Secret) }, http.StatusNoContent},
+		{"control token", func(r *http.Request) { r.Header.Set("Authorization", "Bearer client") }, http.StatusUnauthorized},
+		{"basic", func(r *http.Request) { r.SetBasicAuth("santa", "cookies") }, http.StatusNoContent},
+		{"basic wrong password", func(r *http.Request) { r.SetBasicAuth("santa", "coal") }, http.StatusUnauthorized},
+		{"basic unknown user", func(r *http.Request) { r.SetBasicAuth("grinch", "") }, http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/status", nil)
+			test.setup(r)
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != test.status {
+				t.Errorf("status = %d, want %d", w.Code, test.status)
+			}
+			if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 response has no WWW-Authenticate header")
+			}
+		})
+	}
+
+	t.Run("bearer post", func(t *testing.T) {
+		r := httptest.NewRequest("POST", "http://admin.example/kick-all", nil)
+		r.Header.Set("Authorization", "Bearer hunter2")
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != http.StatusNoContent {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusNoContent)
+		}
+	})
+
+	t.Run("not required", func(t *testing.T) {
+		auth := newAdminAuth(func() adminConfig { return adminConfig{} }, tokens, auth.logger)
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})
+
+		w := httptest.NewRecorder()
+		auth.middleware(next).ServeHTTP(w, httptest.NewRequest("GET", "/status", nil))
+		if w.Code != http.StatusNoContent {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusNoContent)
+		}
+	})
+}
+
+func TestAdminSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "admin.sock")
+	cfg := adminConfig{
+		Token:      "hunter2",
+		Socket:     socket,
+		SocketMode: 0600,
+	}
+	auth := newAdminAuth(
+		func() adminConfig { return cfg },
+		newTokenStore(""),
+		slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	handler := auth.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- auth.serveSocket(ctx, handler) }()
+	defer func() {
+		cancel()
+		if err := <-served; err != nil {
+			t.Error("cannot serve admin socket:", err)
+		}
+	}()
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+
+	var resp *http.Response
+	var err error
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		resp, err = client.Get("http://christmasd/status")
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		t.Fatal("cannot request over the admin socket:", err)
+	}
+	resp.Body.Close()
+
+	// Our own user is allowed, and the socket doesn't need a token.
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusNoContent)
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"dev.acmcsuf.com/christmasd"
+)
+
+type auditConfig struct {
+	// Path is the path of the JSON lines file that the audit log is appended
+	// to. The audit log is disabled unless a path is set.
+	Path string `toml:"path"`
+}
+
+// auditEvent is a single line in the audit log.
+type auditEvent struct {
+	Time time.Time `json:"time"`
+	// Event is what happened, e.g. "token.create" or "session.end".
+	Event string `json:"event"`
+	// Addr is the address of whoever caused the event, either an admin API
+	// client or a session's client.
+	Addr string `json:"addr,omitempty"`
+	// Who is how the admin API client authenticated, if it had to.
+	Who string `json:"who,omitempty"`
+	// Session is the session that the event is about, if any.
+	Session *auditSession `json:"session,omitempty"`
+	// Details are specific to the event.
+	Details map[string]any `json:"details,omitempty"`
+}
+
+// auditSession describes a session in the audit log.
+type auditSession struct {
+	ID       string `json:"id"`
+	Label    string `json:"label,omitempty"`
+	TokenID  string `json:"token_id,omitempty"`
+	ViewOnly bool   `json:"view_only,omitempty"`
+	// Duration, Frames and Reason are only set when the session ends.
+	Duration time.Duration `json:"duration,omitempty"`
+	Frames   int           `json:"frames,omitempty"`
+	Reason   string        `json:"reason,omitempty"`
+}
+
+var errAuditDisabled = errors.New("audit log is disabled")
+
+// auditLog appends events to a JSON lines file. Lines are only ever added,
+// never changed. It is safe for concurrent use. An auditLog with an empty
+// path drops all events.
+type auditLog struct {
+	path   string
+	logger *slog.Logger
+
+	mu     sync.Mutex
+	f      *os.File
+	frames map[string]int // by session ID
+}
+
+// openAuditLog opens the audit log at path for appending, creating it if
+// needed.
+func openAuditLog(path string, logger *slog.Logger) (*auditLog, error) {
+	a := &auditLog{
+		path:   path,
+		logger: logger,
+		frames: make(map[string]int),
+	}
+	if path == "" {
+		return a, nil
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %v", err)
+	}
+	a.f = f
+
+	return a, nil
+}
+
+// close closes the audit log file.
+func (a *auditLog) close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.f == nil {
+		return nil
+	}
+	err := a.f.Close()
+	a.f = nil
+	return err
+}
+
+// record appends the event to the log. The event's time is set if it is zero.
+// Failures are logged, since the action that is audited already happened.
+func (a *auditLog) record(event auditEvent) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	b, err := json.Marshal(event)
+	if err != nil {
+		a.logger.Error(
+			"failed to encode audit event",
+			"event", event.Event,
+			"error", err)
+		return
+	}
+	b = append(b, '\n')
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.f == nil {
+		return
+	}
+
+	if _, err := a.f.Write(b); err != nil {
+		a.logger.Error(
+			"failed to write audit event",
+			"event", event.Event,
+			"error", err)
+	}
+}
+
+// recordAdmin records an action taken through the admin API.
+func (a *auditLog) recordAdmin(r *http.Request, event string, details map[string]any) {
+	a.record(auditEvent{
+		Event:   event,
+		Addr:    r.RemoteAddr,
+		Who:     adminWho(r),
+		Details: details,
+	})
+}
+
+// serverHooks returns the hooks that record sessions starting and ending.
+func (a *auditLog) serverHooks() christmasd.ServerHooks {
+	return christmasd.ServerHooks{
+		SessionStarted: func(s *christmasd.Session) {
+			a.mu.Lock()
+			a.frames[s.ID()] = 0
+			a.mu.Unlock()
+
+			a.record(auditEvent{
+				Event:   "session.start",
+				Addr:    s.RemoteAddr(),
+				Session: newAuditSession(s),
+			})
+		},
+		SessionEnded: func(s *christmasd.Session, err error) {
+			a.mu.Lock()
+			frames := a.frames[s.ID()]
+			delete(a.frames, s.ID())
+			a.mu.Unlock()
+
+			session := newAuditSession(s)
+			session.Reason = "closed by client"
+			if err != nil {
+				session.Reason = err.Error()
+			}
+			session.Duration = time.Since(s.Started())
+			session.Frames = frames
+
+			a.record(auditEvent{
+				Event:   "session.end",
+				Addr:    s.RemoteAddr(),
+				Session: session,
+			})
+		},
+		MessageReceived: func(s *christmasd.Session, kind string, size int) {
+			if kind != "set_leds" && kind != "set_led_canvas" {
+				return
+			}
+
+			a.mu.Lock()
+			defer a.mu.Unlock()
+
+			if _, ok := a.frames[s.ID()]; ok {
+				a.frames[s.ID()]++
+			}
+		},
+	}
+}
+
+func newAuditSession(s *christmasd.Session) *auditSession {
+	return &auditSession{
+		ID:       s.ID(),
+		Label:    s.Label(),
+		TokenID:  s.TokenID(),
+		ViewOnly: s.ViewOnly(),
+	}
+}
+
+// auditQuery selects events from the audit log.
+type auditQuery struct {
+	// Since and Until limit the events to a time range. Zero times are
+	// unbounded.
+	Since time.Time
+	Until time.Time
+	// Event only selects events with this name, if not empty.
+	Event string
+	// Limit is the largest number of events to return. If more events match,
+	// the latest ones are returned. Zero means no limit.
+	Limit int
+}
+
+// query reads the events that match q from the audit log, oldest first.
+func (a *auditLog) query(q auditQuery) ([]auditEvent, error) {
+	if a.path == "" {
+		return nil, errAuditDisabled
+	}
+
+	f, err := os.Open(a.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %v", err)
+	}
+	defer f.Close()
+
+	events := []auditEvent{}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		var event auditEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			// A line might be cut off if the daemon died while writing it.
+			a.logger.Warn(
+				"skipping invalid audit log line",
+				"line", line,
+				"error", err)
+			continue
+		}
+
+		if !q.Since.IsZero() && event.Time.Before(q.Since) {
+			continue
+		}
+		if !q.Until.IsZero() && event.Time.After(q.Until) {
+			continue
+		}
+		if q.Event != "" && event.Event != q.Event {
+			continue
+		}
+
+		events = append(events, event)
+		if q.Limit > 0 && len(events) > q.Limit {
+			events = events[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %v", err)
+	}
+
+	return events, nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"dev.acmcsuf.com/christmasd"
+	"dev.acmcsuf.com/christmasd/christmasdtest"
+)
+
+func TestAuditLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	audit, err := openAuditLog(path, logger)
+	if err != nil {
+		t.Fatal("cannot open audit log:", err)
+	}
+	defer audit.close()
+
+	conn, _ := net.Pipe()
+	defer conn.Close()
+	session, err := christmasd.NewSessionWithOpts(conn, christmasd.ServerOpts{
+		LEDController: christmasdtest.NewLEDController(1, 1, 1),
+		Logger:        logger,
+	}, christmasd.SessionOpts{Label: "team 1", TokenID: "abc"})
+	if err != nil {
+		t.Fatal("cannot create session:", err)
+	}
+
+	hooks := audit.serverHooks()
+	hooks.SessionStarted(session)
+	hooks.MessageReceived(session, "set_leds", 10)
+	hooks.MessageReceived(session, "get_leds", 10)
+	hooks.MessageReceived(session, "set_led_canvas", 10)
+	hooks.SessionEnded(session, errors.New("kicked: too spicy"))
+
+	r := httptest.NewRequest("POST", "/kick-all", nil)
+	audit.recordAdmin(r, "kick", map[string]any{"kicked": 1})
+
+	events, err := audit.query(auditQuery{})
+	if err != nil {
+		t.Fatal("cannot query audit log:", err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("got %d events, want 3", len(events))
+	}
+
+	end := events[1]
+	if end.Event != "session.end" || end.Session == nil {
+		t.Fatalf("second event = %+v, want session.end", end)
+	}
+	if end.Session.Label != "team 1" || end.Session.TokenID != "abc" {
+		t.Errorf("session = %+v, want label and token ID", end.Session)
+	}
+	if end.Session.Frames != 2 {
+		t.Errorf("session has %d frames, want 2", end.Session.Frames)
+	}
+	if end.Session.Reason != "kicked: too spicy" {
+		t.Errorf("session reason = %q", end.Session.Reason)
+	}
+
+	kick := events[2]
+	if kick.Event != "kick" || kick.Addr != r.RemoteAddr || kick.Details["kicked"] != 1.0 {
+		t.Errorf("kick event = %+v", kick)
+	}
+
+	// Events are kept across reopening.
+	audit.close()
+	audit, err = openAuditLog(path, logger)
+	if err != nil {
+		t.Fatal("cannot reopen audit log:", err)
+	}
+	audit.record(auditEvent{Event: "kick", Time: time.Now().Add(time.Hour)})
+
+	events, err = audit.query(auditQuery{Event: "kick", Until: time.Now()})
+	if err != nil {
+		t.Fatal("cannot query audit log:", err)
+	}
+	if len(events) != 1 {
+		t.Errorf("got %d kicks until now, want 1", len(events))
+	}
+
+	events, err = audit.query(auditQuery{Limit: 2})
+	if err != nil {
+		t.Fatal("cannot query audit log:", err)
+	}
+	if len(events) != 2 || events[1].Time.Before(time.Now()) {
+		t.Errorf("limited query did not return the latest events: %+v", events)
+	}
+}
+
+func TestBanList(t *testing.T) {
+	bans := newBanList()
+
+	network, err := parseBanAddr("10.0.0.1/24")
+	if err != nil {
+		t.Fatal("cannot parse network:", err)
+	}
+	ban, err := bans.add(network, "spam", nil)
+	if err != nil {
+		t.Fatal("cannot add ban:", err)
+	}
+
+	host, err := parseBanAddr("::ffff:192.168.1.2")
+	if err != nil {
+		t.Fatal("cannot parse address:", err)
+	}
+	past := time.Now().Add(-time.Second)
+	if _, err := bans.add(host, "", &past); err != nil {
+		t.Fatal("cannot add ban:", err)
+	}
+
+	tests := []struct {
+		addr   string
+		banned bool
+	}{
+		{"10.0.0.200:5000", true},
+		{"[::ffff:10.0.0.3]:5000", true},
+		{"10.0.1.1:5000", false},
+		{"192.168.1.2:5000", false}, // expired
+		{"@", false},
+	}
+	for _, test := range tests {
+		if _, banned := bans.banned(test.addr); banned != test.banned {
+			t.Errorf("%s banned = %v, want %v", test.addr, banned, test.banned)
+		}
+	}
+
+	if list := bans.list(); len(list) != 1 || list[0].Addr.String() != "10.0.0.0/24" {
+		t.Errorf("bans = %+v, want only the unexpired network", list)
+	}
+
+	if _, ok := bans.remove(ban.ID); !ok {
+		t.Error("cannot remove ban")
+	}
+	if _, banned := bans.banned("10.0.0.200:5000"); banned {
+		t.Error("address is still banned after removing the ban")
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+// clientBan keeps clients from an address or network from connecting.
+type clientBan struct {
+	ID string `json:"id"`
+	// Addr is the banned IP address or CIDR network.
+	Addr netip.Prefix `json:"addr"`
+	// Reason is why the clients were banned.
+	Reason  string    `json:"reason,omitempty"`
+	Created time.Time `json:"created"`
+	// Expires is when the ban is lifted. Nil means never.
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+// matches returns whether the ban covers the given "host:port" or host
+// address.
+func (b *clientBan) matches(remoteAddr string, now time.Time) bool {
+	if b.Expires != nil && !now.Before(*b.Expires) {
+		return false
+	}
+	addr, ok := remoteIP(remoteAddr)
+	return ok && b.Addr.Contains(addr)
+}
+
+// remoteIP returns the IP address in a "host:port" or host address.
+func remoteIP(remoteAddr string) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// parseBanAddr parses an IP address or a CIDR network.
+func parseBanAddr(s string) (netip.Prefix, error) {
+	if addr, err := netip.ParseAddr(s); err == nil {
+		addr = addr.Unmap()
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	prefix, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid address %q, expected an IP address or a CIDR network", s)
+	}
+	return prefix.Masked(), nil
+}
+
+// banList holds the bans. It is safe for concurrent use.
+type banList struct {
+	mu   sync.Mutex
+	bans []*clientBan
+}
+
+func newBanList() *banList {
+	return &banList{}
+}
+
+// add bans the address and returns the ban.
+func (l *banList) add(addr netip.Prefix, reason string, expires *time.Time) (clientBan, error) {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return clientBan{}, fmt.Errorf("failed to generate ban ID: %w", err)
+	}
+
+	b := &clientBan{
+		ID:      id.String(),
+		Addr:    addr,
+		Reason:  reason,
+		Created: time.Now(),
+		Expires: expires,
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.bans = append(l.bans, b)
+	return *b, nil
+}
+
+// list returns the bans that haven't expired, dropping the ones that have.
+func (l *banList) list() []clientBan {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.dropExpired(time.Now())
+
+	bans := make([]clientBan, len(l.bans))
+	for i, b := range l.bans {
+		bans[i] = *b
+	}
+	return bans
+}
+
+// restore replaces the bans with the given ones, e.g. from list.
+func (l *banList) restore(bans []clientBan) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.bans = make([]*clientBan, len(bans))
+	for i, b := range bans {
+		b := b
+		l.bans[i] = &b
+	}
+	l.dropExpired(time.Now())
+}
+
+// remove lifts the ban with the given ID and returns it.
+func (l *banList) remove(id string) (clientBan, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	i := slices.IndexFunc(l.bans, func(b *clientBan) bool { return b.ID == id })
+	if i == -1 {
+		return clientBan{}, false
+	}
+
+	b := *l.bans[i]
+	l.bans = slices.Delete(l.bans, i, i+1)
+	return b, true
+}
+
+// banned returns the ban that covers the given "host:port" address, if any.
+func (l *banList) banned(remoteAddr string) (clientBan, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	for _, b := range l.bans {
+		if b.matches(remoteAddr, now) {
+			return *b, true
+		}
+	}
+	return clientBan{}, false
+}
+
+func (l *banList) dropExpired(now time.Time) {
+	l.bans = slices.DeleteFunc(l.bans, func(b *clientBan) bool {
+		return b.Expires != nil && !now.Before(*b.Expires)
+	})
+}
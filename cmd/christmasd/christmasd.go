@@ -4,36 +4,49 @@ import (
 	"context"
 	"encoding/csv"
 	"fmt"
-	"image"
 	"log"
 	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
-	"sync/atomic"
+	"syscall"
 
 	"dev.acmcsuf.com/christmas/lib/csvutil"
 	"dev.acmcsuf.com/christmasd"
+	"dev.acmcsuf.com/christmasd/christmasdmetrics"
+	"dev.acmcsuf.com/christmasd/ledrecord"
+	"github.com/BurntSushi/toml"
 	"github.com/go-chi/chi/v5"
 	"github.com/lmittmann/tint"
 	"github.com/mattn/go-isatty"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/pflag"
 	"golang.org/x/sync/errgroup"
 	"libdb.so/hserve"
-	"libdb.so/ledctl"
 )
 
+var defaults = defaultConfig()
+
 var (
-	httpAddr      = "0.0.0.0:9000"
-	httpAdminAddr = "127.0.0.1:9002"
-	ledPointsCSV  = "led-points.csv"
-	canvasPPI     = 72.0
-	frameRate     = 20
+	configPath    = ""
+	printConfig   = false
 	verbose       = false
-	defaultToken  = ""
+	httpAddr      = defaults.Server.HTTPAddr
+	httpAdminAddr = defaults.Server.AdminAddr
+	ledPointsCSV  = defaults.Canvas.LEDPoints
+	canvasPPI     = defaults.Canvas.PPI
+	frameRate     = defaults.Canvas.FrameRate
+	defaultToken  = defaults.Server.Token
+	strips        = []string{"12:BGR:10"}
+	recordDir     = defaults.Recording.Dir
+	mirrors       = []string{}
 )
 
 func init() {
+	pflag.StringVarP(&configPath, "config", "c", configPath, "TOML config file, flags override its values")
+	pflag.BoolVar(&printConfig, "print-config", printConfig, "print the effective config as TOML and exit")
 	pflag.StringVarP(&httpAddr, "http-addr", "a", httpAddr, "HTTP server address")
 	pflag.StringVarP(&httpAdminAddr, "http-admin-addr", "A", httpAdminAddr, "HTTP admin server address")
 	pflag.StringVar(&ledPointsCSV, "led-points", ledPointsCSV, "CSV file of LED points")
@@ -41,20 +54,27 @@ func init() {
 	pflag.IntVar(&frameRate, "fps", frameRate, "frame rate")
 	pflag.BoolVarP(&verbose, "verbose", "v", verbose, "verbose logging")
 	pflag.StringVar(&defaultToken, "token", defaultToken, "default token")
-}
-
-var ws281xConfig = ledctl.WS281xConfig{
-	ColorOrder:   ledctl.BGROrder,
-	ColorModel:   ledctl.RGBModel,
-	PWMFrequency: 800000,
-	DMAChannel:   10,
-	GPIOPins:     []int{12},
+	pflag.StringVar(&recordDir, "record-dir", recordDir, "directory to save LED recordings into")
+	pflag.StringArrayVar(&mirrors, "mirror", mirrors, "websocket URL of another christmasd to mirror frames onto, can be repeated")
+	pflag.StringArrayVar(&strips, "strip", strips, "LED strip as GPIO[:ORDER[:DMA]], repeat for each strip column in the LED points file, at most one per PWM channel")
 }
 
 func main() {
 	log.SetFlags(0)
 	pflag.Parse()
 
+	cfg, err := readConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if printConfig {
+		if err := toml.NewEncoder(os.Stdout).Encode(cfg); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	level := slog.LevelInfo
 	if verbose {
 		level = slog.LevelDebug
@@ -72,74 +92,196 @@ func main() {
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer cancel()
 
-	if err := run(ctx, logger); err != nil {
+	if err := run(ctx, logger, cfg); err != nil {
 		log.Fatal(err)
 	}
 }
 
-func run(ctx context.Context, logger *slog.Logger) error {
+// recorderBuffer is how many frames can wait to be written to a recording,
+// which is about three seconds at the default frame rate.
+const recorderBuffer = 64
+
+func run(ctx context.Context, logger *slog.Logger, cfg config) error {
 	errg, ctx := errgroup.WithContext(ctx)
 
-	ledCoords, err := csvutil.UnmarshalFile[image.Point](ledPointsCSV)
+	ledPoints, err := loadLEDPoints(cfg.Canvas.LEDPoints)
 	if err != nil {
-		return fmt.Errorf("failed to unmarshal CSV file %q: %v", ledPointsCSV, err)
+		return fmt.Errorf("failed to load LED points file %q: %v", cfg.Canvas.LEDPoints, err)
 	}
 
-	ws281xCfg := ws281xConfig
-	ws281xCfg.NumPixels = len(ledCoords)
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
 
-	ws281x, err := ledctl.NewWS281x(ws281xCfg)
-	if err != nil {
-		return fmt.Errorf("failed to create a WS281x controller: %v", err)
-	}
+	metrics := christmasdmetrics.New(registry)
+	metrics.SetFrameRate(cfg.Canvas.FrameRate)
 
-	controller, err := newLEDController(ledControlConfig{
-		Controller: ws281x,
-		LEDCoords:  ledCoords,
-		FrameRate:  frameRate,
-		CanvasPPI:  canvasPPI,
-		Logger:     logger.With("component", "led-controller"),
-	})
+	ledConfig := newLEDControlConfig(cfg, ledPoints, logger)
+	ledConfig.Hooks = metrics.LEDControllerHooks()
+
+	controller, err := newLEDController(ledConfig)
 	if err != nil {
 		return fmt.Errorf("failed to create a LED controller: %v", err)
 	}
+	defer controller.close()
 
 	errg.Go(func() error {
 		controller.start(ctx)
 		return nil
 	})
 
+	// The recorder is a sink rather than a decorator, so that it records what
+	// the LEDs actually show, idle animations, overrides and DMX input
+	// included, and so that writing the recording never holds up a frame.
+	recorder := ledrecord.NewRecorder(controller, logger.With("component", "recorder"))
+	defer func() {
+		if recorder.Recording() {
+			recorder.Stop()
+		}
+	}()
+
+	teeSinks := []christmasd.TeeSink{{
+		Name:       "recorder",
+		Controller: recorder,
+		Buffer:     recorderBuffer,
+		DropPolicy: christmasd.DropNewest,
+	}}
+	for _, url := range cfg.Server.Mirrors {
+		mirror := newMirrorController(ctx, url, logger.With("component", "mirror", "url", url))
+		defer mirror.Close()
+
+		teeSinks = append(teeSinks, christmasd.TeeSink{
+			Name:       "mirror " + url,
+			Controller: mirror,
+			DropPolicy: christmasd.DropOldest,
+		})
+	}
+
+	tee := christmasd.NewTee(controller, logger.With("component", "tee"), teeSinks...)
+
+	errg.Go(func() error {
+		tee.Start(ctx)
+		return nil
+	})
+
+	diag := newDiagnostics(tee, logger.With("component", "diagnostics"))
+	defer diag.stop()
+
+	// Admin overrides take priority over everything but diagnostics.
+	override := newOverride(diag, logger.With("component", "override"))
+	defer override.stop()
+
+	idle := newIdleAnimator(override, cfg.Idle, logger.With("component", "idle"))
+
+	errg.Go(func() error {
+		idle.start(ctx, cfg.Canvas.FrameRate)
+		return nil
+	})
+
+	// DMX input takes over from client sessions, so it sits in front of the
+	// idle animation.
+	var sessionCtrl christmasd.LEDController = idle
+	var input *dmxInput
+	if cfg.Input.Protocol != "" {
+		input, err = newDMXInput(idle, cfg.Input, logger.With("component", "dmx-input"))
+		if err != nil {
+			return fmt.Errorf("failed to start DMX input: %v", err)
+		}
+		defer input.close()
+
+		errg.Go(func() error {
+			return input.start(ctx)
+		})
+
+		sessionCtrl = input
+	}
+
+	audit, err := openAuditLog(cfg.Audit.Path, logger.With("component", "audit"))
+	if err != nil {
+		return err
+	}
+	defer audit.close()
+
 	server := christmasd.NewServer(christmasd.ServerOpts{
-		LEDController: controller,
+		LEDController: sessionCtrl,
 		Logger:        logger.With("component", "server"),
+		Hooks:         christmasd.JoinServerHooks(metrics.ServerHooks(), audit.serverHooks()),
+		FrameStats:    controller.frameStats,
+	})
+
+	tokens := newTokenStore(cfg.Server.Token)
+	bans := newBanList()
+
+	scheduler, err := newScheduler(cfg.Schedule, controller, server, logger.With("component", "scheduler"))
+	if err != nil {
+		return fmt.Errorf("failed to create the scheduler: %v", err)
+	}
+
+	errg.Go(func() error {
+		scheduler.start(ctx)
+		return nil
 	})
 
-	token := atomic.Pointer[string]{}
-	token.Store(&defaultToken)
+	reloader := newReloader(cfg, controller, idle, scheduler, server, tokens, metrics, logger.With("component", "reloader"))
+
+	errg.Go(func() error {
+		reloader.reloadOnSignal(ctx, syscall.SIGHUP)
+		return nil
+	})
+
+	state := newStateStore(cfg.State, reloader, bans, logger.With("component", "state"))
+	if err := state.restore(); err != nil {
+		return err
+	}
+
+	errg.Go(func() error {
+		state.start(ctx)
+		return nil
+	})
+
+	snapshot := newSnapshotHandler(controller, adminSnapshotLimits, nil)
 
 	errg.Go(func() error {
 		r := chi.NewRouter()
 		r.Get("/ws/{token}", func(w http.ResponseWriter, r *http.Request) {
-			tokenWant := token.Load()
-			token := chi.URLParam(r, "token")
-			if tokenWant != nil {
-				if token != *tokenWant {
-					http.Error(w, "invalid token", http.StatusForbidden)
-					return
-				}
+			if reason := scheduler.rejects(); reason != "" {
+				http.Error(w, reason, http.StatusServiceUnavailable)
+				return
+			}
+
+			if ban, ok := bans.banned(r.RemoteAddr); ok {
+				logger.Debug(
+					"rejected a banned client",
+					"remote_addr", r.RemoteAddr,
+					"ban", ban.ID)
+				http.Error(w, "banned", http.StatusForbidden)
+				return
+			}
+
+			token, err := tokens.use(chi.URLParam(r, "token"), scopeView)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
 			}
 
 			logger.Debug(
 				"now serving a WebSocket connection",
 				"remote_addr", r.RemoteAddr,
-				"token", token)
+				"token", token.Label,
+				"scope", token.Scope)
 
-			server.ServeHTTP(w, r)
+			server.ServeSession(w, r, christmasd.SessionOpts{
+				Label:    token.Label,
+				TokenID:  token.ID,
+				ViewOnly: !token.Scope.allows(scopeControl),
+			})
 
 			logger.Debug(
 				"finished serving a WebSocket connection",
 				"remote_addr", r.RemoteAddr,
-				"token", token)
+				"token", token.Label)
 		})
 
 		r.Get("/led-points.csv", func(w http.ResponseWriter, r *http.Request) {
@@ -147,25 +289,55 @@ func run(ctx context.Context, logger *slog.Logger) error {
 			w.Header().Set("Content-Disposition", "attachment; filename=led-points.csv")
 
 			csvw := csv.NewWriter(w)
-			csvutil.Marshal(csvw, ledCoords)
+			csvutil.Marshal(csvw, ledPointCoords(controller.ledPoints()))
 		})
 
+		r.Get("/snapshot.png", newSnapshotHandler(controller, publicSnapshotLimits, func() bool {
+			return reloader.config().Server.PublicSnapshot
+		}).ServeHTTP)
+
 		logger.Info(
 			"starting public HTTP server",
-			"addr", httpAddr)
+			"addr", cfg.Server.HTTPAddr)
 
-		return hserve.ListenAndServe(ctx, httpAddr, r)
+		return hserve.ListenAndServe(ctx, cfg.Server.HTTPAddr, r)
 	})
 
-	errg.Go(func() error {
-		admin := newAdminHandler(server, &token)
+	auth := newAdminAuth(
+		func() adminConfig { return reloader.config().Admin },
+		tokens,
+		logger.With("component", "admin-auth"))
 
-		logger.Info(
-			"starting admin HTTP server",
-			"addr", httpAdminAddr)
+	api := newAdminHandler(server, tokens, recorder, reloader, scheduler, diag, override, input, bans, audit, state, snapshot,
+		promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	admin := withDashboard(auth.middleware(api))
 
-		return hserve.ListenAndServe(ctx, httpAdminAddr, admin)
-	})
+	if cfg.Server.AdminAddr != "" {
+		if !cfg.Admin.authRequired() && !isLoopbackAddr(cfg.Server.AdminAddr) {
+			logger.Warn(
+				"admin HTTP server is not on a loopback address and has no authentication configured",
+				"addr", cfg.Server.AdminAddr)
+		}
+
+		errg.Go(func() error {
+			logger.Info(
+				"starting admin HTTP server",
+				"addr", cfg.Server.AdminAddr)
+
+			return hserve.ListenAndServe(ctx, cfg.Server.AdminAddr, admin)
+		})
+	}
+
+	if cfg.Admin.Socket != "" {
+		errg.Go(func() error {
+			logger.Info(
+				"starting admin socket",
+				"path", cfg.Admin.Socket,
+				"mode", cfg.Admin.SocketMode)
+
+			return auth.serveSocket(ctx, admin)
+		})
+	}
 
 	return errg.Wait()
 }
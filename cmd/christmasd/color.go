@@ -0,0 +1,29 @@
+package main
+
+import (
+	"math"
+
+	"libdb.so/ledctl"
+)
+
+// colorTable maps each 8-bit color channel value to its corrected value. It
+// applies brightness scaling and gamma correction in a single lookup.
+type colorTable [256]uint8
+
+func newColorTable(cfg colorConfig) *colorTable {
+	var t colorTable
+	for i := range t {
+		v := math.Pow(float64(i)/255, cfg.Gamma) * cfg.Brightness
+		t[i] = uint8(math.Round(v * 255))
+	}
+	return &t
+}
+
+// apply returns the corrected color.
+func (t *colorTable) apply(c ledctl.RGB) ledctl.RGB {
+	return ledctl.RGB{
+		R: t[c.R],
+		G: t[c.G],
+		B: t[c.B],
+	}
+}
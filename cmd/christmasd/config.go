@@ -0,0 +1,359 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"dev.acmcsuf.com/christmasd/dmxnet"
+	"github.com/BurntSushi/toml"
+	"github.com/spf13/pflag"
+	"libdb.so/ledctl"
+)
+
+// config is the configuration of christmasd. It is loaded from a TOML file,
+// and command-line flags take precedence over it.
+type config struct {
+	Server    serverConfig    `toml:"server"`
+	Canvas    canvasConfig    `toml:"canvas"`
+	Color     colorConfig     `toml:"color"`
+	Hardware  hardwareConfig  `toml:"hardware"`
+	Recording recordingConfig `toml:"recording"`
+	Idle      idleConfig      `toml:"idle"`
+	Schedule  scheduleConfig  `toml:"schedule"`
+	Input     inputConfig     `toml:"input"`
+	Admin     adminConfig     `toml:"admin"`
+	Audit     auditConfig     `toml:"audit"`
+	State     stateConfig     `toml:"state"`
+}
+
+type serverConfig struct {
+	// HTTPAddr is the address of the public HTTP server.
+	HTTPAddr string `toml:"http_addr"`
+	// AdminAddr is the address of the admin HTTP server. It may be empty if
+	// the admin API is served on a Unix socket instead.
+	AdminAddr string `toml:"admin_addr"`
+	// Token is the token that clients must use to connect. An empty token
+	// lets anyone connect.
+	Token string `toml:"token"`
+	// Mirrors is a list of websocket URLs of other christmasd servers to
+	// mirror frames onto.
+	Mirrors []string `toml:"mirrors"`
+	// PublicSnapshot also serves /snapshot.png on the public HTTP server,
+	// with smaller size and radius limits. It is always served on the admin
+	// HTTP server.
+	PublicSnapshot bool `toml:"public_snapshot"`
+}
+
+type canvasConfig struct {
+	// LEDPoints is the path to the LED points CSV file.
+	LEDPoints string `toml:"led_points"`
+	// PPI is the pixel density of the canvas.
+	PPI float64 `toml:"ppi"`
+	// FrameRate is the maximum number of frames per second sent to the LEDs.
+	FrameRate int `toml:"fps"`
+	// ImmediateFlush writes a frame out right away if no frame was written
+	// out for a whole frame interval, instead of waiting for the next frame
+	// slot.
+	ImmediateFlush bool `toml:"immediate_flush"`
+}
+
+type colorConfig struct {
+	// Brightness scales every color, from 0 to 1.
+	Brightness float64 `toml:"brightness"`
+	// Gamma is the gamma correction exponent. 1 disables gamma correction.
+	Gamma float64 `toml:"gamma"`
+}
+
+type hardwareConfig struct {
+	// Frequency is the PWM frequency of the WS281x strips, in Hz.
+	Frequency uint `toml:"frequency"`
+	// ColorModel is the color model of the LEDs, either RGB or RGBW.
+	ColorModel colorModel `toml:"color_model"`
+	// Strips is the list of physical LED strips. The strip column in the LED
+	// points file indexes into this list.
+	Strips []stripConfig `toml:"strip"`
+}
+
+type recordingConfig struct {
+	// Dir is the directory that recordings are saved into.
+	Dir string `toml:"dir"`
+}
+
+type idleConfig struct {
+	// Pattern is the idle animation to play.
+	Pattern idlePatternName `toml:"pattern"`
+	// Timeout is how long to wait without any frames before the idle
+	// animation starts. Zero disables the idle animation.
+	Timeout time.Duration `toml:"timeout"`
+}
+
+func defaultConfig() config {
+	return config{
+		Server: serverConfig{
+			HTTPAddr:  "0.0.0.0:9000",
+			AdminAddr: "127.0.0.1:9002",
+		},
+		Canvas: canvasConfig{
+			LEDPoints:      "led-points.csv",
+			PPI:            72,
+			FrameRate:      20,
+			ImmediateFlush: true,
+		},
+		Color: colorConfig{
+			Brightness: 1,
+			Gamma:      1,
+		},
+		Hardware: hardwareConfig{
+			Frequency:  800000,
+			ColorModel: colorModel(ledctl.RGBModel),
+			Strips:     []stripConfig{defaultStripConfig},
+		},
+		Recording: recordingConfig{
+			Dir: "recordings",
+		},
+		Idle: idleConfig{
+			Pattern: "twinkle",
+			Timeout: time.Minute,
+		},
+		Schedule: scheduleConfig{
+			OffAction: offReject,
+		},
+		Input: inputConfig{
+			ColorOrder: colorOrder(ledctl.RGBOrder),
+			Universe:   1,
+			Priority:   dmxnet.DefaultPriority,
+			Timeout:    dmxnet.DataLossTimeout,
+		},
+		Admin: adminConfig{
+			SocketMode: 0660,
+		},
+		State: stateConfig{
+			SaveInterval: 30 * time.Second,
+		},
+	}
+}
+
+// loadConfig loads the configuration file at path on top of the default
+// configuration. If path is empty, the default configuration is returned.
+func loadConfig(path string) (config, error) {
+	cfg := defaultConfig()
+	if path == "" {
+		return cfg, nil
+	}
+
+	// Don't merge the strips with the default ones. If the file has any
+	// strips, then those are all the strips.
+	cfg.Hardware.Strips = nil
+
+	md, err := toml.DecodeFile(path, &cfg)
+	if err != nil {
+		return cfg, fmt.Errorf("failed to parse config file %q: %w", path, err)
+	}
+
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, len(undecoded))
+		for i, key := range undecoded {
+			keys[i] = key.String()
+		}
+		return cfg, fmt.Errorf("config file %q has unknown keys: %s", path, strings.Join(keys, ", "))
+	}
+
+	if !md.IsDefined("hardware", "strip") {
+		cfg.Hardware.Strips = defaultConfig().Hardware.Strips
+	}
+
+	return cfg, nil
+}
+
+// readConfig reads the configuration file given by the --config flag, applies
+// the command-line flags on top of it and validates the result.
+func readConfig() (config, error) {
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		return cfg, err
+	}
+
+	if err := applyFlags(&cfg, pflag.CommandLine); err != nil {
+		return cfg, err
+	}
+
+	if err := cfg.validate(); err != nil {
+		return cfg, fmt.Errorf("invalid config:\n%w", err)
+	}
+
+	return cfg, nil
+}
+
+// applyFlags overrides the configuration with the command-line flags that
+// were explicitly set.
+func applyFlags(cfg *config, flags *pflag.FlagSet) error {
+	var err error
+	flags.Visit(func(f *pflag.Flag) {
+		switch f.Name {
+		case "http-addr":
+			cfg.Server.HTTPAddr = httpAddr
+		case "http-admin-addr":
+			cfg.Server.AdminAddr = httpAdminAddr
+		case "token":
+			cfg.Server.Token = defaultToken
+		case "mirror":
+			cfg.Server.Mirrors = mirrors
+		case "led-points":
+			cfg.Canvas.LEDPoints = ledPointsCSV
+		case "canvas-ppi":
+			cfg.Canvas.PPI = canvasPPI
+		case "fps":
+			cfg.Canvas.FrameRate = frameRate
+		case "record-dir":
+			cfg.Recording.Dir = recordDir
+		case "strip":
+			cfg.Hardware.Strips = make([]stripConfig, len(strips))
+			for i, s := range strips {
+				cfg.Hardware.Strips[i], err = parseStripConfig(s)
+				if err != nil {
+					return
+				}
+			}
+		}
+	})
+	return err
+}
+
+// validate checks the configuration for errors. All errors are reported at
+// once.
+func (cfg config) validate() error {
+	var errs []error
+	check := func(ok bool, key, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+		}
+	}
+
+	_, _, err := net.SplitHostPort(cfg.Server.HTTPAddr)
+	check(err == nil, "server.http_addr", "invalid address %q", cfg.Server.HTTPAddr)
+
+	if cfg.Server.AdminAddr != "" || cfg.Admin.Socket == "" {
+		_, _, err = net.SplitHostPort(cfg.Server.AdminAddr)
+		check(err == nil, "server.admin_addr", "invalid address %q", cfg.Server.AdminAddr)
+	}
+
+	for i, mirror := range cfg.Server.Mirrors {
+		check(strings.HasPrefix(mirror, "ws://") || strings.HasPrefix(mirror, "wss://"),
+			fmt.Sprintf("server.mirrors[%d]", i), "%q is not a ws:// or wss:// URL", mirror)
+	}
+
+	check(cfg.Canvas.LEDPoints != "", "canvas.led_points", "must not be empty")
+	check(cfg.Canvas.PPI > 0, "canvas.ppi", "must be positive, got %v", cfg.Canvas.PPI)
+	check(cfg.Canvas.FrameRate >= 1 && cfg.Canvas.FrameRate <= 1000,
+		"canvas.fps", "must be between 1 and 1000, got %d", cfg.Canvas.FrameRate)
+
+	check(cfg.Color.Brightness >= 0 && cfg.Color.Brightness <= 1,
+		"color.brightness", "must be between 0 and 1, got %v", cfg.Color.Brightness)
+	check(cfg.Color.Gamma > 0, "color.gamma", "must be positive, got %v", cfg.Color.Gamma)
+
+	check(cfg.Hardware.Frequency >= 400000 && cfg.Hardware.Frequency <= 1000000,
+		"hardware.frequency", "must be between 400000 and 1000000 Hz, got %d", cfg.Hardware.Frequency)
+	if err := validateStripConfigs(cfg.Hardware.Strips); err != nil {
+		errs = append(errs, fmt.Errorf("hardware.strip: %w", err))
+	}
+
+	check(cfg.Recording.Dir != "", "recording.dir", "must not be empty")
+
+	check(cfg.Idle.Timeout >= 0, "idle.timeout", "must not be negative, got %v", cfg.Idle.Timeout)
+
+	if err := cfg.Schedule.validate(); err != nil {
+		errs = append(errs, prefixErrors("schedule", err))
+	}
+
+	if err := cfg.Input.validate(); err != nil {
+		errs = append(errs, prefixErrors("input", err))
+	}
+
+	if err := cfg.Admin.validate(); err != nil {
+		errs = append(errs, prefixErrors("admin", err))
+	}
+
+	if err := cfg.State.validate(); err != nil {
+		errs = append(errs, prefixErrors("state", err))
+	}
+
+	return errors.Join(errs...)
+}
+
+// prefixErrors prefixes each error joined in err with the given config key.
+func prefixErrors(key string, err error) error {
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return fmt.Errorf("%s.%w", key, err)
+	}
+
+	errs := joined.Unwrap()
+	for i, err := range errs {
+		errs[i] = fmt.Errorf("%s.%w", key, err)
+	}
+	return errors.Join(errs...)
+}
+
+// colorModel is a ledctl.ColorModel that is encoded as text.
+type colorModel ledctl.ColorModel
+
+func (m colorModel) MarshalText() ([]byte, error) {
+	switch ledctl.ColorModel(m) {
+	case ledctl.RGBModel:
+		return []byte("RGB"), nil
+	case ledctl.RGBWModel:
+		return []byte("RGBW"), nil
+	default:
+		return nil, fmt.Errorf("unknown color model %d", m)
+	}
+}
+
+func (m *colorModel) UnmarshalText(text []byte) error {
+	switch strings.ToUpper(string(text)) {
+	case "RGB":
+		*m = colorModel(ledctl.RGBModel)
+	case "RGBW":
+		*m = colorModel(ledctl.RGBWModel)
+	default:
+		return fmt.Errorf("unknown color model %q, expected RGB or RGBW", text)
+	}
+	return nil
+}
+
+// colorOrder is a ledctl.ColorOrder that is encoded as text.
+type colorOrder ledctl.ColorOrder
+
+func (o colorOrder) MarshalText() ([]byte, error) {
+	for name, order := range ledctl.StringToOrder {
+		if order == ledctl.ColorOrder(o) {
+			return []byte(name), nil
+		}
+	}
+	return nil, fmt.Errorf("unknown color order %d", o)
+}
+
+func (o *colorOrder) UnmarshalText(text []byte) error {
+	order, ok := ledctl.StringToOrder[strings.ToUpper(string(text))]
+	if !ok {
+		return fmt.Errorf("unknown color order %q", text)
+	}
+	*o = colorOrder(order)
+	return nil
+}
+
+// offsets returns the offsets of the red, green and blue channels of a pixel
+// in this order.
+func (o colorOrder) offsets() ([3]int, error) {
+	name, err := o.MarshalText()
+	if err != nil {
+		return [3]int{}, err
+	}
+	return [3]int{
+		strings.IndexByte(string(name), 'R'),
+		strings.IndexByte(string(name), 'G'),
+		strings.IndexByte(string(name), 'B'),
+	}, nil
+}
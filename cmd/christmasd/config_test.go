@@ -0,0 +1,220 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+	"libdb.so/ledctl"
+)
+
+func TestLoadConfig(t *testing.T) {
+	t.Run("no file", func(t *testing.T) {
+		cfg, err := loadConfig("")
+		if err != nil {
+			t.Fatal("cannot load config:", err)
+		}
+		if err := cfg.validate(); err != nil {
+			t.Errorf("default config is invalid: %v", err)
+		}
+
+		// Nothing is written next to the daemon unless configured.
+		if cfg.Audit.Path != "" {
+			t.Errorf("audit log is enabled by default at %q", cfg.Audit.Path)
+		}
+		if cfg.State.Path != "" || cfg.State.RestoreFrame {
+			t.Errorf("state is enabled by default: %+v", cfg.State)
+		}
+	})
+
+	t.Run("file", func(t *testing.T) {
+		cfg, err := loadConfig(writeConfig(t, `
+			[server]
+			http_addr = "127.0.0.1:8000"
+
+			[canvas]
+			fps = 30
+
+			[idle]
+			timeout = "5m"
+		`))
+		if err != nil {
+			t.Fatal("cannot load config:", err)
+		}
+
+		if cfg.Server.HTTPAddr != "127.0.0.1:8000" {
+			t.Errorf("server.http_addr = %q, want the file's", cfg.Server.HTTPAddr)
+		}
+		if cfg.Canvas.FrameRate != 30 {
+			t.Errorf("canvas.fps = %d, want the file's", cfg.Canvas.FrameRate)
+		}
+		if cfg.Idle.Timeout != 5*time.Minute {
+			t.Errorf("idle.timeout = %v, want the file's", cfg.Idle.Timeout)
+		}
+
+		// Keys that the file leaves out keep their defaults.
+		if cfg.Canvas.PPI != defaultConfig().Canvas.PPI {
+			t.Errorf("canvas.ppi = %v, want the default", cfg.Canvas.PPI)
+		}
+		if !slices.EqualFunc(cfg.Hardware.Strips, []stripConfig{defaultStripConfig}, stripConfigEqual) {
+			t.Errorf("hardware.strip = %+v, want the default strip", cfg.Hardware.Strips)
+		}
+	})
+
+	t.Run("strips replace the default", func(t *testing.T) {
+		cfg, err := loadConfig(writeConfig(t, `
+			[[hardware.strip]]
+			gpio = 18
+			order = "GRB"
+			dma = 5
+		`))
+		if err != nil {
+			t.Fatal("cannot load config:", err)
+		}
+
+		want := []stripConfig{{GPIOPin: 18, ColorOrder: colorOrder(ledctl.GRBOrder), DMAChannel: 5}}
+		if !slices.EqualFunc(cfg.Hardware.Strips, want, stripConfigEqual) {
+			t.Errorf("hardware.strip = %+v, want %+v", cfg.Hardware.Strips, want)
+		}
+	})
+
+	t.Run("unknown keys", func(t *testing.T) {
+		_, err := loadConfig(writeConfig(t, `
+			[server]
+			http_adr = "127.0.0.1:8000"
+
+			[canvass]
+			fps = 30
+		`))
+		if err == nil {
+			t.Fatal("expected an error for unknown keys")
+		}
+		for _, key := range []string{"server.http_adr", "canvass"} {
+			if !strings.Contains(err.Error(), key) {
+				t.Errorf("error does not mention %q: %v", key, err)
+			}
+		}
+	})
+
+	t.Run("invalid TOML", func(t *testing.T) {
+		if _, err := loadConfig(writeConfig(t, `[server`)); err == nil {
+			t.Fatal("expected an error for invalid TOML")
+		}
+	})
+}
+
+func TestConfigValidate(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Server.HTTPAddr = "nope"
+	cfg.Server.Mirrors = []string{"http://example.com"}
+	cfg.Canvas.FrameRate = 0
+	cfg.Color.Brightness = 2
+	cfg.State.RestoreFrame = true
+
+	err := cfg.validate()
+	if err == nil {
+		t.Fatal("expected an invalid config")
+	}
+
+	// Every error is reported at once, prefixed with its key.
+	for _, key := range []string{
+		"server.http_addr:",
+		"server.mirrors[0]:",
+		"canvas.fps:",
+		"color.brightness:",
+		"state.restore_frame:",
+	} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("error does not mention %q:\n%v", key, err)
+		}
+	}
+
+	cfg = defaultConfig()
+	cfg.State.Path = filepath.Join(t.TempDir(), "state.json")
+	cfg.State.RestoreFrame = true
+	if err := cfg.validate(); err != nil {
+		t.Errorf("restore_frame with a path is invalid: %v", err)
+	}
+}
+
+func TestApplyFlags(t *testing.T) {
+	oldHTTPAddr, oldFrameRate, oldStrips := httpAddr, frameRate, strips
+	t.Cleanup(func() {
+		httpAddr, frameRate, strips = oldHTTPAddr, oldFrameRate, oldStrips
+	})
+
+	flags := pflag.NewFlagSet("christmasd", pflag.ContinueOnError)
+	flags.StringVarP(&httpAddr, "http-addr", "a", httpAddr, "")
+	flags.IntVar(&frameRate, "fps", frameRate, "")
+	flags.StringArrayVar(&strips, "strip", strips, "")
+
+	if err := flags.Parse([]string{"--fps", "60", "--strip", "18:GRB", "--strip", "13:RGB"}); err != nil {
+		t.Fatal("cannot parse flags:", err)
+	}
+
+	cfg, err := loadConfig(writeConfig(t, `
+		[server]
+		http_addr = "127.0.0.1:8000"
+
+		[canvas]
+		fps = 30
+	`))
+	if err != nil {
+		t.Fatal("cannot load config:", err)
+	}
+
+	if err := applyFlags(&cfg, flags); err != nil {
+		t.Fatal("cannot apply flags:", err)
+	}
+
+	// Flags that were set win over the file, and the others leave it alone.
+	if cfg.Canvas.FrameRate != 60 {
+		t.Errorf("canvas.fps = %d, want the flag's", cfg.Canvas.FrameRate)
+	}
+	if cfg.Server.HTTPAddr != "127.0.0.1:8000" {
+		t.Errorf("server.http_addr = %q, want the file's", cfg.Server.HTTPAddr)
+	}
+
+	wantStrips := []stripConfig{
+		{GPIOPin: 18, ColorOrder: colorOrder(ledctl.GRBOrder), DMAChannel: defaultStripConfig.DMAChannel},
+		{GPIOPin: 13, ColorOrder: colorOrder(ledctl.RGBOrder), DMAChannel: defaultStripConfig.DMAChannel},
+	}
+	if !slices.EqualFunc(cfg.Hardware.Strips, wantStrips, stripConfigEqual) {
+		t.Errorf("hardware.strip = %+v, want %+v", cfg.Hardware.Strips, wantStrips)
+	}
+
+	if err := cfg.validate(); err != nil {
+		t.Errorf("config is invalid after applying flags: %v", err)
+	}
+}
+
+func TestApplyFlagsInvalidStrip(t *testing.T) {
+	oldStrips := strips
+	t.Cleanup(func() { strips = oldStrips })
+
+	flags := pflag.NewFlagSet("christmasd", pflag.ContinueOnError)
+	flags.StringArrayVar(&strips, "strip", strips, "")
+
+	if err := flags.Parse([]string{"--strip", "12:XYZ"}); err != nil {
+		t.Fatal("cannot parse flags:", err)
+	}
+
+	cfg := defaultConfig()
+	if err := applyFlags(&cfg, flags); err == nil {
+		t.Error("expected an error for an invalid strip")
+	}
+}
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "christmasd.toml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal("cannot write config:", err)
+	}
+	return path
+}
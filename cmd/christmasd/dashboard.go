@@ -0,0 +1,62 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+	"net/url"
+)
+
+// The dashboard is plain JavaScript modules, so it needs no build step.
+//
+//go:embed dashboard
+var dashboardFS embed.FS
+var dashboardFilesFS, _ = fs.Sub(dashboardFS, "dashboard")
+
+// withDashboard serves the admin dashboard under /dashboard/ and everything
+// else with api. The dashboard is only static files, so it is served without
+// authentication; it asks for credentials once the API wants them.
+//
+// Requests to api that change something are rejected if a browser sent them
+// on behalf of another site, see crossSiteRequest.
+func withDashboard(api http.Handler) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/dashboard/", http.StripPrefix("/dashboard/", http.FileServer(http.FS(dashboardFilesFS))))
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			http.Redirect(w, r, "/dashboard/", http.StatusFound)
+			return
+		}
+		if crossSiteRequest(r) {
+			http.Error(w, "cross-site request rejected", http.StatusForbidden)
+			return
+		}
+		api.ServeHTTP(w, r)
+	})
+	return mux
+}
+
+// crossSiteRequest returns whether a request to the admin API that changes
+// something was sent by a browser on behalf of another site. Browsers send
+// cached Basic credentials, or none at all if the admin API needs none, with
+// requests made by any page, but they also tell where those requests came
+// from: Sec-Fetch-Site is cross-site, or the Origin is not the admin server's.
+// Clients other than browsers send neither header, so they are let through.
+// Safe methods are always allowed, since they don't change anything.
+func crossSiteRequest(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+
+	if r.Header.Get("Sec-Fetch-Site") == "cross-site" {
+		return true
+	}
+
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return false
+	}
+	u, err := url.Parse(origin)
+	return err != nil || u.Host != r.Host
+}
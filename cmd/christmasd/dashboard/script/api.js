@@ -0,0 +1,81 @@
+// AdminAPI talks to the christmasd admin API on the same server that serves the
+// dashboard.
+
+const authKey = "christmasd-admin-auth";
+
+export class UnauthorizedError extends Error {
+  constructor() {
+    super("unauthorized");
+  }
+}
+
+export class AdminAPI {
+  constructor() {
+    this.auth = sessionStorage.getItem(authKey) ?? "";
+  }
+
+  // login remembers the credentials for this browser tab. Either a token or a
+  // username and a password must be given.
+  login({ token, username, password }) {
+    if (token) {
+      this.auth = `Bearer ${token}`;
+    } else if (username) {
+      this.auth = `Basic ${btoa(`${username}:${password}`)}`;
+    } else {
+      this.auth = "";
+    }
+    sessionStorage.setItem(authKey, this.auth);
+  }
+
+  logout() {
+    this.auth = "";
+    sessionStorage.removeItem(authKey);
+  }
+
+  // fetch makes a request to the admin API. params are added to the query
+  // string, skipping empty ones. It throws UnauthorizedError if the request
+  // needs credentials, and an Error with the server's message for any other
+  // failed request.
+  async fetch(method, path, params = {}, body = undefined) {
+    const url = new URL(path, location.origin);
+    for (const [key, value] of Object.entries(params)) {
+      if (value !== undefined && value !== null && value !== "") {
+        url.searchParams.set(key, String(value));
+      }
+    }
+
+    // X-Requested-With keeps the browser from showing its own login prompt.
+    const headers = { "X-Requested-With": "christmasd-dashboard" };
+    if (this.auth) {
+      headers["Authorization"] = this.auth;
+    }
+
+    const resp = await fetch(url, { method, headers, body });
+    if (resp.status === 401) {
+      throw new UnauthorizedError();
+    }
+    if (!resp.ok) {
+      const text = await resp.text();
+      throw new Error(text.trim() || `${resp.status} ${resp.statusText}`);
+    }
+    return resp;
+  }
+
+  async json(method, path, params = {}, body = undefined) {
+    const resp = await this.fetch(method, path, params, body);
+    const text = await resp.text();
+    return text ? JSON.parse(text) : null;
+  }
+
+  get(path, params = {}) {
+    return this.json("GET", path, params);
+  }
+
+  post(path, params = {}, body = undefined) {
+    return this.json("POST", path, params, body);
+  }
+
+  delete(path, params = {}) {
+    return this.json("DELETE", path, params);
+  }
+}
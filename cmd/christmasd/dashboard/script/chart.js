@@ -0,0 +1,87 @@
+// LineChart draws the last few samples of one or more series onto a canvas.
+export class LineChart {
+  // series is a list of { label, color }. unit is appended to the values in
+  // the legend.
+  constructor(canvas, series, { unit = "", samples = 120, min = 0 } = {}) {
+    this.canvas = canvas;
+    this.ctx = canvas.getContext("2d");
+    this.series = series;
+    this.unit = unit;
+    this.samples = samples;
+    this.min = min;
+    this.values = series.map(() => []);
+  }
+
+  // push adds a sample to each series, in the same order as the series.
+  push(...values) {
+    for (const [i, value] of values.entries()) {
+      const vs = this.values[i];
+      vs.push(value);
+      if (vs.length > this.samples) {
+        vs.shift();
+      }
+    }
+    this.draw();
+  }
+
+  draw() {
+    const { ctx, canvas } = this;
+    const w = canvas.width;
+    const h = canvas.height;
+    const pad = 18;
+
+    ctx.clearRect(0, 0, w, h);
+
+    const all = this.values.flat();
+    if (all.length === 0) {
+      return;
+    }
+    const max = Math.max(this.min + 1e-9, ...all) * 1.1;
+
+    ctx.strokeStyle = "#3c3f44";
+    ctx.fillStyle = "#9a9a9a";
+    ctx.font = "11px system-ui, sans-serif";
+    ctx.beginPath();
+    ctx.moveTo(0, h - pad);
+    ctx.lineTo(w, h - pad);
+    ctx.stroke();
+    ctx.fillText(`${format(max)}${this.unit}`, 4, 12);
+
+    const x = (i) => (i / (this.samples - 1)) * w;
+    const y = (v) => h - pad - ((v - this.min) / (max - this.min)) * (h - pad - 16);
+
+    let legendX = 80;
+    for (const [i, { label, color }] of this.series.entries()) {
+      const vs = this.values[i];
+      const offset = this.samples - vs.length;
+
+      ctx.strokeStyle = color;
+      ctx.lineWidth = 1.5;
+      ctx.beginPath();
+      for (const [j, v] of vs.entries()) {
+        if (j === 0) {
+          ctx.moveTo(x(offset + j), y(v));
+        } else {
+          ctx.lineTo(x(offset + j), y(v));
+        }
+      }
+      ctx.stroke();
+
+      const last = vs.length ? vs[vs.length - 1] : 0;
+      const legend = `${label}: ${format(last)}${this.unit}`;
+      ctx.fillStyle = color;
+      ctx.fillText(legend, legendX, h - 4);
+      legendX += ctx.measureText(legend).width + 16;
+    }
+  }
+}
+
+function format(v) {
+  if (v >= 100) {
+    return v.toFixed(0);
+  }
+  if (v >= 10) {
+    return v.toFixed(1);
+  }
+  return v.toFixed(2);
+}
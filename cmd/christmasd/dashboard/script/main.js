@@ -0,0 +1,477 @@
+import { AdminAPI, UnauthorizedError } from "./api.js";
+import { LineChart } from "./chart.js";
+
+const api = new AdminAPI();
+
+const $ = (selector, parent = document) => parent.querySelector(selector);
+
+const statusElem = $("#status");
+const loginDialog = $("#login");
+const logoutButton = $("#logout");
+
+// element creates an element with the given properties and children. Text is
+// always set as text, never as HTML.
+function element(tag, props = {}, ...children) {
+  const elem = document.createElement(tag);
+  Object.assign(elem, props);
+  elem.append(...children.filter((c) => c !== null && c !== undefined));
+  return elem;
+}
+
+function setStatus(message, isError = false) {
+  statusElem.textContent = message;
+  statusElem.classList.toggle("error", isError);
+}
+
+function formatTime(s) {
+  return s ? new Date(s).toLocaleString() : "never";
+}
+
+function formatSince(s) {
+  const seconds = Math.round((Date.now() - new Date(s).getTime()) / 1000);
+  if (seconds < 60) {
+    return `${seconds}s ago`;
+  }
+  if (seconds < 3600) {
+    return `${Math.floor(seconds / 60)}m ago`;
+  }
+  return `${Math.floor(seconds / 3600)}h ${Math.floor((seconds % 3600) / 60)}m ago`;
+}
+
+const nsPerMs = 1e6;
+
+// Calling the API
+
+let loggingIn = false;
+
+// call runs an API call and reports its failure in the status bar. If the API
+// wants credentials, the login dialog is shown.
+async function call(fn) {
+  try {
+    return await fn();
+  } catch (err) {
+    if (err instanceof UnauthorizedError) {
+      showLogin();
+    } else {
+      setStatus(err.message, true);
+    }
+    return undefined;
+  }
+}
+
+function showLogin(message = "") {
+  if (loggingIn) {
+    return;
+  }
+  loggingIn = true;
+  $("#login-error").textContent = message;
+  loginDialog.showModal();
+}
+
+loginDialog.addEventListener("close", () => {
+  const form = new FormData($("form", loginDialog));
+  api.login({
+    token: form.get("token"),
+    username: form.get("username"),
+    password: form.get("password"),
+  });
+  $("form", loginDialog).reset();
+  loggingIn = false;
+  logoutButton.hidden = !api.auth;
+  refreshAll();
+});
+
+logoutButton.hidden = !api.auth;
+logoutButton.addEventListener("click", () => {
+  api.logout();
+  logoutButton.hidden = true;
+  showLogin();
+});
+
+// every calls fn now and then every interval milliseconds, skipping calls
+// while the login dialog is open or the page is hidden.
+function every(interval, fn) {
+  const tick = () => {
+    if (!loggingIn && !document.hidden) {
+      fn();
+    }
+  };
+  tick();
+  setInterval(tick, interval);
+}
+
+// Tree preview
+
+const snapshotImg = $("#snapshot");
+let snapshotURL = "";
+let snapshotLoading = false;
+
+async function refreshSnapshot() {
+  if (snapshotLoading) {
+    return;
+  }
+  snapshotLoading = true;
+  try {
+    const width = Math.round(Math.min(snapshotImg.clientWidth || 400, 1024) * devicePixelRatio);
+    const resp = await call(() => api.fetch("GET", "/snapshot.png", { width }));
+    if (!resp) {
+      return;
+    }
+    const url = URL.createObjectURL(await resp.blob());
+    snapshotImg.src = url;
+    if (snapshotURL) {
+      URL.revokeObjectURL(snapshotURL);
+    }
+    snapshotURL = url;
+  } finally {
+    snapshotLoading = false;
+  }
+}
+
+// Sessions
+
+const sessionsBody = $("#sessions tbody");
+const sessionsChart = new LineChart($("#chart-sessions"), [
+  { label: "connected", color: "#f0c674" },
+]);
+
+async function refreshSessions() {
+  const sessions = await call(() => api.get("/sessions"));
+  if (!sessions) {
+    return;
+  }
+
+  $("#sessions .count").textContent = `(${sessions.length})`;
+  sessionsChart.push(sessions.length);
+
+  sessionsBody.replaceChildren(
+    ...sessions.map((s) => {
+      const kick = element("button", { className: "danger", textContent: "Kick" });
+      kick.addEventListener("click", async () => {
+        const reason = prompt(`Kick ${s.label || s.addr}? Reason (optional):`);
+        if (reason === null) {
+          return;
+        }
+        await call(() => api.post(`/sessions/${encodeURIComponent(s.id)}/kick`, { reason }));
+        refreshSessions();
+      });
+
+      return element(
+        "tr",
+        {},
+        element("td", { textContent: (s.label || "-") + (s.view_only ? " (view)" : "") }),
+        element("td", { textContent: s.addr }),
+        element("td", { textContent: formatSince(s.started), title: formatTime(s.started) }),
+        element("td", {}, kick),
+      );
+    }),
+  );
+}
+
+$("#kick-all").addEventListener("click", async () => {
+  const reason = prompt("Kick everyone? Reason (optional):");
+  if (reason === null) {
+    return;
+  }
+  await call(() => api.post("/kick-all", { reason }));
+  refreshSessions();
+});
+
+$("#notice-form").addEventListener("submit", async (ev) => {
+  ev.preventDefault();
+  const form = new FormData(ev.target);
+  const sent = await call(() =>
+    api.post("/notice", {
+      message: form.get("message"),
+      kind: form.get("kind"),
+      deadline: form.get("deadline"),
+    })
+  );
+  if (sent) {
+    ev.target.reset();
+  }
+});
+
+// Tokens
+
+const tokensBody = $("#tokens tbody");
+
+async function refreshTokens() {
+  const tokens = await call(() => api.get("/tokens"));
+  if (!tokens) {
+    return;
+  }
+
+  tokensBody.replaceChildren(
+    ...tokens.map((t) => {
+      let revoke = null;
+      if (t.id !== "default") {
+        revoke = element("button", { className: "danger", textContent: "Revoke" });
+        revoke.addEventListener("click", async () => {
+          if (!confirm(`Revoke ${t.label} and kick everyone using it?`)) {
+            return;
+          }
+          await call(() => api.delete(`/tokens/${encodeURIComponent(t.id)}`));
+          refreshTokens();
+          refreshSessions();
+        });
+      }
+
+      const uses = t.max_uses ? `${t.uses} / ${t.max_uses}` : String(t.uses);
+      return element(
+        "tr",
+        {},
+        element("td", { textContent: t.label }),
+        element("td", { textContent: t.scope }),
+        element("td", { textContent: uses }),
+        element("td", { textContent: formatTime(t.expires) }),
+        element("td", {}, revoke),
+      );
+    }),
+  );
+}
+
+$("#token-form").addEventListener("submit", async (ev) => {
+  ev.preventDefault();
+  const form = new FormData(ev.target);
+  const token = await call(() =>
+    api.post("/tokens", {
+      label: form.get("label"),
+      scope: form.get("scope"),
+      expires: form.get("expires"),
+      max_uses: form.get("max_uses"),
+    })
+  );
+  if (!token) {
+    return;
+  }
+
+  ev.target.reset();
+  const secret = $("#token-secret");
+  $("code", secret).textContent = token.token;
+  secret.hidden = false;
+  refreshTokens();
+});
+
+// Brightness, schedule and override
+
+const brightnessInput = $("#brightness");
+let brightnessDragging = false;
+
+async function refreshBrightness() {
+  const b = await call(() => api.get("/brightness"));
+  if (!b) {
+    return;
+  }
+  if (!brightnessDragging) {
+    brightnessInput.value = String(Math.round(b.level * 100));
+  }
+  $("#brightness-value").textContent = `${Math.round(b.level * 100)}%`;
+  $("#brightness-effective").textContent = `The LEDs are drawn at ${
+    Math.round(b.effective * 100)
+  }% after the config and the schedule.`;
+}
+
+brightnessInput.addEventListener("input", () => {
+  brightnessDragging = true;
+  $("#brightness-value").textContent = `${brightnessInput.value}%`;
+});
+
+brightnessInput.addEventListener("change", async () => {
+  brightnessDragging = false;
+  await call(() => api.post("/brightness", { level: Number(brightnessInput.value) / 100 }));
+  refreshBrightness();
+});
+
+function describeSchedule(s) {
+  let text = s.on ? "On" : "Off";
+  if (s.reason) {
+    text += `: ${s.reason}`;
+  }
+  if (s.override) {
+    text += s.override.until
+      ? ` (forced by an admin until ${formatTime(s.override.until)})`
+      : " (forced by an admin)";
+  } else if (s.until) {
+    text += ` (until ${formatTime(s.until)})`;
+  }
+  return text;
+}
+
+async function refreshSchedule() {
+  const s = await call(() => api.get("/schedule"));
+  if (s) {
+    $("#schedule").textContent = describeSchedule(s);
+  }
+}
+
+for (const button of document.querySelectorAll("[data-schedule]")) {
+  button.addEventListener("click", async () => {
+    const state = button.dataset.schedule;
+    const duration = state === "auto" ? "" : $("#schedule-duration").value;
+    const s = await call(() => api.post("/schedule/override", { state, duration }));
+    if (s) {
+      $("#schedule").textContent = describeSchedule(s);
+    }
+    refreshBrightness();
+  });
+}
+
+const canvasForm = $("#canvas-form");
+
+function showCanvas(c) {
+  $("#canvas").textContent = `The canvas is ${c.width}×${c.height} pixels.`;
+  if (!canvasForm.contains(document.activeElement)) {
+    canvasForm.elements.fps.value = String(c.fps);
+    canvasForm.elements.ppi.value = String(c.ppi);
+  }
+}
+
+async function refreshCanvas() {
+  const c = await call(() => api.get("/canvas"));
+  if (c) {
+    showCanvas(c);
+  }
+}
+
+canvasForm.addEventListener("submit", async (ev) => {
+  ev.preventDefault();
+  const form = new FormData(canvasForm);
+  const c = await call(() => api.post("/canvas", { fps: form.get("fps"), ppi: form.get("ppi") }));
+  if (c) {
+    showCanvas(c);
+  }
+});
+
+function describeOverride(o) {
+  if (!o.active) {
+    return "Nothing is overriding the sessions.";
+  }
+  let text = `Showing ${o.kind === "color" ? `the color ${o.color}` : `an ${o.kind}`}`;
+  text += ` since ${formatTime(o.started)}.`;
+  return text;
+}
+
+async function refreshOverride() {
+  const o = await call(() => api.get("/override"));
+  if (o) {
+    $("#override").textContent = describeOverride(o);
+  }
+}
+
+$("#override-color-show").addEventListener("click", async () => {
+  const color = $("#override-color").value;
+  const o = await call(() => api.post("/override/color", { color }));
+  if (o) {
+    $("#override").textContent = describeOverride(o);
+  }
+});
+
+$("#override-image").addEventListener("change", async (ev) => {
+  const file = ev.target.files[0];
+  if (!file) {
+    return;
+  }
+  const o = await call(() => api.post("/override/image", { fit: "contain" }, file));
+  if (o) {
+    $("#override").textContent = describeOverride(o);
+  }
+  ev.target.value = "";
+});
+
+$("#override-stop").addEventListener("click", async () => {
+  const o = await call(() => api.post("/override/stop"));
+  if (o) {
+    $("#override").textContent = describeOverride(o);
+  }
+});
+
+// Metrics
+
+const fpsChart = new LineChart($("#chart-fps"), [
+  { label: "actual", color: "#3fa34d" },
+  { label: "target", color: "#9a9a9a" },
+], { unit: " fps" });
+
+const latencyChart = new LineChart($("#chart-latency"), [
+  { label: "mean", color: "#81a2be" },
+  { label: "max", color: "#cc6666" },
+], { unit: " ms" });
+
+async function refreshFrames() {
+  const f = await call(() => api.get("/frames"));
+  if (!f) {
+    return;
+  }
+  fpsChart.push(f.frame_rate, f.target_frame_rate);
+  latencyChart.push(f.latency_mean / nsPerMs, f.latency_max / nsPerMs);
+  setStatus(`${f.frame_rate.toFixed(1)} fps, ${f.frames} frames written`);
+}
+
+// Audit log
+
+const auditBody = $("#audit tbody");
+
+function describeEvent(e) {
+  if (e.session) {
+    const s = e.session;
+    const parts = [s.label || s.id, e.addr];
+    if (e.event === "session.end") {
+      parts.push(`${Math.round(s.duration / 1e9)}s`, `${s.frames ?? 0} frames`, s.reason);
+    }
+    return parts.filter(Boolean).join(", ");
+  }
+  return e.details ? JSON.stringify(e.details) : "";
+}
+
+async function refreshAudit() {
+  const events = await call(() =>
+    api.get("/audit", {
+      event: $("#audit-event").value,
+      since: $("#audit-since").value,
+      limit: 200,
+    })
+  );
+  if (!events) {
+    return;
+  }
+
+  auditBody.replaceChildren(
+    ...events.reverse().map((e) =>
+      element(
+        "tr",
+        {},
+        element("td", { textContent: formatTime(e.time) }),
+        element("td", { textContent: e.event }),
+        element("td", { textContent: [e.who, e.session ? "" : e.addr].filter(Boolean).join(" ") }),
+        element("td", { className: "details", textContent: describeEvent(e) }),
+      )
+    ),
+  );
+}
+
+$("#audit-refresh").addEventListener("click", refreshAudit);
+
+function refreshAll() {
+  refreshSnapshot();
+  refreshSessions();
+  refreshTokens();
+  refreshBrightness();
+  refreshSchedule();
+  refreshCanvas();
+  refreshOverride();
+  refreshFrames();
+  refreshAudit();
+}
+
+every(500, refreshSnapshot);
+every(1000, refreshFrames);
+every(2000, refreshSessions);
+every(5000, () => {
+  refreshBrightness();
+  refreshSchedule();
+  refreshCanvas();
+  refreshOverride();
+});
+every(15000, refreshTokens);
+every(30000, refreshAudit);
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/bits"
+	"sort"
+	"strings"
+	"time"
+
+	"dev.acmcsuf.com/christmas/lib/leddraw"
+	"dev.acmcsuf.com/christmas/lib/xcolor"
+	"dev.acmcsuf.com/christmasd"
+)
+
+// diagPattern draws a single step of a diagnostics pattern onto leds. step
+// counts up by one every interval, starting at 0.
+type diagPattern func(leds leddraw.LEDStrip, step int, opts diagOptions)
+
+// diagPatterns maps pattern names to diagnostics patterns.
+var diagPatterns = map[string]diagPattern{
+	"walk":   drawDiagWalk,
+	"rgb":    drawDiagRGB,
+	"binary": drawDiagBinary,
+	"points": drawDiagPoints,
+}
+
+// diagDefaultIntervals is the default step interval of each pattern.
+var diagDefaultIntervals = map[string]time.Duration{
+	"walk":   250 * time.Millisecond,
+	"rgb":    time.Second,
+	"binary": 500 * time.Millisecond,
+	"points": time.Second,
+}
+
+// diagPatternNames returns the names of all diagnostics patterns, sorted.
+func diagPatternNames() []string {
+	names := make([]string, 0, len(diagPatterns))
+	for name := range diagPatterns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// diagOptions are the options of a diagnostics run.
+type diagOptions struct {
+	// Pattern is the name of the pattern.
+	Pattern string `json:"pattern"`
+	// Interval is how long each step of the pattern is shown for.
+	Interval time.Duration `json:"interval"`
+	// Duration is how long the pattern runs before it stops by itself. Zero
+	// means until it is stopped.
+	Duration time.Duration `json:"duration,omitempty"`
+	// LEDs are the indices of the LEDs to light for the points pattern.
+	LEDs []int `json:"leds,omitempty"`
+}
+
+var (
+	diagWhite = xcolor.RGB{R: 255, G: 255, B: 255}
+	diagRed   = xcolor.RGB{R: 255}
+	diagGreen = xcolor.RGB{G: 255}
+	diagBlue  = xcolor.RGB{B: 255}
+)
+
+// drawDiagWalk lights one LED at a time, in order.
+func drawDiagWalk(leds leddraw.LEDStrip, step int, opts diagOptions) {
+	clear(leds)
+	if len(leds) > 0 {
+		leds[step%len(leds)] = diagWhite
+	}
+}
+
+// drawDiagRGB lights all LEDs red, then green, then blue. If the colors come
+// out in a different order, then the strip's color order is wrong.
+func drawDiagRGB(leds leddraw.LEDStrip, step int, opts diagOptions) {
+	color := [...]xcolor.RGB{diagRed, diagGreen, diagBlue}[step%3]
+	for i := range leds {
+		leds[i] = color
+	}
+}
+
+// drawDiagBinary blinks each LED's index in binary, most significant bit
+// first. Each code starts with all LEDs white and then dark, followed by one
+// step per bit where a 1 is green and a 0 is red, with a dark step after each
+// bit.
+func drawDiagBinary(leds leddraw.LEDStrip, step int, opts diagOptions) {
+	nbits := diagBinaryBits(len(leds))
+	step %= 2 + 2*nbits
+
+	switch {
+	case step == 0:
+		for i := range leds {
+			leds[i] = diagWhite
+		}
+	case step%2 == 1:
+		clear(leds)
+	default:
+		bit := nbits - step/2 // counts down from nbits-1 to 0
+		for i := range leds {
+			if i&(1<<bit) != 0 {
+				leds[i] = diagGreen
+			} else {
+				leds[i] = diagRed
+			}
+		}
+	}
+}
+
+// diagBinaryBits returns the number of bits needed to blink the index of
+// every LED.
+func diagBinaryBits(numLEDs int) int {
+	return max(1, bits.Len(uint(numLEDs-1)))
+}
+
+// drawDiagPoints lights the LEDs in opts.LEDs.
+func drawDiagPoints(leds leddraw.LEDStrip, step int, opts diagOptions) {
+	clear(leds)
+	for _, i := range opts.LEDs {
+		if i < len(leds) {
+			leds[i] = diagWhite
+		}
+	}
+}
+
+// parseDiagOptions checks the pattern name and fills in the default
+// interval.
+func parseDiagOptions(opts diagOptions) (diagOptions, error) {
+	opts.Pattern = strings.ToLower(opts.Pattern)
+	if _, ok := diagPatterns[opts.Pattern]; !ok {
+		return opts, fmt.Errorf("unknown diagnostics pattern %q, expected one of %s",
+			opts.Pattern, strings.Join(diagPatternNames(), ", "))
+	}
+
+	if opts.Interval == 0 {
+		opts.Interval = diagDefaultIntervals[opts.Pattern]
+	}
+	if opts.Interval < 10*time.Millisecond {
+		return opts, fmt.Errorf("interval %v is too short, must be at least 10ms", opts.Interval)
+	}
+	if opts.Duration < 0 {
+		return opts, fmt.Errorf("duration %v is negative", opts.Duration)
+	}
+
+	return opts, nil
+}
+
+// diagnostics is an LEDController that can take over the LEDs to run a
+// diagnostics pattern, suspending the client sessions and the idle animation
+// while it runs.
+type diagnostics struct {
+	takeover
+
+	// run is the last pattern that was started. It is guarded by mu, and
+	// only shown while a run is active.
+	run *diagRun
+}
+
+var (
+	_ christmasd.LEDController        = (*diagnostics)(nil)
+	_ christmasd.SessionLEDController = (*diagnostics)(nil)
+)
+
+type diagRun struct {
+	diagOptions
+	Started time.Time `json:"started"`
+}
+
+// diagStatus is the status of the diagnostics.
+type diagStatus struct {
+	Running bool `json:"running"`
+	*diagRun
+}
+
+func newDiagnostics(ctrl christmasd.LEDController, logger *slog.Logger) *diagnostics {
+	return &diagnostics{
+		takeover: takeover{
+			ctrl:   ctrl,
+			logger: logger,
+		},
+	}
+}
+
+// status returns the currently running pattern, if any.
+func (d *diagnostics) status() diagStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.active() {
+		return diagStatus{}
+	}
+	run := *d.run
+	return diagStatus{Running: true, diagRun: &run}
+}
+
+// start starts running a diagnostics pattern, replacing any pattern that is
+// already running. The options must have gone through parseDiagOptions.
+func (d *diagnostics) start(opts diagOptions) diagStatus {
+	run := diagRun{
+		diagOptions: opts,
+		Started:     time.Now(),
+	}
+
+	var leds leddraw.LEDStrip
+	first := func() error {
+		d.run = &run
+		leds = d.draw(opts, nil, 0)
+		return nil
+	}
+
+	// first never fails, so neither does begin.
+	d.begin(opts.Duration, first, func(ctx context.Context) {
+		d.loop(ctx, opts, leds)
+	})
+
+	d.logger.Info(
+		"starting diagnostics, client sessions are suspended",
+		"pattern", opts.Pattern,
+		"interval", opts.Interval)
+
+	status := run
+	return diagStatus{Running: true, diagRun: &status}
+}
+
+// stop stops the running diagnostics pattern, if any, and waits for it to
+// stop.
+func (d *diagnostics) stop() {
+	d.end()
+}
+
+func (d *diagnostics) loop(ctx context.Context, opts diagOptions, leds leddraw.LEDStrip) {
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+
+	for step := 1; ; step++ {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		leds = d.draw(opts, leds, step)
+	}
+}
+
+// draw draws a single step of the pattern. leds is reused if it has the right
+// length.
+func (d *diagnostics) draw(opts diagOptions, leds leddraw.LEDStrip, step int) leddraw.LEDStrip {
+	if n := len(d.ctrl.LEDs()); len(leds) != n {
+		leds = make(leddraw.LEDStrip, n)
+	}
+
+	diagPatterns[opts.Pattern](leds, step, opts)
+
+	if err := d.ctrl.SetLEDs(leds); err != nil {
+		d.logger.Warn(
+			"failed to draw diagnostics pattern",
+			"pattern", opts.Pattern,
+			"error", err)
+	}
+
+	return leds
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	"dev.acmcsuf.com/christmas/lib/leddraw"
+	"dev.acmcsuf.com/christmasd/christmasdtest"
+)
+
+func TestDiagBinary(t *testing.T) {
+	leds := make(leddraw.LEDStrip, 6) // indices need 3 bits
+
+	var got [6]string
+	for step := 2; step < 8; step += 2 {
+		drawDiagBinary(leds, step, diagOptions{})
+		for i, led := range leds {
+			switch led {
+			case diagGreen:
+				got[i] += "1"
+			case diagRed:
+				got[i] += "0"
+			default:
+				t.Fatalf("step %d: LED %d is %v, want red or green", step, i, led)
+			}
+		}
+	}
+
+	want := [6]string{"000", "001", "010", "011", "100", "101"}
+	if got != want {
+		t.Errorf("blink codes = %q, want %q", got, want)
+	}
+
+	drawDiagBinary(leds, 8, diagOptions{})
+	if leds[5] != diagWhite {
+		t.Errorf("code does not start over after all bits, got %v", leds[5])
+	}
+}
+
+func TestDiagnosticsHoldsFrames(t *testing.T) {
+	ctrl := christmasdtest.NewLEDController(3, 3, 1)
+	diag := newDiagnostics(ctrl, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	before := leddraw.LEDStrip{{R: 1}, {R: 2}, {R: 3}}
+	if err := diag.SetLEDs(before); err != nil {
+		t.Fatal("cannot set LEDs:", err)
+	}
+
+	diag.start(diagOptions{Pattern: "rgb", Interval: time.Hour})
+	if got := ctrl.LEDs()[0]; got != diagRed {
+		t.Errorf("first LED during diagnostics = %v, want red", got)
+	}
+
+	held := leddraw.LEDStrip{{G: 1}, {G: 2}, {G: 3}}
+	if err := diag.SetLEDs(held); err != nil {
+		t.Fatal("cannot set LEDs:", err)
+	}
+	if got := ctrl.LEDs()[0]; got != diagRed {
+		t.Errorf("frame was drawn during diagnostics, first LED = %v", got)
+	}
+
+	diag.stop()
+	if status := diag.status(); status.Running {
+		t.Error("diagnostics still running after stop")
+	}
+	if got := ctrl.LEDs(); !slices.Equal(got, held) {
+		t.Errorf("LEDs after diagnostics = %v, want the held frame %v", got, held)
+	}
+}
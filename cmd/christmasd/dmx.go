@@ -0,0 +1,206 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"dev.acmcsuf.com/christmasd/dmxnet"
+	"libdb.so/ledctl"
+)
+
+// dmxRange maps a range of LEDs on a strip onto the channels of a universe.
+type dmxRange struct {
+	// First is the index of the first LED of the range on the strip.
+	First int `toml:"first"`
+	// Count is the number of LEDs in the range.
+	Count int `toml:"count"`
+	// Universe is the universe that the range is sent in.
+	Universe int `toml:"universe"`
+	// Channel is the channel of the range's first LED, starting at 1. Each
+	// LED takes 3 channels.
+	Channel int `toml:"channel"`
+}
+
+func validateDMXStrip(cfg stripConfig) error {
+	protocol, _ := cfg.dmxProtocol()
+
+	var errs []error
+	if cfg.Address == "" && protocol != dmxnet.E131 {
+		errs = append(errs, fmt.Errorf("%s needs an address", protocol))
+	}
+	if cfg.Priority < 0 || cfg.Priority > dmxnet.MaxPriority {
+		errs = append(errs, fmt.Errorf("priority must be between 0 and %d, got %d", dmxnet.MaxPriority, cfg.Priority))
+	}
+	errs = append(errs, validateDMXRanges(protocol, cfg.Universe, cfg.Ranges)...)
+
+	return errors.Join(errs...)
+}
+
+// validateDMXRanges checks that the universe, or the ranges if there are
+// any, can be carried by the protocol.
+func validateDMXRanges(protocol dmxnet.Protocol, universe int, ranges []dmxRange) []error {
+	lo, hi := protocol.UniverseRange()
+
+	var errs []error
+	if len(ranges) == 0 {
+		if universe < lo || universe > hi {
+			errs = append(errs, fmt.Errorf("universe must be between %d and %d, got %d", lo, hi, universe))
+		}
+	}
+
+	for i, r := range ranges {
+		check := func(ok bool, format string, args ...any) {
+			if !ok {
+				errs = append(errs, fmt.Errorf("range %d: %s", i, fmt.Sprintf(format, args...)))
+			}
+		}
+		check(r.First >= 0, "first must not be negative, got %d", r.First)
+		check(r.Count > 0, "count must be positive, got %d", r.Count)
+		check(r.Universe >= lo && r.Universe <= hi, "universe must be between %d and %d, got %d", lo, hi, r.Universe)
+		check(r.Channel >= 1 && r.Channel-1+3*r.Count <= dmxnet.UniverseSize,
+			"channels %d to %d do not fit in a universe", r.Channel, r.Channel-1+3*r.Count)
+	}
+
+	return errs
+}
+
+// dmxRanges returns the given ranges, or the ranges that pack numPixels LEDs
+// into consecutive universes starting at universe if none are given. Every
+// LED is checked to be in exactly one range.
+func dmxRanges(ranges []dmxRange, protocol dmxnet.Protocol, universe, numPixels int) ([]dmxRange, error) {
+	if len(ranges) == 0 {
+		for first := 0; first < numPixels; first += dmxnet.PixelsPerUniverse {
+			ranges = append(ranges, dmxRange{
+				First:    first,
+				Count:    min(dmxnet.PixelsPerUniverse, numPixels-first),
+				Universe: universe + len(ranges),
+				Channel:  1,
+			})
+		}
+		if len(ranges) == 0 {
+			return nil, nil
+		}
+		_, hi := protocol.UniverseRange()
+		if last := ranges[len(ranges)-1].Universe; last > hi {
+			return nil, fmt.Errorf("%d LEDs need universes up to %d, past the last universe %d", numPixels, last, hi)
+		}
+		return ranges, nil
+	}
+
+	covered := make([]int, numPixels) // range index + 1
+	for i, r := range ranges {
+		for led := r.First; led < r.First+r.Count; led++ {
+			if led >= numPixels {
+				return nil, fmt.Errorf("range %d goes past the last LED of the strip, %d", i, numPixels-1)
+			}
+			if covered[led] != 0 {
+				return nil, fmt.Errorf("LED %d is in both range %d and range %d", led, covered[led]-1, i)
+			}
+			covered[led] = i + 1
+		}
+	}
+
+	for led, r := range covered {
+		if r == 0 {
+			return nil, fmt.Errorf("LED %d of the strip is not in any range", led)
+		}
+	}
+
+	return ranges, nil
+}
+
+// dmxStrip is an RGBController that sends a strip's LEDs as DMX universes to
+// a pixel controller.
+type dmxStrip struct {
+	sender    *dmxnet.Sender
+	order     [3]int // channel offsets of R, G and B
+	addrs     []dmxAddr
+	universes []dmxUniverse
+}
+
+var _ RGBController = (*dmxStrip)(nil)
+
+type dmxAddr struct {
+	universe int // index into universes
+	channel  int // starting at 0
+}
+
+type dmxUniverse struct {
+	number uint16
+	data   []byte
+}
+
+func newDMXStrip(cfg stripConfig, numPixels int) (*dmxStrip, error) {
+	protocol, _ := cfg.dmxProtocol()
+	ranges, err := dmxRanges(cfg.Ranges, protocol, cfg.Universe, numPixels)
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := cfg.ColorOrder.offsets()
+	if err != nil {
+		return nil, err
+	}
+
+	sender, err := dmxnet.NewSender(dmxnet.SenderOpts{
+		Protocol: protocol,
+		Addr:     cfg.Address,
+		Name:     "christmasd",
+		Priority: uint8(cfg.Priority),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a %s sender: %v", protocol, err)
+	}
+
+	s := &dmxStrip{
+		sender: sender,
+		order:  order,
+		addrs:  make([]dmxAddr, numPixels),
+	}
+
+	universes := make(map[int]int) // universe number -> index
+	for _, r := range ranges {
+		u, ok := universes[r.Universe]
+		if !ok {
+			u = len(s.universes)
+			universes[r.Universe] = u
+			s.universes = append(s.universes, dmxUniverse{number: uint16(r.Universe)})
+		}
+
+		for i := 0; i < r.Count; i++ {
+			channel := r.Channel - 1 + 3*i
+			s.addrs[r.First+i] = dmxAddr{universe: u, channel: channel}
+
+			// Only send as many channels as are used.
+			universe := &s.universes[u]
+			if n := channel + 3; len(universe.data) < n {
+				universe.data = append(universe.data, make([]byte, n-len(universe.data))...)
+			}
+		}
+	}
+
+	return s, nil
+}
+
+func (s *dmxStrip) SetRGBAt(i int, color ledctl.RGB) {
+	addr := s.addrs[i]
+	data := s.universes[addr.universe].data[addr.channel:]
+	data[s.order[0]] = color.R
+	data[s.order[1]] = color.G
+	data[s.order[2]] = color.B
+}
+
+// Flush sends every universe of the strip.
+func (s *dmxStrip) Flush() error {
+	var errs []error
+	for _, universe := range s.universes {
+		if err := s.sender.Send(universe.number, universe.data); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *dmxStrip) Close() error {
+	return s.sender.Close()
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"dev.acmcsuf.com/christmasd/dmxnet"
+	"libdb.so/ledctl"
+)
+
+func TestDMXStrip(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal("cannot listen:", err)
+	}
+	defer conn.Close()
+
+	strip, err := newDMXStrip(stripConfig{
+		Type:       stripArtNet,
+		ColorOrder: colorOrder(ledctl.GRBOrder),
+		Address:    conn.LocalAddr().String(),
+		Ranges: []dmxRange{
+			{First: 0, Count: 2, Universe: 5, Channel: 1},
+			{First: 2, Count: 1, Universe: 6, Channel: 10},
+		},
+	}, 3)
+	if err != nil {
+		t.Fatal("cannot create strip:", err)
+	}
+	defer strip.Close()
+
+	strip.SetRGBAt(0, ledctl.RGB{R: 1, G: 2, B: 3})
+	strip.SetRGBAt(1, ledctl.RGB{R: 4, G: 5, B: 6})
+	strip.SetRGBAt(2, ledctl.RGB{R: 7, G: 8, B: 9})
+
+	if err := strip.Flush(); err != nil {
+		t.Fatal("cannot flush:", err)
+	}
+
+	want := map[uint16][]byte{
+		5: {2, 1, 3, 5, 4, 6},
+		6: {0, 0, 0, 0, 0, 0, 0, 0, 0, 8, 7, 9},
+	}
+
+	buf := make([]byte, 1024)
+	for range want {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			t.Fatal("cannot receive:", err)
+		}
+
+		packet, err := dmxnet.ArtNet.Parse(buf[:n])
+		if err != nil {
+			t.Fatal("cannot parse:", err)
+		}
+
+		if got, want := string(packet.Data), string(want[packet.Universe]); got != want {
+			t.Errorf("universe %d = %v, want %v", packet.Universe, []byte(got), []byte(want))
+		}
+	}
+}
+
+func TestDMXRanges(t *testing.T) {
+	ranges, err := dmxRanges(nil, dmxnet.E131, 1, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []dmxRange{
+		{First: 0, Count: 170, Universe: 1, Channel: 1},
+		{First: 170, Count: 30, Universe: 2, Channel: 1},
+	}
+	if len(ranges) != len(want) || ranges[0] != want[0] || ranges[1] != want[1] {
+		t.Errorf("packed ranges = %v, want %v", ranges, want)
+	}
+
+	tests := []struct {
+		name   string
+		ranges []dmxRange
+	}{
+		{"gap", []dmxRange{{First: 0, Count: 1, Universe: 1, Channel: 1}, {First: 2, Count: 1, Universe: 1, Channel: 4}}},
+		{"overlap", []dmxRange{{First: 0, Count: 2, Universe: 1, Channel: 1}, {First: 1, Count: 2, Universe: 2, Channel: 1}}},
+		{"past end", []dmxRange{{First: 0, Count: 4, Universe: 1, Channel: 1}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := dmxRanges(test.ranges, dmxnet.E131, 0, 3); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"dev.acmcsuf.com/christmas/lib/leddraw"
+	"dev.acmcsuf.com/christmas/lib/xcolor"
+	"dev.acmcsuf.com/christmasd"
+	"dev.acmcsuf.com/christmasd/dmxnet"
+)
+
+type inputConfig struct {
+	// Protocol is the DMX protocol to receive, either e131 or artnet. Empty
+	// disables DMX input.
+	Protocol dmxnet.Protocol `toml:"protocol,omitempty"`
+	// ListenAddr is the [host]:port to receive on. It defaults to the
+	// protocol's port on all interfaces.
+	ListenAddr string `toml:"listen_addr,omitempty"`
+	// Multicast joins the E1.31 multicast groups of the universes instead of
+	// only receiving packets sent straight to the daemon.
+	Multicast bool `toml:"multicast"`
+	// ColorOrder is the order of the channels of each LED.
+	ColorOrder colorOrder `toml:"order"`
+	// Universe is the first universe. The LEDs, in the order of the LED
+	// points file, are packed into consecutive universes, 170 each, unless
+	// Ranges are given.
+	Universe int `toml:"universe"`
+	// Ranges maps ranges of the LEDs onto universes and channels. If given,
+	// every LED must be in exactly one range.
+	Ranges []dmxRange `toml:"range,omitempty"`
+	// Priority is the E1.31 priority of client sessions. DMX sources with a
+	// higher priority take over from client sessions. Sources with the same
+	// or a lower priority, which includes all Art-Net sources by default,
+	// only drive the LEDs while no session sends frames.
+	Priority int `toml:"priority"`
+	// Timeout is how long a source may go without sending before it is
+	// dropped, and how long sessions must be quiet for before lower
+	// priority sources take over.
+	Timeout time.Duration `toml:"timeout"`
+}
+
+func (cfg inputConfig) validate() error {
+	if cfg.Protocol == "" {
+		return nil
+	}
+
+	var errs []error
+	if cfg.ListenAddr != "" {
+		if _, err := dmxnet.ResolveAddr(cfg.ListenAddr, cfg.Protocol.Port()); err != nil {
+			errs = append(errs, fmt.Errorf("listen_addr: %w", err))
+		}
+	}
+	if cfg.Multicast && cfg.Protocol != dmxnet.E131 {
+		errs = append(errs, fmt.Errorf("multicast: only E1.31 can be multicast"))
+	}
+	if cfg.Priority < 0 || cfg.Priority > dmxnet.MaxPriority {
+		errs = append(errs, fmt.Errorf("priority: must be between 0 and %d, got %d", dmxnet.MaxPriority, cfg.Priority))
+	}
+	if cfg.Timeout <= 0 {
+		errs = append(errs, fmt.Errorf("timeout: must be positive, got %v", cfg.Timeout))
+	}
+	errs = append(errs, validateDMXRanges(cfg.Protocol, cfg.Universe, cfg.Ranges)...)
+
+	return errors.Join(errs...)
+}
+
+// universes returns the universes that the input maps onto LEDs, given the
+// number of LEDs.
+func (cfg inputConfig) universes(numLEDs int) []uint16 {
+	ranges, _ := dmxRanges(cfg.Ranges, cfg.Protocol, cfg.Universe, numLEDs)
+
+	var universes []uint16
+	for _, r := range ranges {
+		if !slices.Contains(universes, uint16(r.Universe)) {
+			universes = append(universes, uint16(r.Universe))
+		}
+	}
+	return universes
+}
+
+// dmxInput is an LEDController that lets DMX sources drive the LEDs, as if
+// they were another kind of session. Universes received from lighting
+// software are merged the way E1.31 does it and mapped onto the LEDs. While
+// DMX input drives the LEDs, frames from client sessions are held back, and
+// the last one is drawn once the DMX sources stop or time out.
+type dmxInput struct {
+	// takeover holds back session frames while DMX input drives the LEDs.
+	// Its mu also guards the fields below it.
+	takeover
+
+	cfg      inputConfig
+	receiver *dmxnet.Receiver
+	order    [3]int
+
+	merger      *dmxnet.Merger
+	ranges      []dmxRange
+	numLEDs     int // that ranges was made for
+	leds        leddraw.LEDStrip
+	buf         []byte
+	driving     bool
+	lastSession time.Time
+}
+
+var (
+	_ christmasd.LEDController        = (*dmxInput)(nil)
+	_ christmasd.SessionLEDController = (*dmxInput)(nil)
+)
+
+// dmxInputStatus is the status of the DMX input.
+type dmxInputStatus struct {
+	Protocol dmxnet.Protocol `json:"protocol"`
+	Addr     string          `json:"addr"`
+	// Driving is true if DMX sources are driving the LEDs instead of client
+	// sessions.
+	Driving bool            `json:"driving"`
+	Sources []dmxnet.Source `json:"sources"`
+}
+
+// newDMXInput starts listening for DMX universes. The input does nothing
+// until start is called.
+func newDMXInput(ctrl christmasd.LEDController, cfg inputConfig, logger *slog.Logger) (*dmxInput, error) {
+	order, err := cfg.ColorOrder.offsets()
+	if err != nil {
+		return nil, err
+	}
+
+	opts := dmxnet.ReceiverOpts{
+		Protocol: cfg.Protocol,
+		Addr:     cfg.ListenAddr,
+	}
+	if cfg.Multicast {
+		opts.Universes = cfg.universes(len(ctrl.LEDs()))
+	}
+
+	receiver, err := dmxnet.Listen(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for %s: %v", cfg.Protocol, err)
+	}
+
+	d := &dmxInput{
+		takeover: takeover{
+			ctrl:   ctrl,
+			logger: logger,
+		},
+		cfg:      cfg,
+		receiver: receiver,
+		order:    order,
+		merger:   dmxnet.NewMerger(cfg.Timeout),
+		numLEDs:  -1,
+	}
+	d.hold = d.holds
+	return d, nil
+}
+
+// start receives DMX universes until the context is canceled.
+func (d *dmxInput) start(ctx context.Context) error {
+	d.logger.Info(
+		"receiving DMX input",
+		"protocol", d.cfg.Protocol,
+		"addr", d.receiver.Addr(),
+		"multicast", d.cfg.Multicast)
+
+	go func() {
+		ticker := time.NewTicker(max(d.cfg.Timeout/4, time.Millisecond))
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				d.expire(now)
+			}
+		}
+	}()
+
+	err := d.receiver.Serve(ctx, func(packet dmxnet.Packet) {
+		d.handle(packet, time.Now())
+	}, func(err error) {
+		d.logger.Debug(
+			"ignoring invalid DMX packet",
+			"error", err)
+	})
+	if err != nil && ctx.Err() == nil {
+		return fmt.Errorf("failed to receive DMX input: %v", err)
+	}
+	return nil
+}
+
+func (d *dmxInput) close() error {
+	return d.receiver.Close()
+}
+
+// status returns the status of the input and its sources.
+func (d *dmxInput) status() dmxInputStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return dmxInputStatus{
+		Protocol: d.cfg.Protocol,
+		Addr:     d.receiver.Addr().String(),
+		Driving:  d.driving,
+		Sources:  d.merger.Sources(),
+	}
+}
+
+func (d *dmxInput) handle(packet dmxnet.Packet, now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.merger.Add(packet, now) {
+		return
+	}
+
+	if packet.Terminated {
+		d.logger.Info(
+			"DMX source stopped sending",
+			"source", sourceName(packet.Source, packet.Name),
+			"universe", packet.Universe)
+	}
+
+	d.update(now)
+}
+
+func (d *dmxInput) expire(now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	expired := d.merger.Expire(now)
+	for _, src := range expired {
+		d.logger.Info(
+			"DMX source timed out",
+			"source", sourceName(src.ID, src.Name),
+			"universe", src.Universe)
+	}
+
+	if len(expired) > 0 {
+		d.update(now)
+	}
+}
+
+// update merges the universes into a frame and draws it if DMX input should
+// drive the LEDs. It must be called with mu held.
+func (d *dmxInput) update(now time.Time) {
+	if n := len(d.ctrl.LEDs()); n != d.numLEDs {
+		d.numLEDs = n
+		d.leds = make(leddraw.LEDStrip, n)
+
+		var err error
+		d.ranges, err = dmxRanges(d.cfg.Ranges, d.cfg.Protocol, d.cfg.Universe, n)
+		if err != nil {
+			d.logger.Error(
+				"DMX input ranges do not match the LEDs, ignoring DMX input",
+				"leds", n,
+				"error", err)
+		}
+	}
+
+	var live bool
+	var priority uint8
+
+	clear(d.leds)
+	for _, r := range d.ranges {
+		data, p, ok := d.merger.Merge(uint16(r.Universe), now, d.buf)
+		d.buf = data
+		if !ok {
+			continue
+		}
+		live = true
+		priority = max(priority, p)
+
+		for i := 0; i < r.Count; i++ {
+			channel := r.Channel - 1 + 3*i
+			if channel+3 > len(data) {
+				break
+			}
+			d.leds[r.First+i] = xcolor.RGB{
+				R: data[channel+d.order[0]],
+				G: data[channel+d.order[1]],
+				B: data[channel+d.order[2]],
+			}
+		}
+	}
+
+	if !live {
+		d.handBack()
+		return
+	}
+
+	if !d.driving {
+		if int(priority) <= d.cfg.Priority && now.Sub(d.lastSession) < d.cfg.Timeout {
+			// A client session is still sending frames.
+			return
+		}
+
+		d.driving = true
+		d.logger.Info(
+			"DMX input is driving the LEDs, client sessions are suspended",
+			"priority", priority)
+	}
+
+	if err := d.ctrl.SetLEDs(d.leds); err != nil {
+		d.logger.Warn(
+			"failed to draw DMX input",
+			"error", err)
+	}
+}
+
+// handBack gives the LEDs back to client sessions, drawing the frame that was
+// held back if there is one. It must be called with mu held.
+func (d *dmxInput) handBack() {
+	if !d.driving {
+		return
+	}
+
+	d.driving = false
+	d.logger.Info(
+		"DMX input stopped, client sessions are resumed")
+
+	d.release()
+}
+
+// holds reports whether a session frame should be held back, and records
+// that a session sent a frame. It must be called with mu held.
+func (d *dmxInput) holds() bool {
+	now := time.Now()
+	d.lastSession = now
+
+	if !d.driving {
+		return false
+	}
+
+	// Sources that don't outrank sessions give the LEDs back as soon as a
+	// session sends a frame.
+	var priority uint8
+	for _, src := range d.merger.Sources() {
+		if now.Sub(src.LastSeen) <= d.cfg.Timeout {
+			priority = max(priority, src.Priority)
+		}
+	}
+	if int(priority) > d.cfg.Priority {
+		return true
+	}
+
+	d.driving = false
+	d.held = nil
+	d.logger.Info(
+		"a client session took over from DMX input")
+	return false
+}
+
+// sourceName returns a name for a DMX source to log.
+func sourceName(id, name string) string {
+	if name == "" {
+		return id
+	}
+	return name
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	"dev.acmcsuf.com/christmas/lib/leddraw"
+	"dev.acmcsuf.com/christmasd/christmasdtest"
+	"dev.acmcsuf.com/christmasd/dmxnet"
+	"libdb.so/ledctl"
+)
+
+func TestDMXInput(t *testing.T) {
+	ctrl := christmasdtest.NewLEDController(2, 2, 1)
+
+	input, err := newDMXInput(ctrl, inputConfig{
+		Protocol:   dmxnet.E131,
+		ListenAddr: "127.0.0.1:0",
+		ColorOrder: colorOrder(ledctl.GRBOrder),
+		Universe:   1,
+		Priority:   dmxnet.DefaultPriority,
+		Timeout:    time.Hour,
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal("cannot create DMX input:", err)
+	}
+	defer input.close()
+
+	send := func(source string, seq, priority uint8, data ...byte) {
+		input.handle(dmxnet.Packet{
+			Universe:   1,
+			Sequence:   seq,
+			Priority:   priority,
+			Source:     source,
+			Terminated: data == nil,
+			Data:       data,
+		}, time.Now())
+	}
+
+	session := leddraw.LEDStrip{{R: 1}, {R: 2}}
+	if err := input.SetLEDs(session); err != nil {
+		t.Fatal("cannot set LEDs:", err)
+	}
+
+	// A source with the same priority as sessions waits for them to go quiet.
+	send("low", 1, dmxnet.DefaultPriority, 1, 2, 3, 4, 5, 6)
+	if got := ctrl.LEDs(); !slices.Equal(got, session) {
+		t.Errorf("LEDs = %v, want the session's frame %v", got, session)
+	}
+
+	send("high", 1, 150, 10, 20, 30)
+	want := leddraw.LEDStrip{{R: 20, G: 10, B: 30}, {}}
+	if got := ctrl.LEDs(); !slices.Equal(got, want) {
+		t.Errorf("LEDs from a higher priority source = %v, want %v", got, want)
+	}
+	if !input.status().Driving {
+		t.Error("DMX input is not driving the LEDs")
+	}
+
+	held := leddraw.LEDStrip{{G: 1}, {G: 2}}
+	if err := input.SetLEDs(held); err != nil {
+		t.Fatal("cannot set LEDs:", err)
+	}
+	if got := ctrl.LEDs(); !slices.Equal(got, want) {
+		t.Errorf("session frame was drawn over DMX input, LEDs = %v", got)
+	}
+
+	// Once the high priority source stops, the session outranks the
+	// remaining source, and its held frame is drawn.
+	send("high", 2, 150)
+	send("low", 2, dmxnet.DefaultPriority)
+	if got := ctrl.LEDs(); !slices.Equal(got, held) {
+		t.Errorf("LEDs after DMX input stopped = %v, want the held frame %v", got, held)
+	}
+	if input.status().Driving {
+		t.Error("DMX input is still driving the LEDs")
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"dev.acmcsuf.com/christmasd"
+)
+
+const (
+	// frameStatsSamples is the number of recent frames that the latency and
+	// jitter are measured over.
+	frameStatsSamples = 256
+	// frameRateWindow is the window over which the actual frame rate is
+	// measured.
+	frameRateWindow = 5 * time.Second
+)
+
+// frameScheduler decides when queued frames are flushed. Frames are flushed
+// on a fixed cadence that is aligned to the last flush, and frames queued in
+// between are coalesced into the next flush. It also measures how long frames
+// wait to be flushed and how steady the cadence is.
+type frameScheduler struct {
+	// immediate flushes a frame right away if the last flush was more than
+	// a frame interval ago, instead of waiting for the next slot on the
+	// cadence.
+	immediate bool
+	onLatency func(time.Duration) // may be nil
+	queued    chan struct{}
+
+	mu        sync.Mutex
+	interval  time.Duration
+	pending   bool
+	queuedAt  time.Time
+	frames    uint64
+	coalesced uint64
+	samples   [frameStatsSamples]frameSample
+}
+
+type frameSample struct {
+	flushedAt time.Time
+	latency   time.Duration
+	jitter    time.Duration // -1 if the frame didn't follow another one
+}
+
+func newFrameScheduler(frameRate int, immediate bool, onLatency func(time.Duration)) *frameScheduler {
+	return &frameScheduler{
+		immediate: immediate,
+		onLatency: onLatency,
+		queued:    make(chan struct{}, 1),
+		interval:  time.Second / time.Duration(frameRate),
+	}
+}
+
+// setFrameRate changes the frame rate. The next frame is already flushed on
+// the new cadence.
+func (s *frameScheduler) setFrameRate(frameRate int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.interval = time.Second / time.Duration(frameRate)
+}
+
+// queue queues a frame to be flushed.
+func (s *frameScheduler) queue() {
+	s.mu.Lock()
+	if s.pending {
+		s.coalesced++
+	} else {
+		s.pending = true
+		s.queuedAt = time.Now()
+	}
+	s.mu.Unlock()
+
+	select {
+	case s.queued <- struct{}{}:
+	default:
+	}
+}
+
+// run calls flush for queued frames until the context is canceled.
+func (s *frameScheduler) run(ctx context.Context, flush func()) {
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+
+	var last time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.queued:
+		}
+
+		if wait := s.delay(time.Now(), last); wait > 0 {
+			timer.Reset(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+
+		queuedAt, ok := s.take()
+		if !ok {
+			// The frame was already flushed along with an earlier one.
+			continue
+		}
+
+		start := time.Now()
+		flush()
+		latency := time.Since(queuedAt)
+
+		s.record(last, start, latency)
+		if s.onLatency != nil {
+			s.onLatency(latency)
+		}
+
+		last = start
+	}
+}
+
+// delay returns how long to wait before flushing the next frame.
+func (s *frameScheduler) delay(now, last time.Time) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if last.IsZero() {
+		return 0
+	}
+
+	next := last.Add(s.interval)
+	if !now.Before(next) {
+		if s.immediate {
+			return 0
+		}
+		// Skip ahead to the next slot on the cadence.
+		slots := now.Sub(last)/s.interval + 1
+		next = last.Add(slots * s.interval)
+	}
+
+	return next.Sub(now)
+}
+
+// take marks the pending frame as flushed and returns when it was queued.
+// Frames queued from now on go into the next flush.
+func (s *frameScheduler) take() (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.pending {
+		return time.Time{}, false
+	}
+
+	s.pending = false
+	return s.queuedAt, true
+}
+
+func (s *frameScheduler) record(last, flushedAt time.Time, latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jitter := time.Duration(-1)
+	if !last.IsZero() {
+		// Only count frames that directly followed another one, since the
+		// time after a pause isn't jitter.
+		if since := flushedAt.Sub(last); since < 2*s.interval {
+			jitter = since - s.interval
+			if jitter < 0 {
+				jitter = -jitter
+			}
+		}
+	}
+
+	s.samples[s.frames%frameStatsSamples] = frameSample{
+		flushedAt: flushedAt,
+		latency:   latency,
+		jitter:    jitter,
+	}
+	s.frames++
+}
+
+// stats returns the statistics of the recent frames.
+func (s *frameScheduler) stats() christmasd.FrameStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := christmasd.FrameStats{
+		TargetFrameRate: float64(time.Second) / float64(s.interval),
+		Frames:          s.frames,
+		Coalesced:       s.coalesced,
+	}
+
+	n := int(min(s.frames, frameStatsSamples))
+	if n == 0 {
+		return stats
+	}
+
+	now := time.Now()
+	window := frameRateWindow
+	var inWindow int
+	var latencySum, jitterSum time.Duration
+	var jitters int
+
+	for _, sample := range s.samples[:n] {
+		latencySum += sample.latency
+		stats.LatencyMax = max(stats.LatencyMax, sample.latency)
+
+		if sample.jitter >= 0 {
+			jitterSum += sample.jitter
+			jitters++
+			stats.JitterMax = max(stats.JitterMax, sample.jitter)
+		}
+
+		if now.Sub(sample.flushedAt) < frameRateWindow {
+			inWindow++
+		}
+	}
+
+	// At high frame rates, the samples don't go back far enough to cover the
+	// whole window.
+	if n == frameStatsSamples {
+		oldest := s.samples[s.frames%frameStatsSamples].flushedAt
+		window = min(window, now.Sub(oldest))
+	}
+
+	stats.FrameRate = float64(inWindow) / window.Seconds()
+	stats.LatencyMean = latencySum / time.Duration(n)
+	if jitters > 0 {
+		stats.JitterMean = jitterSum / time.Duration(jitters)
+	}
+
+	return stats
+}
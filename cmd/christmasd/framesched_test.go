@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestFrameSchedulerDelay(t *testing.T) {
+	last := time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC)
+	interval := 50 * time.Millisecond
+
+	tests := []struct {
+		name      string
+		immediate bool
+		since     time.Duration
+		want      time.Duration
+	}{
+		{"first frame", false, -1, 0},
+		{"before next slot", false, 20 * time.Millisecond, 30 * time.Millisecond},
+		{"on next slot", false, 50 * time.Millisecond, 50 * time.Millisecond},
+		{"late", false, 70 * time.Millisecond, 30 * time.Millisecond},
+		{"late immediate", true, 70 * time.Millisecond, 0},
+		{"before next slot immediate", true, 20 * time.Millisecond, 30 * time.Millisecond},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newFrameScheduler(20, test.immediate, nil)
+
+			now, last := last.Add(test.since), last
+			if test.since < 0 {
+				last = time.Time{}
+			}
+
+			if got := s.delay(now, last); got != test.want {
+				t.Errorf("delay = %v, want %v (interval %v)", got, test.want, interval)
+			}
+		})
+	}
+}
+
+func TestFrameSchedulerSetFrameRate(t *testing.T) {
+	last := time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC)
+
+	s := newFrameScheduler(20, false, nil)
+	if got := s.delay(last.Add(10*time.Millisecond), last); got != 40*time.Millisecond {
+		t.Errorf("delay at 20 fps = %v, want 40ms", got)
+	}
+
+	s.setFrameRate(50)
+	if got := s.delay(last.Add(10*time.Millisecond), last); got != 10*time.Millisecond {
+		t.Errorf("delay at 50 fps = %v, want 10ms", got)
+	}
+	if got := s.stats().TargetFrameRate; got != 50 {
+		t.Errorf("target frame rate = %v, want 50", got)
+	}
+}
+
+func TestFrameSchedulerCoalesce(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	s := newFrameScheduler(20, true, nil)
+
+	flushed := make(chan struct{}, 10)
+	go s.run(ctx, func() {
+		flushed <- struct{}{}
+	})
+
+	s.queue()
+	<-flushed
+
+	// These all land within one frame interval of the first flush, so they
+	// are flushed together.
+	for i := 0; i < 5; i++ {
+		s.queue()
+	}
+
+	select {
+	case <-flushed:
+	case <-ctx.Done():
+		t.Fatal("second frame was never flushed")
+	}
+
+	stats := s.stats()
+	if stats.Frames != 2 {
+		t.Errorf("frames = %d, want 2", stats.Frames)
+	}
+	if stats.Coalesced != 4 {
+		t.Errorf("coalesced = %d, want 4", stats.Coalesced)
+	}
+	if stats.TargetFrameRate != 20 {
+		t.Errorf("target frame rate = %v, want 20", stats.TargetFrameRate)
+	}
+}
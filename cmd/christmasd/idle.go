@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"log/slog"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"dev.acmcsuf.com/christmas/lib/leddraw"
+	"dev.acmcsuf.com/christmas/lib/xcolor"
+	"dev.acmcsuf.com/christmasd"
+)
+
+// idlePattern draws a single frame of an idle animation onto leds. t is the
+// time since the animation started.
+type idlePattern func(leds leddraw.LEDStrip, t time.Duration)
+
+// idlePatterns maps pattern names to idle patterns.
+var idlePatterns = map[string]idlePattern{
+	"off":        drawOff,
+	"rainbow":    drawRainbow,
+	"twinkle":    drawTwinkle,
+	"warm-white": drawWarmWhite,
+}
+
+// idlePatternName is the name of an idle pattern. It is validated when it is
+// decoded.
+type idlePatternName string
+
+func (n *idlePatternName) UnmarshalText(text []byte) error {
+	name := strings.ToLower(string(text))
+	if _, ok := idlePatterns[name]; !ok {
+		names := make([]string, 0, len(idlePatterns))
+		for name := range idlePatterns {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown idle pattern %q, expected one of %s", text, strings.Join(names, ", "))
+	}
+	*n = idlePatternName(name)
+	return nil
+}
+
+// warmWhite is the color of an incandescent bulb.
+var warmWhite = xcolor.RGB{R: 255, G: 147, B: 41}
+
+func drawOff(leds leddraw.LEDStrip, t time.Duration) {
+	clear(leds)
+}
+
+func drawWarmWhite(leds leddraw.LEDStrip, t time.Duration) {
+	for i := range leds {
+		leds[i] = warmWhite
+	}
+}
+
+// rainbowPeriod is the time it takes the rainbow to go around once.
+const rainbowPeriod = 20 * time.Second
+
+func drawRainbow(leds leddraw.LEDStrip, t time.Duration) {
+	offset := float64(t%rainbowPeriod) / float64(rainbowPeriod)
+	for i := range leds {
+		hue := math.Mod(float64(i)/float64(len(leds))+offset, 1)
+		leds[i] = hsvToRGB(hue, 1, 0.6)
+	}
+}
+
+func drawTwinkle(leds leddraw.LEDStrip, t time.Duration) {
+	// Seed the same way every frame so that each LED keeps its own phase and
+	// speed.
+	rng := rand.New(rand.NewSource(1))
+	secs := t.Seconds()
+
+	for i := range leds {
+		phase := rng.Float64() * 2 * math.Pi
+		speed := 0.3 + rng.Float64()*0.7
+
+		// Raising the sine to a high power makes short, sparse flashes.
+		sparkle := math.Pow(math.Max(0, math.Sin(secs*speed+phase)), 16)
+		v := 0.25 + 0.75*sparkle
+
+		leds[i] = xcolor.RGB{
+			R: uint8(float64(warmWhite.R) * v),
+			G: uint8(float64(warmWhite.G) * v),
+			B: uint8(float64(warmWhite.B) * v),
+		}
+	}
+}
+
+// hsvToRGB converts a color from HSV to RGB. All components are in [0, 1].
+func hsvToRGB(h, s, v float64) xcolor.RGB {
+	h6 := h * 6
+	c := v * s
+	x := c * (1 - math.Abs(math.Mod(h6, 2)-1))
+	m := v - c
+
+	var r, g, b float64
+	switch int(h6) % 6 {
+	case 0:
+		r, g, b = c, x, 0
+	case 1:
+		r, g, b = x, c, 0
+	case 2:
+		r, g, b = 0, c, x
+	case 3:
+		r, g, b = 0, x, c
+	case 4:
+		r, g, b = x, 0, c
+	case 5:
+		r, g, b = c, 0, x
+	}
+
+	return xcolor.RGB{
+		R: uint8(math.Round((r + m) * 255)),
+		G: uint8(math.Round((g + m) * 255)),
+		B: uint8(math.Round((b + m) * 255)),
+	}
+}
+
+// idleAnimator is an LEDController that plays an idle animation on the
+// controller that it wraps once no frames have been sent to it for a while.
+// It hands control back as soon as a frame is sent.
+type idleAnimator struct {
+	ctrl      christmasd.LEDController
+	logger    *slog.Logger
+	frameRate chan int
+
+	// mu is held for writing while an idle frame is drawn and for reading
+	// while any other frame is, so that an idle frame never lands after a
+	// client frame, but sessions don't hold each other up.
+	mu        sync.RWMutex
+	cfg       idleConfig
+	idleSince time.Time // only used by start
+
+	lastFrame atomic.Int64 // in Unix nanoseconds
+	idle      atomic.Bool
+}
+
+var (
+	_ christmasd.LEDController        = (*idleAnimator)(nil)
+	_ christmasd.SessionLEDController = (*idleAnimator)(nil)
+)
+
+func newIdleAnimator(ctrl christmasd.LEDController, cfg idleConfig, logger *slog.Logger) *idleAnimator {
+	a := &idleAnimator{
+		ctrl:      ctrl,
+		logger:    logger,
+		frameRate: make(chan int, 1),
+		cfg:       cfg,
+	}
+	a.lastFrame.Store(time.Now().UnixNano())
+	return a
+}
+
+// setConfig changes the idle configuration. A running animation switches to
+// the new pattern right away.
+func (a *idleAnimator) setConfig(cfg idleConfig) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.cfg = cfg
+}
+
+// resume starts the idle animation right away instead of after the timeout,
+// e.g. because it was playing before a restart.
+func (a *idleAnimator) resume() {
+	a.lastFrame.Store(0)
+}
+
+// idling returns whether the idle animation is playing.
+func (a *idleAnimator) idling() bool {
+	return a.idle.Load()
+}
+
+// setFrameRate changes the frame rate of the idle animation.
+func (a *idleAnimator) setFrameRate(frameRate int) {
+	// Replace a frame rate that start hasn't picked up yet.
+	select {
+	case <-a.frameRate:
+	default:
+	}
+	a.frameRate <- frameRate
+}
+
+// start plays the idle animation whenever the controller has been idle for
+// long enough, until the context is canceled.
+func (a *idleAnimator) start(ctx context.Context, frameRate int) {
+	ticker := time.NewTicker(time.Second / time.Duration(frameRate))
+	defer ticker.Stop()
+
+	var leds leddraw.LEDStrip
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case frameRate := <-a.frameRate:
+			ticker.Reset(time.Second / time.Duration(frameRate))
+		case now := <-ticker.C:
+			a.mu.Lock()
+			leds = a.drawIdle(now, leds)
+			a.mu.Unlock()
+		}
+	}
+}
+
+// drawIdle draws a frame of the idle animation if the controller has been idle
+// for long enough. It must be called with mu held for writing.
+func (a *idleAnimator) drawIdle(now time.Time, leds leddraw.LEDStrip) leddraw.LEDStrip {
+	lastFrame := time.Unix(0, a.lastFrame.Load())
+	if a.cfg.Timeout <= 0 || now.Sub(lastFrame) < a.cfg.Timeout {
+		return leds
+	}
+
+	if !a.idle.Load() {
+		a.idle.Store(true)
+		a.idleSince = now
+		a.logger.Info(
+			"no frames received, starting idle animation",
+			"pattern", a.cfg.Pattern)
+	}
+
+	if n := len(a.ctrl.LEDs()); len(leds) != n {
+		leds = make(leddraw.LEDStrip, n)
+	}
+
+	idlePatterns[string(a.cfg.Pattern)](leds, now.Sub(a.idleSince))
+
+	if err := a.ctrl.SetLEDs(leds); err != nil {
+		a.logger.Warn(
+			"failed to draw idle animation",
+			"error", err)
+	}
+
+	return leds
+}
+
+// wake records that a frame was sent and stops the idle animation. It must be
+// called with mu held for reading.
+func (a *idleAnimator) wake() {
+	a.lastFrame.Store(time.Now().UnixNano())
+	if a.idle.CompareAndSwap(true, false) {
+		a.logger.Info(
+			"received a frame, stopping idle animation")
+	}
+}
+
+func (a *idleAnimator) LEDs() leddraw.LEDStrip {
+	return a.ctrl.LEDs()
+}
+
+func (a *idleAnimator) SetLEDs(strip leddraw.LEDStrip) error {
+	return a.setLEDs(a.ctrl, strip)
+}
+
+func (a *idleAnimator) ImageSize() (w, h int) {
+	return a.ctrl.ImageSize()
+}
+
+func (a *idleAnimator) DrawImage(img *image.RGBA) error {
+	return a.drawImage(a.ctrl, img)
+}
+
+func (a *idleAnimator) setLEDs(ctrl christmasd.LEDController, strip leddraw.LEDStrip) error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	a.wake()
+	return ctrl.SetLEDs(strip)
+}
+
+func (a *idleAnimator) drawImage(ctrl christmasd.LEDController, img *image.RGBA) error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	a.wake()
+	return ctrl.DrawImage(img)
+}
+
+// ForSession implements christmasd.SessionLEDController. Frames from the
+// session wake the animator up like any other frame.
+func (a *idleAnimator) ForSession(s *christmasd.Session) christmasd.LEDController {
+	return idleSessionController{
+		animator: a,
+		ctrl:     christmasd.ControllerForSession(a.ctrl, s),
+	}
+}
+
+type idleSessionController struct {
+	animator *idleAnimator
+	ctrl     christmasd.LEDController
+}
+
+func (c idleSessionController) LEDs() leddraw.LEDStrip {
+	return c.ctrl.LEDs()
+}
+
+func (c idleSessionController) SetLEDs(strip leddraw.LEDStrip) error {
+	return c.animator.setLEDs(c.ctrl, strip)
+}
+
+func (c idleSessionController) ImageSize() (w, h int) {
+	return c.ctrl.ImageSize()
+}
+
+func (c idleSessionController) DrawImage(img *image.RGBA) error {
+	return c.animator.drawImage(c.ctrl, img)
+}
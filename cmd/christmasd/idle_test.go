@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"image"
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	"dev.acmcsuf.com/christmas/lib/leddraw"
+	"dev.acmcsuf.com/christmasd"
+	"dev.acmcsuf.com/christmasd/christmasdtest"
+)
+
+func TestIdleAnimatorHandoff(t *testing.T) {
+	const timeout = 200 * time.Millisecond
+
+	ctrl := christmasdtest.NewLEDController(2, 2, 1)
+	a := newIdleAnimator(ctrl, idleConfig{Pattern: "warm-white", Timeout: timeout},
+		slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		a.start(ctx, 100)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	session := christmasd.ControllerForSession(a, christmasdtest.NewSession(t, christmasd.ServerOpts{LEDController: a}))
+	idleLEDs := leddraw.LEDStrip{warmWhite, warmWhite}
+
+	for i, frame := range []leddraw.LEDStrip{{{R: 1}, {R: 2}}, {{B: 1}, {B: 2}}} {
+		// The session takes over from the idle animation right away.
+		if err := session.SetLEDs(frame); err != nil {
+			t.Fatal("cannot set LEDs:", err)
+		}
+		if a.idling() {
+			t.Errorf("frame %d: still idling after a frame", i)
+		}
+
+		// No idle frame lands before the timeout.
+		time.Sleep(timeout / 4)
+		if got := ctrl.LEDs(); !slices.Equal(got, frame) {
+			t.Errorf("frame %d: LEDs = %v before the timeout, want the session's %v", i, got, frame)
+		}
+
+		// Then the idle animation takes over from the session.
+		waitLEDs(t, ctrl, idleLEDs)
+		if !a.idling() {
+			t.Errorf("frame %d: idle animation is playing but not reported", i)
+		}
+	}
+}
+
+func TestIdleAnimatorConcurrentSessions(t *testing.T) {
+	ctrl := &blockingDrawController{
+		LEDController: christmasdtest.NewLEDController(1, 1, 1),
+		drawing:       make(chan struct{}),
+		release:       make(chan struct{}),
+	}
+	a := newIdleAnimator(ctrl, idleConfig{Pattern: "off", Timeout: time.Hour},
+		slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	slow := christmasd.ControllerForSession(a, christmasdtest.NewSession(t, christmasd.ServerOpts{LEDController: a}))
+	fast := christmasd.ControllerForSession(a, christmasdtest.NewSession(t, christmasd.ServerOpts{LEDController: a}))
+
+	drawn := make(chan error, 1)
+	go func() {
+		drawn <- slow.DrawImage(image.NewRGBA(image.Rect(0, 0, 1, 1)))
+	}()
+	<-ctrl.drawing
+
+	// A session that is still drawing must not hold up the others.
+	set := make(chan error, 1)
+	go func() {
+		set <- fast.SetLEDs(leddraw.LEDStrip{{G: 1}})
+	}()
+
+	select {
+	case err := <-set:
+		if err != nil {
+			t.Error("cannot set LEDs:", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("a session was held up by another session's frame")
+	}
+
+	close(ctrl.release)
+	if err := <-drawn; err != nil {
+		t.Error("cannot draw image:", err)
+	}
+}
+
+func waitLEDs(t *testing.T, ctrl *christmasdtest.LEDController, want leddraw.LEDStrip) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !slices.Equal(ctrl.LEDs(), want) {
+		if time.Now().After(deadline) {
+			t.Fatalf("LEDs = %v, never became %v", ctrl.LEDs(), want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// blockingDrawController is an LEDController whose DrawImage blocks until
+// release is closed.
+type blockingDrawController struct {
+	*christmasdtest.LEDController
+	drawing chan struct{}
+	release chan struct{}
+}
+
+func (c *blockingDrawController) DrawImage(img *image.RGBA) error {
+	c.drawing <- struct{}{}
+	<-c.release
+	return c.LEDController.DrawImage(img)
+}
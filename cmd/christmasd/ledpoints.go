@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ledPoint is a single row in the LED points CSV file. The file has the
+// columns x, y and optionally strip, which is the index of the physical LED
+// strip that the LED belongs to. Rows without a strip column belong to the
+// first strip.
+type ledPoint struct {
+	image.Point
+	Strip int
+}
+
+// loadLEDPoints loads the LED points CSV file at the given path.
+func loadLEDPoints(path string) ([]ledPoint, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return readLEDPoints(f)
+}
+
+func readLEDPoints(r io.Reader) ([]ledPoint, error) {
+	csvr := csv.NewReader(r)
+	csvr.FieldsPerRecord = -1
+	csvr.TrimLeadingSpace = true
+
+	var points []ledPoint
+	for row := 1; ; row++ {
+		record, err := csvr.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+
+		if len(record) != 2 && len(record) != 3 {
+			return nil, fmt.Errorf("row %d: expected 2 or 3 columns, got %d", row, len(record))
+		}
+
+		point, err := parseLEDPoint(record)
+		if err != nil {
+			// Allow a header row.
+			if row == 1 && isHeader(record) {
+				continue
+			}
+			return nil, fmt.Errorf("row %d: %v", row, err)
+		}
+
+		points = append(points, point)
+	}
+
+	return points, nil
+}
+
+func parseLEDPoint(record []string) (ledPoint, error) {
+	var point ledPoint
+	var err error
+
+	point.X, err = strconv.Atoi(record[0])
+	if err != nil {
+		return point, fmt.Errorf("invalid x: %v", err)
+	}
+
+	point.Y, err = strconv.Atoi(record[1])
+	if err != nil {
+		return point, fmt.Errorf("invalid y: %v", err)
+	}
+
+	if len(record) > 2 {
+		point.Strip, err = strconv.Atoi(record[2])
+		if err != nil {
+			return point, fmt.Errorf("invalid strip: %v", err)
+		}
+		if point.Strip < 0 {
+			return point, fmt.Errorf("invalid strip: %d is negative", point.Strip)
+		}
+	}
+
+	return point, nil
+}
+
+func isHeader(record []string) bool {
+	return strings.EqualFold(record[0], "x") && strings.EqualFold(record[1], "y")
+}
+
+// ledPointCoords returns the coordinates of the given LED points.
+func ledPointCoords(points []ledPoint) []image.Point {
+	coords := make([]image.Point, len(points))
+	for i, point := range points {
+		coords[i] = point.Point
+	}
+	return coords
+}
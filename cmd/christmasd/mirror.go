@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"log/slog"
+	"time"
+
+	"dev.acmcsuf.com/christmas/lib/leddraw"
+	"dev.acmcsuf.com/christmasd"
+)
+
+// mirrorRedialDelay is the minimum delay between attempts to connect to a
+// mirror.
+const mirrorRedialDelay = 5 * time.Second
+
+var errMirrorDisconnected = errors.New("mirror is disconnected")
+
+// mirrorController is an LEDController that mirrors frames onto a remote
+// christmasd server. It is meant to be used as a Tee sink, so it is not safe
+// for concurrent use. It reconnects to the server whenever the connection is
+// lost.
+type mirrorController struct {
+	ctx    context.Context
+	url    string
+	logger *slog.Logger
+
+	client   *christmasd.Client
+	lastDial time.Time
+}
+
+var _ christmasd.LEDController = (*mirrorController)(nil)
+
+func newMirrorController(ctx context.Context, url string, logger *slog.Logger) *mirrorController {
+	return &mirrorController{
+		ctx:    ctx,
+		url:    url,
+		logger: logger,
+	}
+}
+
+func (m *mirrorController) connect() error {
+	if m.client != nil {
+		if m.client.Err() == nil {
+			return nil
+		}
+
+		m.logger.Warn(
+			"lost connection to mirror",
+			"error", m.client.Err())
+
+		m.client = nil
+	}
+
+	if time.Since(m.lastDial) < mirrorRedialDelay {
+		return errMirrorDisconnected
+	}
+	m.lastDial = time.Now()
+
+	ctx, cancel := context.WithTimeout(m.ctx, mirrorRedialDelay)
+	defer cancel()
+
+	client, err := christmasd.Dial(ctx, m.url, christmasd.ClientOpts{
+		Logger: m.logger,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to connect to mirror: %w", err)
+	}
+
+	m.logger.Info(
+		"connected to mirror",
+		"leds", len(client.LEDs()))
+
+	m.client = client
+	return nil
+}
+
+// Close closes the connection to the mirror, if any.
+func (m *mirrorController) Close() error {
+	if m.client == nil {
+		return nil
+	}
+	return m.client.Close()
+}
+
+// LEDs returns the mirror's LEDs, or nil if the mirror cannot be connected
+// to. The Tee calls this before every frame to size the frame, so it also
+// takes care of connecting.
+func (m *mirrorController) LEDs() leddraw.LEDStrip {
+	if err := m.connect(); err != nil {
+		return nil
+	}
+	return m.client.LEDs()
+}
+
+func (m *mirrorController) SetLEDs(strip leddraw.LEDStrip) error {
+	if err := m.connect(); err != nil {
+		return err
+	}
+	return m.client.SetLEDs(strip)
+}
+
+func (m *mirrorController) ImageSize() (w, h int) {
+	if m.client == nil {
+		return 0, 0
+	}
+	return m.client.ImageSize()
+}
+
+func (m *mirrorController) DrawImage(img *image.RGBA) error {
+	if err := m.connect(); err != nil {
+		return err
+	}
+	return m.client.DrawImage(img)
+}
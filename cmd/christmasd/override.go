@@ -0,0 +1,455 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"log/slog"
+	"math"
+	"slices"
+	"time"
+
+	"dev.acmcsuf.com/christmas/lib/leddraw"
+	"dev.acmcsuf.com/christmas/lib/xcolor"
+	"dev.acmcsuf.com/christmasd"
+)
+
+const (
+	// overrideRedraw is how often a still override is drawn again, so that
+	// it keeps up with the canvas changing on a reload.
+	overrideRedraw = time.Second
+	// overrideMinDelay is the shortest delay between GIF frames. Shorter
+	// delays are treated as 100ms, like browsers do.
+	overrideMinDelay = 20 * time.Millisecond
+	// maxOverrideImageSize is the largest width or height of an uploaded
+	// image.
+	maxOverrideImageSize = 8192
+	// maxOverrideUpload is the largest image file that can be uploaded.
+	maxOverrideUpload = 32 << 20
+	// maxOverrideGIFFrames is the largest number of frames in an animated
+	// GIF.
+	maxOverrideGIFFrames = 1000
+	// maxOverrideGIFPixels is the largest number of pixels in all frames of
+	// an animated GIF together. All frames are kept in memory at one byte
+	// per pixel.
+	maxOverrideGIFPixels = 64 << 20
+)
+
+// imageFit is how an image is scaled into the canvas.
+type imageFit string
+
+const (
+	// fitContain scales the image to fit inside the canvas, keeping its
+	// aspect ratio. The rest of the canvas is black.
+	fitContain imageFit = "contain"
+	// fitCover scales the image to cover the canvas, keeping its aspect
+	// ratio. The parts that don't fit are cut off.
+	fitCover imageFit = "cover"
+	// fitStretch scales the image to the size of the canvas.
+	fitStretch imageFit = "stretch"
+)
+
+func parseImageFit(s string) (imageFit, error) {
+	switch fit := imageFit(s); fit {
+	case "":
+		return fitContain, nil
+	case fitContain, fitCover, fitStretch:
+		return fit, nil
+	default:
+		return "", fmt.Errorf("unknown fit %q, expected contain, cover or stretch", s)
+	}
+}
+
+// overrideSource draws the frames of an override.
+type overrideSource interface {
+	// next draws the next frame and returns how long it is shown for.
+	next(ctrl christmasd.LEDController) (time.Duration, error)
+}
+
+// colorOverride lights all LEDs in a single color.
+type colorOverride struct {
+	color xcolor.RGB
+	leds  leddraw.LEDStrip
+}
+
+func (o *colorOverride) next(ctrl christmasd.LEDController) (time.Duration, error) {
+	if n := len(ctrl.LEDs()); len(o.leds) != n {
+		o.leds = make(leddraw.LEDStrip, n)
+		for i := range o.leds {
+			o.leds[i] = o.color
+		}
+	}
+	return overrideRedraw, ctrl.SetLEDs(o.leds)
+}
+
+// imageOverride draws a still image.
+type imageOverride struct {
+	img    *image.RGBA
+	fit    imageFit
+	scaled *image.RGBA // img scaled to the last canvas size
+}
+
+func (o *imageOverride) next(ctrl christmasd.LEDController) (time.Duration, error) {
+	w, h := ctrl.ImageSize()
+	if o.scaled == nil || o.scaled.Rect.Dx() != w || o.scaled.Rect.Dy() != h {
+		o.scaled = scaleImage(o.img, w, h, o.fit)
+	}
+	return overrideRedraw, ctrl.DrawImage(o.scaled)
+}
+
+// gifOverride plays an animated GIF in a loop, at the GIF's own timing.
+type gifOverride struct {
+	gif    *gif.GIF
+	fit    imageFit
+	frame  int
+	canvas *image.RGBA // the GIF's frames drawn so far
+}
+
+func (o *gifOverride) next(ctrl christmasd.LEDController) (time.Duration, error) {
+	if o.frame == 0 || o.canvas == nil {
+		o.canvas = image.NewRGBA(image.Rect(0, 0, o.gif.Config.Width, o.gif.Config.Height))
+	}
+
+	frame := o.gif.Image[o.frame]
+	var disposal byte
+	if o.frame < len(o.gif.Disposal) {
+		disposal = o.gif.Disposal[o.frame]
+	}
+
+	var previous *image.RGBA
+	if disposal == gif.DisposalPrevious {
+		previous = cloneImage(o.canvas)
+	}
+
+	draw.Draw(o.canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+
+	w, h := ctrl.ImageSize()
+	err := ctrl.DrawImage(scaleImage(o.canvas, w, h, o.fit))
+
+	switch disposal {
+	case gif.DisposalBackground:
+		draw.Draw(o.canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+	case gif.DisposalPrevious:
+		o.canvas = previous
+	}
+
+	delay := 100 * time.Millisecond
+	if o.frame < len(o.gif.Delay) {
+		if d := time.Duration(o.gif.Delay[o.frame]) * 10 * time.Millisecond; d >= overrideMinDelay {
+			delay = d
+		}
+	}
+
+	o.frame = (o.frame + 1) % len(o.gif.Image)
+	return delay, err
+}
+
+// decodeOverrideImage decodes a PNG, JPEG or GIF image. A GIF with more than
+// one frame is animated.
+func decodeOverrideImage(data []byte, fit imageFit) (overrideSource, string, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode image: %v", err)
+	}
+	if config.Width > maxOverrideImageSize || config.Height > maxOverrideImageSize {
+		return nil, "", fmt.Errorf("image is %dx%d, larger than %dx%d",
+			config.Width, config.Height, maxOverrideImageSize, maxOverrideImageSize)
+	}
+
+	if format == "gif" {
+		// gif.DecodeAll keeps every frame in memory, so check how many there
+		// are before decoding them.
+		frames, pixels, err := countGIFFrames(data)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to decode GIF: %v", err)
+		}
+		if frames > maxOverrideGIFFrames {
+			return nil, "", fmt.Errorf("GIF has %d frames, more than %d", frames, maxOverrideGIFFrames)
+		}
+		if pixels > maxOverrideGIFPixels {
+			return nil, "", fmt.Errorf("GIF frames have %d pixels together, more than %d", pixels, maxOverrideGIFPixels)
+		}
+
+		g, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to decode GIF: %v", err)
+		}
+		if len(g.Image) > 1 {
+			return &gifOverride{gif: g, fit: fit}, "gif", nil
+		}
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode image: %v", err)
+	}
+
+	rgba := image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	draw.Draw(rgba, rgba.Rect, img, img.Bounds().Min, draw.Src)
+
+	return &imageOverride{img: rgba, fit: fit}, "image", nil
+}
+
+// countGIFFrames returns the number of frames in a GIF and the number of
+// pixels in all of them, without decoding them.
+func countGIFFrames(data []byte) (frames, pixels int, err error) {
+	errTruncated := errors.New("truncated GIF")
+
+	// The header and the logical screen descriptor, followed by the global
+	// color table if there is one.
+	if len(data) < 13 {
+		return 0, 0, errTruncated
+	}
+	i := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		i += 3 << (flags&0x07 + 1)
+	}
+
+	// skipSubBlocks skips data sub-blocks up to and including the block
+	// terminator.
+	skipSubBlocks := func() bool {
+		for i < len(data) {
+			n := int(data[i])
+			i += 1 + n
+			if n == 0 {
+				return true
+			}
+		}
+		return false
+	}
+
+	for i < len(data) {
+		switch data[i] {
+		case 0x21: // extension
+			i += 2
+			if !skipSubBlocks() {
+				return 0, 0, errTruncated
+			}
+		case 0x2C: // image descriptor
+			if i+10 > len(data) {
+				return 0, 0, errTruncated
+			}
+			w := int(binary.LittleEndian.Uint16(data[i+5:]))
+			h := int(binary.LittleEndian.Uint16(data[i+7:]))
+			flags := data[i+9]
+			i += 10
+			if flags&0x80 != 0 {
+				i += 3 << (flags&0x07 + 1)
+			}
+			i++ // the LZW minimum code size
+			if !skipSubBlocks() {
+				return 0, 0, errTruncated
+			}
+			frames++
+			pixels += w * h
+		case 0x3B: // trailer
+			return frames, pixels, nil
+		default:
+			return 0, 0, fmt.Errorf("unknown GIF block 0x%02x", data[i])
+		}
+	}
+
+	return frames, pixels, nil
+}
+
+// scaleImage scales src into a new opaque w by h image. Each pixel is the
+// average of the source pixels under it, which keeps large photos from
+// aliasing when they are scaled down onto a small canvas.
+func scaleImage(src *image.RGBA, w, h int, fit imageFit) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i := 3; i < len(dst.Pix); i += 4 {
+		dst.Pix[i] = 0xFF
+	}
+
+	sw, sh := float64(src.Rect.Dx()), float64(src.Rect.Dy())
+	if w == 0 || h == 0 || sw == 0 || sh == 0 {
+		return dst
+	}
+
+	// dr is where the image goes in dst, and sr is the part of src that is
+	// drawn there.
+	dr := [4]float64{0, 0, float64(w), float64(h)}
+	sr := [4]float64{0, 0, sw, sh}
+
+	switch fit {
+	case fitContain:
+		scale := min(float64(w)/sw, float64(h)/sh)
+		dw, dh := sw*scale, sh*scale
+		dr = [4]float64{(float64(w) - dw) / 2, (float64(h) - dh) / 2, 0, 0}
+		dr[2], dr[3] = dr[0]+dw, dr[1]+dh
+	case fitCover:
+		scale := max(float64(w)/sw, float64(h)/sh)
+		cw, ch := float64(w)/scale, float64(h)/scale
+		sr = [4]float64{(sw - cw) / 2, (sh - ch) / 2, 0, 0}
+		sr[2], sr[3] = sr[0]+cw, sr[1]+ch
+	}
+
+	xscale := (sr[2] - sr[0]) / (dr[2] - dr[0])
+	yscale := (sr[3] - sr[1]) / (dr[3] - dr[1])
+
+	for y := max(0, int(math.Round(dr[1]))); y < min(h, int(math.Round(dr[3]))); y++ {
+		sy0, sy1 := scaleSpan(sr[1]+(float64(y)-dr[1])*yscale, yscale, src.Rect.Dy())
+
+		for x := max(0, int(math.Round(dr[0]))); x < min(w, int(math.Round(dr[2]))); x++ {
+			sx0, sx1 := scaleSpan(sr[0]+(float64(x)-dr[0])*xscale, xscale, src.Rect.Dx())
+
+			var sum [3]int
+			for sy := sy0; sy < sy1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := sx0; sx < sx1; sx++ {
+					// Pixels are premultiplied, so transparent parts come
+					// out black.
+					sum[0] += int(row[sx*4+0])
+					sum[1] += int(row[sx*4+1])
+					sum[2] += int(row[sx*4+2])
+				}
+			}
+
+			n := (sy1 - sy0) * (sx1 - sx0)
+			i := dst.PixOffset(x, y)
+			dst.Pix[i+0] = uint8(sum[0] / n)
+			dst.Pix[i+1] = uint8(sum[1] / n)
+			dst.Pix[i+2] = uint8(sum[2] / n)
+		}
+	}
+
+	return dst
+}
+
+// scaleSpan returns the source pixels in [start, start+size), clamped to
+// [0, limit). It always returns at least one pixel.
+func scaleSpan(start, size float64, limit int) (int, int) {
+	i0 := min(max(int(math.Floor(start)), 0), limit-1)
+	i1 := min(max(int(math.Ceil(start+size)), i0+1), limit)
+	return i0, i1
+}
+
+func cloneImage(img *image.RGBA) *image.RGBA {
+	return &image.RGBA{
+		Pix:    slices.Clone(img.Pix),
+		Stride: img.Stride,
+		Rect:   img.Rect,
+	}
+}
+
+// override is an LEDController that lets an admin push a color or an image
+// straight onto the LEDs. While an override is shown, the LEDs are taken over
+// from the client sessions, the DMX input and the idle animation.
+type override struct {
+	takeover
+
+	// run is the last override that was started. It is guarded by mu, and
+	// only shown while a run is active.
+	run *overrideRun
+}
+
+var (
+	_ christmasd.LEDController        = (*override)(nil)
+	_ christmasd.SessionLEDController = (*override)(nil)
+)
+
+type overrideRun struct {
+	// Kind is color, image or gif.
+	Kind string `json:"kind"`
+	// Color is the hex color of a color override.
+	Color string `json:"color,omitempty"`
+	// Fit is how an image is scaled into the canvas.
+	Fit imageFit `json:"fit,omitempty"`
+	// Duration is how long the override is shown before it stops by itself.
+	// Zero means until it is stopped.
+	Duration time.Duration `json:"duration,omitempty"`
+	Started  time.Time     `json:"started"`
+}
+
+// overrideStatus is the status of the override.
+type overrideStatus struct {
+	Active bool `json:"active"`
+	*overrideRun
+}
+
+func newOverride(ctrl christmasd.LEDController, logger *slog.Logger) *override {
+	return &override{
+		takeover: takeover{
+			ctrl:   ctrl,
+			logger: logger,
+		},
+	}
+}
+
+// status returns the override that is currently shown, if any.
+func (o *override) status() overrideStatus {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if !o.active() {
+		return overrideStatus{}
+	}
+	run := *o.run
+	return overrideStatus{Active: true, overrideRun: &run}
+}
+
+// start starts showing the source, replacing any override that is already
+// shown. run describes the source for the status.
+func (o *override) start(src overrideSource, run overrideRun) (overrideStatus, error) {
+	var delay time.Duration
+	first := func() error {
+		// A source that cannot draw its first frame is never started.
+		var err error
+		delay, err = src.next(o.ctrl)
+		if err != nil {
+			return fmt.Errorf("failed to draw override: %v", err)
+		}
+
+		run.Started = time.Now()
+		o.run = &run
+		return nil
+	}
+
+	err := o.begin(run.Duration, first, func(ctx context.Context) {
+		o.loop(ctx, src, delay)
+	})
+	if err != nil {
+		return overrideStatus{}, err
+	}
+
+	o.logger.Info(
+		"starting admin override, client sessions are suspended",
+		"kind", run.Kind,
+		"duration", run.Duration)
+
+	status := run
+	return overrideStatus{Active: true, overrideRun: &status}, nil
+}
+
+// stop stops the override, if any, and waits for it to stop.
+func (o *override) stop() {
+	o.end()
+}
+
+func (o *override) loop(ctx context.Context, src overrideSource, delay time.Duration) {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		delay, err := src.next(o.ctrl)
+		if err != nil {
+			o.logger.Warn(
+				"failed to draw admin override",
+				"error", err)
+		}
+		timer.Reset(delay)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	"dev.acmcsuf.com/christmas/lib/leddraw"
+	"dev.acmcsuf.com/christmas/lib/xcolor"
+	"dev.acmcsuf.com/christmasd/christmasdtest"
+)
+
+func TestOverrideHoldsFrames(t *testing.T) {
+	ctrl := christmasdtest.NewLEDController(3, 3, 1)
+	o := newOverride(ctrl, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	before := leddraw.LEDStrip{{R: 1}, {R: 2}, {R: 3}}
+	if err := o.SetLEDs(before); err != nil {
+		t.Fatal("cannot set LEDs:", err)
+	}
+
+	orange := xcolor.RGB{R: 255, G: 136}
+	if _, err := o.start(&colorOverride{color: orange}, overrideRun{Kind: "color"}); err != nil {
+		t.Fatal("cannot start override:", err)
+	}
+	want := leddraw.LEDStrip{orange, orange, orange}
+	if got := ctrl.LEDs(); !slices.Equal(got, want) {
+		t.Errorf("LEDs during override = %v, want %v", got, want)
+	}
+
+	held := leddraw.LEDStrip{{G: 1}, {G: 2}, {G: 3}}
+	if err := o.SetLEDs(held); err != nil {
+		t.Fatal("cannot set LEDs:", err)
+	}
+	if got := ctrl.LEDs(); !slices.Equal(got, want) {
+		t.Errorf("frame was drawn during the override, LEDs = %v", got)
+	}
+
+	o.stop()
+	if status := o.status(); status.Active {
+		t.Error("override still active after stop")
+	}
+	if got := ctrl.LEDs(); !slices.Equal(got, held) {
+		t.Errorf("LEDs after the override = %v, want the held frame %v", got, held)
+	}
+}
+
+func TestScaleImage(t *testing.T) {
+	// A 4x2 image that is red on the left half and blue on the right.
+	src := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 4; x++ {
+			if x < 2 {
+				src.SetRGBA(x, y, color.RGBA{R: 255, A: 255})
+			} else {
+				src.SetRGBA(x, y, color.RGBA{B: 255, A: 255})
+			}
+		}
+	}
+
+	red := color.RGBA{R: 255, A: 255}
+	blue := color.RGBA{B: 255, A: 255}
+	black := color.RGBA{A: 255}
+
+	tests := []struct {
+		fit  imageFit
+		want [6]color.RGBA // a 2x3 image, row by row
+	}{
+		{fitContain, [6]color.RGBA{black, black, red, blue, black, black}},
+		{fitCover, [6]color.RGBA{red, blue, red, blue, red, blue}},
+		{fitStretch, [6]color.RGBA{red, blue, red, blue, red, blue}},
+	}
+
+	for _, test := range tests {
+		dst := scaleImage(src, 2, 3, test.fit)
+		var got [6]color.RGBA
+		for i := range got {
+			got[i] = dst.RGBAAt(i%2, i/2)
+		}
+		if got != test.want {
+			t.Errorf("%s: got %v, want %v", test.fit, got, test.want)
+		}
+	}
+}
+
+func TestDecodeOverrideGIF(t *testing.T) {
+	frame := func(c color.Color) *image.Paletted {
+		img := image.NewPaletted(image.Rect(0, 0, 2, 2), palette.Plan9)
+		for i := range img.Pix {
+			img.Pix[i] = uint8(img.Palette.Index(c))
+		}
+		return img
+	}
+
+	var buf bytes.Buffer
+	err := gif.EncodeAll(&buf, &gif.GIF{
+		Image: []*image.Paletted{frame(color.White), frame(color.Black)},
+		Delay: []int{5, 0},
+	})
+	if err != nil {
+		t.Fatal("cannot encode GIF:", err)
+	}
+
+	src, kind, err := decodeOverrideImage(buf.Bytes(), fitStretch)
+	if err != nil {
+		t.Fatal("cannot decode GIF:", err)
+	}
+	if kind != "gif" {
+		t.Fatalf("kind = %q, want gif", kind)
+	}
+
+	ctrl := christmasdtest.NewLEDController(1, 1, 1)
+	var got []color.RGBA
+	for i := 0; i < 3; i++ {
+		delay, err := src.next(ctrl)
+		if err != nil {
+			t.Fatal("cannot draw GIF frame:", err)
+		}
+		if i == 0 && delay != 50*time.Millisecond {
+			t.Errorf("first frame delay = %v, want 50ms", delay)
+		}
+		calls := ctrl.Calls()
+		got = append(got, calls[len(calls)-1].Image.RGBAAt(0, 0))
+	}
+
+	white := color.RGBA{255, 255, 255, 255}
+	black := color.RGBA{A: 255}
+	if want := []color.RGBA{white, black, white}; !slices.Equal(got, want) {
+		t.Errorf("frames = %v, want %v", got, want)
+	}
+}
+
+func TestDecodeOverrideGIFLimits(t *testing.T) {
+	encode := func(frames, size int) []byte {
+		g := &gif.GIF{}
+		for i := 0; i < frames; i++ {
+			g.Image = append(g.Image, image.NewPaletted(image.Rect(0, 0, size, size), palette.Plan9))
+			g.Delay = append(g.Delay, 0)
+		}
+
+		var buf bytes.Buffer
+		if err := gif.EncodeAll(&buf, g); err != nil {
+			t.Fatal("cannot encode GIF:", err)
+		}
+		return buf.Bytes()
+	}
+
+	frames, pixels, err := countGIFFrames(encode(3, 4))
+	if err != nil {
+		t.Fatal("cannot count GIF frames:", err)
+	}
+	if frames != 3 || pixels != 3*4*4 {
+		t.Errorf("counted %d frames of %d pixels, want 3 frames of 48 pixels", frames, pixels)
+	}
+
+	if _, _, err := decodeOverrideImage(encode(maxOverrideGIFFrames+1, 1), fitStretch); err == nil {
+		t.Error("expected an error for too many frames")
+	}
+	if _, _, err := decodeOverrideImage(encode(5, 4096), fitStretch); err == nil {
+		t.Error("expected an error for too many pixels")
+	}
+	if _, _, err := decodeOverrideImage(encode(maxOverrideGIFFrames, 1), fitStretch); err != nil {
+		t.Error("cannot decode a GIF within the limits:", err)
+	}
+}
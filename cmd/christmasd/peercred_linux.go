@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net"
+	"syscall"
+)
+
+// unixPeerCred returns the credentials of the process on the other end of a
+// Unix socket connection.
+func unixPeerCred(conn *net.UnixConn) (peerCred, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return peerCred{}, err
+	}
+
+	var ucred *syscall.Ucred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		ucred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	}); err != nil {
+		return peerCred{}, err
+	}
+	if credErr != nil {
+		return peerCred{}, credErr
+	}
+
+	return peerCred{
+		PID: int(ucred.Pid),
+		UID: int(ucred.Uid),
+		GID: int(ucred.Gid),
+	}, nil
+}
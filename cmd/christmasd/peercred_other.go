@@ -0,0 +1,14 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"net"
+)
+
+// unixPeerCred returns the credentials of the process on the other end of a
+// Unix socket connection. It is only supported on Linux.
+func unixPeerCred(conn *net.UnixConn) (peerCred, error) {
+	return peerCred{}, errors.ErrUnsupported
+}
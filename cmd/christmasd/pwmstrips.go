@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"libdb.so/ledctl"
+	"libdb.so/ledctl/rpi"
+)
+
+// pwmChannelPins are the GPIO pins that each of the Pi's PWM channels can
+// drive.
+var pwmChannelPins = [rpi.RPI_PWM_CHANNELS][]int{
+	{12, 18, 40},
+	{13, 19, 41, 45},
+}
+
+// pwmChannel returns the PWM channel that drives the given GPIO pin, or false
+// if no PWM channel can drive it.
+func pwmChannel(pin int) (int, bool) {
+	for channel, pins := range pwmChannelPins {
+		for _, p := range pins {
+			if p == pin {
+				return channel, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// pwmStripConfig is the configuration of a WS281x strip on one of the PWM
+// channels.
+type pwmStripConfig struct {
+	GPIOPin    int
+	ColorOrder ledctl.ColorOrder
+	NumPixels  int
+}
+
+// pwmStrips drives the WS281x strips on both of the Pi's PWM channels.
+// ledctl.WS281x sends the same data on both channels, and the Pi only has a
+// single PWM block, so the strips share one DMA buffer instead. The PWM block
+// takes the words of both channels interleaved from it, which writes the
+// strips out at the same time.
+type pwmStrips struct {
+	rp     *rpi.RPi
+	dma    *rpi.DMABuf
+	words  []uint32
+	strips [rpi.RPI_PWM_CHANNELS]*pwmStrip // nil for unused channels
+	closed bool
+}
+
+// pwmStrip is the strip on one of the PWM channels of a pwmStrips.
+type pwmStrip struct {
+	out       *pwmStrips
+	channel   int
+	pixels    []byte // in the strip's color order
+	numColors int
+	r, g, b   int // offsets of the colors within a pixel
+}
+
+var (
+	_ RGBController = (*pwmStrip)(nil)
+	_ sharedStrip   = (*pwmStrip)(nil)
+)
+
+// newPWMStrips sets up the PWM block for the given strips, which must be on
+// different PWM channels. If channel 1 is used, then channel 0 must be used
+// too.
+func newPWMStrips(strips []pwmStripConfig, model ledctl.ColorModel, freq uint, dmaChannel int) (*pwmStrips, error) {
+	p := &pwmStrips{}
+
+	var pins [rpi.RPI_PWM_CHANNELS]int
+	var numPixels int
+	for _, cfg := range strips {
+		channel, ok := pwmChannel(cfg.GPIOPin)
+		if !ok {
+			return nil, fmt.Errorf("GPIO pin %d is not a PWM pin", cfg.GPIOPin)
+		}
+		if p.strips[channel] != nil {
+			return nil, fmt.Errorf("more than one strip on PWM channel %d", channel)
+		}
+
+		r, g, b := colorOffsets(cfg.ColorOrder)
+		p.strips[channel] = &pwmStrip{
+			out:       p,
+			channel:   channel,
+			pixels:    make([]byte, cfg.NumPixels*model.NumColors()),
+			numColors: model.NumColors(),
+			r:         r,
+			g:         g,
+			b:         b,
+		}
+		pins[channel] = cfg.GPIOPin
+		numPixels = max(numPixels, cfg.NumPixels)
+	}
+
+	if p.strips[0] == nil {
+		return nil, fmt.Errorf("a strip on PWM channel 1 needs one on PWM channel 0 too")
+	}
+	usedPins := pins[:1]
+	if p.strips[1] != nil {
+		usedPins = pins[:2]
+	}
+
+	rp, err := rpi.NewRPi()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't init RPi: %v", err)
+	}
+	p.rp = rp
+
+	bytes := pwmBufferSize(numPixels, model.NumColors(), freq)
+	p.dma, err = rp.GetDMABuf(bytes)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get DMA buffer: %v", err)
+	}
+
+	// Unused channels and the tail of the shorter strip stay low, which the
+	// LEDs take as a reset.
+	p.words = p.dma.Uint32Slice()
+	clear(p.words)
+
+	if err := rp.InitDMA(dmaChannel); err != nil {
+		rp.FreeDMABuf(p.dma)
+		return nil, fmt.Errorf("couldn't init registers: %v", err)
+	}
+
+	if err := rp.InitGPIO(); err != nil {
+		rp.FreeDMABuf(p.dma)
+		return nil, fmt.Errorf("couldn't init GPIO: %v", err)
+	}
+
+	if err := rp.InitPWM(freq, p.dma, bytes, usedPins); err != nil {
+		rp.FreeDMABuf(p.dma)
+		return nil, fmt.Errorf("couldn't init PWM: %v", err)
+	}
+
+	return p, nil
+}
+
+// strip returns the strip on the given PWM channel.
+func (p *pwmStrips) strip(channel int) *pwmStrip {
+	return p.strips[channel]
+}
+
+// Flush writes out the strips on both channels in a single DMA transfer.
+func (p *pwmStrips) Flush() error {
+	// The buffer is in use until the previous transfer is done.
+	if err := p.rp.WaitForDMAEnd(); err != nil {
+		return fmt.Errorf("pre-DMA wait failed: %v", err)
+	}
+
+	for _, strip := range p.strips {
+		if strip != nil {
+			encodePWMChannel(p.words, strip.channel, strip.pixels)
+		}
+	}
+
+	p.rp.StartDMA(p.dma)
+	return nil
+}
+
+// Close stops the PWM and frees the DMA buffer. It may be called more than
+// once.
+func (p *pwmStrips) Close() error {
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+
+	p.rp.StopPWM()
+
+	if err := p.rp.FreeDMABuf(p.dma); err != nil {
+		return fmt.Errorf("couldn't free DMA buffer: %v", err)
+	}
+
+	return nil
+}
+
+func (s *pwmStrip) SetRGBAt(i int, color ledctl.RGB) {
+	o := i * s.numColors
+	s.pixels[o+s.r] = color.R
+	s.pixels[o+s.g] = color.G
+	s.pixels[o+s.b] = color.B
+}
+
+// Flush writes out the strips on all PWM channels, not just this one.
+func (s *pwmStrip) Flush() error {
+	return s.out.Flush()
+}
+
+func (s *pwmStrip) output() stripOutput {
+	return s.out
+}
+
+// colorOffsets returns the offsets of red, green and blue within a pixel in
+// the given color order.
+func colorOffsets(order ledctl.ColorOrder) (r, g, b int) {
+	for name, o := range ledctl.StringToOrder {
+		if o == order {
+			return strings.IndexByte(name, 'R'), strings.IndexByte(name, 'G'), strings.IndexByte(name, 'B')
+		}
+	}
+	panic(fmt.Sprintf("unknown color order %d", order))
+}
+
+// ws281xResetMicros is how long the data line is held low after a frame, so
+// that the LEDs latch it.
+const ws281xResetMicros = 55
+
+// pwmBufferSize returns the size in bytes of the DMA buffer for strips of up
+// to numPixels pixels on both PWM channels. It matches what ledctl.WS281x
+// uses for a single strip.
+func pwmBufferSize(numPixels, numColors int, freq uint) uint {
+	// Each bit is sent as three bits of PWM output, followed by the reset.
+	bits := uint(3 * 8 * numColors * numPixels)
+	bits += ws281xResetMicros * freq * 3 / 1000000
+
+	// Round up to whole words, with at least one word to spare.
+	bytes := bits / 8
+	bytes -= bytes % 4
+	bytes += 4
+
+	return bytes * rpi.RPI_PWM_CHANNELS
+}
+
+const (
+	pwmSymbolHigh = 0b110
+	pwmSymbolLow  = 0b100
+)
+
+// encodePWMChannel encodes pixels into the words of the given PWM channel.
+// The words of the channels are interleaved, most significant bit first.
+func encodePWMChannel(words []uint32, channel int, pixels []byte) {
+	pos := channel
+	bit := 31
+
+	for _, b := range pixels {
+		for k := 7; k >= 0; k-- {
+			symbol := pwmSymbolLow
+			if b&(1<<k) != 0 {
+				symbol = pwmSymbolHigh
+			}
+
+			for l := 2; l >= 0; l-- {
+				if symbol&(1<<l) != 0 {
+					words[pos] |= 1 << bit
+				} else {
+					words[pos] &^= 1 << bit
+				}
+
+				bit--
+				if bit < 0 {
+					pos += rpi.RPI_PWM_CHANNELS
+					bit = 31
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"slices"
+	"sync"
+
+	"dev.acmcsuf.com/christmasd"
+	"dev.acmcsuf.com/christmasd/christmasdmetrics"
+)
+
+// reloader reloads the configuration and the LED points file while the daemon
+// is running, without dropping any sessions.
+type reloader struct {
+	leds    *ledController
+	idle    *idleAnimator
+	sched   *scheduler
+	server  *christmasd.Server
+	tokens  *tokenStore
+	metrics *christmasdmetrics.Metrics
+	logger  *slog.Logger
+
+	mu  sync.Mutex
+	cfg config
+}
+
+func newReloader(cfg config, leds *ledController, idle *idleAnimator, sched *scheduler, server *christmasd.Server, tokens *tokenStore, metrics *christmasdmetrics.Metrics, logger *slog.Logger) *reloader {
+	return &reloader{
+		leds:    leds,
+		idle:    idle,
+		sched:   sched,
+		server:  server,
+		tokens:  tokens,
+		metrics: metrics,
+		logger:  logger,
+		cfg:     cfg,
+	}
+}
+
+// newLEDControlConfig creates the ledControlConfig for the given config and
+// LED points.
+func newLEDControlConfig(cfg config, points []ledPoint, logger *slog.Logger) ledControlConfig {
+	return ledControlConfig{
+		OpenController: func(points []ledPoint) (RGBController, error) {
+			strips, err := newHardwareStrips(points, cfg.Hardware)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create LED strips: %v", err)
+			}
+			return strips, nil
+		},
+		LEDPoints:      points,
+		FrameRate:      cfg.Canvas.FrameRate,
+		ImmediateFlush: cfg.Canvas.ImmediateFlush,
+		CanvasPPI:      cfg.Canvas.PPI,
+		Color:          cfg.Color,
+		Logger:         logger.With("component", "led-controller"),
+	}
+}
+
+// config returns the current configuration.
+func (r *reloader) config() config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.cfg
+}
+
+// reloadOnSignal reloads whenever one of the given signals is received, until
+// the context is canceled.
+func (r *reloader) reloadOnSignal(ctx context.Context, sigs ...os.Signal) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, sigs...)
+	defer signal.Stop(sigCh)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-sigCh:
+			r.logger.Info(
+				"reloading config",
+				"signal", sig)
+
+			if err := r.reload(); err != nil {
+				r.logger.Error(
+					"failed to reload config, keeping the old one",
+					"error", err)
+			}
+		}
+	}
+}
+
+// reload reads the configuration and the LED points file again and applies
+// them. Sessions are notified if the canvas changed. If anything fails, the
+// old configuration is kept.
+func (r *reloader) reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cfg, err := readConfig()
+	if err != nil {
+		return err
+	}
+
+	points, err := loadLEDPoints(cfg.Canvas.LEDPoints)
+	if err != nil {
+		return fmt.Errorf("failed to load LED points file %q: %v", cfg.Canvas.LEDPoints, err)
+	}
+
+	r.keepStatic(&cfg)
+
+	oldPoints := r.leds.ledPoints()
+	oldW, oldH := r.leds.ImageSize()
+
+	// Only reopen the strips if we have to, since that blanks the LEDs.
+	reopen := len(points) != len(oldPoints) ||
+		!slices.EqualFunc(points, oldPoints, func(a, b ledPoint) bool { return a.Strip == b.Strip }) ||
+		!reflect.DeepEqual(cfg.Hardware.Strips, r.cfg.Hardware.Strips) ||
+		cfg.Hardware.Frequency != r.cfg.Hardware.Frequency ||
+		cfg.Hardware.ColorModel != r.cfg.Hardware.ColorModel
+
+	// Keep the canvas PPI set through the admin API unless it changed in the
+	// config, like the token below.
+	ledConfig := newLEDControlConfig(cfg, points, r.logger)
+	if cfg.Canvas.PPI == r.cfg.Canvas.PPI {
+		_, ledConfig.CanvasPPI = r.leds.canvasSettings()
+	}
+
+	if err := r.leds.reconfigure(ledConfig, reopen); err != nil {
+		return fmt.Errorf("failed to reconfigure LEDs: %w", err)
+	}
+
+	if cfg.Canvas.FrameRate != r.cfg.Canvas.FrameRate {
+		r.setFrameRate(cfg.Canvas.FrameRate)
+	}
+
+	// Only replace the token if it changed in the config, so that a token set
+	// through the admin API survives unrelated reloads.
+	if cfg.Server.Token != r.cfg.Server.Token {
+		r.tokens.setDefault(cfg.Server.Token)
+	}
+
+	r.idle.setConfig(cfg.Idle)
+	if err := r.sched.setConfig(cfg.Schedule); err != nil {
+		// The config was validated already, so this shouldn't happen.
+		r.logger.Error(
+			"failed to update the schedule",
+			"error", err)
+	}
+	r.cfg = cfg
+
+	newW, newH := r.leds.ImageSize()
+	canvasChanged := len(points) != len(oldPoints) || newW != oldW || newH != oldH
+	if canvasChanged {
+		r.server.NotifyCanvasChanged()
+	}
+
+	r.logger.Info(
+		"reloaded config",
+		"leds", len(points),
+		"width", newW,
+		"height", newH,
+		"strips_reopened", reopen,
+		"canvas_changed", canvasChanged)
+
+	return nil
+}
+
+// setCanvas changes the frame rate and the canvas pixel density while the
+// daemon is running. Zero values keep the current settings. Sessions are
+// notified if the canvas changed. The settings are kept across reloads, unless
+// the config changes them too.
+func (r *reloader) setCanvas(frameRate int, ppi float64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	oldW, oldH := r.leds.ImageSize()
+
+	if ppi != 0 {
+		if err := r.leds.setCanvasPPI(ppi); err != nil {
+			return err
+		}
+	}
+	if frameRate != 0 {
+		r.setFrameRate(frameRate)
+	}
+
+	frameRate, ppi = r.leds.canvasSettings()
+	newW, newH := r.leds.ImageSize()
+	canvasChanged := newW != oldW || newH != oldH
+	if canvasChanged {
+		r.server.NotifyCanvasChanged()
+	}
+
+	r.logger.Info(
+		"changed canvas settings",
+		"fps", frameRate,
+		"ppi", ppi,
+		"width", newW,
+		"height", newH,
+		"canvas_changed", canvasChanged)
+
+	return nil
+}
+
+func (r *reloader) setFrameRate(frameRate int) {
+	r.leds.setFrameRate(frameRate)
+	r.idle.setFrameRate(frameRate)
+	r.metrics.SetFrameRate(frameRate)
+}
+
+// keepStatic reverts the fields of cfg that cannot be changed without a
+// restart, warning about the ones that were changed.
+func (r *reloader) keepStatic(cfg *config) {
+	keep := func(key string, changed bool, revert func()) {
+		if changed {
+			r.logger.Warn(
+				"config change requires a restart, ignoring",
+				"key", key)
+			revert()
+		}
+	}
+
+	keep("server.http_addr", cfg.Server.HTTPAddr != r.cfg.Server.HTTPAddr,
+		func() { cfg.Server.HTTPAddr = r.cfg.Server.HTTPAddr })
+	keep("server.admin_addr", cfg.Server.AdminAddr != r.cfg.Server.AdminAddr,
+		func() { cfg.Server.AdminAddr = r.cfg.Server.AdminAddr })
+	keep("server.mirrors", !slices.Equal(cfg.Server.Mirrors, r.cfg.Server.Mirrors),
+		func() { cfg.Server.Mirrors = r.cfg.Server.Mirrors })
+	keep("canvas.immediate_flush", cfg.Canvas.ImmediateFlush != r.cfg.Canvas.ImmediateFlush,
+		func() { cfg.Canvas.ImmediateFlush = r.cfg.Canvas.ImmediateFlush })
+	keep("input", !reflect.DeepEqual(cfg.Input, r.cfg.Input),
+		func() { cfg.Input = r.cfg.Input })
+	keep("admin.socket", cfg.Admin.Socket != r.cfg.Admin.Socket,
+		func() { cfg.Admin.Socket = r.cfg.Admin.Socket })
+	keep("admin.socket_mode", cfg.Admin.SocketMode != r.cfg.Admin.SocketMode,
+		func() { cfg.Admin.SocketMode = r.cfg.Admin.SocketMode })
+	keep("audit.path", cfg.Audit.Path != r.cfg.Audit.Path,
+		func() { cfg.Audit.Path = r.cfg.Audit.Path })
+	keep("state", cfg.State != r.cfg.State,
+		func() { cfg.State = r.cfg.State })
+}
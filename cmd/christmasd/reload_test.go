@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"dev.acmcsuf.com/christmas/lib/leddraw"
+	"dev.acmcsuf.com/christmasd"
+	"dev.acmcsuf.com/christmasd/christmasdmetrics"
+	"dev.acmcsuf.com/christmasd/christmasdtest"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestReloadPoints(t *testing.T) {
+	d := newTestDaemon(t, 3)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client, err := christmasd.Dial(ctx, christmasdtest.Serve(t, d.server), christmasd.ClientOpts{})
+	if err != nil {
+		t.Fatal("cannot dial:", err)
+	}
+	defer client.Close()
+
+	strips := d.rgbController()
+
+	// Changing the number of points rebuilds the canvas and the strips.
+	d.writePoints(t, 4)
+	if err := d.reload(); err != nil {
+		t.Fatal("cannot reload:", err)
+	}
+	if n := len(d.leds.LEDs()); n != 4 {
+		t.Errorf("reloaded %d LEDs, want 4", n)
+	}
+	if d.rgbController() == strips {
+		t.Error("strips were not reopened for the new points")
+	}
+
+	// Sessions are told about the new canvas instead of being kicked.
+	deadline := time.Now().Add(5 * time.Second)
+	for len(client.LEDs()) != 4 {
+		if time.Now().After(deadline) {
+			t.Fatalf("client still has %d LEDs after the reload", len(client.LEDs()))
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := client.SetLEDs(make(leddraw.LEDStrip, 4)); err != nil {
+		t.Error("cannot set LEDs after the reload:", err)
+	}
+	if n := len(d.server.Sessions()); n != 1 {
+		t.Errorf("%d sessions after the reload, want 1", n)
+	}
+
+	// Other changes don't reopen the strips, which would blank the LEDs.
+	strips = d.rgbController()
+	d.writeConfig(t, "[color]\nbrightness = 0.5\n", "")
+	if err := d.reload(); err != nil {
+		t.Fatal("cannot reload:", err)
+	}
+	if d.rgbController() != strips {
+		t.Error("strips were reopened for a color change")
+	}
+}
+
+func TestReloadKeepsAPISettings(t *testing.T) {
+	d := newTestDaemon(t, 3)
+
+	// Settings changed through the admin API survive unrelated reloads.
+	if err := d.setCanvas(0, 36); err != nil {
+		t.Fatal("cannot set canvas:", err)
+	}
+	d.tokens.setDefault("api-token")
+
+	d.writeConfig(t, "[color]\nbrightness = 0.5\n", "")
+	if err := d.reload(); err != nil {
+		t.Fatal("cannot reload:", err)
+	}
+	if _, ppi := d.leds.canvasSettings(); ppi != 36 {
+		t.Errorf("ppi = %v after reload, want the API's 36", ppi)
+	}
+	if _, err := d.tokens.check("api-token", scopeView); err != nil {
+		t.Errorf("API token was dropped by the reload: %v", err)
+	}
+
+	// Unless the config changes them too.
+	d.writeConfig(t, "[server]\ntoken = \"new-token\"\n", "ppi = 24\n")
+	if err := d.reload(); err != nil {
+		t.Fatal("cannot reload:", err)
+	}
+	if _, ppi := d.leds.canvasSettings(); ppi != 24 {
+		t.Errorf("ppi = %v after reload, want the config's 24", ppi)
+	}
+	if _, err := d.tokens.check("new-token", scopeView); err != nil {
+		t.Errorf("config token was not applied: %v", err)
+	}
+	if _, err := d.tokens.check("api-token", scopeView); err == nil {
+		t.Error("API token still works after the config changed the token")
+	}
+}
+
+func TestReloadStaticKeys(t *testing.T) {
+	d := newTestDaemon(t, 3)
+
+	d.writeConfig(t, "[server]\nhttp_addr = \"127.0.0.1:8001\"\n\n[idle]\ntimeout = \"5m\"\n", "")
+	if err := d.reload(); err != nil {
+		t.Fatal("cannot reload:", err)
+	}
+
+	cfg := d.config()
+	if cfg.Server.HTTPAddr != defaultConfig().Server.HTTPAddr {
+		t.Errorf("server.http_addr = %q, want it reverted", cfg.Server.HTTPAddr)
+	}
+	if cfg.Idle.Timeout != 5*time.Minute {
+		t.Errorf("idle.timeout = %v, want the reloaded 5m", cfg.Idle.Timeout)
+	}
+
+	logs := d.logs.String()
+	if !strings.Contains(logs, "config change requires a restart") || !strings.Contains(logs, "key=server.http_addr") {
+		t.Errorf("no warning about server.http_addr in the logs:\n%s", logs)
+	}
+}
+
+// testDaemon is a reloader for a daemon whose config and LED points are in
+// files, with the strips sending Art-Net to a local socket.
+type testDaemon struct {
+	*reloader
+	dir   string
+	strip string // config of the strip
+	logs  *syncBuffer
+}
+
+func newTestDaemon(t *testing.T, numPoints int) *testDaemon {
+	t.Helper()
+
+	sink, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("cannot listen for Art-Net:", err)
+	}
+	t.Cleanup(func() { sink.Close() })
+	go func() {
+		b := make([]byte, 1500)
+		for {
+			if _, _, err := sink.ReadFrom(b); err != nil {
+				return
+			}
+		}
+	}()
+
+	d := &testDaemon{
+		dir:   t.TempDir(),
+		strip: fmt.Sprintf("[[hardware.strip]]\ntype = \"artnet\"\naddress = %q\n", sink.LocalAddr()),
+		logs:  &syncBuffer{},
+	}
+
+	oldConfigPath := configPath
+	configPath = filepath.Join(d.dir, "christmasd.toml")
+	t.Cleanup(func() { configPath = oldConfigPath })
+
+	d.writePoints(t, numPoints)
+	d.writeConfig(t, "", "")
+
+	cfg, err := readConfig()
+	if err != nil {
+		t.Fatal("cannot read config:", err)
+	}
+	points, err := loadLEDPoints(cfg.Canvas.LEDPoints)
+	if err != nil {
+		t.Fatal("cannot load LED points:", err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(d.logs, nil))
+
+	leds, err := newLEDController(newLEDControlConfig(cfg, points, logger))
+	if err != nil {
+		t.Fatal("cannot create LED controller:", err)
+	}
+	t.Cleanup(func() { leds.close() })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		leds.start(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	server := christmasd.NewServer(christmasd.ServerOpts{
+		LEDController: leds,
+		Logger:        logger,
+	})
+	sched, err := newScheduler(cfg.Schedule, leds, server, logger)
+	if err != nil {
+		t.Fatal("cannot create scheduler:", err)
+	}
+
+	d.reloader = newReloader(cfg, leds,
+		newIdleAnimator(leds, cfg.Idle, logger),
+		sched,
+		server,
+		newTokenStore(cfg.Server.Token),
+		christmasdmetrics.New(prometheus.NewRegistry()),
+		logger)
+	return d
+}
+
+// writeConfig writes the config file with the given TOML, followed by the
+// canvas table with the LED points and any extra canvas keys, and the strip.
+func (d *testDaemon) writeConfig(t *testing.T, toml, canvas string) {
+	t.Helper()
+
+	toml += fmt.Sprintf("\n[canvas]\nled_points = %q\n", filepath.Join(d.dir, "points.csv"))
+	toml += canvas
+	toml += "\n" + d.strip
+
+	if err := os.WriteFile(configPath, []byte(toml), 0644); err != nil {
+		t.Fatal("cannot write config:", err)
+	}
+}
+
+// writePoints writes an LED points file of n points on a diagonal.
+func (d *testDaemon) writePoints(t *testing.T, n int) {
+	t.Helper()
+
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "%d,%d\n", i*10, i*20)
+	}
+	if err := os.WriteFile(filepath.Join(d.dir, "points.csv"), []byte(b.String()), 0644); err != nil {
+		t.Fatal("cannot write LED points:", err)
+	}
+}
+
+// rgbController returns the strips that the LED controller writes to.
+func (d *testDaemon) rgbController() RGBController {
+	d.leds.ctrlMu.Lock()
+	defer d.leds.ctrlMu.Unlock()
+	return d.leds.ctrl
+}
+
+// syncBuffer is a bytes.Buffer that is safe for concurrent use, for logs.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
@@ -0,0 +1,517 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"dev.acmcsuf.com/christmasd"
+)
+
+type scheduleConfig struct {
+	// TimeZone is the IANA time zone that the schedule is in. An empty time
+	// zone means the system's local time zone.
+	TimeZone string `toml:"timezone"`
+	// OffAction is what happens to sessions while the tree is off.
+	OffAction offAction `toml:"off_action"`
+	// On is the list of weekly windows during which the tree may be on. If
+	// there are none, the tree may always be on.
+	On []scheduleWindow `toml:"on"`
+	// Dim is the list of weekly windows during which the tree is dimmed.
+	Dim []dimWindow `toml:"dim"`
+	// Exceptions replace the weekly on windows for specific dates.
+	Exceptions []scheduleException `toml:"exception"`
+}
+
+// scheduleWindow is a weekly window of time. A window whose end is not after
+// its start wraps past midnight into the next day, so a window from 00:00 to
+// 00:00 is a whole day.
+type scheduleWindow struct {
+	// Days are the days of the week that the window starts on. No days means
+	// every day.
+	Days  []weekday `toml:"days"`
+	Start clockTime `toml:"start"`
+	End   clockTime `toml:"end"`
+}
+
+type dimWindow struct {
+	scheduleWindow
+	// Brightness scales the brightness of the LEDs during the window, from 0
+	// to 1.
+	Brightness float64 `toml:"brightness"`
+}
+
+// scheduleException overrides the weekly on windows for a single date.
+type scheduleException struct {
+	Date scheduleDate `toml:"date"`
+	// On is whether the tree may be on at all on that date.
+	On bool `toml:"on"`
+	// Start and End restrict the on time to a window within the date. If
+	// both are unset, the tree may be on all day.
+	Start clockTime `toml:"start"`
+	End   clockTime `toml:"end"`
+}
+
+func (cfg scheduleConfig) validate() error {
+	var errs []error
+
+	if _, err := cfg.location(); err != nil {
+		errs = append(errs, fmt.Errorf("timezone: %w", err))
+	}
+
+	for i, dim := range cfg.Dim {
+		if dim.Brightness < 0 || dim.Brightness > 1 {
+			errs = append(errs, fmt.Errorf("dim[%d].brightness: must be between 0 and 1, got %v", i, dim.Brightness))
+		}
+	}
+
+	dates := make(map[scheduleDate]int, len(cfg.Exceptions))
+	for i, ex := range cfg.Exceptions {
+		if ex.Date == "" {
+			errs = append(errs, fmt.Errorf("exception[%d].date: must not be empty", i))
+		}
+		if j, ok := dates[ex.Date]; ok {
+			errs = append(errs, fmt.Errorf("exception[%d].date: %s is already used by exception[%d]", i, ex.Date, j))
+		}
+		dates[ex.Date] = i
+
+		if (ex.Start != 0 || ex.End != 0) && ex.End.orMidnight() <= ex.Start {
+			errs = append(errs, fmt.Errorf("exception[%d]: end must be after start", i))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// location returns the time zone of the schedule.
+func (cfg scheduleConfig) location() (*time.Location, error) {
+	if cfg.TimeZone == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(cfg.TimeZone)
+}
+
+// offAction is what happens to sessions while the tree is off.
+type offAction string
+
+const (
+	// offReject kicks all sessions and rejects new ones.
+	offReject offAction = "reject"
+	// offBlank keeps sessions connected, but nothing is shown.
+	offBlank offAction = "blank"
+)
+
+func (a *offAction) UnmarshalText(text []byte) error {
+	switch action := offAction(strings.ToLower(string(text))); action {
+	case offReject, offBlank:
+		*a = action
+		return nil
+	default:
+		return fmt.Errorf("unknown off action %q, expected reject or blank", text)
+	}
+}
+
+// weekday is a time.Weekday that is encoded as its short name.
+type weekday time.Weekday
+
+func (d weekday) MarshalText() ([]byte, error) {
+	return []byte(strings.ToLower(time.Weekday(d).String()[:3])), nil
+}
+
+func (d *weekday) UnmarshalText(text []byte) error {
+	name := strings.ToLower(string(text))
+	for wd := time.Sunday; wd <= time.Saturday; wd++ {
+		full := strings.ToLower(wd.String())
+		if name == full || name == full[:3] {
+			*d = weekday(wd)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown day of the week %q", text)
+}
+
+// clockTime is a time of day in minutes since midnight. It is encoded as
+// HH:MM. 24:00 is allowed as the end of a day.
+type clockTime int
+
+const minutesPerDay = 24 * 60
+
+func (t clockTime) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("%02d:%02d", t/60, t%60)), nil
+}
+
+func (t *clockTime) UnmarshalText(text []byte) error {
+	h, m, ok := strings.Cut(string(text), ":")
+	if !ok {
+		return fmt.Errorf("invalid time %q, expected HH:MM", text)
+	}
+
+	hours, err1 := strconv.Atoi(h)
+	minutes, err2 := strconv.Atoi(m)
+	if err1 != nil || err2 != nil || hours < 0 || minutes < 0 || minutes > 59 || hours*60+minutes > minutesPerDay {
+		return fmt.Errorf("invalid time %q, expected HH:MM", text)
+	}
+
+	*t = clockTime(hours*60 + minutes)
+	return nil
+}
+
+// orMidnight returns t, or 24:00 if t is 00:00. It is used for ends of
+// windows.
+func (t clockTime) orMidnight() clockTime {
+	if t == 0 {
+		return minutesPerDay
+	}
+	return t
+}
+
+func clockTimeOf(t time.Time) clockTime {
+	return clockTime(t.Hour()*60 + t.Minute())
+}
+
+// scheduleDate is a date encoded as YYYY-MM-DD.
+type scheduleDate string
+
+const scheduleDateLayout = "2006-01-02"
+
+func (d *scheduleDate) UnmarshalText(text []byte) error {
+	date, err := time.Parse(scheduleDateLayout, string(text))
+	if err != nil {
+		return fmt.Errorf("invalid date %q, expected YYYY-MM-DD", text)
+	}
+	*d = scheduleDate(date.Format(scheduleDateLayout))
+	return nil
+}
+
+func (w scheduleWindow) hasDay(wd time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, day := range w.Days {
+		if time.Weekday(day) == wd {
+			return true
+		}
+	}
+	return false
+}
+
+// contains returns whether the local time t is within the window.
+func (w scheduleWindow) contains(t time.Time) bool {
+	now := clockTimeOf(t)
+	wd := t.Weekday()
+
+	if w.Start < w.End {
+		return w.hasDay(wd) && w.Start <= now && now < w.End
+	}
+
+	// The window wraps past midnight, so it might have started yesterday.
+	yesterday := (wd + 6) % 7
+	return (w.hasDay(wd) && now >= w.Start) || (w.hasDay(yesterday) && now < w.End)
+}
+
+// scheduleState is the state of the schedule at some point in time.
+type scheduleState struct {
+	// On is whether the tree may be on.
+	On bool
+	// Brightness scales the brightness of the LEDs. It is 0 while the tree is
+	// off.
+	Brightness float64
+	// Reason explains why the tree is off or dimmed.
+	Reason string
+	// Until is when the state changes next. It is zero if the state does not
+	// change within the next week.
+	Until time.Time
+}
+
+func (s scheduleState) equal(other scheduleState) bool {
+	return s.On == other.On && s.Brightness == other.Brightness && s.Reason == other.Reason
+}
+
+// schedule decides whether the tree is on at any point in time.
+type schedule struct {
+	cfg scheduleConfig
+	loc *time.Location
+	// changes are the times of day at which the state may change, in order.
+	// It always includes midnight, when the day and the date change.
+	changes []clockTime
+}
+
+func newSchedule(cfg scheduleConfig) (*schedule, error) {
+	loc, err := cfg.location()
+	if err != nil {
+		return nil, fmt.Errorf("invalid time zone: %w", err)
+	}
+
+	changes := []clockTime{0}
+	for _, window := range cfg.On {
+		changes = append(changes, window.Start, window.End)
+	}
+	for _, dim := range cfg.Dim {
+		changes = append(changes, dim.Start, dim.End)
+	}
+	for _, ex := range cfg.Exceptions {
+		changes = append(changes, ex.Start, ex.End)
+	}
+	for i, change := range changes {
+		changes[i] = change % minutesPerDay
+	}
+	slices.Sort(changes)
+	changes = slices.Compact(changes)
+
+	return &schedule{cfg: cfg, loc: loc, changes: changes}, nil
+}
+
+// at returns the state of the schedule at t, including when it changes next.
+func (s *schedule) at(t time.Time) scheduleState {
+	state := s.stateAt(t)
+
+	// The state only changes at the start or end of a window, or at
+	// midnight, so only those times need to be checked over the next week.
+	t = t.In(s.loc)
+	year, month, day := t.Date()
+	for i := 0; i < 8; i++ {
+		for _, change := range s.changes {
+			next := time.Date(year, month, day+i, 0, int(change), 0, 0, s.loc)
+			if !next.After(t) {
+				continue
+			}
+			if !s.stateAt(next).equal(state) {
+				state.Until = next
+				return state
+			}
+		}
+	}
+
+	return state
+}
+
+func (s *schedule) stateAt(t time.Time) scheduleState {
+	t = t.In(s.loc)
+	state := scheduleState{On: true, Brightness: 1}
+
+	if ex, ok := s.exception(t); ok {
+		now := clockTimeOf(t)
+		hasWindow := ex.Start != 0 || ex.End != 0
+		if !ex.On || (hasWindow && (now < ex.Start || now >= ex.End.orMidnight())) {
+			state.On = false
+			state.Reason = fmt.Sprintf("the tree is off on %s", ex.Date)
+		}
+	} else if len(s.cfg.On) > 0 && !s.inOnWindow(t) {
+		state.On = false
+		state.Reason = "the tree is off outside of its scheduled hours"
+	}
+
+	if !state.On {
+		state.Brightness = 0
+		return state
+	}
+
+	for _, dim := range s.cfg.Dim {
+		if dim.contains(t) && dim.Brightness < state.Brightness {
+			state.Brightness = dim.Brightness
+			state.Reason = "the tree is dimmed during quiet hours"
+		}
+	}
+
+	return state
+}
+
+func (s *schedule) exception(t time.Time) (scheduleException, bool) {
+	date := scheduleDate(t.Format(scheduleDateLayout))
+	for _, ex := range s.cfg.Exceptions {
+		if ex.Date == date {
+			return ex, true
+		}
+	}
+	return scheduleException{}, false
+}
+
+func (s *schedule) inOnWindow(t time.Time) bool {
+	for _, window := range s.cfg.On {
+		if window.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// scheduleOverride turns the tree on or off regardless of the schedule.
+type scheduleOverride struct {
+	On bool `json:"on"`
+	// Until is when the schedule takes over again. Nil means until the
+	// override is cleared.
+	Until *time.Time `json:"until,omitempty"`
+}
+
+// state returns the state that the override forces at t, or false if it
+// has ended.
+func (o scheduleOverride) state(t time.Time) (scheduleState, bool) {
+	if o.Until != nil && !t.Before(*o.Until) {
+		return scheduleState{}, false
+	}
+
+	state := scheduleState{On: o.On, Brightness: 1}
+	if !o.On {
+		state.Brightness = 0
+		state.Reason = "the tree was turned off by an admin"
+	}
+	if o.Until != nil {
+		state.Until = *o.Until
+	}
+	return state, true
+}
+
+// scheduleCheckInterval is how often the scheduler checks the schedule.
+const scheduleCheckInterval = 15 * time.Second
+
+// scheduler applies a schedule to the LEDs and to the sessions.
+type scheduler struct {
+	leds   *ledController
+	server *christmasd.Server
+	logger *slog.Logger
+
+	mu       sync.Mutex
+	schedule *schedule
+	override *scheduleOverride // nil if the schedule is followed
+	state    scheduleState
+	changed  chan struct{}
+}
+
+func newScheduler(cfg scheduleConfig, leds *ledController, server *christmasd.Server, logger *slog.Logger) (*scheduler, error) {
+	schedule, err := newSchedule(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &scheduler{
+		leds:     leds,
+		server:   server,
+		logger:   logger,
+		schedule: schedule,
+		state:    scheduleState{On: true, Brightness: 1},
+		changed:  make(chan struct{}, 1),
+	}
+	s.apply(time.Now())
+
+	return s, nil
+}
+
+// setConfig replaces the schedule. It is applied right away.
+func (s *scheduler) setConfig(cfg scheduleConfig) error {
+	schedule, err := newSchedule(cfg)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.schedule = schedule
+	s.mu.Unlock()
+
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// setOverride forces the tree on or off until the override ends, or follows
+// the schedule again if o is nil. It is applied right away.
+func (s *scheduler) setOverride(o *scheduleOverride) {
+	s.mu.Lock()
+	s.override = o
+	s.mu.Unlock()
+
+	s.apply(time.Now())
+}
+
+// currentOverride returns the override that is in effect, if any.
+func (s *scheduler) currentOverride() *scheduleOverride {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.override == nil {
+		return nil
+	}
+	o := *s.override
+	return &o
+}
+
+// current returns the current state of the schedule.
+func (s *scheduler) current() scheduleState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.state
+}
+
+// rejects returns the reason that new sessions are rejected, or an empty
+// string if they are allowed.
+func (s *scheduler) rejects() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state.On || s.schedule.cfg.OffAction != offReject {
+		return ""
+	}
+	return s.state.Reason
+}
+
+// start applies the schedule until the context is canceled.
+func (s *scheduler) start(ctx context.Context) {
+	ticker := time.NewTicker(scheduleCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.apply(now)
+		case <-s.changed:
+			s.apply(time.Now())
+		}
+	}
+}
+
+func (s *scheduler) apply(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state := s.schedule.at(now)
+	if s.override != nil {
+		if forced, ok := s.override.state(now); ok {
+			state = forced
+		} else {
+			s.logger.Info(
+				"schedule override ended")
+			s.override = nil
+		}
+	}
+
+	changed := !state.equal(s.state)
+	s.state = state
+
+	if !changed {
+		return
+	}
+
+	s.logger.Info(
+		"schedule changed",
+		"on", state.On,
+		"brightness", state.Brightness,
+		"reason", state.Reason,
+		"until", state.Until)
+
+	s.leds.setDimming(state.Brightness)
+
+	if !state.On && s.schedule.cfg.OffAction == offReject {
+		s.server.KickAllConnections(state.Reason)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+const testSchedule = `
+timezone = "UTC"
+
+[[on]]
+days = ["mon", "tue", "wed", "thu", "fri"]
+start = "17:00"
+end = "23:00"
+
+[[on]]
+days = ["sat"]
+start = "18:00"
+end = "02:00"
+
+[[dim]]
+start = "21:00"
+end = "23:00"
+brightness = 0.25
+
+[[exception]]
+date = "2023-12-25"
+on = true
+
+[[exception]]
+date = "2023-12-22"
+on = false
+`
+
+func TestSchedule(t *testing.T) {
+	var cfg scheduleConfig
+	if _, err := toml.Decode(testSchedule, &cfg); err != nil {
+		t.Fatal("cannot decode schedule:", err)
+	}
+	if err := cfg.validate(); err != nil {
+		t.Fatal("invalid schedule:", err)
+	}
+
+	schedule, err := newSchedule(cfg)
+	if err != nil {
+		t.Fatal("cannot create schedule:", err)
+	}
+
+	tests := []struct {
+		time       string
+		on         bool
+		brightness float64
+	}{
+		// Monday.
+		{"2023-12-18T16:59:00Z", false, 0},
+		{"2023-12-18T17:00:00Z", true, 1},
+		{"2023-12-18T21:30:00Z", true, 0.25},
+		{"2023-12-18T23:00:00Z", false, 0},
+		// Friday, but off for the day.
+		{"2023-12-22T18:00:00Z", false, 0},
+		// Saturday into Sunday.
+		{"2023-12-23T17:00:00Z", false, 0},
+		{"2023-12-23T19:00:00Z", true, 1},
+		{"2023-12-24T01:59:00Z", true, 1},
+		{"2023-12-24T02:00:00Z", false, 0},
+		// Monday, but on all day.
+		{"2023-12-25T09:00:00Z", true, 1},
+		{"2023-12-25T22:00:00Z", true, 0.25},
+	}
+
+	for _, test := range tests {
+		now, err := time.Parse(time.RFC3339, test.time)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		state := schedule.stateAt(now)
+		if state.On != test.on || state.Brightness != test.brightness {
+			t.Errorf("at %s: got on=%v brightness=%v, want on=%v brightness=%v",
+				test.time, state.On, state.Brightness, test.on, test.brightness)
+		}
+	}
+}
+
+func TestScheduleUntil(t *testing.T) {
+	schedule, err := newSchedule(scheduleConfig{
+		TimeZone: "UTC",
+		On:       []scheduleWindow{{Start: 17 * 60, End: 23 * 60}},
+	})
+	if err != nil {
+		t.Fatal("cannot create schedule:", err)
+	}
+
+	now := time.Date(2023, 12, 18, 12, 30, 15, 0, time.UTC)
+	state := schedule.at(now)
+
+	want := time.Date(2023, 12, 18, 17, 0, 0, 0, time.UTC)
+	if !state.Until.Equal(want) {
+		t.Errorf("got next change at %v, want %v", state.Until, want)
+	}
+}
+
+func TestScheduleUntilMatchesScan(t *testing.T) {
+	var cfg scheduleConfig
+	if _, err := toml.Decode(testSchedule, &cfg); err != nil {
+		t.Fatal("cannot decode schedule:", err)
+	}
+	cfg.Exceptions = append(cfg.Exceptions, scheduleException{
+		Date:  "2023-12-26",
+		On:    true,
+		Start: 10 * 60,
+		End:   12*60 + 30,
+	})
+
+	schedule, err := newSchedule(cfg)
+	if err != nil {
+		t.Fatal("cannot create schedule:", err)
+	}
+
+	// The next change must be the same as if every minute was checked.
+	start := time.Date(2023, 12, 17, 0, 0, 30, 0, time.UTC)
+	for now := start; now.Before(start.AddDate(0, 0, 14)); now = now.Add(7 * time.Minute) {
+		state := schedule.at(now)
+
+		var want time.Time
+		next := now.Truncate(time.Minute)
+		for i := 0; i < 8*minutesPerDay; i++ {
+			next = next.Add(time.Minute)
+			if !schedule.stateAt(next).equal(state) {
+				want = next
+				break
+			}
+		}
+
+		if !state.Until.Equal(want) {
+			t.Fatalf("at %v: got next change at %v, want %v", now, state.Until, want)
+		}
+	}
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"dev.acmcsuf.com/christmas/lib/leddraw"
+)
+
+const (
+	// defaultSnapshotWidth is the width of a snapshot if neither its width
+	// nor its height is given.
+	defaultSnapshotWidth = 512
+	// snapshotGlow is how far the glow around an LED reaches, as a multiple
+	// of its radius.
+	snapshotGlow = 4
+)
+
+// snapshotLimits bounds how much work and memory a single snapshot takes.
+type snapshotLimits struct {
+	// MaxSize is the largest width or height of a snapshot.
+	MaxSize int
+	// MaxRadius is the largest radius of an LED. Each LED is drawn over a
+	// square of 2*snapshotGlow*MaxRadius pixels on each side.
+	MaxRadius float64
+}
+
+var (
+	// adminSnapshotLimits are the limits of snapshots on the admin HTTP
+	// server.
+	adminSnapshotLimits = snapshotLimits{MaxSize: 4096, MaxRadius: 50}
+	// publicSnapshotLimits are the limits of snapshots on the public HTTP
+	// server, which anyone can request.
+	publicSnapshotLimits = snapshotLimits{MaxSize: 1024, MaxRadius: 12}
+)
+
+// snapshotOpts is how a snapshot is rendered.
+type snapshotOpts struct {
+	Width  int
+	Height int
+	// Background is drawn behind the LEDs. It may be transparent.
+	Background color.RGBA
+	// Radius is the radius of the solid part of each LED in pixels.
+	Radius float64
+}
+
+// snapshotBuffer is the memory that a snapshot is rendered into. It is reused
+// from one snapshot to the next, so that each snapshot doesn't allocate it
+// again.
+type snapshotBuffer struct {
+	img image.RGBA
+	// Light and coverage are added up separately so that overlapping glows
+	// brighten each other before they are composited onto the background.
+	light [][3]float64
+	cover []float64
+}
+
+// render draws each LED as a glowing dot at its point, scaled to fit the image
+// the same way as the browser's tree canvas. The returned image is only valid
+// until the next call to render.
+func (b *snapshotBuffer) render(points []image.Point, leds leddraw.LEDStrip, opts snapshotOpts) *image.RGBA {
+	n := opts.Width * opts.Height
+	b.img = image.RGBA{
+		Pix:    slices.Grow(b.img.Pix[:0], 4*n)[:4*n],
+		Stride: 4 * opts.Width,
+		Rect:   image.Rect(0, 0, opts.Width, opts.Height),
+	}
+	b.light = slices.Grow(b.light[:0], n)[:n]
+	b.cover = slices.Grow(b.cover[:0], n)[:n]
+	clear(b.light)
+	clear(b.cover)
+
+	img, light, cover := &b.img, b.light, b.cover
+
+	glow := opts.Radius * snapshotGlow
+	scale, offset := snapshotTransform(points, opts.Width, opts.Height, glow)
+
+	for i, point := range points {
+		if i >= len(leds) {
+			break
+		}
+		c := leds[i]
+		cx := (float64(point.X)-offset.X)*scale + glow
+		cy := (float64(point.Y)-offset.Y)*scale + glow
+
+		x0 := max(0, int(math.Floor(cx-glow)))
+		x1 := min(opts.Width-1, int(math.Ceil(cx+glow)))
+		y0 := max(0, int(math.Floor(cy-glow)))
+		y1 := min(opts.Height-1, int(math.Ceil(cy+glow)))
+
+		for y := y0; y <= y1; y++ {
+			for x := x0; x <= x1; x++ {
+				d := math.Hypot(float64(x)+0.5-cx, float64(y)+0.5-cy)
+				a := snapshotIntensity(d, opts.Radius, glow)
+				if a == 0 {
+					continue
+				}
+
+				j := y*opts.Width + x
+				light[j][0] += float64(c.R) * a
+				light[j][1] += float64(c.G) * a
+				light[j][2] += float64(c.B) * a
+				cover[j] += a
+			}
+		}
+	}
+
+	bg := opts.Background
+	for j := range light {
+		a := min(cover[j], 1)
+		// Everything is premultiplied, so the light must not be brighter
+		// than its own coverage.
+		lightMax := 255 * a
+		r := min(light[j][0], lightMax) + float64(bg.R)*(1-a)
+		g := min(light[j][1], lightMax) + float64(bg.G)*(1-a)
+		b := min(light[j][2], lightMax) + float64(bg.B)*(1-a)
+		alpha := lightMax + float64(bg.A)*(1-a)
+
+		img.Pix[j*4+0] = uint8(math.Round(min(r, alpha)))
+		img.Pix[j*4+1] = uint8(math.Round(min(g, alpha)))
+		img.Pix[j*4+2] = uint8(math.Round(min(b, alpha)))
+		img.Pix[j*4+3] = uint8(math.Round(alpha))
+	}
+
+	return img
+}
+
+// snapshotIntensity returns how much of an LED's light reaches the given
+// distance from its center.
+func snapshotIntensity(d, radius, glow float64) float64 {
+	switch {
+	case d <= radius:
+		return 1
+	case d >= glow:
+		return 0
+	default:
+		f := (glow - d) / (glow - radius)
+		return 0.6 * f * f
+	}
+}
+
+// snapshotTransform returns the scale and the offset that fit the points
+// into a width by height image, leaving a margin for the glow on all sides.
+func snapshotTransform(points []image.Point, width, height int, margin float64) (float64, struct{ X, Y float64 }) {
+	var offset struct{ X, Y float64 }
+	if len(points) == 0 {
+		return 1, offset
+	}
+
+	bounds := snapshotBounds(points)
+	w := float64(width) - 2*margin
+	h := float64(height) - 2*margin
+
+	scale := math.Inf(1)
+	if bounds.Dx() > 0 {
+		scale = min(scale, w/float64(bounds.Dx()))
+	}
+	if bounds.Dy() > 0 {
+		scale = min(scale, h/float64(bounds.Dy()))
+	}
+	if math.IsInf(scale, 1) {
+		// All LEDs are at the same point.
+		scale = 1
+	}
+	scale = max(scale, 0)
+
+	// Center the points in whichever direction has room left.
+	offset.X = float64(bounds.Min.X) - (w-float64(bounds.Dx())*scale)/2/scale
+	offset.Y = float64(bounds.Min.Y) - (h-float64(bounds.Dy())*scale)/2/scale
+	if scale == 0 {
+		offset.X, offset.Y = float64(bounds.Min.X), float64(bounds.Min.Y)
+	}
+
+	return scale, offset
+}
+
+// snapshotBounds returns the smallest rectangle that has all points on or
+// inside its edges.
+func snapshotBounds(points []image.Point) image.Rectangle {
+	r := image.Rectangle{Min: points[0], Max: points[0]}
+	for _, p := range points[1:] {
+		r.Min.X = min(r.Min.X, p.X)
+		r.Min.Y = min(r.Min.Y, p.Y)
+		r.Max.X = max(r.Max.X, p.X)
+		r.Max.Y = max(r.Max.Y, p.Y)
+	}
+	return r
+}
+
+// parseHexColor parses a color like "#ff8800", "ff8800", "#f80" or
+// "#ff880080". The "#" is optional.
+func parseHexColor(s string) (color.RGBA, error) {
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if len(hex) != 8 || err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid color %q, expected a hex color like #ff8800", s)
+	}
+
+	c := color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}
+	return color.RGBAModel.Convert(c).(color.RGBA), nil
+}
+
+// snapshotHandler serves the LEDs as a PNG image. Snapshots are rendered one
+// at a time into the same buffer, and the last one is served again for as long
+// as the LEDs and the options stay the same.
+type snapshotHandler struct {
+	leds   *ledController
+	limits snapshotLimits
+	// enabled returns whether the handler serves snapshots. If it is nil,
+	// it always does.
+	enabled func() bool
+
+	// rendering is held while a snapshot is rendered. It guards the fields
+	// below.
+	rendering chan struct{}
+	buf       snapshotBuffer
+	encoder   png.Encoder
+	last      cachedSnapshot
+}
+
+// cachedSnapshot is an encoded snapshot and what it was rendered from.
+type cachedSnapshot struct {
+	opts   snapshotOpts
+	points []image.Point
+	leds   leddraw.LEDStrip
+	png    []byte
+}
+
+func newSnapshotHandler(leds *ledController, limits snapshotLimits, enabled func() bool) *snapshotHandler {
+	return &snapshotHandler{
+		leds:      leds,
+		limits:    limits,
+		enabled:   enabled,
+		rendering: make(chan struct{}, 1),
+		encoder: png.Encoder{
+			CompressionLevel: png.BestSpeed,
+			BufferPool:       &pngBufferPool{},
+		},
+	}
+}
+
+// ServeHTTP serves a snapshot. The query parameters are:
+//
+//   - width and height: the size of the image in pixels. If only one is
+//     given, the other is picked to fit the LEDs.
+//   - background: a hex color or "transparent". It defaults to black.
+//   - radius: the radius of each LED in pixels.
+func (h *snapshotHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.enabled != nil && !h.enabled() {
+		http.NotFound(w, r)
+		return
+	}
+
+	points, leds := h.leds.snapshot()
+
+	opts, err := parseSnapshotOpts(r.URL.Query(), points, h.limits)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	select {
+	case h.rendering <- struct{}{}:
+	case <-r.Context().Done():
+		return
+	}
+	b, err := h.encode(points, leds, opts)
+	<-h.rendering
+
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to encode snapshot: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(b)
+}
+
+// encode returns the PNG of a snapshot, rendering it only if the last one was
+// of different LEDs or options. It must be called with rendering held. The
+// returned bytes are never modified.
+func (h *snapshotHandler) encode(points []image.Point, leds leddraw.LEDStrip, opts snapshotOpts) ([]byte, error) {
+	if h.last.png != nil &&
+		h.last.opts == opts &&
+		slices.Equal(h.last.points, points) &&
+		slices.Equal(h.last.leds, leds) {
+		return h.last.png, nil
+	}
+
+	var buf bytes.Buffer
+	if err := h.encoder.Encode(&buf, h.buf.render(points, leds, opts)); err != nil {
+		return nil, err
+	}
+
+	h.last = cachedSnapshot{
+		opts:   opts,
+		points: points,
+		leds:   leds,
+		png:    buf.Bytes(),
+	}
+	return h.last.png, nil
+}
+
+// pngBufferPool keeps a single png.EncoderBuffer. It is only used with the
+// rendering lock of a snapshotHandler held.
+type pngBufferPool struct {
+	buf *png.EncoderBuffer
+}
+
+func (p *pngBufferPool) Get() *png.EncoderBuffer { return p.buf }
+
+func (p *pngBufferPool) Put(buf *png.EncoderBuffer) { p.buf = buf }
+
+func parseSnapshotOpts(query map[string][]string, points []image.Point, limits snapshotLimits) (snapshotOpts, error) {
+	get := func(key string) string {
+		if v := query[key]; len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+
+	opts := snapshotOpts{
+		Background: color.RGBA{A: 255},
+	}
+
+	for _, size := range []struct {
+		key string
+		v   *int
+	}{
+		{"width", &opts.Width},
+		{"height", &opts.Height},
+	} {
+		s := get(size.key)
+		if s == "" {
+			continue
+		}
+		v, err := strconv.Atoi(s)
+		if err != nil || v < 1 || v > limits.MaxSize {
+			return opts, fmt.Errorf("%s must be a number from 1 to %d", size.key, limits.MaxSize)
+		}
+		*size.v = v
+	}
+
+	if s := get("background"); s != "" {
+		if s == "transparent" {
+			opts.Background = color.RGBA{}
+		} else {
+			c, err := parseHexColor(s)
+			if err != nil {
+				return opts, fmt.Errorf("background: %v", err)
+			}
+			opts.Background = c
+		}
+	}
+
+	// Pick the missing size from the aspect ratio of the LEDs.
+	aspect := 1.0
+	if len(points) > 0 {
+		bounds := snapshotBounds(points)
+		if bounds.Dx() > 0 && bounds.Dy() > 0 {
+			aspect = float64(bounds.Dx()) / float64(bounds.Dy())
+		}
+	}
+	switch {
+	case opts.Width == 0 && opts.Height == 0:
+		opts.Width = defaultSnapshotWidth
+		fallthrough
+	case opts.Height == 0:
+		opts.Height = int(math.Round(float64(opts.Width) / aspect))
+	case opts.Width == 0:
+		opts.Width = int(math.Round(float64(opts.Height) * aspect))
+	}
+	opts.Width = min(max(opts.Width, 1), limits.MaxSize)
+	opts.Height = min(max(opts.Height, 1), limits.MaxSize)
+
+	opts.Radius = min(max(2, float64(min(opts.Width, opts.Height))/200), limits.MaxRadius)
+	if s := get("radius"); s != "" {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil || v <= 0 || v > limits.MaxRadius {
+			return opts, fmt.Errorf("radius must be a number above 0 and up to %g", limits.MaxRadius)
+		}
+		opts.Radius = v
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"net/url"
+	"slices"
+	"testing"
+
+	"dev.acmcsuf.com/christmas/lib/leddraw"
+)
+
+func TestRenderSnapshot(t *testing.T) {
+	points := []image.Point{{0, 0}, {100, 0}, {100, 200}}
+	leds := leddraw.LEDStrip{{R: 255}, {G: 255}, {}}
+
+	opts, err := parseSnapshotOpts(url.Values{"height": {"400"}, "background": {"#000010"}}, points, adminSnapshotLimits)
+	if err != nil {
+		t.Fatal("cannot parse options:", err)
+	}
+	if opts.Width != 200 || opts.Height != 400 {
+		t.Errorf("size = %dx%d, want 200x400", opts.Width, opts.Height)
+	}
+
+	var buf snapshotBuffer
+
+	// Render something bigger first, so that the snapshot is drawn over the
+	// leftovers of another one.
+	big := opts
+	big.Width, big.Height = 300, 500
+	buf.render(points, leddraw.LEDStrip{{B: 255}, {B: 255}, {B: 255}}, big)
+
+	img := buf.render(points, leds, opts)
+	if img.Bounds() != image.Rect(0, 0, 200, 400) {
+		t.Errorf("image bounds = %v, want 200x400", img.Bounds())
+	}
+	glow := opts.Radius * snapshotGlow
+	scale, offset := snapshotTransform(points, opts.Width, opts.Height, glow)
+	at := func(p image.Point) color.RGBA {
+		x := (float64(p.X)-offset.X)*scale + glow
+		y := (float64(p.Y)-offset.Y)*scale + glow
+		return img.RGBAAt(int(x), int(y))
+	}
+
+	if c := at(points[0]); c != (color.RGBA{R: 255, A: 255}) {
+		t.Errorf("red LED is drawn as %v", c)
+	}
+	if c := at(points[1]); c != (color.RGBA{G: 255, A: 255}) {
+		t.Errorf("green LED is drawn as %v", c)
+	}
+	if c := at(points[2]); c != (color.RGBA{A: 255}) {
+		t.Errorf("off LED is drawn as %v", c)
+	}
+	if c := img.RGBAAt(opts.Width/2, opts.Height*3/4); c != opts.Background {
+		t.Errorf("background is drawn as %v, want %v", c, opts.Background)
+	}
+}
+
+func TestParseSnapshotOpts(t *testing.T) {
+	points := []image.Point{{0, 0}, {300, 100}}
+
+	tests := []struct {
+		query  url.Values
+		public bool
+		width  int
+		height int
+		bg     color.RGBA
+		err    bool
+	}{
+		{query: url.Values{}, width: defaultSnapshotWidth, height: 171, bg: color.RGBA{A: 255}},
+		{query: url.Values{"width": {"4096"}}, width: 4096, height: 1365, bg: color.RGBA{A: 255}},
+		{query: url.Values{"width": {"1024"}}, public: true, width: 1024, height: 341, bg: color.RGBA{A: 255}},
+		{query: url.Values{"width": {"4096"}}, public: true, err: true},
+		{query: url.Values{"radius": {"50"}}, width: defaultSnapshotWidth, height: 171, bg: color.RGBA{A: 255}},
+		{query: url.Values{"radius": {"50"}}, public: true, err: true},
+		{query: url.Values{"width": {"30"}, "height": {"40"}}, width: 30, height: 40, bg: color.RGBA{A: 255}},
+		{query: url.Values{"background": {"transparent"}}, width: defaultSnapshotWidth, height: 171},
+		{query: url.Values{"background": {"fff"}}, width: defaultSnapshotWidth, height: 171, bg: color.RGBA{255, 255, 255, 255}},
+		{query: url.Values{"width": {"0"}}, err: true},
+		{query: url.Values{"height": {"100000"}}, err: true},
+		{query: url.Values{"background": {"red"}}, err: true},
+		{query: url.Values{"radius": {"-1"}}, err: true},
+	}
+
+	for _, test := range tests {
+		limits := adminSnapshotLimits
+		if test.public {
+			limits = publicSnapshotLimits
+		}
+
+		opts, err := parseSnapshotOpts(test.query, points, limits)
+		if test.err {
+			if err == nil {
+				t.Errorf("%v: expected an error", test.query)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %v", test.query, err)
+			continue
+		}
+		if opts.Width != test.width || opts.Height != test.height || opts.Background != test.bg {
+			t.Errorf("%v: got %dx%d on %v, want %dx%d on %v", test.query,
+				opts.Width, opts.Height, opts.Background, test.width, test.height, test.bg)
+		}
+	}
+}
+
+func TestSnapshotHandlerCache(t *testing.T) {
+	h := newSnapshotHandler(nil, publicSnapshotLimits, nil)
+
+	points := []image.Point{{0, 0}, {10, 10}}
+	leds := leddraw.LEDStrip{{R: 255}, {G: 255}}
+	opts, err := parseSnapshotOpts(url.Values{}, points, h.limits)
+	if err != nil {
+		t.Fatal("cannot parse options:", err)
+	}
+
+	first, err := h.encode(points, leds, opts)
+	if err != nil {
+		t.Fatal("cannot encode snapshot:", err)
+	}
+	firstCopy := bytes.Clone(first)
+
+	// The same frame with the same options is not rendered again.
+	again, err := h.encode(points, slices.Clone(leds), opts)
+	if err != nil {
+		t.Fatal("cannot encode snapshot:", err)
+	}
+	if &again[0] != &first[0] {
+		t.Error("unchanged snapshot was rendered again")
+	}
+
+	changed, err := h.encode(points, leddraw.LEDStrip{{B: 255}, {G: 255}}, opts)
+	if err != nil {
+		t.Fatal("cannot encode snapshot:", err)
+	}
+	if bytes.Equal(changed, first) {
+		t.Error("snapshot of a new frame is the same as the old one")
+	}
+
+	// The earlier snapshot may still be being written to a client, so it
+	// must not share memory with the new one.
+	if !bytes.Equal(first, firstCopy) {
+		t.Error("earlier snapshot was overwritten by the new one")
+	}
+	if _, err := png.Decode(bytes.NewReader(changed)); err != nil {
+		t.Error("cannot decode snapshot:", err)
+	}
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"dev.acmcsuf.com/christmas/lib/leddraw"
+	"dev.acmcsuf.com/christmas/lib/xcolor"
+)
+
+type stateConfig struct {
+	// Path is the path of the JSON file that the settings changed through
+	// the admin API are saved to, so that they survive a restart. Nothing is
+	// saved unless a path is set.
+	Path string `toml:"path"`
+	// SaveInterval is how often the state is saved if it changed. It is also
+	// saved right after changes through the admin API and when the daemon
+	// stops.
+	SaveInterval time.Duration `toml:"save_interval"`
+	// RestoreFrame shows the last frame again on startup, or resumes the
+	// idle animation if it was playing. It is off by default, and it needs
+	// a path to save the frame to. The frame is saved when the daemon stops,
+	// and once it has been shown for frameSaveDelay without changing.
+	RestoreFrame bool `toml:"restore_frame"`
+}
+
+func (cfg stateConfig) validate() error {
+	var errs []error
+	if cfg.Path != "" && cfg.SaveInterval <= 0 {
+		errs = append(errs, fmt.Errorf("save_interval: must be positive, got %v", cfg.SaveInterval))
+	}
+	if cfg.RestoreFrame && cfg.Path == "" {
+		errs = append(errs, errors.New("restore_frame: needs a path to save the frame to"))
+	}
+	return errors.Join(errs...)
+}
+
+// daemonState is what is saved in the state file.
+type daemonState struct {
+	// Config is the part of the config that the state overrides, as it was
+	// when the state was saved. Like on reload, those settings are only
+	// restored if the config didn't change them since.
+	Config savedConfig `json:"config"`
+
+	Tokens           []accessToken     `json:"tokens,omitempty"`
+	Bans             []clientBan       `json:"bans,omitempty"`
+	Brightness       float64           `json:"brightness"`
+	FrameRate        int               `json:"fps"`
+	PPI              float64           `json:"ppi"`
+	ScheduleOverride *scheduleOverride `json:"schedule_override,omitempty"`
+	Frame            *savedFrame       `json:"frame,omitempty"`
+}
+
+type savedConfig struct {
+	Token     string  `json:"token"`
+	FrameRate int     `json:"fps"`
+	PPI       float64 `json:"ppi"`
+}
+
+// frameSaveDelay is how long a frame must be shown without changing before
+// it is saved. Animations would otherwise rewrite the state file every
+// save_interval.
+const frameSaveDelay = time.Minute
+
+type savedFrame struct {
+	// LEDs are the colors of the LEDs as RGB triples, before color
+	// correction. They are empty while the idle animation is playing.
+	LEDs []byte `json:"leds,omitempty"`
+	// Idle is whether the idle animation was playing.
+	Idle bool `json:"idle,omitempty"`
+}
+
+func newSavedFrame(strip leddraw.LEDStrip, idle bool) *savedFrame {
+	leds := make([]byte, 0, 3*len(strip))
+	for _, c := range strip {
+		leds = append(leds, c.R, c.G, c.B)
+	}
+	return &savedFrame{LEDs: leds, Idle: idle}
+}
+
+func (f *savedFrame) equal(other *savedFrame) bool {
+	return other != nil && f.Idle == other.Idle && bytes.Equal(f.LEDs, other.LEDs)
+}
+
+func (f *savedFrame) strip() leddraw.LEDStrip {
+	strip := make(leddraw.LEDStrip, len(f.LEDs)/3)
+	for i := range strip {
+		strip[i] = xcolor.RGB{R: f.LEDs[3*i], G: f.LEDs[3*i+1], B: f.LEDs[3*i+2]}
+	}
+	return strip
+}
+
+// stateStore saves the settings that were changed through the admin API and
+// restores them on startup. It is safe for concurrent use.
+type stateStore struct {
+	cfg      stateConfig
+	reloader *reloader
+	bans     *banList
+	logger   *slog.Logger
+	changes  chan struct{}
+
+	mu    sync.Mutex
+	last  []byte      // last saved state
+	frame *savedFrame // frame in the state file
+	// shown is the frame that was shown when the state was last saved, and
+	// shownSince is when it was first seen.
+	shown      *savedFrame
+	shownSince time.Time
+}
+
+func newStateStore(cfg stateConfig, reloader *reloader, bans *banList, logger *slog.Logger) *stateStore {
+	return &stateStore{
+		cfg:      cfg,
+		reloader: reloader,
+		bans:     bans,
+		logger:   logger,
+		changes:  make(chan struct{}, 1),
+	}
+}
+
+// restore applies the saved state, if there is any.
+func (s *stateStore) restore() error {
+	if s.cfg.Path == "" {
+		return nil
+	}
+
+	b, err := os.ReadFile(s.cfg.Path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("failed to read state file: %v", err)
+	}
+
+	var state daemonState
+	if err := json.Unmarshal(b, &state); err != nil {
+		return fmt.Errorf("failed to decode state file %q: %v", s.cfg.Path, err)
+	}
+
+	s.apply(state)
+
+	s.mu.Lock()
+	s.last = b
+	s.frame = state.Frame
+	s.mu.Unlock()
+
+	s.logger.Info(
+		"restored state",
+		"path", s.cfg.Path,
+		"tokens", len(state.Tokens),
+		"bans", len(state.Bans),
+		"frame", state.Frame != nil)
+
+	return nil
+}
+
+func (s *stateStore) apply(state daemonState) {
+	r := s.reloader
+	cfg := r.config()
+
+	tokens := state.Tokens
+	if cfg.Server.Token != state.Config.Token {
+		// The config has a new token, which wins over the saved one.
+		tokens = slices.DeleteFunc(slices.Clone(tokens), func(t accessToken) bool {
+			return t.ID == defaultTokenID
+		})
+	}
+	r.tokens.restore(tokens)
+	s.bans.restore(state.Bans)
+
+	if state.Brightness >= 0 && state.Brightness <= 1 {
+		r.leds.setLevel(state.Brightness)
+	}
+
+	var frameRate int
+	var ppi float64
+	if cfg.Canvas.FrameRate == state.Config.FrameRate && state.FrameRate >= 1 && state.FrameRate <= 1000 {
+		frameRate = state.FrameRate
+	}
+	if cfg.Canvas.PPI == state.Config.PPI && state.PPI > 0 {
+		ppi = state.PPI
+	}
+	if frameRate != 0 || ppi != 0 {
+		if err := r.setCanvas(frameRate, ppi); err != nil {
+			s.logger.Warn(
+				"failed to restore canvas settings",
+				"error", err)
+		}
+	}
+
+	if state.ScheduleOverride != nil {
+		r.sched.setOverride(state.ScheduleOverride)
+	}
+
+	if s.cfg.RestoreFrame && state.Frame != nil {
+		if state.Frame.Idle {
+			r.idle.resume()
+		} else if err := r.idle.SetLEDs(state.Frame.strip()); err != nil {
+			s.logger.Warn(
+				"failed to restore the last frame",
+				"error", err)
+		}
+	}
+}
+
+// capture returns the current state, with the given frame.
+func (s *stateStore) capture(frame *savedFrame) daemonState {
+	r := s.reloader
+	cfg := r.config()
+
+	level, _ := r.leds.brightness()
+	frameRate, ppi := r.leds.canvasSettings()
+
+	state := daemonState{
+		Config: savedConfig{
+			Token:     cfg.Server.Token,
+			FrameRate: cfg.Canvas.FrameRate,
+			PPI:       cfg.Canvas.PPI,
+		},
+		Tokens:           r.tokens.export(),
+		Bans:             s.bans.list(),
+		Brightness:       level,
+		FrameRate:        frameRate,
+		PPI:              ppi,
+		ScheduleOverride: r.sched.currentOverride(),
+		Frame:            frame,
+	}
+
+	return state
+}
+
+// frameToSave returns the frame to save at now. The frame that is shown is
+// only saved once it hasn't changed for frameSaveDelay, or if final is set;
+// until then, the frame that was saved before is kept. It must be called with
+// mu held.
+func (s *stateStore) frameToSave(now time.Time, final bool) *savedFrame {
+	if !s.cfg.RestoreFrame {
+		return nil
+	}
+
+	r := s.reloader
+	shown := &savedFrame{Idle: true}
+	if !r.idle.idling() {
+		_, strip := r.leds.snapshot()
+		shown = newSavedFrame(strip, false)
+	}
+
+	if !shown.equal(s.shown) {
+		s.shown = shown
+		s.shownSince = now
+	}
+
+	if final || now.Sub(s.shownSince) >= frameSaveDelay {
+		return shown
+	}
+	return s.frame
+}
+
+// changed asks for the state to be saved soon.
+func (s *stateStore) changed() {
+	select {
+	case s.changes <- struct{}{}:
+	default:
+	}
+}
+
+// save writes the state at now to the state file if it changed since it was
+// last saved. final is set for the last save before the daemon stops, which
+// always saves the frame that is shown.
+func (s *stateStore) save(now time.Time, final bool) error {
+	if s.cfg.Path == "" {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	frame := s.frameToSave(now, final)
+
+	b, err := json.MarshalIndent(s.capture(frame), "", "\t")
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %v", err)
+	}
+
+	if bytes.Equal(b, s.last) {
+		return nil
+	}
+
+	// The state has the token secrets, so only the daemon's user may read
+	// it.
+	if err := writeFileAtomic(s.cfg.Path, b, 0600); err != nil {
+		return fmt.Errorf("failed to write state file: %v", err)
+	}
+
+	s.last = b
+	s.frame = frame
+	return nil
+}
+
+// start saves the state whenever it changed, until the context is canceled.
+// The state is saved one last time before it returns.
+func (s *stateStore) start(ctx context.Context) {
+	if s.cfg.Path == "" {
+		return
+	}
+
+	ticker := time.NewTicker(s.cfg.SaveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.saveAndLog(true)
+			return
+		case <-ticker.C:
+		case <-s.changes:
+		}
+		s.saveAndLog(false)
+	}
+}
+
+func (s *stateStore) saveAndLog(final bool) {
+	if err := s.save(time.Now(), final); err != nil {
+		s.logger.Error(
+			"failed to save state",
+			"error", err)
+	}
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it
+// over path, so that path always has either the old or the new data, even if
+// the power goes out halfway.
+func writeFileAtomic(path string, data []byte, perm fs.FileMode) error {
+	dir := filepath.Dir(path)
+
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err := writeAndSync(f, data, perm); err != nil {
+		return err
+	}
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		return err
+	}
+
+	// Make sure that the rename itself is on disk. Not every platform can
+	// sync a directory, so this is best effort.
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+
+	return nil
+}
+
+func writeAndSync(f *os.File, data []byte, perm fs.FileMode) error {
+	_, err := f.Write(data)
+	if err == nil {
+		err = f.Chmod(perm)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"encoding/json"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"dev.acmcsuf.com/christmas/lib/leddraw"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+
+	for _, data := range []string{"first", "second"} {
+		if err := writeFileAtomic(path, []byte(data), 0600); err != nil {
+			t.Fatalf("cannot write %q: %v", data, err)
+		}
+
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal("cannot read file:", err)
+		}
+		if string(b) != data {
+			t.Errorf("file = %q, want %q", b, data)
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal("cannot stat file:", err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("mode = %v, want 0600", mode)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal("cannot read dir:", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("dir has %d entries, want only the file", len(entries))
+	}
+}
+
+func TestSavedFrame(t *testing.T) {
+	strip := leddraw.LEDStrip{
+		{R: 255, G: 0, B: 0},
+		{R: 1, G: 2, B: 3},
+		{},
+	}
+
+	frame := newSavedFrame(strip, false)
+	if len(frame.LEDs) != 9 {
+		t.Fatalf("saved %d bytes, want 9", len(frame.LEDs))
+	}
+
+	if got := frame.strip(); !slices.Equal(got, strip) {
+		t.Errorf("restored strip = %v, want %v", got, strip)
+	}
+}
+
+func TestStateRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	d := newTestDaemon(t, 3)
+	store := newTestStateStore(d, stateConfig{Path: path})
+
+	d.leds.setLevel(0.5)
+	if err := d.setCanvas(30, 36); err != nil {
+		t.Fatal("cannot set canvas:", err)
+	}
+	d.tokens.setDefault("api-token")
+	if _, err := store.bans.add(netip.MustParsePrefix("10.0.0.0/24"), "spam", nil); err != nil {
+		t.Fatal("cannot add ban:", err)
+	}
+
+	if err := store.save(time.Now(), false); err != nil {
+		t.Fatal("cannot save state:", err)
+	}
+
+	t.Run("same config", func(t *testing.T) {
+		d := newTestDaemon(t, 3)
+		store := newTestStateStore(d, stateConfig{Path: path})
+		if err := store.restore(); err != nil {
+			t.Fatal("cannot restore state:", err)
+		}
+
+		if level, _ := d.leds.brightness(); level != 0.5 {
+			t.Errorf("brightness = %v, want 0.5", level)
+		}
+		if fps, ppi := d.leds.canvasSettings(); fps != 30 || ppi != 36 {
+			t.Errorf("canvas = %d fps, %v ppi, want 30 fps, 36 ppi", fps, ppi)
+		}
+		if _, err := d.tokens.check("api-token", scopeView); err != nil {
+			t.Errorf("saved token was not restored: %v", err)
+		}
+		if _, banned := store.bans.banned("10.0.0.7:1234"); !banned {
+			t.Error("saved ban was not restored")
+		}
+	})
+
+	t.Run("changed config", func(t *testing.T) {
+		d := newTestDaemon(t, 3)
+		d.writeConfig(t, "[server]\ntoken = \"config-token\"\n", "fps = 25\nppi = 24\n")
+		if err := d.reload(); err != nil {
+			t.Fatal("cannot reload:", err)
+		}
+
+		store := newTestStateStore(d, stateConfig{Path: path})
+		if err := store.restore(); err != nil {
+			t.Fatal("cannot restore state:", err)
+		}
+
+		// Settings that the config changed since the state was saved win
+		// over the saved ones.
+		if fps, ppi := d.leds.canvasSettings(); fps != 25 || ppi != 24 {
+			t.Errorf("canvas = %d fps, %v ppi, want the config's 25 fps, 24 ppi", fps, ppi)
+		}
+		if _, err := d.tokens.check("config-token", scopeView); err != nil {
+			t.Errorf("config token was replaced: %v", err)
+		}
+		if _, err := d.tokens.check("api-token", scopeView); err == nil {
+			t.Error("saved token was restored over the config's")
+		}
+		if level, _ := d.leds.brightness(); level != 0.5 {
+			t.Errorf("brightness = %v, want 0.5", level)
+		}
+	})
+}
+
+func TestStateBrightness(t *testing.T) {
+	tests := []struct {
+		saved float64
+		want  float64
+	}{
+		{0.25, 0.25},
+		{0, 0},
+		{-0.5, 1},
+		{2, 1},
+	}
+
+	for _, test := range tests {
+		d := newTestDaemon(t, 3)
+		store := writeTestState(t, d, stateConfig{}, daemonState{Brightness: test.saved})
+
+		if err := store.restore(); err != nil {
+			t.Fatal("cannot restore state:", err)
+		}
+		if level, _ := d.leds.brightness(); level != test.want {
+			t.Errorf("saved brightness %v restored as %v, want %v", test.saved, level, test.want)
+		}
+	}
+}
+
+func TestStateRestoreFrame(t *testing.T) {
+	strip := leddraw.LEDStrip{{R: 255}, {G: 255}, {B: 255}}
+
+	for _, restoreFrame := range []bool{false, true} {
+		d := newTestDaemon(t, 3)
+		store := writeTestState(t, d, stateConfig{RestoreFrame: restoreFrame}, daemonState{
+			Brightness: 1,
+			Frame:      newSavedFrame(strip, false),
+		})
+		if err := store.restore(); err != nil {
+			t.Fatal("cannot restore state:", err)
+		}
+
+		if _, leds := d.leds.snapshot(); slices.Equal(leds, strip) != restoreFrame {
+			t.Errorf("with restore_frame = %v, LEDs are %v after restoring %v", restoreFrame, leds, strip)
+		}
+
+		d = newTestDaemon(t, 3)
+		store = writeTestState(t, d, stateConfig{RestoreFrame: restoreFrame}, daemonState{
+			Brightness: 1,
+			Frame:      &savedFrame{Idle: true},
+		})
+		if err := store.restore(); err != nil {
+			t.Fatal("cannot restore state:", err)
+		}
+
+		if resumed := d.idle.lastFrame.Load() == 0; resumed != restoreFrame {
+			t.Errorf("with restore_frame = %v, idle animation resumed = %v", restoreFrame, resumed)
+		}
+	}
+}
+
+func TestStateSaveFrame(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	d := newTestDaemon(t, 3)
+	store := newTestStateStore(d, stateConfig{Path: path, RestoreFrame: true})
+
+	first := leddraw.LEDStrip{{R: 255}, {G: 255}, {B: 255}}
+	second := leddraw.LEDStrip{{R: 1}, {G: 2}, {B: 3}}
+
+	readFrame := func() leddraw.LEDStrip {
+		t.Helper()
+
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal("cannot read state:", err)
+		}
+		var state daemonState
+		if err := json.Unmarshal(b, &state); err != nil {
+			t.Fatal("cannot decode state:", err)
+		}
+		if state.Frame == nil {
+			return nil
+		}
+		return state.Frame.strip()
+	}
+
+	steps := []struct {
+		strip leddraw.LEDStrip
+		after time.Duration
+		final bool
+		want  leddraw.LEDStrip
+	}{
+		// A new frame is only saved once it has been shown for a while.
+		{first, 0, false, nil},
+		{first, frameSaveDelay / 2, false, nil},
+		{first, frameSaveDelay, false, first},
+		// Until then, the frame that was saved before is kept.
+		{second, frameSaveDelay + time.Second, false, first},
+		// Stopping the daemon saves the frame right away.
+		{second, frameSaveDelay + 2*time.Second, true, second},
+	}
+
+	now := time.Now()
+	for i, step := range steps {
+		if err := d.leds.SetLEDs(step.strip); err != nil {
+			t.Fatal("cannot set LEDs:", err)
+		}
+		if err := store.save(now.Add(step.after), step.final); err != nil {
+			t.Fatal("cannot save state:", err)
+		}
+		if got := readFrame(); !slices.Equal(got, step.want) {
+			t.Errorf("step %d: saved frame = %v, want %v", i, got, step.want)
+		}
+	}
+}
+
+// newTestStateStore returns a state store for the daemon, with an empty ban
+// list.
+func newTestStateStore(d *testDaemon, cfg stateConfig) *stateStore {
+	if cfg.SaveInterval == 0 {
+		cfg.SaveInterval = time.Second
+	}
+	return newStateStore(cfg, d.reloader, newBanList(), d.logger)
+}
+
+// writeTestState writes state to a new state file and returns a state store
+// for the daemon that restores from it.
+func writeTestState(t *testing.T, d *testDaemon, cfg stateConfig, state daemonState) *stateStore {
+	t.Helper()
+
+	cfg.Path = filepath.Join(t.TempDir(), "state.json")
+	b, err := json.Marshal(state)
+	if err != nil {
+		t.Fatal("cannot encode state:", err)
+	}
+	if err := os.WriteFile(cfg.Path, b, 0600); err != nil {
+		t.Fatal("cannot write state:", err)
+	}
+
+	return newTestStateStore(d, cfg)
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"dev.acmcsuf.com/christmasd/dmxnet"
+	"libdb.so/ledctl"
+)
+
+// stripConfig is the configuration for a single physical LED strip. Each
+// strip is either a WS281x strip on one of the Pi's two PWM channels, or a
+// pixel controller that is sent DMX universes over the network.
+type stripConfig struct {
+	// Type is how the strip is driven.
+	Type stripType `toml:"type,omitempty"`
+	// ColorOrder is the order that the strip expects colors in.
+	ColorOrder colorOrder `toml:"order"`
+
+	// GPIOPin is the GPIO pin of the strip's data line. It decides the PWM
+	// channel of the strip: 12, 18 or 40 for channel 0, and 13, 19, 41 or 45
+	// for channel 1. Each channel drives at most one strip.
+	GPIOPin int `toml:"gpio,omitzero"`
+	// DMAChannel is the DMA channel used to drive the strip. The WS281x
+	// strips are written out together, so they must all use the same one. BE
+	// CAREFUL, a wrong DMA channel may damage the Pi.
+	DMAChannel int `toml:"dma,omitzero"`
+
+	// Address is the host[:port] of the pixel controller. E1.31 strips
+	// without an address are multicast.
+	Address string `toml:"address,omitempty"`
+	// Universe is the first universe of the strip. The LEDs are packed into
+	// consecutive universes, 170 each, unless Ranges are given.
+	Universe int `toml:"universe,omitzero"`
+	// Priority is the E1.31 priority of the strip's universes. Zero means
+	// the default of 100.
+	Priority int `toml:"priority,omitzero"`
+	// Ranges maps ranges of the strip's LEDs onto universes and channels.
+	// If given, every LED on the strip must be in exactly one range.
+	Ranges []dmxRange `toml:"range,omitempty"`
+}
+
+// stripType is how a strip is driven. The empty type is a WS281x strip.
+type stripType string
+
+const (
+	stripWS281x stripType = "ws281x"
+	stripE131   stripType = stripType(dmxnet.E131)
+	stripArtNet stripType = stripType(dmxnet.ArtNet)
+)
+
+func (t *stripType) UnmarshalText(text []byte) error {
+	switch typ := stripType(strings.ToLower(string(text))); typ {
+	case stripWS281x, stripE131, stripArtNet:
+		*t = typ
+	default:
+		return fmt.Errorf("unknown strip type %q, expected ws281x, e131 or artnet", text)
+	}
+	return nil
+}
+
+// dmxProtocol returns the DMX protocol that drives the strip, or false if
+// the strip is a WS281x strip.
+func (cfg stripConfig) dmxProtocol() (dmxnet.Protocol, bool) {
+	switch cfg.Type {
+	case stripE131, stripArtNet:
+		return dmxnet.Protocol(cfg.Type), true
+	default:
+		return "", false
+	}
+}
+
+// defaultStripConfig is the configuration used for a strip when parts of it
+// are not specified.
+var defaultStripConfig = stripConfig{
+	GPIOPin:    12,
+	ColorOrder: colorOrder(ledctl.BGROrder),
+	DMAChannel: 10,
+}
+
+// parseStripConfig parses a strip configuration in the format
+// GPIO[:ORDER[:DMA]], e.g. "12", "12:BGR" or "13:GRB".
+func parseStripConfig(s string) (stripConfig, error) {
+	cfg := defaultStripConfig
+	parts := strings.Split(s, ":")
+	if len(parts) > 3 {
+		return cfg, fmt.Errorf("invalid strip %q: expected GPIO[:ORDER[:DMA]]", s)
+	}
+
+	var err error
+
+	cfg.GPIOPin, err = strconv.Atoi(parts[0])
+	if err != nil {
+		return cfg, fmt.Errorf("invalid strip %q: invalid GPIO pin: %v", s, err)
+	}
+
+	if len(parts) > 1 {
+		order, ok := ledctl.StringToOrder[strings.ToUpper(parts[1])]
+		if !ok {
+			return cfg, fmt.Errorf("invalid strip %q: unknown color order %q", s, parts[1])
+		}
+		cfg.ColorOrder = colorOrder(order)
+	}
+
+	if len(parts) > 2 {
+		cfg.DMAChannel, err = strconv.Atoi(parts[2])
+		if err != nil {
+			return cfg, fmt.Errorf("invalid strip %q: invalid DMA channel: %v", s, err)
+		}
+	}
+
+	return cfg, nil
+}
+
+// stripsController is an RGBController that splits a single logical LED strip
+// across multiple physical strips.
+type stripsController struct {
+	strips  []RGBController
+	outputs []stripOutput // each output once, in strip order
+	addrs   []stripAddr   // logical index -> physical address
+}
+
+var _ RGBController = (*stripsController)(nil)
+
+type stripAddr struct {
+	strip int
+	index int
+}
+
+// stripOutput is what writes out a strip's LEDs. Most strips are their own
+// output.
+type stripOutput interface {
+	Flush() error
+}
+
+// sharedStrip is implemented by strips that are written out together with
+// other strips, such as the WS281x strips that share the Pi's PWM block. The
+// stripsController flushes and closes each output only once.
+type sharedStrip interface {
+	RGBController
+	output() stripOutput
+}
+
+// stripLengths returns the number of LEDs on each of n strips, given the
+// strip that each LED point is on. Every strip must have LEDs.
+func stripLengths(points []ledPoint, n int) ([]int, error) {
+	lengths := make([]int, n)
+	for i, point := range points {
+		if point.Strip >= n {
+			return nil, fmt.Errorf("LED %d is on strip %d, but only %d strips are configured", i, point.Strip, n)
+		}
+		lengths[point.Strip]++
+	}
+
+	for i, length := range lengths {
+		if length == 0 {
+			return nil, fmt.Errorf("strip %d has no LEDs", i)
+		}
+	}
+
+	return lengths, nil
+}
+
+// newStripsController creates a new stripsController. Each LED point is
+// mapped, in order, onto the strip that its Strip column refers to, so strips
+// must have the lengths returned by stripLengths.
+func newStripsController(points []ledPoint, strips []RGBController) *stripsController {
+	c := &stripsController{
+		strips: strips,
+		addrs:  make([]stripAddr, len(points)),
+	}
+
+	next := make([]int, len(strips))
+	for i, point := range points {
+		c.addrs[i] = stripAddr{
+			strip: point.Strip,
+			index: next[point.Strip],
+		}
+		next[point.Strip]++
+	}
+
+	for _, strip := range strips {
+		var out stripOutput = strip
+		if shared, ok := strip.(sharedStrip); ok {
+			out = shared.output()
+		}
+		if !slices.Contains(c.outputs, out) {
+			c.outputs = append(c.outputs, out)
+		}
+	}
+
+	return c
+}
+
+// newHardwareStrips creates a stripsController that drives each strip using
+// the output that its type calls for. The WS281x strips are driven together
+// by the Pi's PWM block, one on each PWM channel.
+func newHardwareStrips(points []ledPoint, hw hardwareConfig) (*stripsController, error) {
+	if err := validateStripConfigs(hw.Strips); err != nil {
+		return nil, err
+	}
+
+	lengths, err := stripLengths(points, len(hw.Strips))
+	if err != nil {
+		return nil, err
+	}
+
+	var pwmConfigs []pwmStripConfig
+	var dmaChannel int
+	for i, strip := range hw.Strips {
+		if _, ok := strip.dmxProtocol(); !ok {
+			pwmConfigs = append(pwmConfigs, pwmStripConfig{
+				GPIOPin:    strip.GPIOPin,
+				ColorOrder: ledctl.ColorOrder(strip.ColorOrder),
+				NumPixels:  lengths[i],
+			})
+			dmaChannel = strip.DMAChannel
+		}
+	}
+
+	var pwm *pwmStrips
+	if len(pwmConfigs) > 0 {
+		pwm, err = newPWMStrips(pwmConfigs, ledctl.ColorModel(hw.ColorModel), hw.Frequency, dmaChannel)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create a WS281x controller: %v", err)
+		}
+	}
+
+	strips := make([]RGBController, 0, len(hw.Strips))
+	for i, cfg := range hw.Strips {
+		if _, ok := cfg.dmxProtocol(); ok {
+			strip, err := newDMXStrip(cfg, lengths[i])
+			if err != nil {
+				newStripsController(nil, strips).Close()
+				if pwm != nil {
+					pwm.Close()
+				}
+				return nil, fmt.Errorf("strip %d: %w", i, err)
+			}
+			strips = append(strips, strip)
+			continue
+		}
+
+		channel, _ := pwmChannel(cfg.GPIOPin)
+		strips = append(strips, pwm.strip(channel))
+	}
+
+	return newStripsController(points, strips), nil
+}
+
+func validateStripConfigs(configs []stripConfig) error {
+	if len(configs) == 0 {
+		return errors.New("no LED strips configured")
+	}
+
+	// The index of the WS281x strip on each PWM channel, or -1.
+	channels := [len(pwmChannelPins)]int{-1, -1}
+
+	var errs []error
+	for i, cfg := range configs {
+		if _, ok := cfg.dmxProtocol(); ok {
+			if err := validateDMXStrip(cfg); err != nil {
+				errs = append(errs, fmt.Errorf("strip %d: %w", i, err))
+			}
+			continue
+		}
+
+		channel, ok := pwmChannel(cfg.GPIOPin)
+		if !ok {
+			errs = append(errs, fmt.Errorf(
+				"strip %d: GPIO pin %d is not a PWM pin, expected one of %v for PWM channel 0 or %v for PWM channel 1",
+				i, cfg.GPIOPin, pwmChannelPins[0], pwmChannelPins[1]))
+			continue
+		}
+
+		if j := channels[channel]; j != -1 {
+			errs = append(errs, fmt.Errorf(
+				"strips %d and %d are both on PWM channel %d, but each channel can only drive one strip",
+				j, i, channel))
+			continue
+		}
+		channels[channel] = i
+	}
+
+	if channels[1] != -1 && channels[0] == -1 {
+		errs = append(errs, fmt.Errorf(
+			"strip %d is on PWM channel 1, which needs a strip on PWM channel 0 (GPIO %v) too",
+			channels[1], pwmChannelPins[0]))
+	}
+
+	if i, j := channels[0], channels[1]; i != -1 && j != -1 && configs[i].DMAChannel != configs[j].DMAChannel {
+		errs = append(errs, fmt.Errorf(
+			"strips %d and %d use DMA channels %d and %d, but they are written out together, so they must use the same one",
+			i, j, configs[i].DMAChannel, configs[j].DMAChannel))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c *stripsController) SetRGBAt(i int, color ledctl.RGB) {
+	addr := c.addrs[i]
+	c.strips[addr.strip].SetRGBAt(addr.index, color)
+}
+
+// Flush writes out all strips. The WS281x strips are written out together in
+// a single DMA transfer, and Flush only waits for the previous transfer to
+// finish, so they are written out in parallel with the other strips.
+func (c *stripsController) Flush() error {
+	var errs []error
+	for i, out := range c.outputs {
+		if err := out.Flush(); err != nil {
+			errs = append(errs, fmt.Errorf("output %d: %w", i, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes all outputs that can be closed.
+func (c *stripsController) Close() error {
+	var errs []error
+	for i, out := range c.outputs {
+		if closer, ok := out.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("output %d: %w", i, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
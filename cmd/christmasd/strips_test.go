@@ -0,0 +1,239 @@
+package main
+
+import (
+	"image"
+	"slices"
+	"strings"
+	"testing"
+
+	"libdb.so/ledctl"
+)
+
+func TestParseStripConfig(t *testing.T) {
+	tests := []struct {
+		in   string
+		want stripConfig
+		err  bool
+	}{
+		{in: "12", want: defaultStripConfig},
+		{in: "18:GRB", want: stripConfig{GPIOPin: 18, ColorOrder: colorOrder(ledctl.GRBOrder), DMAChannel: 10}},
+		{in: "13:rgb:5", want: stripConfig{GPIOPin: 13, ColorOrder: colorOrder(ledctl.RGBOrder), DMAChannel: 5}},
+		{in: "", err: true},
+		{in: "x", err: true},
+		{in: "12:XYZ", err: true},
+		{in: "12:BGR:x", err: true},
+		{in: "12:BGR:10:1", err: true},
+	}
+
+	for _, test := range tests {
+		got, err := parseStripConfig(test.in)
+		if test.err {
+			if err == nil {
+				t.Errorf("%q: expected an error", test.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", test.in, err)
+			continue
+		}
+		if !stripConfigEqual(got, test.want) {
+			t.Errorf("%q: got %+v, want %+v", test.in, got, test.want)
+		}
+	}
+}
+
+func stripConfigEqual(a, b stripConfig) bool {
+	return a.Type == b.Type && a.ColorOrder == b.ColorOrder && a.GPIOPin == b.GPIOPin && a.DMAChannel == b.DMAChannel
+}
+
+func TestValidateStripConfigs(t *testing.T) {
+	ws := func(pin, dma int) stripConfig {
+		return stripConfig{GPIOPin: pin, DMAChannel: dma}
+	}
+	artnet := stripConfig{Type: stripArtNet, Address: "127.0.0.1"}
+
+	tests := []struct {
+		name    string
+		configs []stripConfig
+		err     string // substring of the error, or empty if valid
+	}{
+		{"one strip", []stripConfig{ws(12, 10)}, ""},
+		{"both channels", []stripConfig{ws(12, 10), ws(13, 10)}, ""},
+		{"with a DMX strip", []stripConfig{ws(18, 10), artnet, ws(19, 10)}, ""},
+		{"only DMX strips", []stripConfig{artnet, artnet}, ""},
+		{"no strips", nil, "no LED strips"},
+		{"not a PWM pin", []stripConfig{ws(4, 10)}, "not a PWM pin"},
+		{"same channel", []stripConfig{ws(12, 10), ws(18, 10)}, "both on PWM channel 0"},
+		{"same pin", []stripConfig{ws(13, 10), ws(13, 10)}, "both on PWM channel 1"},
+		{"only channel 1", []stripConfig{ws(13, 10)}, "needs a strip on PWM channel 0"},
+		{"different DMA channels", []stripConfig{ws(12, 10), ws(13, 11)}, "same one"},
+	}
+
+	for _, test := range tests {
+		err := validateStripConfigs(test.configs)
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("%s: %v", test.name, err)
+		case test.err != "" && err == nil:
+			t.Errorf("%s: expected an error", test.name)
+		case test.err != "" && !strings.Contains(err.Error(), test.err):
+			t.Errorf("%s: error %q does not contain %q", test.name, err, test.err)
+		}
+	}
+}
+
+type fakeStrip struct {
+	leds    []ledctl.RGB
+	flushes int
+	out     *fakeStrip // shared output, if any
+}
+
+func (s *fakeStrip) SetRGBAt(i int, color ledctl.RGB) { s.leds[i] = color }
+func (s *fakeStrip) Flush() error                     { s.flushes++; return nil }
+
+type fakeSharedStrip struct{ *fakeStrip }
+
+func (s fakeSharedStrip) output() stripOutput { return s.out }
+
+func TestStripsController(t *testing.T) {
+	points := []ledPoint{
+		{Strip: 0}, {Strip: 1}, {Strip: 1}, {Strip: 2}, {Strip: 0}, {Strip: 1},
+	}
+
+	lengths, err := stripLengths(points, 3)
+	if err != nil {
+		t.Fatal("cannot get strip lengths:", err)
+	}
+	if want := []int{2, 3, 1}; !slices.Equal(lengths, want) {
+		t.Fatalf("strip lengths = %v, want %v", lengths, want)
+	}
+
+	// Strips 0 and 1 share an output, like the WS281x strips do.
+	shared := &fakeStrip{}
+	strips := []*fakeStrip{
+		{leds: make([]ledctl.RGB, 2), out: shared},
+		{leds: make([]ledctl.RGB, 3), out: shared},
+		{leds: make([]ledctl.RGB, 1)},
+	}
+
+	c := newStripsController(points, []RGBController{
+		fakeSharedStrip{strips[0]},
+		fakeSharedStrip{strips[1]},
+		strips[2],
+	})
+
+	for i := range points {
+		c.SetRGBAt(i, ledctl.RGB{R: uint8(i)})
+	}
+
+	want := [][]uint8{{0, 4}, {1, 2, 5}, {3}}
+	for i, strip := range strips {
+		got := make([]uint8, len(strip.leds))
+		for j, led := range strip.leds {
+			got[j] = led.R
+		}
+		if !slices.Equal(got, want[i]) {
+			t.Errorf("strip %d has LEDs %v, want %v", i, got, want[i])
+		}
+	}
+
+	if err := c.Flush(); err != nil {
+		t.Fatal("cannot flush:", err)
+	}
+	if shared.flushes != 1 || strips[2].flushes != 1 {
+		t.Errorf("shared output flushed %d times and strip 2 %d times, want once each",
+			shared.flushes, strips[2].flushes)
+	}
+	if strips[0].flushes != 0 || strips[1].flushes != 0 {
+		t.Errorf("strips with a shared output were flushed themselves")
+	}
+}
+
+func TestStripLengthsErrors(t *testing.T) {
+	if _, err := stripLengths([]ledPoint{{Strip: 0}, {Strip: 2}}, 2); err == nil {
+		t.Error("expected an error for an LED on an unknown strip")
+	}
+	if _, err := stripLengths([]ledPoint{{Strip: 1}}, 2); err == nil {
+		t.Error("expected an error for a strip without LEDs")
+	}
+}
+
+func TestEncodePWMChannel(t *testing.T) {
+	// One byte is 24 bits of PWM output, so two bytes fill one and a half
+	// words of each channel.
+	words := make([]uint32, 4)
+	encodePWMChannel(words, 0, []byte{0xFF, 0x00})
+	encodePWMChannel(words, 1, []byte{0x80, 0x01})
+
+	want := []uint32{
+		// Channel 0: eight high symbols, then eight low symbols.
+		0b110110110110110110110110_10010010,
+		// Channel 1: a high symbol and seven low ones, then the start of
+		// the second byte, which ends in a high symbol.
+		0b110100100100100100100100_10010010,
+		0b0100100100100100_0000000000000000,
+		0b0100100100100110_0000000000000000,
+	}
+	for i := range want {
+		if words[i] != want[i] {
+			t.Errorf("word %d = %032b, want %032b", i, words[i], want[i])
+		}
+	}
+}
+
+func TestColorOffsets(t *testing.T) {
+	for name, order := range ledctl.StringToOrder {
+		r, g, b := colorOffsets(order)
+		pixel := make([]byte, 3)
+		pixel[r], pixel[g], pixel[b] = 'R', 'G', 'B'
+		if string(pixel) != name {
+			t.Errorf("%s: offsets put the colors in the order %s", name, pixel)
+		}
+	}
+}
+
+func TestReadLEDPoints(t *testing.T) {
+	tests := []struct {
+		name string
+		csv  string
+		want []ledPoint
+		err  bool
+	}{
+		{
+			name: "two columns",
+			csv:  "1,2\n3,4\n",
+			want: []ledPoint{{Point: image.Pt(1, 2)}, {Point: image.Pt(3, 4)}},
+		},
+		{
+			name: "strip column with header",
+			csv:  "x,y,strip\n1,2,0\n3, 4, 1\n5,6\n",
+			want: []ledPoint{
+				{Point: image.Pt(1, 2), Strip: 0},
+				{Point: image.Pt(3, 4), Strip: 1},
+				{Point: image.Pt(5, 6), Strip: 0},
+			},
+		},
+		{name: "negative strip", csv: "1,2,-1\n", err: true},
+		{name: "invalid strip", csv: "1,2,a\n", err: true},
+		{name: "too many columns", csv: "1,2,0,4\n", err: true},
+		{name: "header after the first row", csv: "1,2\nx,y\n", err: true},
+	}
+
+	for _, test := range tests {
+		got, err := readLEDPoints(strings.NewReader(test.csv))
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !slices.Equal(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
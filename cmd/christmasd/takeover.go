@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"image"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"dev.acmcsuf.com/christmas/lib/leddraw"
+	"dev.acmcsuf.com/christmasd"
+)
+
+// takeover is an LEDController that lets something take over the LEDs from
+// the controllers in front of it, such as the client sessions and the idle
+// animation. While the LEDs are taken over, frames sent to it are held back
+// instead of being drawn. Once they are handed back, the last held back frame
+// is drawn.
+//
+// The LEDs are taken over either by a run, which draws from its own goroutine
+// between begin and end, or for as long as hold says so.
+type takeover struct {
+	ctrl   christmasd.LEDController
+	logger *slog.Logger
+	// hold reports whether frames are held back while no run is active. It
+	// is called with mu held for every frame, and may be nil.
+	hold func() bool
+
+	// startMu serializes begin and end.
+	startMu sync.Mutex
+
+	// mu is held while drawing, so that a held back frame is never drawn
+	// over a frame of whatever took over the LEDs.
+	mu      sync.Mutex
+	cancel  context.CancelFunc // nil if no run is active
+	held    func() error
+	before  leddraw.LEDStrip
+	stopped chan struct{} // closed when the current run stops
+}
+
+var (
+	_ christmasd.LEDController        = (*takeover)(nil)
+	_ christmasd.SessionLEDController = (*takeover)(nil)
+)
+
+// begin starts a run, replacing any run that is already active. first is
+// called with mu held to draw the first frame, so that it is showing by the
+// time begin returns. If it fails, the run is not started. Otherwise, run is
+// called in a new goroutine until its context is done, which is after the
+// duration if it is positive, or once end is called.
+func (t *takeover) begin(duration time.Duration, first func() error, run func(ctx context.Context)) error {
+	t.startMu.Lock()
+	defer t.startMu.Unlock()
+
+	t.endRun()
+
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if duration > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), duration)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	before := slices.Clone(t.ctrl.LEDs())
+	if err := first(); err != nil {
+		cancel()
+		return err
+	}
+
+	t.cancel = cancel
+	t.before = before
+	t.held = nil
+	t.stopped = make(chan struct{})
+
+	go func(stopped chan struct{}) {
+		defer close(stopped)
+		defer t.finish()
+		run(ctx)
+	}(t.stopped)
+
+	return nil
+}
+
+// end stops the current run, if any, and waits for it to stop.
+func (t *takeover) end() {
+	t.startMu.Lock()
+	defer t.startMu.Unlock()
+
+	t.endRun()
+}
+
+func (t *takeover) endRun() {
+	t.mu.Lock()
+	cancel, stopped := t.cancel, t.stopped
+	t.mu.Unlock()
+
+	if cancel == nil {
+		return
+	}
+
+	cancel()
+	<-stopped
+}
+
+// active reports whether a run is active. It must be called with mu held.
+func (t *takeover) active() bool {
+	return t.cancel != nil
+}
+
+// finish ends the current run and puts back the frame that was held back,
+// or the LEDs from before the run if no frame was.
+func (t *takeover) finish() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.cancel()
+	t.cancel = nil
+
+	if t.held == nil {
+		before := t.before
+		t.held = func() error { return t.ctrl.SetLEDs(before) }
+	}
+	t.before = nil
+	t.release()
+
+	t.logger.Info(
+		"stopped taking over the LEDs, client sessions are resumed")
+}
+
+// release draws the frame that was held back, if any. It must be called with
+// mu held.
+func (t *takeover) release() {
+	if t.held == nil {
+		return
+	}
+
+	if err := t.held(); err != nil {
+		t.logger.Warn(
+			"failed to restore the LEDs",
+			"error", err)
+	}
+	t.held = nil
+}
+
+// holding reports whether a frame is held back. It must be called with mu
+// held.
+func (t *takeover) holding() bool {
+	if t.active() {
+		return true
+	}
+	return t.hold != nil && t.hold()
+}
+
+func (t *takeover) LEDs() leddraw.LEDStrip {
+	return t.ctrl.LEDs()
+}
+
+func (t *takeover) SetLEDs(strip leddraw.LEDStrip) error {
+	return t.setLEDs(t.ctrl, strip)
+}
+
+func (t *takeover) ImageSize() (w, h int) {
+	return t.ctrl.ImageSize()
+}
+
+func (t *takeover) DrawImage(img *image.RGBA) error {
+	return t.drawImage(t.ctrl, img)
+}
+
+func (t *takeover) setLEDs(ctrl christmasd.LEDController, strip leddraw.LEDStrip) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.holding() {
+		strip = slices.Clone(strip)
+		t.held = func() error { return ctrl.SetLEDs(strip) }
+		return nil
+	}
+
+	return ctrl.SetLEDs(strip)
+}
+
+func (t *takeover) drawImage(ctrl christmasd.LEDController, img *image.RGBA) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.holding() {
+		img = cloneImage(img)
+		t.held = func() error { return ctrl.DrawImage(img) }
+		return nil
+	}
+
+	return ctrl.DrawImage(img)
+}
+
+// ForSession implements christmasd.SessionLEDController. Frames from the
+// session are held back like any other frame while the LEDs are taken over.
+func (t *takeover) ForSession(s *christmasd.Session) christmasd.LEDController {
+	return takeoverSessionController{
+		takeover: t,
+		ctrl:     christmasd.ControllerForSession(t.ctrl, s),
+	}
+}
+
+type takeoverSessionController struct {
+	takeover *takeover
+	ctrl     christmasd.LEDController
+}
+
+func (c takeoverSessionController) LEDs() leddraw.LEDStrip {
+	return c.ctrl.LEDs()
+}
+
+func (c takeoverSessionController) SetLEDs(strip leddraw.LEDStrip) error {
+	return c.takeover.setLEDs(c.ctrl, strip)
+}
+
+func (c takeoverSessionController) ImageSize() (w, h int) {
+	return c.ctrl.ImageSize()
+}
+
+func (c takeoverSessionController) DrawImage(img *image.RGBA) error {
+	return c.takeover.drawImage(c.ctrl, img)
+}
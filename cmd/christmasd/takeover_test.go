@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+
+	"dev.acmcsuf.com/christmas/lib/leddraw"
+	"dev.acmcsuf.com/christmasd"
+	"dev.acmcsuf.com/christmasd/christmasdtest"
+)
+
+func TestTakeover(t *testing.T) {
+	ctrl := christmasdtest.NewLEDController(2, 2, 1)
+	to := &takeover{
+		ctrl:   ctrl,
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	session := christmasd.ControllerForSession(to, christmasdtest.NewSession(t, christmasd.ServerOpts{LEDController: to}))
+
+	before := leddraw.LEDStrip{{R: 1}, {R: 2}}
+	if err := session.SetLEDs(before); err != nil {
+		t.Fatal("cannot set LEDs:", err)
+	}
+
+	taken := leddraw.LEDStrip{{B: 1}, {B: 2}}
+	ran := make(chan struct{})
+	err := to.begin(0, func() error {
+		return to.ctrl.SetLEDs(taken)
+	}, func(ctx context.Context) {
+		close(ran)
+		<-ctx.Done()
+	})
+	if err != nil {
+		t.Fatal("cannot begin run:", err)
+	}
+	<-ran
+
+	// Frames from sessions are held back during the run.
+	held := leddraw.LEDStrip{{G: 1}, {G: 2}}
+	if err := session.SetLEDs(held); err != nil {
+		t.Fatal("cannot set LEDs:", err)
+	}
+	if got := ctrl.LEDs(); !slices.Equal(got, taken) {
+		t.Errorf("LEDs during the run = %v, want %v", got, taken)
+	}
+
+	// The held back frame is drawn once the run ends.
+	to.end()
+	if got := ctrl.LEDs(); !slices.Equal(got, held) {
+		t.Errorf("LEDs after the run = %v, want the held frame %v", got, held)
+	}
+
+	// A run that ends by itself without a held back frame puts back the LEDs
+	// from before it.
+	err = to.begin(time.Millisecond, func() error {
+		return to.ctrl.SetLEDs(taken)
+	}, func(ctx context.Context) {
+		<-ctx.Done()
+	})
+	if err != nil {
+		t.Fatal("cannot begin run:", err)
+	}
+	waitLEDs(t, ctrl, held)
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+// tokenScope is what a token lets its holder do.
+type tokenScope string
+
+const (
+	// scopeView lets clients connect and look at the LEDs, but not change
+	// them.
+	scopeView tokenScope = "view"
+	// scopeControl lets clients connect and draw on the LEDs.
+	scopeControl tokenScope = "control"
+	// scopeAdmin can do everything that scopeControl can, and it is also
+	// accepted as a bearer token by the admin API.
+	scopeAdmin tokenScope = "admin"
+)
+
+// tokenScopes is every scope, from least to most allowed.
+var tokenScopes = []tokenScope{scopeView, scopeControl, scopeAdmin}
+
+func (s *tokenScope) UnmarshalText(text []byte) error {
+	scope := tokenScope(strings.ToLower(string(text)))
+	if scope == "view-only" {
+		scope = scopeView
+	}
+	if !slices.Contains(tokenScopes, scope) {
+		return fmt.Errorf("unknown token scope %q, expected view, control or admin", text)
+	}
+	*s = scope
+	return nil
+}
+
+// allows returns whether the scope allows everything that want allows.
+func (s tokenScope) allows(want tokenScope) bool {
+	return slices.Index(tokenScopes, s) >= slices.Index(tokenScopes, want)
+}
+
+// defaultTokenID is the ID of the default token, which is the token from the
+// config or the one set through the admin API.
+const defaultTokenID = "default"
+
+// accessToken is a token that clients connect with.
+type accessToken struct {
+	ID string `json:"id"`
+	// Secret is what clients connect with. It is only shown when the token
+	// is created.
+	Secret string `json:"token,omitempty"`
+	// Label names the token in logs, e.g. the team that it was handed to.
+	Label string     `json:"label"`
+	Scope tokenScope `json:"scope"`
+	// Created is when the token was created.
+	Created time.Time `json:"created"`
+	// Expires is when the token stops working for new connections. Sessions
+	// that are already connected are kept. Nil means never.
+	Expires *time.Time `json:"expires,omitempty"`
+	// MaxUses is how many connections the token can be used for. Zero means
+	// unlimited.
+	MaxUses int `json:"max_uses,omitempty"`
+	// Uses is how many connections the token was used for.
+	Uses int `json:"uses"`
+}
+
+var (
+	errTokenInvalid = errors.New("invalid token")
+	errTokenExpired = errors.New("token expired")
+	errTokenUsedUp  = errors.New("token has no uses left")
+	errTokenScope   = errors.New("token does not allow this")
+)
+
+// tokenStore holds the tokens that clients may connect with. It is safe for
+// concurrent use.
+type tokenStore struct {
+	mu     sync.Mutex
+	tokens []*accessToken
+}
+
+// newTokenStore creates a token store with the given default token.
+func newTokenStore(defaultToken string) *tokenStore {
+	s := &tokenStore{}
+	s.setDefault(defaultToken)
+	return s
+}
+
+// setDefault replaces the default token, which has the control scope and
+// never expires.
+func (s *tokenStore) setDefault(secret string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokens = slices.DeleteFunc(s.tokens, func(t *accessToken) bool { return t.ID == defaultTokenID })
+	s.tokens = slices.Insert(s.tokens, 0, &accessToken{
+		ID:      defaultTokenID,
+		Secret:  secret,
+		Label:   defaultTokenID,
+		Scope:   scopeControl,
+		Created: time.Now(),
+	})
+}
+
+// create adds a new token with a random secret and returns it, including the
+// secret.
+func (s *tokenStore) create(label string, scope tokenScope, expires *time.Time, maxUses int) (accessToken, error) {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return accessToken{}, fmt.Errorf("failed to generate token ID: %w", err)
+	}
+	secret, err := uuid.NewV4()
+	if err != nil {
+		return accessToken{}, fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	t := &accessToken{
+		ID:      id.String(),
+		Secret:  secret.String(),
+		Label:   label,
+		Scope:   scope,
+		Created: time.Now(),
+		Expires: expires,
+		MaxUses: maxUses,
+	}
+	if t.Label == "" {
+		t.Label = t.ID
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokens = append(s.tokens, t)
+	return *t, nil
+}
+
+// list returns all tokens, without their secrets.
+func (s *tokenStore) list() []accessToken {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tokens := make([]accessToken, len(s.tokens))
+	for i, t := range s.tokens {
+		tokens[i] = *t
+		tokens[i].Secret = ""
+	}
+	return tokens
+}
+
+// export returns all tokens, including their secrets.
+func (s *tokenStore) export() []accessToken {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tokens := make([]accessToken, len(s.tokens))
+	for i, t := range s.tokens {
+		tokens[i] = *t
+	}
+	return tokens
+}
+
+// restore replaces the tokens with the given ones, e.g. from export. The
+// current default token is kept unless tokens has one.
+func (s *tokenStore) restore(tokens []accessToken) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	restored := make([]*accessToken, 0, len(tokens)+1)
+	if !slices.ContainsFunc(tokens, func(t accessToken) bool { return t.ID == defaultTokenID }) {
+		for _, t := range s.tokens {
+			if t.ID == defaultTokenID {
+				restored = append(restored, t)
+			}
+		}
+	}
+	for _, t := range tokens {
+		t := t
+		restored = append(restored, &t)
+	}
+
+	s.tokens = restored
+}
+
+// revoke removes the token with the given ID and returns it.
+func (s *tokenStore) revoke(id string) (accessToken, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := slices.IndexFunc(s.tokens, func(t *accessToken) bool { return t.ID == id })
+	if i == -1 {
+		return accessToken{}, false
+	}
+
+	t := *s.tokens[i]
+	t.Secret = ""
+	s.tokens = slices.Delete(s.tokens, i, i+1)
+	return t, true
+}
+
+// use checks that the secret is a token with at least the wanted scope and
+// counts a use of it.
+func (s *tokenStore) use(secret string, want tokenScope) (accessToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, err := s.find(secret, want)
+	if err != nil {
+		return accessToken{}, err
+	}
+
+	t.Uses++
+
+	used := *t
+	used.Secret = ""
+	return used, nil
+}
+
+// check is like use, but without counting a use. It is for tokens that
+// authenticate every request rather than a connection.
+func (s *tokenStore) check(secret string, want tokenScope) (accessToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, err := s.find(secret, want)
+	if err != nil {
+		return accessToken{}, err
+	}
+
+	checked := *t
+	checked.Secret = ""
+	return checked, nil
+}
+
+// find returns the token with the given secret if it is still valid and has
+// at least the wanted scope. It must be called with mu held.
+func (s *tokenStore) find(secret string, want tokenScope) (*accessToken, error) {
+	var t *accessToken
+	for _, token := range s.tokens {
+		if subtle.ConstantTimeCompare([]byte(token.Secret), []byte(secret)) == 1 {
+			t = token
+			break
+		}
+	}
+
+	switch {
+	case t == nil:
+		return nil, errTokenInvalid
+	case t.Expires != nil && time.Now().After(*t.Expires):
+		return nil, errTokenExpired
+	case t.MaxUses > 0 && t.Uses >= t.MaxUses:
+		return nil, errTokenUsedUp
+	case !t.Scope.allows(want):
+		return nil, errTokenScope
+	}
+
+	return t, nil
+}
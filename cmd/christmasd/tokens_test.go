@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTokenStore(t *testing.T) {
+	store := newTokenStore("secret")
+
+	if token, err := store.use("secret", scopeControl); err != nil || token.ID != defaultTokenID {
+		t.Errorf("default token = %+v, %v", token, err)
+	}
+	if _, err := store.use("wrong", scopeView); !errors.Is(err, errTokenInvalid) {
+		t.Errorf("wrong token error = %v, want errTokenInvalid", err)
+	}
+
+	view, err := store.create("team 1", scopeView, nil, 2)
+	if err != nil {
+		t.Fatal("cannot create token:", err)
+	}
+	if _, err := store.use(view.Secret, scopeControl); !errors.Is(err, errTokenScope) {
+		t.Errorf("view token used for control, error = %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := store.use(view.Secret, scopeView); err != nil {
+			t.Errorf("use %d of view token: %v", i+1, err)
+		}
+	}
+	if _, err := store.use(view.Secret, scopeView); !errors.Is(err, errTokenUsedUp) {
+		t.Errorf("third use of a two use token, error = %v", err)
+	}
+
+	past := time.Now().Add(-time.Minute)
+	expired, err := store.create("team 2", scopeAdmin, &past, 0)
+	if err != nil {
+		t.Fatal("cannot create token:", err)
+	}
+	if _, err := store.use(expired.Secret, scopeControl); !errors.Is(err, errTokenExpired) {
+		t.Errorf("expired token error = %v", err)
+	}
+
+	tokens := store.list()
+	if len(tokens) != 3 {
+		t.Fatalf("listed %d tokens, want 3", len(tokens))
+	}
+	for _, token := range tokens {
+		if token.Secret != "" {
+			t.Errorf("listed token %q has its secret", token.Label)
+		}
+	}
+	if tokens[1].Uses != 2 {
+		t.Errorf("view token has %d uses, want 2", tokens[1].Uses)
+	}
+
+	if _, ok := store.revoke(view.ID); !ok {
+		t.Error("cannot revoke the view token")
+	}
+	if _, err := store.use(view.Secret, scopeView); !errors.Is(err, errTokenInvalid) {
+		t.Errorf("revoked token error = %v, want errTokenInvalid", err)
+	}
+
+	store.setDefault("other")
+	if _, err := store.use("secret", scopeControl); !errors.Is(err, errTokenInvalid) {
+		t.Errorf("old default token error = %v, want errTokenInvalid", err)
+	}
+	if _, err := store.use("other", scopeControl); err != nil {
+		t.Errorf("new default token: %v", err)
+	}
+}
+
+func TestTokenStoreRestore(t *testing.T) {
+	old := newTokenStore("old")
+	team, err := old.create("team 1", scopeControl, nil, 3)
+	if err != nil {
+		t.Fatal("cannot create token:", err)
+	}
+	if _, err := old.use(team.Secret, scopeControl); err != nil {
+		t.Fatal("cannot use token:", err)
+	}
+
+	store := newTokenStore("new")
+	store.restore(old.export())
+
+	if _, err := store.use("old", scopeControl); err != nil {
+		t.Errorf("restored default token: %v", err)
+	}
+	if _, err := store.use("new", scopeControl); !errors.Is(err, errTokenInvalid) {
+		t.Errorf("replaced default token error = %v, want errTokenInvalid", err)
+	}
+	if token, err := store.use(team.Secret, scopeControl); err != nil || token.Uses != 2 {
+		t.Errorf("restored token = %+v, %v, want 2 uses", token, err)
+	}
+
+	// Without a saved default token, the current one is kept.
+	store = newTokenStore("new")
+	store.restore(nil)
+	if _, err := store.use("new", scopeControl); err != nil {
+		t.Errorf("kept default token: %v", err)
+	}
+}
@@ -2,9 +2,12 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"image"
+	"io"
 	"log/slog"
+	"slices"
 	"sync"
 	"time"
 
@@ -20,92 +23,301 @@ type RGBController interface {
 }
 
 type ledController struct {
-	canvas *leddraw.LEDCanvas
 	logger *slog.Logger
+	sched  *frameScheduler
 
-	drawCh chan struct{}
-	ctrl   RGBController
+	// ctrlMu guards everything below, since all of it can be swapped out by
+	// reconfigure.
 	ctrlMu sync.Mutex
-
-	cfg ledControlConfig
+	canvas *leddraw.LEDCanvas
+	ctrl   RGBController // nil if it failed to reopen
+	colors *colorTable
+	dim    float64          // brightness set by the schedule
+	level  float64          // brightness set through the admin API
+	strip  leddraw.LEDStrip // last strip before color correction
+	cfg    ledControlConfig
 }
 
 var _ christmasd.LEDController = (*ledController)(nil)
 
 type ledControlConfig struct {
-	Controller RGBController
-	LEDCoords  []image.Point
-	FrameRate  int
-	CanvasPPI  float64
+	// OpenController opens the RGB controller for the given LED points. The
+	// controller is closed before it is opened again, so it may reuse the
+	// same hardware.
+	OpenController func(points []ledPoint) (RGBController, error)
+	LEDPoints      []ledPoint
+	FrameRate      int
+	ImmediateFlush bool
+	CanvasPPI      float64
+	Color          colorConfig
+	Hooks          christmasd.LEDControllerHooks
 
 	Logger *slog.Logger
 }
 
 func newLEDController(cfg ledControlConfig) (*ledController, error) {
-	canvasOpts := leddraw.LEDCanvasOpts{PPI: cfg.CanvasPPI}
-	canvas, err := leddraw.NewLEDCanvas(cfg.LEDCoords, canvasOpts)
+	canvas, err := newLEDCanvas(cfg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create LED canvas: %v", err)
+		return nil, err
+	}
+
+	ctrl, err := cfg.OpenController(cfg.LEDPoints)
+	if err != nil {
+		return nil, err
 	}
 
 	return &ledController{
-		canvas: canvas,
 		logger: cfg.Logger,
-		drawCh: make(chan struct{}, 1),
-		ctrl:   cfg.Controller,
+		sched:  newFrameScheduler(cfg.FrameRate, cfg.ImmediateFlush, cfg.Hooks.FrameLatency),
+		canvas: canvas,
+		ctrl:   ctrl,
+		colors: newColorTable(cfg.Color),
+		dim:    1,
+		level:  1,
 		cfg:    cfg,
 	}, nil
 }
 
-func (c *ledController) start(ctx context.Context) {
-	frameTicker := time.NewTicker(time.Second / time.Duration(c.cfg.FrameRate))
-	defer frameTicker.Stop()
-
-	drawCh := c.drawCh
-	frameTick := frameTicker.C
-
-	for {
-		select {
-		case <-ctx.Done():
-			c.logger.Debug(
-				"stopping LED controller")
-			return
-		case <-frameTick:
-			drawCh = c.drawCh
-			frameTick = nil
-
-			c.logger.Debug(
-				"frame timer reset")
-
-			continue
-		case <-drawCh:
-			drawCh = nil
-			frameTick = frameTicker.C
-
-			c.logger.Debug(
-				"flushing LED strip")
-		}
+func newLEDCanvas(cfg ledControlConfig) (*leddraw.LEDCanvas, error) {
+	canvasOpts := leddraw.LEDCanvasOpts{PPI: cfg.CanvasPPI}
+	canvas, err := leddraw.NewLEDCanvas(ledPointCoords(cfg.LEDPoints), canvasOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create LED canvas: %v", err)
+	}
+	return canvas, nil
+}
+
+// reconfigure replaces the LED canvas and the colors with the ones in cfg. If
+// reopen is true, the RGB controller is closed and opened again, which is
+// needed when the number of LEDs or the hardware changed. The frame rate is
+// changed with setFrameRate instead, and the hooks cannot be changed.
+func (c *ledController) reconfigure(cfg ledControlConfig, reopen bool) error {
+	canvas, err := newLEDCanvas(cfg)
+	if err != nil {
+		return err
+	}
 
-		c.ctrlMu.Lock()
-		if err := c.ctrl.Flush(); err != nil {
-			c.logger.Error(
-				"error writing LED strip",
+	c.ctrlMu.Lock()
+	defer c.ctrlMu.Unlock()
+
+	if reopen {
+		if err := c.closeController(); err != nil {
+			c.logger.Warn(
+				"failed to close LED strips",
 				"error", err)
 		}
-		c.ctrlMu.Unlock()
+
+		ctrl, err := cfg.OpenController(cfg.LEDPoints)
+		if err != nil {
+			// Bring back the old strips so that the LEDs keep working.
+			old, oldErr := c.cfg.OpenController(c.cfg.LEDPoints)
+			if oldErr != nil {
+				return errors.Join(err, fmt.Errorf("failed to reopen the old LED strips: %w", oldErr))
+			}
+			c.ctrl = old
+			c.queueDraw()
+			return err
+		}
+		c.ctrl = ctrl
+	}
+
+	cfg.FrameRate = c.cfg.FrameRate
+	cfg.ImmediateFlush = c.cfg.ImmediateFlush
+	cfg.Hooks = c.cfg.Hooks
+
+	c.canvas = canvas
+	c.cfg = cfg
+	c.updateColors()
+
+	return nil
+}
+
+// setFrameRate changes how often frames are flushed to the LEDs.
+func (c *ledController) setFrameRate(frameRate int) {
+	c.ctrlMu.Lock()
+	defer c.ctrlMu.Unlock()
+
+	c.cfg.FrameRate = frameRate
+	c.sched.setFrameRate(frameRate)
+}
+
+// setCanvasPPI rebuilds the LED canvas with the given pixel density. The
+// current LEDs are kept. Images drawn for the old canvas size are dropped, so
+// the caller should notify the sessions if ImageSize changed.
+func (c *ledController) setCanvasPPI(ppi float64) error {
+	c.ctrlMu.Lock()
+	defer c.ctrlMu.Unlock()
+
+	cfg := c.cfg
+	cfg.CanvasPPI = ppi
+
+	canvas, err := newLEDCanvas(cfg)
+	if err != nil {
+		return err
 	}
+
+	c.canvas = canvas
+	c.cfg = cfg
+	return nil
+}
+
+// canvasSettings returns the frame rate and the canvas pixel density that
+// the controller is using.
+func (c *ledController) canvasSettings() (frameRate int, ppi float64) {
+	c.ctrlMu.Lock()
+	defer c.ctrlMu.Unlock()
+
+	return c.cfg.FrameRate, c.cfg.CanvasPPI
+}
+
+// setDimming scales the brightness of the LEDs on top of the configured
+// brightness. The current LEDs are redrawn with the new brightness right
+// away.
+func (c *ledController) setDimming(brightness float64) {
+	c.ctrlMu.Lock()
+	defer c.ctrlMu.Unlock()
+
+	c.dim = brightness
+	c.updateColors()
+}
+
+// setLevel scales the brightness of the LEDs on top of the configured
+// brightness and the schedule's dimming. Unlike the configured brightness, it
+// is kept across reloads.
+func (c *ledController) setLevel(level float64) {
+	c.ctrlMu.Lock()
+	defer c.ctrlMu.Unlock()
+
+	c.level = level
+	c.updateColors()
+}
+
+// brightness returns the level set with setLevel and the brightness that the
+// LEDs are actually drawn with, including the config and the schedule.
+func (c *ledController) brightness() (level, effective float64) {
+	c.ctrlMu.Lock()
+	defer c.ctrlMu.Unlock()
+
+	return c.level, c.cfg.Color.Brightness * c.dim * c.level
 }
 
+// updateColors rebuilds the color table and redraws the last strip with it.
+func (c *ledController) updateColors() {
+	color := c.cfg.Color
+	color.Brightness *= c.dim * c.level
+	c.colors = newColorTable(color)
+
+	if c.ctrl != nil && c.strip != nil {
+		c.setLEDs(c.strip)
+	}
+	c.queueDraw()
+}
+
+// ledPoints returns the LED points that the controller is using.
+func (c *ledController) ledPoints() []ledPoint {
+	c.ctrlMu.Lock()
+	defer c.ctrlMu.Unlock()
+
+	return c.cfg.LEDPoints
+}
+
+// snapshot returns the coordinates of the LED points and a copy of the colors
+// that were last written to them, before color correction. LEDs that were
+// never written are black.
+func (c *ledController) snapshot() ([]image.Point, leddraw.LEDStrip) {
+	c.ctrlMu.Lock()
+	defer c.ctrlMu.Unlock()
+
+	leds := make(leddraw.LEDStrip, len(c.cfg.LEDPoints))
+	copy(leds, c.strip)
+	return ledPointCoords(c.cfg.LEDPoints), leds
+}
+
+// close closes the RGB controller if it can be closed.
+func (c *ledController) close() error {
+	c.ctrlMu.Lock()
+	defer c.ctrlMu.Unlock()
+
+	return c.closeController()
+}
+
+func (c *ledController) closeController() error {
+	closer, ok := c.ctrl.(io.Closer)
+	c.ctrl = nil
+	if !ok {
+		return nil
+	}
+	return closer.Close()
+}
+
+func (c *ledController) start(ctx context.Context) {
+	c.sched.run(ctx, c.flush)
+
+	c.logger.Debug(
+		"stopping LED controller")
+}
+
+func (c *ledController) flush() {
+	c.ctrlMu.Lock()
+	defer c.ctrlMu.Unlock()
+
+	if c.ctrl == nil {
+		return
+	}
+
+	start := time.Now()
+	err := c.ctrl.Flush()
+	if c.cfg.Hooks.Flushed != nil {
+		c.cfg.Hooks.Flushed(time.Since(start), err)
+	}
+	if err != nil {
+		c.logger.Error(
+			"error writing LED strip",
+			"error", err)
+	}
+}
+
+// frameStats returns statistics about the flushed frames.
+func (c *ledController) frameStats() christmasd.FrameStats {
+	return c.sched.stats()
+}
+
+// LEDs implements christmasd.LEDController. It returns a copy of the LEDs,
+// since sessions keep drawing into the canvas after the lock is released.
 func (c *ledController) LEDs() leddraw.LEDStrip {
-	return c.canvas.LEDs()
+	c.ctrlMu.Lock()
+	defer c.ctrlMu.Unlock()
+
+	return slices.Clone(c.canvas.LEDs())
 }
 
 func (c *ledController) SetLEDs(strip leddraw.LEDStrip) error {
 	c.ctrlMu.Lock()
 	defer c.ctrlMu.Unlock()
 
+	return c.setLEDs(strip)
+}
+
+var errStripsClosed = errors.New("LED strips are closed")
+
+func (c *ledController) setLEDs(strip leddraw.LEDStrip) error {
+	if c.ctrl == nil {
+		return errStripsClosed
+	}
+
+	// The strip might be from before a reconfigure, so don't write past the
+	// end of the canvas.
+	if n := len(c.cfg.LEDPoints); len(strip) > n {
+		strip = strip[:n]
+	}
+
+	if len(c.strip) != len(strip) {
+		c.strip = make(leddraw.LEDStrip, len(strip))
+	}
+	copy(c.strip, strip)
+
 	for i, color := range strip {
-		c.ctrl.SetRGBAt(i, ledctl.RGB(color))
+		c.ctrl.SetRGBAt(i, c.colors.apply(ledctl.RGB(color)))
 	}
 
 	c.queueDraw()
@@ -113,26 +325,44 @@ func (c *ledController) SetLEDs(strip leddraw.LEDStrip) error {
 }
 
 func (c *ledController) ImageSize() (w, h int) {
+	c.ctrlMu.Lock()
+	defer c.ctrlMu.Unlock()
+
 	bounds := c.canvas.CanvasBounds()
 	return bounds.Dx(), bounds.Dy()
 }
 
 func (c *ledController) DrawImage(img *image.RGBA) error {
+	c.ctrlMu.Lock()
+	defer c.ctrlMu.Unlock()
+
+	// The image might have been sized for the canvas from before a
+	// reconfigure. Sessions are told about the change, so just drop it.
+	if img.Bounds().Size() != c.canvas.CanvasBounds().Size() {
+		c.logger.Debug(
+			"dropping image with the wrong size",
+			"width", img.Bounds().Dx(),
+			"height", img.Bounds().Dy())
+		return nil
+	}
+
 	c.logger.Debug(
 		"beginning image render",
 		"width", img.Bounds().Dx(),
 		"height", img.Bounds().Dy())
-	if err := c.canvas.Render(img); err != nil {
+	start := time.Now()
+	err := c.canvas.Render(img)
+	if c.cfg.Hooks.Rendered != nil {
+		c.cfg.Hooks.Rendered(time.Since(start), err)
+	}
+	if err != nil {
 		return fmt.Errorf("failed to render image: %v", err)
 	}
 	c.logger.Debug(
 		"image render complete")
-	return c.SetLEDs(c.canvas.LEDs())
+	return c.setLEDs(c.canvas.LEDs())
 }
 
 func (c *ledController) queueDraw() {
-	select {
-	case c.drawCh <- struct{}{}:
-	default:
-	}
+	c.sched.queue()
 }
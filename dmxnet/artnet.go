@@ -0,0 +1,66 @@
+package dmxnet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	artNetHeaderSize = 18
+
+	artNetOpDmx       = 0x5000
+	artNetProtocol    = 14
+	artNetMaxUniverse = 0x7fff
+)
+
+var artNetID = [8]byte{'A', 'r', 't', '-', 'N', 'e', 't', 0}
+
+func appendArtDmx(b []byte, packet Packet) []byte {
+	// The length must be even.
+	length := len(packet.Data) + len(packet.Data)%2
+	length = max(length, 2)
+
+	start := len(b)
+	b = append(b, make([]byte, artNetHeaderSize+length)...)
+	p := b[start:]
+
+	copy(p[0:8], artNetID[:])
+	binary.LittleEndian.PutUint16(p[8:], artNetOpDmx)
+	binary.BigEndian.PutUint16(p[10:], artNetProtocol)
+	p[12] = packet.Sequence
+	p[13] = 0 // physical input port
+	binary.LittleEndian.PutUint16(p[14:], packet.Universe&artNetMaxUniverse)
+	binary.BigEndian.PutUint16(p[16:], uint16(length))
+	copy(p[artNetHeaderSize:], packet.Data)
+
+	return b
+}
+
+func parseArtDmx(p []byte) (Packet, error) {
+	if len(p) < 10 || !bytes.Equal(p[0:8], artNetID[:]) {
+		return Packet{}, errors.New("not an Art-Net packet")
+	}
+
+	if op := binary.LittleEndian.Uint16(p[8:]); op != artNetOpDmx {
+		// Polls, sync and everything else.
+		return Packet{}, ErrNotDMX
+	}
+
+	if len(p) < artNetHeaderSize {
+		return Packet{}, fmt.Errorf("ArtDmx packet is too short, %d bytes", len(p))
+	}
+
+	length := int(binary.BigEndian.Uint16(p[16:]))
+	if length > UniverseSize || artNetHeaderSize+length > len(p) {
+		return Packet{}, fmt.Errorf("invalid ArtDmx length %d", length)
+	}
+
+	return Packet{
+		Universe: binary.LittleEndian.Uint16(p[14:]) & artNetMaxUniverse,
+		Sequence: p[12],
+		Priority: DefaultPriority,
+		Data:     p[artNetHeaderSize : artNetHeaderSize+length],
+	}, nil
+}
@@ -0,0 +1,135 @@
+// Package dmxnet implements the E1.31 (sACN) and Art-Net protocols, which
+// carry DMX universes over UDP.
+//
+// A DMX universe has up to 512 channels of one byte each. RGB pixels take
+// three channels each, so a universe fits up to 170 pixels.
+package dmxnet
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// UniverseSize is the maximum number of channels in a universe.
+	UniverseSize = 512
+	// PixelsPerUniverse is the number of RGB pixels that fit in a universe.
+	PixelsPerUniverse = UniverseSize / 3
+
+	// E131Port is the UDP port of E1.31.
+	E131Port = 5568
+	// ArtNetPort is the UDP port of Art-Net.
+	ArtNetPort = 6454
+
+	// DefaultPriority is the E1.31 priority of sources that don't have one.
+	DefaultPriority = 100
+	// MaxPriority is the highest E1.31 priority.
+	MaxPriority = 200
+)
+
+// Protocol is a protocol that carries DMX universes.
+type Protocol string
+
+const (
+	E131   Protocol = "e131"
+	ArtNet Protocol = "artnet"
+)
+
+// Port returns the default UDP port of the protocol.
+func (p Protocol) Port() int {
+	switch p {
+	case E131:
+		return E131Port
+	case ArtNet:
+		return ArtNetPort
+	default:
+		return 0
+	}
+}
+
+// UniverseRange returns the lowest and highest universe numbers that the
+// protocol can carry.
+func (p Protocol) UniverseRange() (lo, hi int) {
+	switch p {
+	case E131:
+		return 1, 63999
+	case ArtNet:
+		return 0, 32767
+	default:
+		return 0, -1
+	}
+}
+
+func (p Protocol) MarshalText() ([]byte, error) {
+	return []byte(p), nil
+}
+
+func (p *Protocol) UnmarshalText(text []byte) error {
+	switch Protocol(strings.ToLower(string(text))) {
+	case E131, "sacn":
+		*p = E131
+	case ArtNet, "art-net":
+		*p = ArtNet
+	default:
+		return fmt.Errorf("unknown protocol %q, expected e131 or artnet", text)
+	}
+	return nil
+}
+
+// Packet is a DMX universe sent over the network.
+type Packet struct {
+	// Universe is the universe number.
+	Universe uint16
+	// Sequence increments with each packet of the universe, so that
+	// receivers can drop packets that arrive out of order.
+	Sequence uint8
+	// Priority is the E1.31 priority of the packet. Art-Net packets always
+	// have DefaultPriority.
+	Priority uint8
+	// Source identifies the sender. For E1.31, it is the CID of the source.
+	// For Art-Net, it is left empty and filled in by receivers with the
+	// sender's address.
+	Source string
+	// Name is the name of the source. It is only sent by E1.31.
+	Name string
+	// Terminated is true if the source is stopping to send this universe.
+	// It is only sent by E1.31.
+	Terminated bool
+	// Data is the DMX channels, without the start code.
+	Data []byte
+}
+
+// ErrNotDMX is returned when parsing a packet that is valid but doesn't
+// carry DMX data, such as an Art-Net poll or an E1.31 sync packet. It can be
+// safely ignored.
+var ErrNotDMX = errors.New("packet does not carry DMX data")
+
+// Append appends the packet encoded in the given protocol to b.
+func (p Protocol) Append(b []byte, packet Packet, cid CID) ([]byte, error) {
+	if len(packet.Data) > UniverseSize {
+		return b, fmt.Errorf("%d channels is more than a universe can carry", len(packet.Data))
+	}
+
+	switch p {
+	case E131:
+		return appendE131(b, packet, cid), nil
+	case ArtNet:
+		return appendArtDmx(b, packet), nil
+	default:
+		return b, fmt.Errorf("unknown protocol %q", p)
+	}
+}
+
+// Parse parses a packet in the given protocol. It returns ErrNotDMX for
+// packets that don't carry DMX data.
+func (p Protocol) Parse(b []byte) (Packet, error) {
+	switch p {
+	case E131:
+		return parseE131(b)
+	case ArtNet:
+		return parseArtDmx(b)
+	default:
+		return Packet{}, fmt.Errorf("unknown protocol %q", p)
+	}
+}
@@ -0,0 +1,266 @@
+package dmxnet
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRoundTrip(t *testing.T) {
+	cid := NewCID()
+	data := make([]byte, 510)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	tests := []struct {
+		protocol Protocol
+		packet   Packet
+		want     Packet
+	}{
+		{
+			protocol: E131,
+			packet: Packet{
+				Universe: 7,
+				Sequence: 42,
+				Priority: 150,
+				Name:     "christmasd",
+				Data:     data,
+			},
+			want: Packet{
+				Universe: 7,
+				Sequence: 42,
+				Priority: 150,
+				Source:   cid.String(),
+				Name:     "christmasd",
+				Data:     data,
+			},
+		},
+		{
+			protocol: E131,
+			packet:   Packet{Universe: 1, Priority: 100, Terminated: true},
+			want: Packet{
+				Universe:   1,
+				Priority:   100,
+				Source:     cid.String(),
+				Terminated: true,
+				Data:       []byte{},
+			},
+		},
+		{
+			protocol: ArtNet,
+			packet:   Packet{Universe: 0x1234, Sequence: 3, Data: data[:3]},
+			// Art-Net rounds the length up to an even number.
+			want: Packet{Universe: 0x1234, Sequence: 3, Priority: DefaultPriority, Data: []byte{0, 1, 2, 0}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.protocol), func(t *testing.T) {
+			b, err := test.protocol.Append(nil, test.packet, cid)
+			if err != nil {
+				t.Fatal("cannot encode:", err)
+			}
+
+			got, err := test.protocol.Parse(b)
+			if err != nil {
+				t.Fatal("cannot parse:", err)
+			}
+
+			if diff := cmp.Diff(test.want, got); diff != "" {
+				t.Errorf("unexpected diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	if _, err := E131.Parse([]byte("hello")); err == nil {
+		t.Error("expected an error for a short E1.31 packet")
+	}
+
+	poll := append(artNetID[:], 0x00, 0x20, 0, 14, 0, 0)
+	if _, err := ArtNet.Parse(poll); !errors.Is(err, ErrNotDMX) {
+		t.Errorf("ArtPoll error = %v, want ErrNotDMX", err)
+	}
+
+	b, _ := ArtNet.Append(nil, Packet{Data: []byte{1, 2}}, CID{})
+	if _, err := ArtNet.Parse(b[:len(b)-1]); err == nil {
+		t.Error("expected an error for a truncated ArtDmx packet")
+	}
+}
+
+func TestSender(t *testing.T) {
+	for _, protocol := range []Protocol{E131, ArtNet} {
+		t.Run(string(protocol), func(t *testing.T) {
+			conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+			if err != nil {
+				t.Fatal("cannot listen:", err)
+			}
+			defer conn.Close()
+
+			sender, err := NewSender(SenderOpts{
+				Protocol: protocol,
+				Addr:     conn.LocalAddr().String(),
+				Name:     "test",
+			})
+			if err != nil {
+				t.Fatal("cannot create sender:", err)
+			}
+
+			data := []byte{255, 0, 0, 0, 255, 0}
+			for i := 0; i < 2; i++ {
+				if err := sender.Send(3, data); err != nil {
+					t.Fatal("cannot send:", err)
+				}
+			}
+
+			buf := make([]byte, 1024)
+			for seq := 0; seq < 2; seq++ {
+				conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+				n, _, err := conn.ReadFromUDP(buf)
+				if err != nil {
+					t.Fatal("cannot receive:", err)
+				}
+
+				packet, err := protocol.Parse(buf[:n])
+				if err != nil {
+					t.Fatal("cannot parse:", err)
+				}
+				if packet.Universe != 3 || int(packet.Sequence) != seq || !bytes.Equal(packet.Data, data) {
+					t.Errorf("received universe %d, sequence %d, data %v",
+						packet.Universe, packet.Sequence, packet.Data)
+				}
+			}
+
+			if err := sender.Close(); err != nil {
+				t.Error("cannot close:", err)
+			}
+
+			if protocol == E131 {
+				conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+				n, _, err := conn.ReadFromUDP(buf)
+				if err != nil {
+					t.Fatal("cannot receive the terminated packet:", err)
+				}
+				if packet, err := protocol.Parse(buf[:n]); err != nil || !packet.Terminated {
+					t.Errorf("expected a terminated packet, got %+v, %v", packet, err)
+				}
+			}
+		})
+	}
+}
+
+func TestReceiver(t *testing.T) {
+	receiver, err := Listen(ReceiverOpts{
+		Protocol: ArtNet,
+		Addr:     "127.0.0.1:0",
+	})
+	if err != nil {
+		t.Fatal("cannot listen:", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	packets := make(chan Packet, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- receiver.Serve(ctx, func(p Packet) {
+			p.Data = bytes.Clone(p.Data)
+			packets <- p
+		}, nil)
+	}()
+
+	sender, err := NewSender(SenderOpts{
+		Protocol: ArtNet,
+		Addr:     receiver.Addr().String(),
+	})
+	if err != nil {
+		t.Fatal("cannot create sender:", err)
+	}
+	defer sender.Close()
+
+	if err := sender.Send(9, []byte{1, 2, 3, 4}); err != nil {
+		t.Fatal("cannot send:", err)
+	}
+
+	select {
+	case p := <-packets:
+		if p.Universe != 9 || !bytes.Equal(p.Data, []byte{1, 2, 3, 4}) {
+			t.Errorf("received universe %d, data %v", p.Universe, p.Data)
+		}
+		if p.Source == "" {
+			t.Error("Art-Net packet has no source address")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a packet")
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Serve returned %v, want context.Canceled", err)
+	}
+}
+
+func TestMerger(t *testing.T) {
+	now := time.Now()
+	m := NewMerger(time.Second)
+
+	add := func(source string, seq, priority uint8, data ...byte) bool {
+		return m.Add(Packet{
+			Universe: 1,
+			Sequence: seq,
+			Priority: priority,
+			Source:   source,
+			Data:     data,
+		}, now)
+	}
+	merge := func() ([]byte, uint8, bool) {
+		return m.Merge(1, now, nil)
+	}
+
+	add("a", 1, 100, 10, 200)
+	add("b", 1, 100, 50, 20, 7)
+
+	if data, priority, ok := merge(); !ok || priority != 100 || !bytes.Equal(data, []byte{50, 200, 7}) {
+		t.Errorf("HTP merge = %v, %d, %v", data, priority, ok)
+	}
+
+	if add("a", 1, 100, 0, 0) {
+		t.Error("a duplicate packet was not dropped")
+	}
+
+	add("c", 1, 150, 1)
+	if data, priority, _ := merge(); priority != 150 || !bytes.Equal(data, []byte{1}) {
+		t.Errorf("higher priority merge = %v, %d", data, priority)
+	}
+
+	m.Add(Packet{Universe: 1, Sequence: 2, Source: "c", Terminated: true}, now)
+	if _, priority, _ := merge(); priority != 100 {
+		t.Errorf("priority after the source terminated = %d, want 100", priority)
+	}
+
+	now = now.Add(600 * time.Millisecond)
+	add("a", 2, 100, 1, 1)
+
+	now = now.Add(600 * time.Millisecond)
+	if data, _, _ := merge(); !bytes.Equal(data, []byte{1, 1}) {
+		t.Errorf("merge after b timed out = %v", data)
+	}
+
+	expired := m.Expire(now)
+	if len(expired) != 1 || expired[0].ID != "b" {
+		t.Errorf("expired sources = %+v, want b", expired)
+	}
+
+	now = now.Add(2 * time.Second)
+	if _, _, ok := merge(); ok {
+		t.Error("merge succeeded after all sources timed out")
+	}
+}
@@ -0,0 +1,149 @@
+package dmxnet
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// CID is the component identifier that E1.31 sources identify themselves
+// with. It is a UUID.
+type CID [16]byte
+
+// NewCID returns a random CID.
+func NewCID() CID {
+	var cid CID
+	if _, err := rand.Read(cid[:]); err != nil {
+		panic(err)
+	}
+	cid[6] = cid[6]&0x0f | 0x40 // version 4
+	cid[8] = cid[8]&0x3f | 0x80 // variant 10
+	return cid
+}
+
+func (c CID) String() string {
+	return hex.EncodeToString(c[:])
+}
+
+// E131MulticastAddr returns the multicast address that E1.31 sends the given
+// universe to.
+func E131MulticastAddr(universe uint16) *net.UDPAddr {
+	return &net.UDPAddr{
+		IP:   net.IPv4(239, 255, byte(universe>>8), byte(universe)),
+		Port: E131Port,
+	}
+}
+
+const (
+	e131HeaderSize = 126 // up to and including the start code
+
+	e131VectorRootData    = 0x00000004
+	e131VectorRootExtend  = 0x00000008
+	e131VectorFramingData = 0x00000002
+	e131VectorDMPSetProp  = 0x02
+
+	e131OptionTerminated = 1 << 6
+
+	e131NameSize = 64
+)
+
+var e131PacketID = [12]byte{'A', 'S', 'C', '-', 'E', '1', '.', '1', '7'}
+
+func appendE131(b []byte, packet Packet, cid CID) []byte {
+	size := e131HeaderSize + len(packet.Data)
+	start := len(b)
+	b = append(b, make([]byte, size)...)
+	p := b[start:]
+
+	// Root layer.
+	binary.BigEndian.PutUint16(p[0:], 0x0010) // preamble size
+	binary.BigEndian.PutUint16(p[2:], 0x0000) // postamble size
+	copy(p[4:16], e131PacketID[:])
+	binary.BigEndian.PutUint16(p[16:], 0x7000|uint16(size-16))
+	binary.BigEndian.PutUint32(p[18:], e131VectorRootData)
+	copy(p[22:38], cid[:])
+
+	// Framing layer.
+	binary.BigEndian.PutUint16(p[38:], 0x7000|uint16(size-38))
+	binary.BigEndian.PutUint32(p[40:], e131VectorFramingData)
+	name := packet.Name
+	if len(name) > e131NameSize-1 {
+		name = name[:e131NameSize-1]
+	}
+	copy(p[44:44+e131NameSize], name)
+	p[108] = packet.Priority
+	binary.BigEndian.PutUint16(p[109:], 0) // sync address
+	p[111] = packet.Sequence
+	if packet.Terminated {
+		p[112] = e131OptionTerminated
+	}
+	binary.BigEndian.PutUint16(p[113:], packet.Universe)
+
+	// DMP layer.
+	binary.BigEndian.PutUint16(p[115:], 0x7000|uint16(size-115))
+	p[117] = e131VectorDMPSetProp
+	p[118] = 0xa1                               // address and data type
+	binary.BigEndian.PutUint16(p[119:], 0x0000) // first property address
+	binary.BigEndian.PutUint16(p[121:], 0x0001) // address increment
+	binary.BigEndian.PutUint16(p[123:], uint16(1+len(packet.Data)))
+	p[125] = 0x00 // DMX start code
+	copy(p[126:], packet.Data)
+
+	return b
+}
+
+func parseE131(p []byte) (Packet, error) {
+	if len(p) < 22 || !bytes.Equal(p[4:16], e131PacketID[:]) {
+		return Packet{}, errors.New("not an E1.31 packet")
+	}
+
+	switch vector := binary.BigEndian.Uint32(p[18:]); vector {
+	case e131VectorRootData:
+	case e131VectorRootExtend:
+		return Packet{}, ErrNotDMX
+	default:
+		return Packet{}, fmt.Errorf("unknown E1.31 root vector %#x", vector)
+	}
+
+	if len(p) < e131HeaderSize {
+		return Packet{}, fmt.Errorf("E1.31 data packet is too short, %d bytes", len(p))
+	}
+
+	if vector := binary.BigEndian.Uint32(p[40:]); vector != e131VectorFramingData {
+		return Packet{}, fmt.Errorf("unknown E1.31 framing vector %#x", vector)
+	}
+	if p[117] != e131VectorDMPSetProp {
+		return Packet{}, fmt.Errorf("unknown E1.31 DMP vector %#x", p[117])
+	}
+	if p[125] != 0x00 {
+		// Not dimmer data, e.g. RDM or a per-channel priority packet.
+		return Packet{}, ErrNotDMX
+	}
+
+	count := int(binary.BigEndian.Uint16(p[123:])) - 1
+	if count < 0 || count > UniverseSize || e131HeaderSize+count > len(p) {
+		return Packet{}, fmt.Errorf("invalid E1.31 channel count %d", count)
+	}
+
+	name := p[44 : 44+e131NameSize]
+	if i := bytes.IndexByte(name, 0); i != -1 {
+		name = name[:i]
+	}
+
+	var cid CID
+	copy(cid[:], p[22:38])
+
+	return Packet{
+		Universe:   binary.BigEndian.Uint16(p[113:]),
+		Sequence:   p[111],
+		Priority:   p[108],
+		Source:     cid.String(),
+		Name:       string(name),
+		Terminated: p[112]&e131OptionTerminated != 0,
+		Data:       p[e131HeaderSize : e131HeaderSize+count],
+	}, nil
+}
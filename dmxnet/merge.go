@@ -0,0 +1,179 @@
+package dmxnet
+
+import (
+	"sort"
+	"time"
+)
+
+// DataLossTimeout is how long E1.31 waits for a source to send a universe
+// again before it considers the source gone.
+const DataLossTimeout = 2500 * time.Millisecond
+
+// Merger merges universes sent by several sources. For each universe, the
+// sources with the highest priority win, and if there are several of them,
+// each channel takes the highest value among them (highest takes
+// precedence). Sources that stop sending a universe for longer than the
+// timeout are dropped. A Merger is not safe for concurrent use.
+type Merger struct {
+	timeout   time.Duration
+	universes map[uint16]map[string]*mergeSource
+}
+
+type mergeSource struct {
+	name     string
+	priority uint8
+	sequence uint8
+	data     []byte
+	lastSeen time.Time
+}
+
+// Source is a source that sends a universe.
+type Source struct {
+	ID       string    `json:"id"`
+	Name     string    `json:"name,omitempty"`
+	Universe uint16    `json:"universe"`
+	Priority uint8     `json:"priority"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// NewMerger creates a new Merger. If timeout is zero, DataLossTimeout is
+// used.
+func NewMerger(timeout time.Duration) *Merger {
+	if timeout == 0 {
+		timeout = DataLossTimeout
+	}
+	return &Merger{
+		timeout:   timeout,
+		universes: make(map[uint16]map[string]*mergeSource),
+	}
+}
+
+// Add adds a packet received at the given time. A terminated packet removes
+// its source from the universe right away. It returns false if the packet was
+// dropped because it arrived out of order, or if it terminates a source that
+// isn't sending the universe.
+func (m *Merger) Add(packet Packet, now time.Time) bool {
+	sources := m.universes[packet.Universe]
+
+	src, ok := sources[packet.Source]
+	if ok && packet.Sequence != 0 {
+		// E1.31 drops packets that are up to 20 behind the last one. A
+		// sequence of 0 is always taken, since Art-Net sources that don't
+		// number their packets always send 0.
+		if diff := int8(packet.Sequence - src.sequence); diff <= 0 && diff > -20 {
+			return false
+		}
+	}
+
+	if packet.Terminated {
+		if !ok {
+			return false
+		}
+		delete(sources, packet.Source)
+		if len(sources) == 0 {
+			delete(m.universes, packet.Universe)
+		}
+		return true
+	}
+
+	if !ok {
+		if sources == nil {
+			sources = make(map[string]*mergeSource)
+			m.universes[packet.Universe] = sources
+		}
+		src = &mergeSource{}
+		sources[packet.Source] = src
+	}
+
+	src.name = packet.Name
+	src.priority = packet.Priority
+	src.sequence = packet.Sequence
+	src.data = append(src.data[:0], packet.Data...)
+	src.lastSeen = now
+
+	return true
+}
+
+// Expire drops the sources that timed out by the given time and returns
+// them.
+func (m *Merger) Expire(now time.Time) []Source {
+	var expired []Source
+	for universe, sources := range m.universes {
+		for id, src := range sources {
+			if now.Sub(src.lastSeen) > m.timeout {
+				expired = append(expired, src.info(id, universe))
+				delete(sources, id)
+			}
+		}
+		if len(sources) == 0 {
+			delete(m.universes, universe)
+		}
+	}
+	sortSources(expired)
+	return expired
+}
+
+// Merge merges the universe into buf and returns it along with the priority
+// of the winning sources. It returns false if no source sends the universe.
+// Sources that timed out are ignored even if Expire wasn't called yet.
+func (m *Merger) Merge(universe uint16, now time.Time, buf []byte) ([]byte, uint8, bool) {
+	var priority uint8
+	var found bool
+	for _, src := range m.universes[universe] {
+		if now.Sub(src.lastSeen) <= m.timeout && (!found || src.priority > priority) {
+			priority = src.priority
+			found = true
+		}
+	}
+	if !found {
+		return buf[:0], 0, false
+	}
+
+	buf = buf[:0]
+	for _, src := range m.universes[universe] {
+		if src.priority != priority || now.Sub(src.lastSeen) > m.timeout {
+			continue
+		}
+		for i, v := range src.data {
+			if i < len(buf) {
+				buf[i] = max(buf[i], v)
+			} else {
+				buf = append(buf, v)
+			}
+		}
+	}
+
+	return buf, priority, true
+}
+
+// Sources returns all sources that are sending universes, ordered by
+// universe.
+func (m *Merger) Sources() []Source {
+	var all []Source
+	for universe, sources := range m.universes {
+		for id, src := range sources {
+			all = append(all, src.info(id, universe))
+		}
+	}
+	sortSources(all)
+	return all
+}
+
+func (s *mergeSource) info(id string, universe uint16) Source {
+	return Source{
+		ID:       id,
+		Name:     s.name,
+		Universe: universe,
+		Priority: s.priority,
+		LastSeen: s.lastSeen,
+	}
+}
+
+func sortSources(sources []Source) {
+	sort.Slice(sources, func(i, j int) bool {
+		if sources[i].Universe != sources[j].Universe {
+			return sources[i].Universe < sources[j].Universe
+		}
+		return sources[i].ID < sources[j].ID
+	})
+}
@@ -0,0 +1,145 @@
+package dmxnet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+)
+
+// ReceiverOpts are options for a Receiver.
+type ReceiverOpts struct {
+	// Protocol is the protocol to receive.
+	Protocol Protocol
+	// Addr is the [host]:port to listen on. If it is empty, the protocol's
+	// default port is listened on on all interfaces.
+	Addr string
+	// Universes are the E1.31 universes whose multicast groups are joined.
+	// If empty, only packets sent straight to Addr are received. Multicast
+	// is always listened for on the default E1.31 port, so Addr is ignored.
+	Universes []uint16
+}
+
+// Receiver receives DMX universes over UDP.
+type Receiver struct {
+	opts  ReceiverOpts
+	conns []*net.UDPConn
+}
+
+// Listen starts listening for DMX universes.
+func Listen(opts ReceiverOpts) (*Receiver, error) {
+	if opts.Protocol.Port() == 0 {
+		return nil, fmt.Errorf("unknown protocol %q", opts.Protocol)
+	}
+
+	r := &Receiver{opts: opts}
+
+	if len(opts.Universes) > 0 {
+		if opts.Protocol != E131 {
+			return nil, fmt.Errorf("%s has no multicast groups to join", opts.Protocol)
+		}
+
+		// The standard library can only join one group per socket, so every
+		// universe gets its own. The sockets share the port and may all
+		// receive each packet, which the sequence numbers take care of.
+		for _, universe := range opts.Universes {
+			conn, err := net.ListenMulticastUDP("udp4", nil, E131MulticastAddr(universe))
+			if err != nil {
+				r.Close()
+				return nil, fmt.Errorf("failed to join universe %d: %w", universe, err)
+			}
+			r.conns = append(r.conns, conn)
+		}
+
+		return r, nil
+	}
+
+	addr := opts.Addr
+	if addr == "" {
+		addr = ":" + strconv.Itoa(opts.Protocol.Port())
+	}
+	laddr, err := ResolveAddr(addr, opts.Protocol.Port())
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenUDP("udp", laddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen: %w", err)
+	}
+	r.conns = append(r.conns, conn)
+
+	return r, nil
+}
+
+// Addr returns the address that the receiver listens on.
+func (r *Receiver) Addr() net.Addr {
+	return r.conns[0].LocalAddr()
+}
+
+// Serve receives packets until the context is canceled or the receiver is
+// closed, calling handle for each packet that carries DMX data. handle is
+// never called concurrently, and the packet's Data is only valid until it
+// returns. Packets that cannot be parsed are passed to onError, which may be
+// nil.
+func (r *Receiver) Serve(ctx context.Context, handle func(Packet), onError func(error)) error {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	stop := context.AfterFunc(ctx, func() { r.Close() })
+	defer stop()
+
+	errs := make([]error, len(r.conns))
+	for i, conn := range r.conns {
+		wg.Add(1)
+		go func(i int, conn *net.UDPConn) {
+			defer wg.Done()
+
+			buf := make([]byte, 1500)
+			for {
+				n, from, err := conn.ReadFromUDP(buf)
+				if err != nil {
+					if !errors.Is(err, net.ErrClosed) {
+						errs[i] = err
+					}
+					return
+				}
+
+				packet, err := r.opts.Protocol.Parse(buf[:n])
+				if err != nil {
+					if !errors.Is(err, ErrNotDMX) && onError != nil {
+						onError(fmt.Errorf("invalid packet from %v: %w", from, err))
+					}
+					continue
+				}
+				if packet.Source == "" {
+					packet.Source = from.String()
+				}
+
+				mu.Lock()
+				handle(packet)
+				mu.Unlock()
+			}
+		}(i, conn)
+	}
+
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return errors.Join(errs...)
+}
+
+// Close stops the receiver.
+func (r *Receiver) Close() error {
+	var errs []error
+	for _, conn := range r.conns {
+		if err := conn.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
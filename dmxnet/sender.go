@@ -0,0 +1,151 @@
+package dmxnet
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+)
+
+// SenderOpts are options for a Sender.
+type SenderOpts struct {
+	// Protocol is the protocol to send in.
+	Protocol Protocol
+	// Addr is the host[:port] to send to. If the port is missing, the
+	// protocol's default port is used. If Addr is empty, E1.31 universes are
+	// sent to their multicast addresses. Art-Net needs an address.
+	Addr string
+	// Name is the source name sent with E1.31 packets.
+	Name string
+	// CID identifies the source in E1.31 packets. A random CID is used if it
+	// is zero.
+	CID CID
+	// Priority is the E1.31 priority of the packets. DefaultPriority is used
+	// if it is zero.
+	Priority uint8
+}
+
+// Sender sends DMX universes over UDP. It is safe for concurrent use.
+type Sender struct {
+	opts SenderOpts
+	conn *net.UDPConn
+	addr *net.UDPAddr // nil to use the multicast address
+
+	mu   sync.Mutex
+	seqs map[uint16]uint8
+	buf  []byte
+}
+
+// NewSender creates a new Sender.
+func NewSender(opts SenderOpts) (*Sender, error) {
+	if opts.Protocol.Port() == 0 {
+		return nil, fmt.Errorf("unknown protocol %q", opts.Protocol)
+	}
+	if opts.CID == (CID{}) {
+		opts.CID = NewCID()
+	}
+	if opts.Priority == 0 {
+		opts.Priority = DefaultPriority
+	}
+	if opts.Priority > MaxPriority {
+		return nil, fmt.Errorf("priority %d is higher than %d", opts.Priority, MaxPriority)
+	}
+
+	var addr *net.UDPAddr
+	switch {
+	case opts.Addr != "":
+		var err error
+		addr, err = ResolveAddr(opts.Addr, opts.Protocol.Port())
+		if err != nil {
+			return nil, err
+		}
+	case opts.Protocol != E131:
+		return nil, fmt.Errorf("%s needs an address to send to", opts.Protocol)
+	}
+
+	conn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open UDP socket: %w", err)
+	}
+
+	return &Sender{
+		opts: opts,
+		conn: conn,
+		addr: addr,
+		seqs: make(map[uint16]uint8),
+	}, nil
+}
+
+// ResolveAddr resolves a host[:port] UDP address, using defaultPort if the
+// port is missing.
+func ResolveAddr(hostport string, defaultPort int) (*net.UDPAddr, error) {
+	if _, _, err := net.SplitHostPort(hostport); err != nil {
+		hostport = net.JoinHostPort(hostport, strconv.Itoa(defaultPort))
+	}
+
+	addr, err := net.ResolveUDPAddr("udp", hostport)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %q: %w", hostport, err)
+	}
+	return addr, nil
+}
+
+// Send sends the channels of a universe.
+func (s *Sender) Send(universe uint16, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.send(Packet{
+		Universe: universe,
+		Data:     data,
+	})
+}
+
+func (s *Sender) send(packet Packet) error {
+	packet.Sequence = s.seqs[packet.Universe]
+	packet.Priority = s.opts.Priority
+	packet.Name = s.opts.Name
+
+	var err error
+	s.buf, err = s.opts.Protocol.Append(s.buf[:0], packet, s.opts.CID)
+	if err != nil {
+		return err
+	}
+
+	addr := s.addr
+	if addr == nil {
+		addr = E131MulticastAddr(packet.Universe)
+	}
+
+	if _, err := s.conn.WriteToUDP(s.buf, addr); err != nil {
+		return fmt.Errorf("failed to send universe %d: %w", packet.Universe, err)
+	}
+
+	s.seqs[packet.Universe]++
+	return nil
+}
+
+// Close closes the sender. For E1.31, receivers are told that the universes
+// are no longer being sent, so that they don't have to wait for them to time
+// out.
+func (s *Sender) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var errs []error
+	if s.opts.Protocol == E131 {
+		for universe := range s.seqs {
+			// E1.31 asks for the terminated packet to be sent three times.
+			for i := 0; i < 3; i++ {
+				if err := s.send(Packet{Universe: universe, Terminated: true}); err != nil {
+					errs = append(errs, err)
+					break
+				}
+			}
+		}
+	}
+
+	errs = append(errs, s.conn.Close())
+	return errors.Join(errs...)
+}
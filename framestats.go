@@ -0,0 +1,56 @@
+package christmasd
+
+import (
+	"time"
+
+	"dev.acmcsuf.com/christmasd/christmaspb"
+)
+
+// FrameStats are statistics about how frames are written out to the LEDs.
+type FrameStats struct {
+	// TargetFrameRate is the frame rate that frames are written out at when
+	// there are enough of them.
+	TargetFrameRate float64 `json:"target_frame_rate"`
+	// FrameRate is the actual frame rate over the last few seconds.
+	FrameRate float64 `json:"frame_rate"`
+	// Frames is the total number of frames written out.
+	Frames uint64 `json:"frames"`
+	// Coalesced is the total number of frames that were replaced by a newer
+	// frame before they could be written out.
+	Coalesced uint64 `json:"coalesced"`
+	// LatencyMean and LatencyMax are the mean and maximum time from a frame
+	// being queued to it being written out, over the recent frames.
+	LatencyMean time.Duration `json:"latency_mean"`
+	LatencyMax  time.Duration `json:"latency_max"`
+	// JitterMean and JitterMax are the mean and maximum deviation of the time
+	// between frames from the target frame interval, over the recent frames.
+	JitterMean time.Duration `json:"jitter_mean"`
+	JitterMax  time.Duration `json:"jitter_max"`
+}
+
+func (s FrameStats) proto() *christmaspb.GetFrameStatsResponse {
+	return &christmaspb.GetFrameStatsResponse{
+		Available:       true,
+		TargetFrameRate: s.TargetFrameRate,
+		FrameRate:       s.FrameRate,
+		Frames:          s.Frames,
+		Coalesced:       s.Coalesced,
+		LatencyMeanUs:   s.LatencyMean.Microseconds(),
+		LatencyMaxUs:    s.LatencyMax.Microseconds(),
+		JitterMeanUs:    s.JitterMean.Microseconds(),
+		JitterMaxUs:     s.JitterMax.Microseconds(),
+	}
+}
+
+func frameStatsFromProto(pb *christmaspb.GetFrameStatsResponse) FrameStats {
+	return FrameStats{
+		TargetFrameRate: pb.GetTargetFrameRate(),
+		FrameRate:       pb.GetFrameRate(),
+		Frames:          pb.GetFrames(),
+		Coalesced:       pb.GetCoalesced(),
+		LatencyMean:     time.Duration(pb.GetLatencyMeanUs()) * time.Microsecond,
+		LatencyMax:      time.Duration(pb.GetLatencyMaxUs()) * time.Microsecond,
+		JitterMean:      time.Duration(pb.GetJitterMeanUs()) * time.Microsecond,
+		JitterMax:       time.Duration(pb.GetJitterMaxUs()) * time.Microsecond,
+	}
+}
@@ -0,0 +1,166 @@
+package christmasd
+
+import (
+	"time"
+
+	"dev.acmcsuf.com/christmasd/christmaspb"
+	"google.golang.org/protobuf/proto"
+)
+
+// ServerHooks are callbacks that a server and its sessions call to report
+// what they are doing, which is useful for instrumentation such as metrics.
+// Any nil hook is skipped. Hooks are called from the sessions' goroutines, so
+// they must be safe for concurrent use and must return quickly.
+type ServerHooks struct {
+	// SessionStarted is called when a session starts.
+	SessionStarted func(s *Session)
+	// SessionEnded is called when a session ends. err is why the session
+	// ended, or nil if the client closed it.
+	SessionEnded func(s *Session, err error)
+	// MessageReceived is called for every message received from a client.
+	// kind is the name of the message's field, e.g. "set_leds", and size is
+	// its encoded size in bytes.
+	MessageReceived func(s *Session, kind string, size int)
+	// MessageSent is called for every message sent to a client. kind is
+	// "error" for error messages.
+	MessageSent func(s *Session, kind string, size int)
+	// FrameRejected is called when a frame from a client is not shown.
+	FrameRejected func(s *Session, reason FrameRejectReason)
+	// Error is called when a session runs into an error.
+	Error func(s *Session, cause ErrorCause, err error)
+}
+
+// JoinServerHooks returns hooks that call each of the given hooks in order.
+func JoinServerHooks(hooks ...ServerHooks) ServerHooks {
+	return ServerHooks{
+		SessionStarted: func(s *Session) {
+			for i := range hooks {
+				hooks[i].sessionStarted(s)
+			}
+		},
+		SessionEnded: func(s *Session, err error) {
+			for i := range hooks {
+				hooks[i].sessionEnded(s, err)
+			}
+		},
+		MessageReceived: func(s *Session, kind string, size int) {
+			for i := range hooks {
+				hooks[i].messageReceived(s, kind, size)
+			}
+		},
+		MessageSent: func(s *Session, kind string, size int) {
+			for i := range hooks {
+				hooks[i].messageSent(s, kind, size)
+			}
+		},
+		FrameRejected: func(s *Session, reason FrameRejectReason) {
+			for i := range hooks {
+				hooks[i].frameRejected(s, reason)
+			}
+		},
+		Error: func(s *Session, cause ErrorCause, err error) {
+			for i := range hooks {
+				hooks[i].error(s, cause, err)
+			}
+		},
+	}
+}
+
+// FrameRejectReason is why a frame from a client was not shown.
+type FrameRejectReason string
+
+const (
+	// FrameInvalidSize means that the frame had the wrong number of LEDs or
+	// the wrong image size. The session is ended.
+	FrameInvalidSize FrameRejectReason = "invalid_size"
+	// FrameStaleSize means that the frame had the size of the canvas from
+	// before it changed, so it was dropped.
+	FrameStaleSize FrameRejectReason = "stale_size"
+	// FrameViewOnly means that the frame came from a view-only session. The
+	// session is ended.
+	FrameViewOnly FrameRejectReason = "view_only"
+)
+
+// ErrorCause is where an error in a session came from.
+type ErrorCause string
+
+const (
+	// ErrorRead is an error reading from the websocket.
+	ErrorRead ErrorCause = "read"
+	// ErrorWrite is an error writing to the websocket.
+	ErrorWrite ErrorCause = "write"
+	// ErrorDecode is an invalid message from the client.
+	ErrorDecode ErrorCause = "decode"
+	// ErrorProtocol is a valid message that the client was not allowed to
+	// send, such as a frame of the wrong size.
+	ErrorProtocol ErrorCause = "protocol"
+	// ErrorController is an error returned by the LEDController.
+	ErrorController ErrorCause = "controller"
+)
+
+// LEDControllerHooks are callbacks that an LEDController implementation calls
+// to report what it is doing. They are not used by this package, but they
+// give controllers and instrumentation a common interface. Any nil hook is
+// skipped.
+type LEDControllerHooks struct {
+	// Flushed is called after the LEDs are written out, with how long the
+	// write took and its error, if any.
+	Flushed func(took time.Duration, err error)
+	// Rendered is called after DrawImage renders an image onto the LEDs,
+	// with how long the render took and its error, if any.
+	Rendered func(took time.Duration, err error)
+	// FrameLatency is called after a frame is written out, with how long it
+	// waited from being queued to being written out.
+	FrameLatency func(latency time.Duration)
+}
+
+func (h *ServerHooks) sessionStarted(s *Session) {
+	if h.SessionStarted != nil {
+		h.SessionStarted(s)
+	}
+}
+
+func (h *ServerHooks) sessionEnded(s *Session, err error) {
+	if h.SessionEnded != nil {
+		h.SessionEnded(s, err)
+	}
+}
+
+func (h *ServerHooks) messageReceived(s *Session, kind string, size int) {
+	if h.MessageReceived != nil {
+		h.MessageReceived(s, kind, size)
+	}
+}
+
+func (h *ServerHooks) messageSent(s *Session, kind string, size int) {
+	if h.MessageSent != nil {
+		h.MessageSent(s, kind, size)
+	}
+}
+
+func (h *ServerHooks) frameRejected(s *Session, reason FrameRejectReason) {
+	if h.FrameRejected != nil {
+		h.FrameRejected(s, reason)
+	}
+}
+
+func (h *ServerHooks) error(s *Session, cause ErrorCause, err error) {
+	if h.Error != nil {
+		h.Error(s, cause, err)
+	}
+}
+
+// messageKind returns the name of the field that is set in the message's
+// oneof.
+func messageKind(msg proto.Message) string {
+	m := msg.ProtoReflect()
+	if oneofs := m.Descriptor().Oneofs(); oneofs.Len() > 0 {
+		if field := m.WhichOneof(oneofs.Get(0)); field != nil {
+			return string(field.Name())
+		}
+	}
+	if msg, ok := msg.(*christmaspb.LEDServerMessage); ok && msg.Error != nil {
+		return "error"
+	}
+	return "unknown"
+}
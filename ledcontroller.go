@@ -2,6 +2,7 @@ package christmasd
 
 import (
 	"image"
+	"time"
 
 	"dev.acmcsuf.com/christmas/lib/leddraw"
 )
@@ -17,3 +18,42 @@ type LEDController interface {
 	// DrawImage draws an image to the LED strip.
 	DrawImage(img *image.RGBA) error
 }
+
+// SessionLEDController is an LEDController that can give each session its own
+// view of itself. This allows the controller to know which session a frame
+// came from.
+type SessionLEDController interface {
+	LEDController
+	// ForSession returns the LEDController to be used by the given session.
+	ForSession(s *Session) LEDController
+}
+
+// TimedLEDController is an LEDController that can be told when a frame was
+// shown. A Tee uses it to pass sinks the time that it forwarded each frame,
+// since a sink may only get to the frame later.
+type TimedLEDController interface {
+	LEDController
+	// SetLEDsAt sets the LED strip to a frame that was shown at the given
+	// time.
+	SetLEDsAt(strip leddraw.LEDStrip, shown time.Time) error
+}
+
+// ControllerForSession returns the LEDController that the given session
+// should use. If ctrl implements SessionLEDController, then its ForSession
+// method is used. Otherwise, ctrl is returned as-is.
+func ControllerForSession(ctrl LEDController, s *Session) LEDController {
+	if sctrl, ok := ctrl.(SessionLEDController); ok {
+		return sctrl.ForSession(s)
+	}
+	return ctrl
+}
+
+// SetLEDsAt sets the LED strip of ctrl to a frame that was shown at the given
+// time. If ctrl implements TimedLEDController, then its SetLEDsAt method is
+// used. Otherwise, the time is dropped.
+func SetLEDsAt(ctrl LEDController, strip leddraw.LEDStrip, shown time.Time) error {
+	if tctrl, ok := ctrl.(TimedLEDController); ok {
+		return tctrl.SetLEDsAt(strip, shown)
+	}
+	return ctrl.SetLEDs(strip)
+}
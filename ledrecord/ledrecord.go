@@ -0,0 +1,187 @@
+// Package ledrecord implements recording LED frames to a compact file format.
+//
+// A recording is a gzip stream that starts with a magic header followed by
+// frames. Each frame is encoded as:
+//
+//	uvarint   timestamp, in microseconds since the Unix epoch
+//	uvarint   length of the session ID
+//	[]byte    session ID, empty if unknown
+//	uvarint   number of LEDs
+//	[]byte    3 bytes per LED, in R, G, B order
+//
+// Consecutive frames are usually very similar, so gzip compresses them well.
+package ledrecord
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"dev.acmcsuf.com/christmas/lib/leddraw"
+	"dev.acmcsuf.com/christmas/lib/xcolor"
+)
+
+// magic is the header of every recording, including its version.
+const magic = "XMASREC\x01"
+
+// FileExtension is the conventional file extension for recordings.
+const FileExtension = ".ledrec"
+
+// maxLEDs is the maximum number of LEDs that a frame can have. It guards
+// against allocating a huge buffer when reading a corrupted file.
+const maxLEDs = 1 << 16
+
+// maxSessionLen is the maximum length of a session ID.
+const maxSessionLen = 256
+
+// Frame is a single recorded LED frame.
+type Frame struct {
+	// Time is the time that the frame was shown.
+	Time time.Time
+	// Session is the ID of the session that produced the frame. It is empty
+	// if the frame did not come from a session.
+	Session string
+	// LEDs is the LED strip.
+	LEDs leddraw.LEDStrip
+}
+
+// Writer writes frames into a recording.
+type Writer struct {
+	gz  *gzip.Writer
+	buf []byte
+}
+
+// NewWriter creates a new Writer that writes into w. The caller must call
+// Close to finish the recording.
+func NewWriter(w io.Writer) (*Writer, error) {
+	gz := gzip.NewWriter(w)
+	if _, err := io.WriteString(gz, magic); err != nil {
+		return nil, fmt.Errorf("failed to write header: %w", err)
+	}
+	return &Writer{gz: gz}, nil
+}
+
+// WriteFrame writes a single frame. The frame is flushed to the underlying
+// writer before WriteFrame returns, so an interrupted recording only loses the
+// frame that was being written.
+func (w *Writer) WriteFrame(frame Frame) error {
+	if len(frame.LEDs) > maxLEDs {
+		return fmt.Errorf("too many LEDs: %d", len(frame.LEDs))
+	}
+	if len(frame.Session) > maxSessionLen {
+		return fmt.Errorf("session ID too long: %d bytes", len(frame.Session))
+	}
+
+	buf := w.buf[:0]
+	buf = binary.AppendUvarint(buf, uint64(frame.Time.UnixMicro()))
+	buf = binary.AppendUvarint(buf, uint64(len(frame.Session)))
+	buf = append(buf, frame.Session...)
+	buf = binary.AppendUvarint(buf, uint64(len(frame.LEDs)))
+	for _, led := range frame.LEDs {
+		buf = append(buf, led.R, led.G, led.B)
+	}
+	w.buf = buf
+
+	if _, err := w.gz.Write(buf); err != nil {
+		return err
+	}
+	return w.gz.Flush()
+}
+
+// Close finishes the recording. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	return w.gz.Close()
+}
+
+// Reader reads frames from a recording.
+type Reader struct {
+	r   *bufio.Reader
+	buf []byte
+}
+
+// NewReader creates a new Reader that reads from r.
+func NewReader(r io.Reader) (*Reader, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a recording: %w", err)
+	}
+
+	br := bufio.NewReader(gz)
+
+	header := make([]byte, len(magic))
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	if string(header) != magic {
+		return nil, errors.New("not a recording: invalid header")
+	}
+
+	return &Reader{r: br}, nil
+}
+
+// ReadFrame reads the next frame. It returns io.EOF if there are no more
+// frames. The returned frame's LEDs are freshly allocated.
+func (r *Reader) ReadFrame() (Frame, error) {
+	var frame Frame
+
+	t, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		// A clean EOF is only possible at a frame boundary.
+		return frame, err
+	}
+	frame.Time = time.UnixMicro(int64(t))
+
+	sessionLen, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return frame, unexpectedEOF(err)
+	}
+	if sessionLen > maxSessionLen {
+		return frame, fmt.Errorf("session ID too long: %d bytes", sessionLen)
+	}
+	if err := r.read(int(sessionLen)); err != nil {
+		return frame, err
+	}
+	frame.Session = string(r.buf)
+
+	numLEDs, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return frame, unexpectedEOF(err)
+	}
+	if numLEDs > maxLEDs {
+		return frame, fmt.Errorf("too many LEDs: %d", numLEDs)
+	}
+	if err := r.read(int(numLEDs) * 3); err != nil {
+		return frame, err
+	}
+
+	frame.LEDs = make(leddraw.LEDStrip, numLEDs)
+	for i := range frame.LEDs {
+		frame.LEDs[i] = xcolor.RGB{
+			R: r.buf[i*3+0],
+			G: r.buf[i*3+1],
+			B: r.buf[i*3+2],
+		}
+	}
+
+	return frame, nil
+}
+
+func (r *Reader) read(n int) error {
+	if cap(r.buf) < n {
+		r.buf = make([]byte, n)
+	}
+	r.buf = r.buf[:n]
+	_, err := io.ReadFull(r.r, r.buf)
+	return unexpectedEOF(err)
+}
+
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,89 @@
+package ledrecord
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"dev.acmcsuf.com/christmas/lib/leddraw"
+	"dev.acmcsuf.com/christmas/lib/xcolor"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRoundTrip(t *testing.T) {
+	start := time.UnixMicro(time.Now().UnixMicro())
+	frames := []Frame{
+		{
+			Time:    start,
+			Session: "0000-1111",
+			LEDs:    leddraw.LEDStrip{{R: 255}, {G: 255}, {B: 255}},
+		},
+		{
+			Time: start.Add(50 * time.Millisecond),
+			LEDs: leddraw.LEDStrip{{R: 1, G: 2, B: 3}, {}, {R: 4, G: 5, B: 6}},
+		},
+		{
+			Time:    start.Add(time.Second),
+			Session: "2222-3333",
+			LEDs:    leddraw.LEDStrip{},
+		},
+	}
+
+	var buf bytes.Buffer
+
+	w, err := NewWriter(&buf)
+	if err != nil {
+		t.Fatal("cannot create writer:", err)
+	}
+	for _, frame := range frames {
+		if err := w.WriteFrame(frame); err != nil {
+			t.Fatal("cannot write frame:", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal("cannot close writer:", err)
+	}
+
+	r, err := NewReader(&buf)
+	if err != nil {
+		t.Fatal("cannot create reader:", err)
+	}
+
+	var got []Frame
+	for {
+		frame, err := r.ReadFrame()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			t.Fatal("cannot read frame:", err)
+		}
+		got = append(got, frame)
+	}
+
+	if diff := cmp.Diff(frames, got, cmp.Comparer(func(a, b xcolor.RGB) bool {
+		return a == b
+	})); diff != "" {
+		t.Errorf("unexpected frames (-want +got):\n%s", diff)
+	}
+}
+
+func TestReaderInvalidHeader(t *testing.T) {
+	var buf bytes.Buffer
+
+	w, err := NewWriter(&buf)
+	if err != nil {
+		t.Fatal("cannot create writer:", err)
+	}
+	w.Close()
+
+	b := buf.Bytes()
+	if _, err := NewReader(bytes.NewReader(b[:len(b)/2])); err == nil {
+		t.Error("expected error reading truncated header")
+	}
+	if _, err := NewReader(bytes.NewReader([]byte("hello"))); err == nil {
+		t.Error("expected error reading non-recording")
+	}
+}
@@ -0,0 +1,182 @@
+package ledrecord
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"dev.acmcsuf.com/christmas/lib/leddraw"
+	"dev.acmcsuf.com/christmasd"
+)
+
+// minLoopPass is the shortest time that a pass through a looped recording
+// takes, which is one frame at christmasd's default frame rate. Without it, a
+// recording that takes no time to play, such as one with a single frame, would
+// be looped as fast as the controller takes frames.
+const minLoopPass = 50 * time.Millisecond
+
+var errLoopNoFrames = errors.New("cannot loop a recording without frames")
+
+// PlayOpts are options for playing a recording.
+type PlayOpts struct {
+	// Speed is the playback speed multiplier. A zero value means 1, i.e.
+	// real-time playback.
+	Speed float64
+	// Seek is the position in the recording to start playing from, relative
+	// to the first frame. The last frame before this position is shown
+	// immediately.
+	Seek time.Duration
+	// Loop plays the recording from the seek position again every time it
+	// ends, until the context is canceled. Looping a recording without any
+	// frames is an error.
+	Loop bool
+}
+
+// Play plays the recording in r onto ctrl. Frames are paced according to
+// their recorded timestamps. Play returns when the recording ends, or when
+// the context is canceled. A recording that was cut short, for example
+// because the daemon crashed while recording, is played up to where it ends.
+func Play(ctx context.Context, r io.ReadSeeker, ctrl christmasd.LEDController, opts PlayOpts) error {
+	if opts.Speed == 0 {
+		opts.Speed = 1
+	}
+	if opts.Speed < 0 {
+		return fmt.Errorf("invalid speed %v", opts.Speed)
+	}
+
+	p := player{
+		ctrl:  ctrl,
+		opts:  opts,
+		strip: make(leddraw.LEDStrip, len(ctrl.LEDs())),
+		timer: time.NewTimer(time.Hour),
+	}
+	p.timer.Stop()
+
+	for {
+		passStart := time.Now()
+
+		shown, err := p.play(ctx, r)
+		if err != nil {
+			return err
+		}
+
+		if !opts.Loop {
+			return nil
+		}
+
+		if shown == 0 {
+			return errLoopNoFrames
+		}
+		if err := p.waitUntil(ctx, passStart.Add(minLoopPass)); err != nil {
+			return err
+		}
+
+		if _, err := r.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to rewind recording: %w", err)
+		}
+	}
+}
+
+type player struct {
+	ctrl  christmasd.LEDController
+	opts  PlayOpts
+	strip leddraw.LEDStrip
+	timer *time.Timer
+}
+
+// play plays the recording once and returns the number of frames shown.
+func (p *player) play(ctx context.Context, r io.Reader) (int, error) {
+	rec, err := NewReader(r)
+	if err != nil {
+		return 0, err
+	}
+
+	var shown int
+
+	var (
+		first   time.Time // time of the first frame in the recording
+		start   time.Time // wall time that the seek position is played at
+		pending *Frame    // last frame before the seek position
+	)
+
+	for {
+		frame, err := rec.ReadFrame()
+		if err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				break
+			}
+			return shown, fmt.Errorf("failed to read frame: %w", err)
+		}
+
+		if first.IsZero() {
+			first = frame.Time
+		}
+
+		pos := frame.Time.Sub(first)
+		if pos < p.opts.Seek {
+			pending = &frame
+			continue
+		}
+
+		if start.IsZero() {
+			start = time.Now()
+			if pending != nil {
+				if err := p.show(*pending); err != nil {
+					return shown, err
+				}
+				shown++
+				pending = nil
+			}
+		}
+
+		at := start.Add(time.Duration(float64(pos-p.opts.Seek) / p.opts.Speed))
+		if err := p.waitUntil(ctx, at); err != nil {
+			return shown, err
+		}
+
+		if err := p.show(frame); err != nil {
+			return shown, err
+		}
+		shown++
+	}
+
+	if pending != nil {
+		// The seek position is past the end of the recording, so just show
+		// the last frame.
+		if err := p.show(*pending); err != nil {
+			return shown, err
+		}
+		shown++
+	}
+
+	return shown, nil
+}
+
+func (p *player) waitUntil(ctx context.Context, t time.Time) error {
+	d := time.Until(t)
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	p.timer.Reset(d)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-p.timer.C:
+		return nil
+	}
+}
+
+func (p *player) show(frame Frame) error {
+	// Fit the frame into the controller's strip in case the recording was
+	// made on a strip of a different length.
+	n := copy(p.strip, frame.LEDs)
+	clear(p.strip[n:])
+
+	if err := p.ctrl.SetLEDs(p.strip); err != nil {
+		return fmt.Errorf("failed to set LEDs: %w", err)
+	}
+	return nil
+}
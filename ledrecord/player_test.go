@@ -0,0 +1,160 @@
+package ledrecord
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"dev.acmcsuf.com/christmas/lib/leddraw"
+	"dev.acmcsuf.com/christmas/lib/xcolor"
+	"dev.acmcsuf.com/christmasd/christmasdtest"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPlay(t *testing.T) {
+	rec := writeRecording(t,
+		leddraw.LEDStrip{{R: 1}, {R: 2}, {R: 3}},
+		leddraw.LEDStrip{{G: 1}},
+		leddraw.LEDStrip{{B: 1}, {B: 2}},
+	)
+
+	ctrl := christmasdtest.NewLEDController(2, 1, 1)
+	if err := Play(context.Background(), rec, ctrl, PlayOpts{Speed: 10}); err != nil {
+		t.Fatal("cannot play:", err)
+	}
+
+	// Frames are fitted to the controller's strip.
+	assertPlayed(t, ctrl,
+		leddraw.LEDStrip{{R: 1}, {R: 2}},
+		leddraw.LEDStrip{{G: 1}, {}},
+		leddraw.LEDStrip{{B: 1}, {B: 2}},
+	)
+}
+
+func TestPlaySeek(t *testing.T) {
+	rec := writeRecording(t,
+		leddraw.LEDStrip{{R: 1}},
+		leddraw.LEDStrip{{R: 2}},
+		leddraw.LEDStrip{{R: 3}},
+	)
+
+	ctrl := christmasdtest.NewLEDController(1, 1, 1)
+	err := Play(context.Background(), rec, ctrl, PlayOpts{Seek: 15 * time.Millisecond})
+	if err != nil {
+		t.Fatal("cannot play:", err)
+	}
+
+	assertPlayed(t, ctrl,
+		leddraw.LEDStrip{{R: 2}},
+		leddraw.LEDStrip{{R: 3}},
+	)
+
+	ctrl.Reset()
+	rec.Seek(0, io.SeekStart)
+
+	err = Play(context.Background(), rec, ctrl, PlayOpts{Seek: time.Hour})
+	if err != nil {
+		t.Fatal("cannot play past the end:", err)
+	}
+
+	assertPlayed(t, ctrl, leddraw.LEDStrip{{R: 3}})
+}
+
+func TestPlayLoop(t *testing.T) {
+	tests := []struct {
+		name   string
+		frames []leddraw.LEDStrip
+		opts   PlayOpts
+	}{
+		{
+			name:   "single frame",
+			frames: []leddraw.LEDStrip{{{R: 1}}},
+			opts:   PlayOpts{Loop: true},
+		},
+		{
+			name:   "seek past the end",
+			frames: []leddraw.LEDStrip{{{R: 1}}, {{R: 2}}},
+			opts:   PlayOpts{Loop: true, Seek: time.Hour},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*minLoopPass)
+			defer cancel()
+
+			ctrl := christmasdtest.NewLEDController(1, 1, 1)
+			err := Play(ctx, writeRecording(t, test.frames...), ctrl, test.opts)
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("expected the loop to run until the deadline, got %v", err)
+			}
+
+			// Every pass takes at least minLoopPass, so there is one frame
+			// per pass and at most one pass more than fits.
+			if calls := ctrl.Calls(); len(calls) == 0 || len(calls) > 6 {
+				t.Errorf("expected 1 to 6 frames, got %d", len(calls))
+			}
+		})
+	}
+}
+
+func TestPlayLoopEmpty(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ctrl := christmasdtest.NewLEDController(1, 1, 1)
+	if err := Play(ctx, writeRecording(t), ctrl, PlayOpts{Loop: true}); err == nil {
+		t.Fatal("expected an error looping an empty recording")
+	}
+
+	if err := Play(ctx, writeRecording(t), ctrl, PlayOpts{}); err != nil {
+		t.Fatal("cannot play an empty recording once:", err)
+	}
+}
+
+// writeRecording writes a recording with a frame every 10ms.
+func writeRecording(t *testing.T, frames ...leddraw.LEDStrip) *bytes.Reader {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	w, err := NewWriter(&buf)
+	if err != nil {
+		t.Fatal("cannot create writer:", err)
+	}
+
+	start := time.Now()
+	for i, leds := range frames {
+		err := w.WriteFrame(Frame{
+			Time: start.Add(time.Duration(i) * 10 * time.Millisecond),
+			LEDs: leds,
+		})
+		if err != nil {
+			t.Fatal("cannot write frame:", err)
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal("cannot close writer:", err)
+	}
+
+	return bytes.NewReader(buf.Bytes())
+}
+
+func assertPlayed(t *testing.T, ctrl *christmasdtest.LEDController, want ...leddraw.LEDStrip) {
+	t.Helper()
+
+	var got []leddraw.LEDStrip
+	for _, call := range ctrl.Calls() {
+		got = append(got, call.LEDs)
+	}
+
+	if diff := cmp.Diff(want, got, cmp.Comparer(func(a, b xcolor.RGB) bool {
+		return a == b
+	})); diff != "" {
+		t.Errorf("unexpected frames (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,203 @@
+package ledrecord
+
+import (
+	"errors"
+	"image"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+
+	"dev.acmcsuf.com/christmas/lib/leddraw"
+	"dev.acmcsuf.com/christmasd"
+)
+
+// ErrNotRecording is returned by Recorder.Stop when the recorder is not
+// recording.
+var ErrNotRecording = errors.New("not recording")
+
+// ErrAlreadyRecording is returned by Recorder.Start when the recorder is
+// already recording.
+var ErrAlreadyRecording = errors.New("already recording")
+
+// Recorder is a christmasd.LEDController that records the frames that are set
+// on it. It is meant to be a christmasd.TeeSink of the controller that shows
+// the frames, so that it records exactly what is shown and writing the
+// recording never holds up the LEDs. Recording can be started and stopped at
+// any time.
+type Recorder struct {
+	source christmasd.LEDController
+	logger *slog.Logger
+
+	mu     sync.Mutex
+	w      *Writer
+	dst    io.WriteCloser
+	frames int
+}
+
+var (
+	_ christmasd.LEDController        = (*Recorder)(nil)
+	_ christmasd.SessionLEDController = (*Recorder)(nil)
+	_ christmasd.TimedLEDController   = (*Recorder)(nil)
+)
+
+// errDrawImage is returned by DrawImage, since the recorder has nothing to
+// render images with.
+var errDrawImage = errors.New("ledrecord: Recorder only records LED strips")
+
+// NewRecorder creates a new Recorder for frames shown on source. The recorder
+// has the number of LEDs and the image size of source, but it never writes to
+// it. The recorder does not record anything until Start is called.
+func NewRecorder(source christmasd.LEDController, logger *slog.Logger) *Recorder {
+	return &Recorder{
+		source: source,
+		logger: logger,
+	}
+}
+
+// Start starts recording into dst. The recorder takes ownership of dst and
+// closes it when recording stops.
+func (r *Recorder) Start(dst io.WriteCloser) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.w != nil {
+		return ErrAlreadyRecording
+	}
+
+	w, err := NewWriter(dst)
+	if err != nil {
+		return err
+	}
+
+	r.w = w
+	r.dst = dst
+	r.frames = 0
+	return nil
+}
+
+// Stop stops recording and closes the destination. It returns the number of
+// frames that were recorded.
+func (r *Recorder) Stop() (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.w == nil {
+		return 0, ErrNotRecording
+	}
+
+	return r.frames, r.stop()
+}
+
+func (r *Recorder) stop() error {
+	err1 := r.w.Close()
+	err2 := r.dst.Close()
+	r.w = nil
+	r.dst = nil
+	return errors.Join(err1, err2)
+}
+
+// Recording returns true if the recorder is currently recording.
+func (r *Recorder) Recording() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.w != nil
+}
+
+// Frames returns the number of frames recorded since recording started. It
+// returns 0 if the recorder is not recording.
+func (r *Recorder) Frames() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.w == nil {
+		return 0
+	}
+	return r.frames
+}
+
+// LEDs implements christmasd.LEDController. It returns the LEDs of the
+// source.
+func (r *Recorder) LEDs() leddraw.LEDStrip {
+	return r.source.LEDs()
+}
+
+// SetLEDs implements christmasd.LEDController. The frame is recorded without
+// a session, as shown now.
+func (r *Recorder) SetLEDs(strip leddraw.LEDStrip) error {
+	return r.SetLEDsAt(strip, time.Now())
+}
+
+// SetLEDsAt implements christmasd.TimedLEDController. The frame is recorded
+// without a session, as shown at the given time.
+func (r *Recorder) SetLEDsAt(strip leddraw.LEDStrip, shown time.Time) error {
+	r.record("", strip, shown)
+	return nil
+}
+
+// ImageSize implements christmasd.LEDController. It returns the image size of
+// the source.
+func (r *Recorder) ImageSize() (w, h int) {
+	return r.source.ImageSize()
+}
+
+// DrawImage implements christmasd.LEDController. It always fails, since only
+// LED strips can be recorded.
+func (r *Recorder) DrawImage(img *image.RGBA) error {
+	return errDrawImage
+}
+
+// ForSession implements christmasd.SessionLEDController. Frames set on the
+// returned controller are recorded with the session's ID.
+func (r *Recorder) ForSession(s *christmasd.Session) christmasd.LEDController {
+	return &sessionRecorder{
+		Recorder: r,
+		session:  s.ID(),
+	}
+}
+
+type sessionRecorder struct {
+	*Recorder
+	session string
+}
+
+func (r *sessionRecorder) SetLEDs(strip leddraw.LEDStrip) error {
+	return r.SetLEDsAt(strip, time.Now())
+}
+
+func (r *sessionRecorder) SetLEDsAt(strip leddraw.LEDStrip, shown time.Time) error {
+	r.record(r.session, strip, shown)
+	return nil
+}
+
+func (r *Recorder) record(session string, strip leddraw.LEDStrip, shown time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.w == nil {
+		return
+	}
+
+	err := r.w.WriteFrame(Frame{
+		Time:    shown,
+		Session: session,
+		LEDs:    strip,
+	})
+	if err != nil {
+		// Don't fail the sink because of a recording error. Just stop
+		// recording instead.
+		r.logger.Error(
+			"failed to record frame, stopping recording",
+			"error", err)
+
+		if err := r.stop(); err != nil {
+			r.logger.Warn(
+				"failed to stop recording",
+				"error", err)
+		}
+		return
+	}
+
+	r.frames++
+}
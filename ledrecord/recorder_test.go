@@ -0,0 +1,226 @@
+package ledrecord
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"dev.acmcsuf.com/christmas/lib/leddraw"
+	"dev.acmcsuf.com/christmas/lib/xcolor"
+	"dev.acmcsuf.com/christmasd"
+	"dev.acmcsuf.com/christmasd/christmasdtest"
+	"github.com/google/go-cmp/cmp"
+	"github.com/neilotoole/slogt"
+)
+
+func TestRecorder(t *testing.T) {
+	source := christmasdtest.NewLEDController(3, 4, 4)
+	rec := NewRecorder(source, slogt.New(t))
+	session := christmasdtest.NewSession(t, christmasd.ServerOpts{LEDController: source})
+
+	if err := rec.SetLEDs(leddraw.LEDStrip{{R: 9}, {}, {}}); err != nil {
+		t.Fatal("cannot set LEDs before recording:", err)
+	}
+
+	var dst closeBuffer
+	if err := rec.Start(&dst); err != nil {
+		t.Fatal("cannot start recording:", err)
+	}
+	if err := rec.Start(&closeBuffer{}); !errors.Is(err, ErrAlreadyRecording) {
+		t.Errorf("expected ErrAlreadyRecording, got %v", err)
+	}
+
+	want := []Frame{
+		{LEDs: leddraw.LEDStrip{{R: 1}, {G: 2}, {B: 3}}},
+		{Session: session.ID(), LEDs: leddraw.LEDStrip{{R: 4}, {G: 5}, {B: 6}}},
+	}
+	if err := rec.SetLEDs(want[0].LEDs); err != nil {
+		t.Fatal("cannot set LEDs:", err)
+	}
+	if err := christmasd.ControllerForSession(rec, session).SetLEDs(want[1].LEDs); err != nil {
+		t.Fatal("cannot set LEDs for session:", err)
+	}
+
+	if frames := rec.Frames(); frames != 2 {
+		t.Errorf("expected 2 frames so far, got %d", frames)
+	}
+
+	frames, err := rec.Stop()
+	if err != nil {
+		t.Fatal("cannot stop recording:", err)
+	}
+	if frames != 2 {
+		t.Errorf("expected 2 recorded frames, got %d", frames)
+	}
+	if !dst.closed {
+		t.Error("recording was not closed")
+	}
+	if _, err := rec.Stop(); !errors.Is(err, ErrNotRecording) {
+		t.Errorf("expected ErrNotRecording, got %v", err)
+	}
+
+	assertFrames(t, readFrames(t, &dst.Buffer), want)
+
+	if calls := source.Calls(); len(calls) != 0 {
+		t.Errorf("recorder wrote to its source: %v", calls)
+	}
+}
+
+func TestRecorderTeeSink(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	primary := christmasdtest.NewLEDController(2, 4, 4)
+	rec := NewRecorder(primary, slogt.New(t))
+
+	tee := christmasd.NewTee(primary, slogt.New(t), christmasd.TeeSink{
+		Name:       "recorder",
+		Controller: rec,
+		Buffer:     8,
+		DropPolicy: christmasd.DropNewest,
+	})
+	go tee.Start(ctx)
+
+	var dst closeBuffer
+	if err := rec.Start(&dst); err != nil {
+		t.Fatal("cannot start recording:", err)
+	}
+
+	session := christmasdtest.NewSession(t, christmasd.ServerOpts{LEDController: tee})
+	want := []Frame{
+		{LEDs: leddraw.LEDStrip{{R: 1}, {G: 1}}},
+		{Session: session.ID(), LEDs: leddraw.LEDStrip{{R: 2}, {G: 2}}},
+	}
+	if err := tee.SetLEDs(want[0].LEDs); err != nil {
+		t.Fatal("cannot set LEDs:", err)
+	}
+	if err := christmasd.ControllerForSession(tee, session).SetLEDs(want[1].LEDs); err != nil {
+		t.Fatal("cannot set LEDs for session:", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for rec.Frames() < len(want) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for frames, got %d", rec.Frames())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := rec.Stop(); err != nil {
+		t.Fatal("cannot stop recording:", err)
+	}
+
+	assertFrames(t, readFrames(t, &dst.Buffer), want)
+}
+
+func TestRecorderFrameTime(t *testing.T) {
+	rec := NewRecorder(christmasdtest.NewLEDController(1, 1, 1), slogt.New(t))
+
+	var dst closeBuffer
+	if err := rec.Start(&dst); err != nil {
+		t.Fatal("cannot start recording:", err)
+	}
+
+	// Frames are recorded at the time that they were shown, not at the time
+	// that the recorder got to them.
+	shown := time.Now().Add(-3 * time.Second).Round(time.Millisecond)
+	if err := rec.SetLEDsAt(leddraw.LEDStrip{{R: 1}}, shown); err != nil {
+		t.Fatal("cannot set LEDs:", err)
+	}
+	if _, err := rec.Stop(); err != nil {
+		t.Fatal("cannot stop recording:", err)
+	}
+
+	frames := readFrames(t, &dst.Buffer)
+	if len(frames) != 1 || !frames[0].Time.Equal(shown) {
+		t.Errorf("recorded frames %+v, want one shown at %v", frames, shown)
+	}
+}
+
+func TestRecorderWriteError(t *testing.T) {
+	rec := NewRecorder(christmasdtest.NewLEDController(1, 1, 1), slogt.New(t))
+
+	if err := rec.Start(&failingWriter{}); err != nil {
+		t.Fatal("cannot start recording:", err)
+	}
+
+	if err := rec.SetLEDs(leddraw.LEDStrip{{R: 1}}); err != nil {
+		t.Error("recording error was returned to the caller:", err)
+	}
+	if rec.Recording() {
+		t.Error("recorder is still recording after a write error")
+	}
+}
+
+func TestRecorderDrawImage(t *testing.T) {
+	rec := NewRecorder(christmasdtest.NewLEDController(1, 1, 1), slogt.New(t))
+	if err := rec.DrawImage(nil); err == nil {
+		t.Error("expected DrawImage to fail")
+	}
+}
+
+func readFrames(t *testing.T, r io.Reader) []Frame {
+	t.Helper()
+
+	rr, err := NewReader(r)
+	if err != nil {
+		t.Fatal("cannot create reader:", err)
+	}
+
+	var frames []Frame
+	for {
+		frame, err := rr.ReadFrame()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return frames
+			}
+			t.Fatal("cannot read frame:", err)
+		}
+		frames = append(frames, frame)
+	}
+}
+
+// assertFrames compares frames without their times, which depend on when the
+// frames were recorded.
+func assertFrames(t *testing.T, got, want []Frame) {
+	t.Helper()
+
+	for i := range got {
+		got[i].Time = time.Time{}
+	}
+	if diff := cmp.Diff(want, got, cmp.Comparer(func(a, b xcolor.RGB) bool {
+		return a == b
+	})); diff != "" {
+		t.Errorf("unexpected frames (-want +got):\n%s", diff)
+	}
+}
+
+type closeBuffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *closeBuffer) Close() error {
+	b.closed = true
+	return nil
+}
+
+// failingWriter takes the gzip header, then fails every write after it.
+type failingWriter struct {
+	writes int
+}
+
+func (w *failingWriter) Write(b []byte) (int, error) {
+	w.writes++
+	if w.writes > 1 {
+		return 0, errors.New("disk full")
+	}
+	return len(b), nil
+}
+
+func (w *failingWriter) Close() error {
+	return nil
+}
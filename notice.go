@@ -0,0 +1,91 @@
+package christmasd
+
+import (
+	"fmt"
+	"time"
+
+	"dev.acmcsuf.com/christmasd/christmaspb"
+)
+
+// NoticeKind is what a Notice is about.
+type NoticeKind int
+
+const (
+	// NoticeInfo is a general message, e.g. from an admin.
+	NoticeInfo NoticeKind = iota
+	// NoticeKicked tells the client why it was kicked. It is sent by
+	// Server.KickSessions right before the connection is closed.
+	NoticeKicked
+	// NoticeTimeLimit warns that the session is closed at the deadline.
+	NoticeTimeLimit
+	// NoticeMaintenance warns that the server goes down for maintenance, at
+	// the deadline if there is one.
+	NoticeMaintenance
+	// NoticeQueue tells the client its new place in the queue for the LEDs.
+	NoticeQueue
+)
+
+var noticeKindNames = []string{
+	NoticeInfo:        "info",
+	NoticeKicked:      "kicked",
+	NoticeTimeLimit:   "time_limit",
+	NoticeMaintenance: "maintenance",
+	NoticeQueue:       "queue",
+}
+
+// ParseNoticeKind parses the name of a notice kind, as returned by
+// NoticeKind.String.
+func ParseNoticeKind(s string) (NoticeKind, error) {
+	for k, name := range noticeKindNames {
+		if name == s {
+			return NoticeKind(k), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown notice kind %q", s)
+}
+
+// String returns the name of the kind, e.g. "maintenance".
+func (k NoticeKind) String() string {
+	if k >= 0 && int(k) < len(noticeKindNames) {
+		return noticeKindNames[k]
+	}
+	return fmt.Sprintf("NoticeKind(%d)", int(k))
+}
+
+// Notice is a message for the user of a client, which the server sends on its
+// own rather than in response to a request.
+type Notice struct {
+	Kind NoticeKind
+	// Message is the human-readable message, e.g. the reason for a kick.
+	Message string
+	// Deadline is when the notice takes effect, e.g. when a time limit is up.
+	// It is zero if there is none.
+	Deadline time.Time
+	// QueuePosition is the client's position in the queue for NoticeQueue,
+	// 1 being next.
+	QueuePosition int
+}
+
+func (n Notice) proto() *christmaspb.NoticeEvent {
+	pb := &christmaspb.NoticeEvent{
+		Kind:          christmaspb.NoticeKind(n.Kind),
+		Message:       n.Message,
+		QueuePosition: uint32(n.QueuePosition),
+	}
+	if !n.Deadline.IsZero() {
+		pb.DeadlineUnixMs = n.Deadline.UnixMilli()
+	}
+	return pb
+}
+
+func noticeFromProto(pb *christmaspb.NoticeEvent) Notice {
+	n := Notice{
+		Kind:          NoticeKind(pb.GetKind()),
+		Message:       pb.GetMessage(),
+		QueuePosition: int(pb.GetQueuePosition()),
+	}
+	if ms := pb.GetDeadlineUnixMs(); ms != 0 {
+		n.Deadline = time.UnixMilli(ms)
+	}
+	return n
+}
@@ -0,0 +1,263 @@
+package christmasd
+
+import (
+	"context"
+	"image"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"dev.acmcsuf.com/christmas/lib/leddraw"
+)
+
+// TeeDropPolicy decides which frame is dropped when a sink's buffer is full.
+type TeeDropPolicy int
+
+const (
+	// DropOldest drops the oldest buffered frame to make room for the new
+	// one. This keeps the sink as close to live as possible.
+	DropOldest TeeDropPolicy = iota
+	// DropNewest drops the new frame, keeping the buffered ones. This keeps
+	// the sink's frames contiguous at the cost of lagging behind.
+	DropNewest
+)
+
+// TeeSink describes a sink that a Tee forwards frames to.
+type TeeSink struct {
+	// Name is the name of the sink. It is used in logs and stats.
+	Name string
+	// Controller is the LEDController that frames are forwarded to. Only its
+	// LEDs and SetLEDs methods are used. If it is a SessionLEDController,
+	// frames from a session are forwarded to its view of the session. If it
+	// is a TimedLEDController, frames are forwarded with SetLEDsAt and the
+	// time that the Tee got them.
+	Controller LEDController
+	// Buffer is the number of frames that can be queued for the sink before
+	// frames are dropped. A zero value means 1.
+	Buffer int
+	// DropPolicy decides which frame is dropped when the buffer is full.
+	DropPolicy TeeDropPolicy
+}
+
+// TeeSinkStats contains statistics about a single sink.
+type TeeSinkStats struct {
+	Name    string `json:"name"`
+	Sent    uint64 `json:"sent"`
+	Dropped uint64 `json:"dropped"`
+	Errors  uint64 `json:"errors"`
+}
+
+// Tee is an LEDController that forwards frames to a primary LEDController and
+// to any number of sinks. The primary controller is written to synchronously.
+// Each sink is written to from its own goroutine through its own buffer, so a
+// slow or stalled sink never delays the primary controller.
+//
+// Sinks receive the resulting LED strip of each frame. Images drawn using
+// DrawImage are rendered by the primary controller, and its LEDs are then
+// forwarded to the sinks. The primary controller's LEDs method must return a
+// copy if it can be drawn to concurrently, since it is read without any lock.
+type Tee struct {
+	primary LEDController
+	sinks   []*teeSink
+	session *Session // nil unless returned by ForSession
+}
+
+var (
+	_ LEDController        = (*Tee)(nil)
+	_ SessionLEDController = (*Tee)(nil)
+)
+
+type teeSink struct {
+	TeeSink
+	frames chan teeFrame
+	logger *slog.Logger
+
+	sent    atomic.Uint64
+	dropped atomic.Uint64
+	errors  atomic.Uint64
+}
+
+// teeFrame is a frame queued for a sink.
+type teeFrame struct {
+	leds    leddraw.LEDStrip
+	session *Session
+	shown   time.Time
+}
+
+// NewTee creates a new Tee. Start must be called for the sinks to receive
+// any frames.
+func NewTee(primary LEDController, logger *slog.Logger, sinks ...TeeSink) *Tee {
+	t := &Tee{
+		primary: primary,
+		sinks:   make([]*teeSink, len(sinks)),
+	}
+
+	for i, sink := range sinks {
+		if sink.Buffer < 1 {
+			sink.Buffer = 1
+		}
+		t.sinks[i] = &teeSink{
+			TeeSink: sink,
+			frames:  make(chan teeFrame, sink.Buffer),
+			logger:  logger.With("sink", sink.Name),
+		}
+	}
+
+	return t
+}
+
+// Start forwards frames to the sinks until the context is canceled.
+func (t *Tee) Start(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, sink := range t.sinks {
+		wg.Add(1)
+		go func(sink *teeSink) {
+			defer wg.Done()
+			sink.start(ctx)
+		}(sink)
+	}
+	wg.Wait()
+}
+
+// Stats returns statistics for each sink.
+func (t *Tee) Stats() []TeeSinkStats {
+	stats := make([]TeeSinkStats, len(t.sinks))
+	for i, sink := range t.sinks {
+		stats[i] = TeeSinkStats{
+			Name:    sink.Name,
+			Sent:    sink.sent.Load(),
+			Dropped: sink.dropped.Load(),
+			Errors:  sink.errors.Load(),
+		}
+	}
+	return stats
+}
+
+// LEDs implements LEDController. It returns the primary controller's LEDs.
+func (t *Tee) LEDs() leddraw.LEDStrip {
+	return t.primary.LEDs()
+}
+
+// SetLEDs implements LEDController.
+func (t *Tee) SetLEDs(strip leddraw.LEDStrip) error {
+	if err := t.primary.SetLEDs(strip); err != nil {
+		return err
+	}
+	t.forward(strip)
+	return nil
+}
+
+// ImageSize implements LEDController. It returns the primary controller's
+// image size.
+func (t *Tee) ImageSize() (w, h int) {
+	return t.primary.ImageSize()
+}
+
+// DrawImage implements LEDController.
+func (t *Tee) DrawImage(img *image.RGBA) error {
+	if err := t.primary.DrawImage(img); err != nil {
+		return err
+	}
+	t.forward(t.primary.LEDs())
+	return nil
+}
+
+// ForSession implements SessionLEDController. The returned controller
+// forwards to the primary controller's view of the session and shares the
+// sinks of t, which are told which session its frames came from.
+func (t *Tee) ForSession(s *Session) LEDController {
+	return &Tee{
+		primary: ControllerForSession(t.primary, s),
+		sinks:   t.sinks,
+		session: s,
+	}
+}
+
+func (t *Tee) forward(strip leddraw.LEDStrip) {
+	if len(t.sinks) == 0 {
+		return
+	}
+
+	// Sinks only read the frame, so they can all share the same copy. The
+	// time is taken now, since a sink may only get to the frame much later.
+	frame := teeFrame{
+		leds:    make(leddraw.LEDStrip, len(strip)),
+		session: t.session,
+		shown:   time.Now(),
+	}
+	copy(frame.leds, strip)
+
+	for _, sink := range t.sinks {
+		sink.queue(frame)
+	}
+}
+
+func (s *teeSink) queue(frame teeFrame) {
+	for {
+		select {
+		case s.frames <- frame:
+			return
+		default:
+		}
+
+		if s.DropPolicy == DropNewest {
+			s.dropped.Add(1)
+			return
+		}
+
+		// Make room by dropping the oldest frame, then try again. The sink
+		// might have taken the frame in the meantime, which is fine too.
+		select {
+		case <-s.frames:
+			s.dropped.Add(1)
+		default:
+		}
+	}
+}
+
+func (s *teeSink) start(ctx context.Context) {
+	var strip leddraw.LEDStrip
+	var failing bool
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case frame := <-s.frames:
+			// Fit the frame into the sink's strip, since the sink might have a
+			// different number of LEDs than the primary controller.
+			if n := len(s.Controller.LEDs()); len(strip) != n {
+				strip = make(leddraw.LEDStrip, n)
+			}
+			n := copy(strip, frame.leds)
+			clear(strip[n:])
+
+			ctrl := s.Controller
+			if frame.session != nil {
+				ctrl = ControllerForSession(ctrl, frame.session)
+			}
+
+			if err := SetLEDsAt(ctrl, strip, frame.shown); err != nil {
+				s.errors.Add(1)
+				// Only log the first error of a streak to not flood the
+				// logs when a sink is down.
+				if !failing {
+					s.logger.Warn(
+						"failed to forward frame to sink",
+						"error", err)
+					failing = true
+				}
+				continue
+			}
+
+			if failing {
+				s.logger.Info(
+					"sink recovered")
+				failing = false
+			}
+
+			s.sent.Add(1)
+		}
+	}
+}
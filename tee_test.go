@@ -0,0 +1,260 @@
+package christmasd_test
+
+import (
+	"context"
+	"image"
+	"sync"
+	"testing"
+	"time"
+
+	"dev.acmcsuf.com/christmas/lib/leddraw"
+	"dev.acmcsuf.com/christmasd"
+	"dev.acmcsuf.com/christmasd/christmasdtest"
+	"github.com/neilotoole/slogt"
+)
+
+func TestTee(t *testing.T) {
+	primary := christmasdtest.NewLEDController(2, 2, 1)
+	primary.Render = func(img *image.RGBA, leds leddraw.LEDStrip) {
+		leds[0].R = img.Pix[0]
+		leds[1].R = img.Pix[4]
+	}
+
+	same := christmasdtest.NewLEDController(2, 2, 1)
+	longer := christmasdtest.NewLEDController(3, 2, 1)
+
+	tee := christmasd.NewTee(primary, slogt.New(t),
+		christmasd.TeeSink{Name: "same", Controller: same},
+		christmasd.TeeSink{Name: "longer", Controller: longer},
+	)
+	startTee(t, tee)
+
+	if err := tee.SetLEDs(leddraw.LEDStrip{{G: 1}, {G: 2}}); err != nil {
+		t.Fatal("cannot set LEDs:", err)
+	}
+	waitCalls(t, same, 1)
+	waitCalls(t, longer, 1)
+
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.Pix[0] = 3
+	img.Pix[4] = 4
+	if err := tee.DrawImage(img); err != nil {
+		t.Fatal("cannot draw image:", err)
+	}
+
+	// Sinks get the LEDs that the primary controller rendered, fitted to
+	// their own strips.
+	assertEq(t, []leddraw.LEDStrip{
+		{{G: 1}, {G: 2}},
+		{{R: 3, G: 1}, {R: 4, G: 2}},
+	}, callLEDs(waitCalls(t, same, 2)))
+	assertEq(t, []leddraw.LEDStrip{
+		{{G: 1}, {G: 2}, {}},
+		{{R: 3, G: 1}, {R: 4, G: 2}, {}},
+	}, callLEDs(waitCalls(t, longer, 2)))
+
+	assertEq(t, 2, len(primary.Calls()))
+}
+
+func TestTeeDropPolicy(t *testing.T) {
+	frames := []leddraw.LEDStrip{{{R: 1}}, {{R: 2}}, {{R: 3}}, {{R: 4}}, {{R: 5}}}
+
+	tests := []struct {
+		name   string
+		policy christmasd.TeeDropPolicy
+		want   []leddraw.LEDStrip
+	}{
+		{
+			name:   "drop oldest",
+			policy: christmasd.DropOldest,
+			want:   []leddraw.LEDStrip{frames[0], frames[3], frames[4]},
+		},
+		{
+			name:   "drop newest",
+			policy: christmasd.DropNewest,
+			want:   []leddraw.LEDStrip{frames[0], frames[1], frames[2]},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sink := newBlockingSink(1)
+
+			tee := christmasd.NewTee(christmasdtest.NewLEDController(1, 1, 1), slogt.New(t),
+				christmasd.TeeSink{
+					Name:       "sink",
+					Controller: sink,
+					Buffer:     2,
+					DropPolicy: test.policy,
+				},
+			)
+			startTee(t, tee)
+			t.Cleanup(sink.unblock)
+
+			// Wait for the sink to be stuck on the first frame, so that the
+			// rest of the frames go into its buffer.
+			tee.SetLEDs(frames[0])
+			sink.waitEntered(t)
+
+			for _, frame := range frames[1:] {
+				tee.SetLEDs(frame)
+			}
+			assertEq(t, uint64(2), tee.Stats()[0].Dropped)
+
+			sink.unblock()
+			assertEq(t, test.want, callLEDs(waitCalls(t, sink.LEDController, len(test.want))))
+		})
+	}
+}
+
+func TestTeeBlockedSink(t *testing.T) {
+	primary := christmasdtest.NewLEDController(1, 1, 1)
+	blocked := newBlockingSink(1)
+	live := christmasdtest.NewLEDController(1, 1, 1)
+
+	tee := christmasd.NewTee(primary, slogt.New(t),
+		christmasd.TeeSink{Name: "blocked", Controller: blocked},
+		christmasd.TeeSink{Name: "live", Controller: live, Buffer: 200},
+	)
+	startTee(t, tee)
+	t.Cleanup(blocked.unblock)
+
+	tee.SetLEDs(leddraw.LEDStrip{{R: 1}})
+	blocked.waitEntered(t)
+
+	// The blocked sink must not hold up the primary controller or the other
+	// sinks.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			tee.SetLEDs(leddraw.LEDStrip{{G: uint8(i)}})
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("primary controller was held up by a blocked sink")
+	}
+
+	assertEq(t, 101, len(primary.Calls()))
+	waitCalls(t, live, 101)
+
+	stats := tee.Stats()
+	assertEq(t, "blocked", stats[0].Name)
+	assertEq(t, uint64(0), stats[0].Sent)
+	assertEq(t, uint64(99), stats[0].Dropped)
+}
+
+func TestTeeFrameTime(t *testing.T) {
+	sink := &timedSink{blockingSink: newBlockingSink(1)}
+
+	tee := christmasd.NewTee(christmasdtest.NewLEDController(1, 1, 1), slogt.New(t),
+		christmasd.TeeSink{Name: "sink", Controller: sink},
+	)
+	startTee(t, tee)
+	t.Cleanup(sink.unblock)
+
+	before := time.Now()
+	tee.SetLEDs(leddraw.LEDStrip{{R: 1}})
+	after := time.Now()
+
+	// The sink gets to the frame late, but with the time that it was shown.
+	sink.waitEntered(t)
+	time.Sleep(10 * time.Millisecond)
+	sink.unblock()
+	waitCalls(t, sink.LEDController, 1)
+
+	if shown := sink.shown(); shown.Before(before) || shown.After(after) {
+		t.Errorf("frame shown at %v, want between %v and %v", shown, before, after)
+	}
+}
+
+// timedSink is a blockingSink that keeps the time of the last frame.
+type timedSink struct {
+	*blockingSink
+	mu   sync.Mutex
+	last time.Time
+}
+
+func (s *timedSink) SetLEDsAt(strip leddraw.LEDStrip, shown time.Time) error {
+	if err := s.blockingSink.SetLEDs(strip); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.last = shown
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *timedSink) shown() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.last
+}
+
+// blockingSink is a sink whose SetLEDs blocks until unblock is called.
+type blockingSink struct {
+	*christmasdtest.LEDController
+	entered chan struct{}
+	release chan struct{}
+}
+
+func newBlockingSink(numLEDs int) *blockingSink {
+	return &blockingSink{
+		LEDController: christmasdtest.NewLEDController(numLEDs, 1, 1),
+		entered:       make(chan struct{}, 1),
+		release:       make(chan struct{}),
+	}
+}
+
+func (s *blockingSink) SetLEDs(strip leddraw.LEDStrip) error {
+	select {
+	case s.entered <- struct{}{}:
+	default:
+	}
+	<-s.release
+	return s.LEDController.SetLEDs(strip)
+}
+
+func (s *blockingSink) waitEntered(t *testing.T) {
+	t.Helper()
+
+	select {
+	case <-s.entered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("sink never got a frame")
+	}
+}
+
+func (s *blockingSink) unblock() {
+	select {
+	case <-s.release:
+	default:
+		close(s.release)
+	}
+}
+
+func startTee(t *testing.T, tee *christmasd.Tee) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		tee.Start(ctx)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func callLEDs(calls []christmasdtest.Call) []leddraw.LEDStrip {
+	leds := make([]leddraw.LEDStrip, len(calls))
+	for i, call := range calls {
+		leds[i] = call.LEDs
+	}
+	return leds
+}
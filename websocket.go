@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"strings"
 	"time"
 
 	"dev.acmcsuf.com/christmasd/christmaspb"
@@ -25,43 +26,81 @@ func (f closeFrame) encode() []byte {
 	return ws.NewCloseFrameBody(f.Code, f.Reason)
 }
 
+// maxCloseReason is the longest reason that fits in a close frame, whose body
+// is limited to 125 bytes including the 2-byte status code.
+const maxCloseReason = 123
+
+// truncateCloseReason shortens reason to fit in a close frame without cutting
+// a character in half.
+func truncateCloseReason(reason string) string {
+	if len(reason) <= maxCloseReason {
+		return reason
+	}
+	return strings.ToValidUTF8(reason[:maxCloseReason], "")
+}
+
+// outgoingMessage is a message to send to the client. If close is not nil, the
+// connection is closed with it after the message is sent.
+type outgoingMessage struct {
+	msg   *christmaspb.LEDServerMessage
+	close *closeFrame
+}
+
 type websocketServer struct {
 	// Messages is a channel of messages received from the client.
 	Messages chan *christmaspb.LEDClientMessage
 	// Sending is a channel of messages to send to the client.
-	Sending chan *christmaspb.LEDServerMessage
+	Sending chan outgoingMessage
 
-	wsconn io.ReadWriteCloser
-	logger *slog.Logger
+	wsconn  io.ReadWriteCloser
+	logger  *slog.Logger
+	session *Session
+	hooks   *ServerHooks
 }
 
-func newWebsocketServer(wsconn io.ReadWriteCloser, logger *slog.Logger) *websocketServer {
+func newWebsocketServer(wsconn io.ReadWriteCloser, logger *slog.Logger, session *Session, hooks *ServerHooks) *websocketServer {
 	return &websocketServer{
 		Messages: make(chan *christmaspb.LEDClientMessage),
-		Sending:  make(chan *christmaspb.LEDServerMessage),
+		Sending:  make(chan outgoingMessage),
 
-		wsconn: wsconn,
-		logger: logger,
+		wsconn:  wsconn,
+		logger:  logger,
+		session: session,
+		hooks:   hooks,
 	}
 }
 
 // Send sends a message to the client.
 func (s *websocketServer) Send(ctx context.Context, msg *christmaspb.LEDServerMessage) error {
+	return s.send(ctx, outgoingMessage{msg: msg})
+}
+
+// SendAndClose sends a message to the client, then closes the connection with
+// the given close frame.
+func (s *websocketServer) SendAndClose(ctx context.Context, msg *christmaspb.LEDServerMessage, frame closeFrame) error {
+	return s.send(ctx, outgoingMessage{msg: msg, close: &frame})
+}
+
+func (s *websocketServer) send(ctx context.Context, out outgoingMessage) error {
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
-	case s.Sending <- msg:
+	case s.Sending <- out:
 		return nil
 	}
 }
 
-// SendError sends an error message to the client. It is a convenience
-// wrapper around Send. The server will automatically close the connection
-// after sending the error.
+// SendError sends an error message to the client, then closes the
+// connection. It is a convenience wrapper around SendAndClose.
 func (s *websocketServer) SendError(ctx context.Context, err error) error {
-	return s.Send(ctx, &christmaspb.LEDServerMessage{
-		Error: proto.String(err.Error()),
-	})
+	return s.SendAndClose(ctx,
+		&christmaspb.LEDServerMessage{
+			Error: proto.String(err.Error()),
+		},
+		closeFrame{
+			Code:   ws.StatusNormalClosure,
+			Reason: "error delivered to client",
+		})
 }
 
 func (s *websocketServer) Start(ctx context.Context) error {
@@ -113,16 +152,21 @@ func (s *websocketServer) Start(ctx context.Context) error {
 					"failed to read from websocket",
 					"error", err.Error())
 
-				return fmt.Errorf("failed to read from websocket: %w", err)
+				err = fmt.Errorf("failed to read from websocket: %w", err)
+				s.hooks.error(s.session, ErrorRead, err)
+				return err
 			}
 
 			var msg christmaspb.LEDClientMessage
 			if err := proto.Unmarshal(buf.Bytes(), &msg); err != nil {
 				err = fmt.Errorf("failed to unmarshal message: %w", err)
+				s.hooks.error(s.session, ErrorDecode, err)
 				err = s.SendError(ctx, err)
 				return err
 			}
 
+			s.hooks.messageReceived(s.session, messageKind(&msg), buf.Len())
+
 			// s.logger.DebugContext(ctx,
 			// 	"received message from client",
 			// 	"message", msg.String())
@@ -146,7 +190,8 @@ func (s *websocketServer) Start(ctx context.Context) error {
 			case <-ctx.Done():
 				return ctx.Err()
 
-			case msg := <-s.Sending:
+			case out := <-s.Sending:
+				msg := out.msg
 				buf = buf[:0]
 
 				buf, err = marshaler.MarshalAppend(buf, msg)
@@ -159,16 +204,17 @@ func (s *websocketServer) Start(ctx context.Context) error {
 					"message", msg.String())
 
 				if err := wsutil.WriteServerBinary(s.wsconn, buf); err != nil {
-					return fmt.Errorf("failed to write to websocket: %w", err)
+					err = fmt.Errorf("failed to write to websocket: %w", err)
+					s.hooks.error(s.session, ErrorWrite, err)
+					return err
 				}
 
-				// If we've just delivered an error, then shut down the
-				// connection.
-				if msg.Error != nil {
-					closeFrame := closeFrame{
-						Code:   ws.StatusNormalClosure,
-						Reason: "error delivered to client",
-					}
+				s.hooks.messageSent(s.session, messageKind(msg), len(buf))
+
+				// If the message was the last one, e.g. an error, then shut
+				// down the connection.
+				if out.close != nil {
+					closeFrame := *out.close
 
 					s.logger.DebugContext(ctx,
 						"sending close frame to client",